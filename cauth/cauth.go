@@ -17,15 +17,16 @@ import (
 	"io"
 	"io/ioutil"
 	"math/big"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
 	log "github.com/inconshreveable/log15"
+	"github.com/joonnna/ifrit/keys"
 )
 
 var (
@@ -36,10 +37,27 @@ var (
 	errInvalidBootNodes = errors.New("Number of boot nodes needs to be greater than zero.")
 	errInvalidNumRings  = errors.New("Number of rings needs to be greater than zero.")
 	errPortNotSet       = errors.New("Port number is not set")
+	errNoGroups         = errors.New("CA has no groups.")
+	errGroupExists      = errors.New("CA already has a group, only one is supported.")
+	errManyGroups       = errors.New("Found several group certificates, only one is supported.")
+	errUnknownId        = errors.New("No certificate issued for the given id.")
+	errNilSerial        = errors.New("Serial number was nil.")
+	errKeyType          = errors.New("CA private key is not an rsa key.")
+
+	errRenewalIssuer     = errors.New("Renewed certificate was not issued by this CA.")
+	errRenewalExpired    = errors.New("Renewed certificate has expired.")
+	errRenewalRevoked    = errors.New("Renewed certificate has been revoked.")
+	errRenewalSuperseded = errors.New("Renewed certificate has been superseded by a more recent one.")
+	errRenewalSignature  = errors.New("Renewal request is not signed by the key of the renewed certificate.")
 
 	RingNumberOid asn1.ObjectIdentifier = []int{2, 5, 13, 37}
 )
 
+const (
+	// How long a revocation list is valid after being issued.
+	revocationValidity = time.Hour * 24
+)
+
 type Ca struct {
 	privKey *rsa.PrivateKey
 	pubKey  crypto.PublicKey
@@ -47,6 +65,9 @@ type Ca struct {
 	path        string
 	keyFilePath string
 
+	// Encrypts the stored private key if set.
+	passphrase []byte
+
 	groups []*group
 
 	addr       string
@@ -58,8 +79,20 @@ type group struct {
 	knownCertsMutex sync.RWMutex
 
 	existingIds map[string]bool
+	issued      map[string]*big.Int
 	idMutex     sync.RWMutex
 
+	revoked         []x509.RevocationListEntry
+	revokedSerials  map[string]bool
+	revocationNum   int64
+	revocationMutex sync.RWMutex
+
+	renewalMutex sync.Mutex
+
+	// Issued certificates and revocations are stored here, if set.
+	statePath  string
+	stateMutex sync.Mutex
+
 	groupCert *x509.Certificate
 
 	bootNodes     uint32
@@ -70,6 +103,12 @@ type group struct {
 
 // LoadCa initializes a CA from a file path
 func LoadCa(path string, numBootNodes, numRings uint32) (*Ca, error) {
+	return LoadCaWithPassphrase(path, nil, numBootNodes, numRings)
+}
+
+// LoadCaWithPassphrase is like LoadCa, but decrypts the stored private key with the given passphrase.
+// A key stored in clear text is encrypted in place, migrating existing CAs.
+func LoadCaWithPassphrase(path string, passphrase []byte, numBootNodes, numRings uint32) (*Ca, error) {
 	if numBootNodes < 1 {
 		return nil, errInvalidBootNodes
 	}
@@ -79,17 +118,15 @@ func LoadCa(path string, numBootNodes, numRings uint32) (*Ca, error) {
 	}
 	keyPath := filepath.Join(path, "key.pem")
 
-	fp, err := ioutil.ReadFile(keyPath)
+	// Load private key
+	priv, encrypted, err := keys.ReadPrivateKey(keyPath, passphrase)
 	if err != nil {
 		return nil, err
 	}
 
-	// Load private key
-	keyBlock, _ := pem.Decode(fp)
-	key, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
-
-	if err != nil {
-		return nil, err
+	key, ok := priv.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errKeyType
 	}
 
 	c := &Ca{
@@ -97,6 +134,15 @@ func LoadCa(path string, numBootNodes, numRings uint32) (*Ca, error) {
 		pubKey:      key.Public(),
 		path:        path,
 		keyFilePath: "key.pem",
+		passphrase:  passphrase,
+	}
+
+	if !encrypted && len(passphrase) > 0 {
+		if err := c.SavePrivateKey(); err != nil {
+			return nil, err
+		}
+
+		log.Info("CA private key encrypted", "path", keyPath)
 	}
 
 	// Load group certificates
@@ -105,12 +151,19 @@ func LoadCa(path string, numBootNodes, numRings uint32) (*Ca, error) {
 		return nil, err
 	}
 
+	if len(groupCertFiles) > 1 {
+		return nil, errManyGroups
+	}
+
 	for _, fileName := range groupCertFiles {
 		g := &group{
 			knownCerts:  make([]*x509.Certificate, numBootNodes),
 			bootNodes:   numBootNodes,
 			numRings:    numRings,
 			existingIds: make(map[string]bool),
+
+			issued:         make(map[string]*big.Int),
+			revokedSerials: make(map[string]bool),
 		}
 
 		// Read group certificate
@@ -122,6 +175,11 @@ func LoadCa(path string, numBootNodes, numRings uint32) (*Ca, error) {
 		cert, err := x509.ParseCertificate(certBlock.Bytes)
 
 		g.groupCert = cert
+		g.statePath = c.statePath(cert.SerialNumber)
+
+		if err := g.loadState(); err != nil {
+			return nil, err
+		}
 
 		// Search for number of rings extension
 		for _, ext := range cert.Extensions {
@@ -165,20 +223,19 @@ func (c *Ca) SavePrivateKey() error {
 
 	p := filepath.Join(c.path, c.keyFilePath)
 
-	f, err := os.Create(p)
+	err := keys.WritePrivateKey(p, c.privKey, c.passphrase)
 	if err != nil {
 		log.Error(err.Error())
 		return err
 	}
 
-	b := x509.MarshalPKCS1PrivateKey(c.privKey)
-
-	block := &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: b,
-	}
+	return nil
+}
 
-	return pem.Encode(f, block)
+// SetPassphrase sets the passphrase encrypting the private key saved by SavePrivateKey,
+// an empty passphrase stores the key in clear text.
+func (c *Ca) SetPassphrase(passphrase []byte) {
+	c.passphrase = passphrase
 }
 
 // SaveCertificate Public key / certificate to the given io object.
@@ -228,7 +285,7 @@ func (c *Ca) Shutdown() {
 // Starts serving certificate signing requests, requires the amount of gossip rings
 // to be used in the network between ifrit clients.
 func (c *Ca) Start(host, port string) error {
-	addr := fmt.Sprintf("%s:%s", host, port)
+	addr := net.JoinHostPort(host, port)
 	log.Info("Started certificate authority", "addr", addr)
 	c.addr = addr
 	return c.httpHandler(addr)
@@ -240,8 +297,12 @@ func (c *Ca) Addr() string {
 	return c.addr
 }
 
-// NewGroup creates a new Ifrit group.
+// NewGroup creates the Ifrit group of the CA, a CA holds a single group.
 func (c *Ca) NewGroup(ringNum, bootNodes uint32) error {
+	if len(c.groups) > 0 {
+		return errGroupExists
+	}
+
 	serialNumber, err := genSerialNumber()
 	if err != nil {
 		log.Error(err.Error())
@@ -267,7 +328,7 @@ func (c *Ca) NewGroup(ringNum, bootNodes uint32) error {
 		PublicKey:             c.pubKey,
 		ExtraExtensions:       []pkix.Extension{ext},
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
 	}
 
 	gCert, err := x509.CreateCertificate(rand.Reader, caCert, caCert, c.pubKey, c.privKey)
@@ -288,6 +349,15 @@ func (c *Ca) NewGroup(ringNum, bootNodes uint32) error {
 		knownCerts:  make([]*x509.Certificate, bootNodes),
 		bootNodes:   bootNodes,
 		existingIds: make(map[string]bool),
+
+		issued:         make(map[string]*big.Int),
+		revokedSerials: make(map[string]bool),
+		statePath:      c.statePath(cert.SerialNumber),
+	}
+
+	if err := g.saveState(); err != nil {
+		log.Error(err.Error())
+		return err
 	}
 
 	c.groups = append(c.groups, g)
@@ -309,14 +379,16 @@ func genKeys() (*rsa.PrivateKey, error) {
 func (c *Ca) httpHandler(addr string) error {
 	r := mux.NewRouter()
 	r.HandleFunc("/certificateRequest", c.certificateSigning).Methods("POST")
+	r.HandleFunc("/revocationList", c.revocationList).Methods("GET")
+	r.HandleFunc("/certificateRenewal", c.certificateRenewal).Methods("POST")
 
-	port := strings.Split(addr, ":")[1]
-	if port == "" {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil || port == "" {
 		return errPortNotSet
 	}
 
 	c.httpServer = &http.Server{
-		Addr:         ":" + port,
+		Addr:         net.JoinHostPort("", port),
 		Handler:      r,
 		ReadTimeout:  time.Second * 10,
 		WriteTimeout: time.Second * 10,
@@ -345,15 +417,6 @@ func (c *Ca) certificateSigning(w http.ResponseWriter, r *http.Request) {
 	//var oidExtensionExtendedKeyUsage = []int{2, 5, 29, 37}
 	//var oidExtensionSubjectAltName = []int{2, 5, 29, 17}
 
-	ringBytes := make([]byte, 4)
-	binary.LittleEndian.PutUint32(ringBytes[0:], g.numRings)
-
-	ext := pkix.Extension{
-		Id:       []int{2, 5, 13, 37},
-		Critical: false,
-		Value:    ringBytes,
-	}
-
 	if len(reqCert.Subject.Locality) < 2 {
 		log.Error(errNoAddr.Error())
 		return
@@ -365,13 +428,6 @@ func (c *Ca) certificateSigning(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	/*
-		ipAddr, err := net.ResolveIPAddr("ip4", strings.Split(reqCert.Subject.Locality[0], ":")[0])
-		if err != nil {
-			log.Error(err.Error())
-			return
-		}
-	*/
 	id := g.genId()
 
 	newCert := &x509.Certificate{
@@ -380,12 +436,12 @@ func (c *Ca) certificateSigning(w http.ResponseWriter, r *http.Request) {
 		Subject:         reqCert.Subject,
 		NotBefore:       time.Now().AddDate(-10, 0, 0),
 		NotAfter:        time.Now().AddDate(10, 0, 0),
-		ExtraExtensions: []pkix.Extension{ext},
+		ExtraExtensions: []pkix.Extension{g.ringExtension()},
 		PublicKey:       reqCert.PublicKey,
-		// IPAddresses:     []net.IP{ipAddr.IP},
-		DNSNames:    reqCert.DNSNames,
-		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		IPAddresses:     reqCert.IPAddresses,
+		DNSNames:        reqCert.DNSNames,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		KeyUsage:        x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
 	}
 
 	signedCert, err := x509.CreateCertificate(rand.Reader, newCert, g.groupCert, reqCert.PublicKey, c.privKey)
@@ -399,6 +455,10 @@ func (c *Ca) certificateSigning(w http.ResponseWriter, r *http.Request) {
 		log.Error(err.Error())
 		return
 	}
+	// The certificate is handed out regardless, it can still be revoked by serial number.
+	if err := g.addIssued(knownCert); err != nil {
+		log.Error(err.Error())
+	}
 	trusted := g.addKnownCert(knownCert)
 
 	respStruct := struct {
@@ -425,6 +485,18 @@ func (c *Ca) certificateSigning(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Returns the certificate extension carrying the number of rings of the group.
+func (g *group) ringExtension() pkix.Extension {
+	ringBytes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(ringBytes[0:], g.numRings)
+
+	return pkix.Extension{
+		Id:       []int{2, 5, 13, 37},
+		Critical: false,
+		Value:    ringBytes,
+	}
+}
+
 func (g *group) addKnownCert(new *x509.Certificate) bool {
 	g.knownCertsMutex.Lock()
 	defer g.knownCertsMutex.Unlock()
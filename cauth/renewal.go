@@ -0,0 +1,181 @@
+package cauth
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/joonnna/ifrit/keys"
+)
+
+// Body of certificate renewal requests. The certificate request carries the new key
+// and is signed by the key of the current certificate, proving possession of both.
+type renewalRequest struct {
+	Certificate []byte
+	Request     []byte
+	R           []byte
+	S           []byte
+}
+
+// Renews the current certificate, issuing a certificate with the same id and addresses
+// for the key of the certificate request. Only the most recent certificate issued
+// for an id can be renewed, a superseded key can hence not fork the identity.
+// The current certificate is revoked, its key can no longer be used to act as the id.
+func (c *Ca) renew(req *renewalRequest) (*x509.Certificate, *group, error) {
+	curr, err := x509.ParseCertificate(req.Certificate)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	csr, err := x509.ParseCertificateRequest(req.Request)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	g := c.issuer(curr)
+	if g == nil {
+		return nil, nil, errRenewalIssuer
+	}
+
+	if time.Now().After(curr.NotAfter) {
+		return nil, nil, errRenewalExpired
+	}
+
+	if g.isRevoked(curr) {
+		return nil, nil, errRenewalRevoked
+	}
+
+	if !keys.Verify(curr.PublicKey, req.Request, req.R, req.S) {
+		return nil, nil, errRenewalSignature
+	}
+
+	if err := csr.CheckSignature(); err != nil {
+		return nil, nil, err
+	}
+
+	// Concurrent renewals of the same certificate would otherwise both succeed.
+	g.renewalMutex.Lock()
+	defer g.renewalMutex.Unlock()
+
+	if serial := g.issuedSerial(curr.SubjectKeyId); serial != nil && serial.Cmp(curr.SerialNumber) != 0 {
+		return nil, nil, errRenewalSuperseded
+	}
+
+	serialNumber, err := genSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Peers only accept certificates issued later than the one they know,
+	// which has to hold even for renewals within the same second.
+	notBefore := time.Now().AddDate(-10, 0, 0).Truncate(time.Second)
+	if !notBefore.After(curr.NotBefore) {
+		notBefore = curr.NotBefore.Add(time.Second)
+	}
+
+	newCert := &x509.Certificate{
+		SerialNumber:    serialNumber,
+		SubjectKeyId:    curr.SubjectKeyId,
+		Subject:         curr.Subject,
+		NotBefore:       notBefore,
+		NotAfter:        time.Now().AddDate(10, 0, 0),
+		ExtraExtensions: []pkix.Extension{g.ringExtension()},
+		PublicKey:       csr.PublicKey,
+		IPAddresses:     curr.IPAddresses,
+		DNSNames:        curr.DNSNames,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		KeyUsage:        x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+
+	signedCert, err := x509.CreateCertificate(rand.Reader, newCert, g.groupCert, csr.PublicKey, c.privKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := x509.ParseCertificate(signedCert)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := g.addIssued(cert); err != nil {
+		log.Error(err.Error())
+	}
+
+	if err := g.revoke(curr.SerialNumber); err != nil {
+		log.Error(err.Error())
+	}
+	g.replaceKnownCert(cert)
+
+	return cert, g, nil
+}
+
+func (c *Ca) certificateRenewal(w http.ResponseWriter, r *http.Request) {
+	var req renewalRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cert, g, err := c.renew(&req)
+	if err != nil {
+		log.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	log.Info("Renewed certificate", "addr", cert.Subject.Locality, "serial", cert.SerialNumber.String())
+
+	respStruct := struct {
+		OwnCert []byte
+		CaCert  []byte
+	}{
+		OwnCert: cert.Raw,
+		CaCert:  g.groupCert.Raw,
+	}
+
+	b := new(bytes.Buffer)
+	json.NewEncoder(b).Encode(respStruct)
+
+	_, err = w.Write(b.Bytes())
+	if err != nil {
+		log.Error(err.Error())
+	}
+}
+
+// Returns the group which issued the given certificate, nil if issued by none of them.
+func (c *Ca) issuer(cert *x509.Certificate) *group {
+	for _, g := range c.groups {
+		if cert.CheckSignatureFrom(g.groupCert) == nil {
+			return g
+		}
+	}
+
+	return nil
+}
+
+func (g *group) isRevoked(cert *x509.Certificate) bool {
+	g.revocationMutex.RLock()
+	defer g.revocationMutex.RUnlock()
+
+	return g.revokedSerials[cert.SerialNumber.String()]
+}
+
+// Replaces the certificate handed out to joining nodes if it carries the id of the given certificate.
+func (g *group) replaceKnownCert(cert *x509.Certificate) {
+	g.knownCertsMutex.Lock()
+	defer g.knownCertsMutex.Unlock()
+
+	for i, c := range g.knownCerts {
+		if c != nil && bytes.Equal(c.SubjectKeyId, cert.SubjectKeyId) {
+			g.knownCerts[i] = cert
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package cauth
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"math/big"
+	"net/http"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// RevokeId revokes the most recent certificate issued to the given Ifrit id.
+// Certificates issued before the CA stored its issued certificates can only be revoked by serial number.
+func (c *Ca) RevokeId(id []byte) error {
+	g, err := c.group()
+	if err != nil {
+		return err
+	}
+
+	serial := g.issuedSerial(id)
+	if serial == nil {
+		return errUnknownId
+	}
+
+	if err := g.revoke(serial); err != nil {
+		return err
+	}
+
+	log.Info("Revoked certificate", "serial", serial.String())
+
+	return nil
+}
+
+// RevokeSerial revokes the certificate with the given serial number.
+func (c *Ca) RevokeSerial(serial *big.Int) error {
+	if serial == nil {
+		return errNilSerial
+	}
+
+	g, err := c.group()
+	if err != nil {
+		return err
+	}
+
+	if err := g.revoke(serial); err != nil {
+		return err
+	}
+
+	log.Info("Revoked certificate", "serial", serial.String())
+
+	return nil
+}
+
+// RevocationList returns the DER encoded revocation list of the CA,
+// signed with the CA private key.
+// The list is also served over HTTP at /revocationList.
+func (c *Ca) RevocationList() ([]byte, error) {
+	g, err := c.group()
+	if err != nil {
+		return nil, err
+	}
+
+	g.revocationMutex.RLock()
+	defer g.revocationMutex.RUnlock()
+
+	now := time.Now()
+
+	template := &x509.RevocationList{
+		RevokedCertificateEntries: g.revoked,
+		Number:                    big.NewInt(g.revocationNum),
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(revocationValidity),
+	}
+
+	// Group certificates created before revocation support
+	// lack the CRL signing key usage, which only affects the template.
+	issuer := *g.groupCert
+	issuer.KeyUsage |= x509.KeyUsageCRLSign
+
+	return x509.CreateRevocationList(rand.Reader, template, &issuer, c.privKey)
+}
+
+// Returns the group of the CA.
+// A CA holds a single group, all certificates are issued and revoked under it
+// and nodes only verify revocation lists against its certificate.
+func (c *Ca) group() (*group, error) {
+	if len(c.groups) == 0 {
+		return nil, errNoGroups
+	}
+
+	return c.groups[0], nil
+}
+
+func (c *Ca) revocationList(w http.ResponseWriter, r *http.Request) {
+	rl, err := c.RevocationList()
+	if err != nil {
+		log.Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pkix-crl")
+
+	_, err = w.Write(rl)
+	if err != nil {
+		log.Error(err.Error())
+	}
+}
+
+func (g *group) addIssued(cert *x509.Certificate) error {
+	g.idMutex.Lock()
+	g.issued[string(cert.SubjectKeyId)] = cert.SerialNumber
+	g.idMutex.Unlock()
+
+	return g.saveState()
+}
+
+func (g *group) issuedSerial(id []byte) *big.Int {
+	g.idMutex.RLock()
+	defer g.idMutex.RUnlock()
+
+	return g.issued[string(id)]
+}
+
+// Each revocation bumps the list number, letting nodes tell which list is the most recent.
+// Numbers follow the time of revocation, so they keep increasing even if the stored state is lost.
+func (g *group) revoke(serial *big.Int) error {
+	g.revocationMutex.Lock()
+
+	if g.revokedSerials[serial.String()] {
+		g.revocationMutex.Unlock()
+		return nil
+	}
+
+	now := time.Now()
+
+	g.revokedSerials[serial.String()] = true
+
+	g.revoked = append(g.revoked, x509.RevocationListEntry{
+		SerialNumber:   serial,
+		RevocationTime: now,
+	})
+
+	if num := now.Unix(); num > g.revocationNum {
+		g.revocationNum = num
+	} else {
+		g.revocationNum++
+	}
+
+	g.revocationMutex.Unlock()
+
+	return g.saveState()
+}
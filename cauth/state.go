@@ -0,0 +1,139 @@
+package cauth
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// Issued certificates and revocations of a group, stored next to the group certificate.
+// Restarted CAs keep revoking by id, refusing superseded renewals and numbering
+// revocation lists above the ones nodes already hold.
+type groupState struct {
+	// Serial number of the most recent certificate issued for each hex encoded id.
+	Issued map[string]*big.Int
+
+	Revoked []revokedEntry
+	Number  int64
+}
+
+type revokedEntry struct {
+	Serial *big.Int
+	Time   time.Time
+}
+
+// Returns the path of the state file of the group with the given certificate serial,
+// empty if the CA has no path to store it under.
+func (c *Ca) statePath(serial *big.Int) string {
+	if c.path == "" {
+		return ""
+	}
+
+	return filepath.Join(c.path, fmt.Sprintf("g-%s.json", serial))
+}
+
+// Restores the state of the group, groups stored before the state was kept start empty.
+func (g *group) loadState() error {
+	if g.statePath == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(g.statePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var s groupState
+
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	g.idMutex.Lock()
+	for id, serial := range s.Issued {
+		raw, err := hex.DecodeString(id)
+		if err != nil {
+			g.idMutex.Unlock()
+			return err
+		}
+
+		g.issued[string(raw)] = serial
+		g.existingIds[string(raw)] = true
+	}
+	g.idMutex.Unlock()
+
+	g.revocationMutex.Lock()
+	defer g.revocationMutex.Unlock()
+
+	for _, e := range s.Revoked {
+		g.revoked = append(g.revoked, x509.RevocationListEntry{
+			SerialNumber:   e.Serial,
+			RevocationTime: e.Time,
+		})
+		g.revokedSerials[e.Serial.String()] = true
+	}
+
+	g.revocationNum = s.Number
+
+	log.Info("Restored group state", "issued", len(s.Issued), "revoked", len(s.Revoked), "number", s.Number)
+
+	return nil
+}
+
+// Writes the state of the group, replacing the stored one atomically.
+func (g *group) saveState() error {
+	if g.statePath == "" {
+		return nil
+	}
+
+	g.stateMutex.Lock()
+	defer g.stateMutex.Unlock()
+
+	s := groupState{Issued: make(map[string]*big.Int)}
+
+	g.idMutex.RLock()
+	for id, serial := range g.issued {
+		s.Issued[hex.EncodeToString([]byte(id))] = serial
+	}
+	g.idMutex.RUnlock()
+
+	g.revocationMutex.RLock()
+	for _, e := range g.revoked {
+		s.Revoked = append(s.Revoked, revokedEntry{Serial: e.SerialNumber, Time: e.RevocationTime})
+	}
+	s.Number = g.revocationNum
+	g.revocationMutex.RUnlock()
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(g.statePath), ".state")
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), g.statePath)
+}
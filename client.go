@@ -3,29 +3,65 @@ package ifrit
 import (
 	"crypto/x509/pkix"
 	"errors"
-	"fmt"
+	"io"
+	"net"
+	"strconv"
 
 	log "github.com/inconshreveable/log15"
 
 	"github.com/joonnna/ifrit/comm"
 	"github.com/joonnna/ifrit/core"
+	"github.com/joonnna/ifrit/core/discovery"
+	"github.com/joonnna/ifrit/fault"
 	"github.com/joonnna/ifrit/netutil"
+	"github.com/joonnna/ifrit/transport"
 	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
 )
 
 type Client struct {
 	node *core.Node
+	comm transport.Comm
 }
 
 type ClientConfig struct {
 	UdpPort, TcpPort   int
 	Hostname, CertPath string
+
+	// Addresses (host:port) other members use to reach the client,
+	// for when the client runs in a container or behind port mapping.
+	// They are put in the certificate, while the listeners are still bound
+	// to TcpPort and UdpPort on all local interfaces.
+	// Defaults to Hostname combined with the bound ports.
+	AdvertisedAddr, AdvertisedPingAddr string
+
+	// If set, all outgoing gossip, messages, streams and pings
+	// pass through the injector, see the fault package.
+	Faults *fault.Injector
+
+	// Interceptors and options added to the rpc server and the connections to other members,
+	// e.g. for logging, tracing, authorisation or metrics.
+	// Interceptors run in the given order before the ifrit services,
+	// options can not replace the tls credentials ifrit uses to identify members.
+	UnaryServerInterceptors  []grpc.UnaryServerInterceptor
+	StreamServerInterceptors []grpc.StreamServerInterceptor
+	UnaryClientInterceptors  []grpc.UnaryClientInterceptor
+	StreamClientInterceptors []grpc.StreamClientInterceptor
+	ServerOptions            []grpc.ServerOption
+	DialOptions              []grpc.DialOption
 }
 
+const (
+	// Ring used to place keys when no ring is specified.
+	keyRing = 1
+)
+
 var (
 	errNoData      = errors.New("Supplied data is of length 0")
 	errNoCaAddress = errors.New("Config does not contain address of CA")
 	errNoClientArg = errors.New("Client argument zero")
+	errAdvertised  = errors.New("Advertised address is not of the form host:port")
 )
 
 /* Creates and returns a new ifrit client instance.
@@ -44,7 +80,7 @@ func NewClient(cliCfg *ClientConfig) (*Client, error) {
 		return nil, err
 	}
 
-	udpConn, udpAddr, err := netutil.ListenUdp(cliCfg.Hostname, cliCfg.UdpPort)
+	udpConn, _, err := netutil.ListenUdp(cliCfg.Hostname, cliCfg.UdpPort)
 	if err != nil {
 		return nil, err
 	}
@@ -54,16 +90,23 @@ func NewClient(cliCfg *ClientConfig) (*Client, error) {
 		return nil, err
 	}
 
-	log.Debug("addrs", "rpc", l.Addr().String(), "udp", udpAddr)
+	rpcAddr, pingAddr, err := advertisedAddrs(cliCfg, l.Addr(), udpConn.LocalAddr())
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug("addrs", "rpc", l.Addr().String(), "udp", udpConn.LocalAddr().String(),
+		"advertisedRpc", rpcAddr, "advertisedUdp", pingAddr)
 
 	pk := pkix.Name{
-		Locality: []string{fmt.Sprintf("%s:%d", cliCfg.Hostname, cliCfg.TcpPort), udpAddr},
+		Locality: []string{rpcAddr, pingAddr},
 	}
 
 	caAddr := viper.GetString("ca_addr")
 
 	if cliCfg.CertPath == "" {
-		cu, err = comm.NewCu(pk, caAddr, cliCfg.Hostname)
+		host, _, _ := net.SplitHostPort(rpcAddr)
+		cu, err = comm.NewCu(pk, caAddr, host)
 		if err != nil {
 			return nil, err
 		}
@@ -74,7 +117,7 @@ func NewClient(cliCfg *ClientConfig) (*Client, error) {
 		}
 	}
 
-	c, err := comm.NewComm(cu.Certificate(), cu.CaCertificate(), cu.Priv(), l)
+	c, err := comm.NewComm(cu.Certificate(), cu.CaCertificate(), cu.Priv(), l, cliCfg.grpcOptions())
 	if err != nil {
 		return nil, err
 	}
@@ -84,24 +127,72 @@ func NewClient(cliCfg *ClientConfig) (*Client, error) {
 		return nil, err
 	}
 
-	n, err := core.NewNode(c, udpServer, cu, cu)
+	client, err := newClient(cliCfg, c, udpServer, cu)
+	if err != nil {
+		return nil, err
+	}
+
+	c.SetRevocationList(client.node.RevocationList())
+	c.SetCertificateRecord(client.node)
+
+	// A stored certificate may carry addresses from an earlier deployment,
+	// disseminate the advertised ones instead of requesting a new certificate.
+	if n := client.node; n.Addr() != rpcAddr || n.PingAddr() != pingAddr {
+		if err := n.SetAddress(rpcAddr, pingAddr, n.HttpAddr()); err != nil {
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
+
+// Creates a client communicating through the given transports instead of grpc and udp,
+// e.g. unix sockets between co-located processes or a relay.
+// The identity holds the certificate of the client, its addresses have to be the ones
+// the transports are reached at. See the transport package for what implementations must provide.
+// The address, port and grpc options of the config are not used.
+func NewClientWithTransport(cliCfg *ClientConfig, c transport.Comm, p transport.Ping, id transport.Identity) (*Client, error) {
+	if cliCfg == nil {
+		return nil, errNoClientArg
+	}
+
+	if err := readConfig(); err != nil {
+		return nil, err
+	}
+
+	return newClient(cliCfg, c, p, id)
+}
+
+func newClient(cliCfg *ClientConfig, c transport.Comm, p transport.Ping, id transport.Identity) (*Client, error) {
+	var n *core.Node
+	var err error
+
+	if inj := cliCfg.Faults; inj != nil {
+		n, err = core.NewNode(fault.NewComm(c, inj), fault.NewPing(p, inj), id, id)
+	} else {
+		n, err = core.NewNode(c, p, id, id)
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	return &Client{
 		node: n,
+		comm: c,
 	}, nil
 }
 
 /* Perform certificate request to CA and save them in argument path. */
 func NewClientCertificate(cliCfg *ClientConfig, path string) error {
 
+	rpcAddr, pingAddr, err := advertisedAddrs(cliCfg,
+		&net.TCPAddr{Port: cliCfg.TcpPort}, &net.UDPAddr{Port: cliCfg.UdpPort})
+	if err != nil {
+		return err
+	}
+
 	pk := pkix.Name{
-		Locality: []string{
-			fmt.Sprintf("%s:%d", cliCfg.Hostname, cliCfg.TcpPort),
-			fmt.Sprintf("%s:%d", cliCfg.Hostname, cliCfg.UdpPort),
-		},
+		Locality: []string{rpcAddr, pingAddr},
 	}
 
 	if err := readConfig(); err != nil {
@@ -110,7 +201,9 @@ func NewClientCertificate(cliCfg *ClientConfig, path string) error {
 
 	caAddr := viper.GetString("ca_addr")
 
-	cu, err := comm.NewStaticCu(pk, caAddr, cliCfg.Hostname)
+	host, _, _ := net.SplitHostPort(rpcAddr)
+
+	cu, err := comm.NewStaticCu(pk, caAddr, host)
 	if err != nil {
 		return err
 	}
@@ -123,6 +216,50 @@ func NewClientCertificate(cliCfg *ClientConfig, path string) error {
 	return err
 }
 
+// Returns the rpc and ping addresses to put in the certificate,
+// the advertised ones if set, otherwise the hostname combined with the bound ports.
+func advertisedAddrs(cliCfg *ClientConfig, rpc, ping net.Addr) (string, string, error) {
+	rpcAddr, pingAddr := cliCfg.AdvertisedAddr, cliCfg.AdvertisedPingAddr
+
+	if rpcAddr == "" {
+		rpcAddr = net.JoinHostPort(cliCfg.Hostname, strconv.Itoa(addrPort(rpc)))
+	}
+
+	if pingAddr == "" {
+		pingAddr = net.JoinHostPort(cliCfg.Hostname, strconv.Itoa(addrPort(ping)))
+	}
+
+	for _, a := range []string{rpcAddr, pingAddr} {
+		if host, port, err := net.SplitHostPort(a); err != nil || host == "" || port == "" {
+			return "", "", errAdvertised
+		}
+	}
+
+	return rpcAddr, pingAddr, nil
+}
+
+func (cliCfg *ClientConfig) grpcOptions() *comm.Options {
+	return &comm.Options{
+		UnaryServerInterceptors:  cliCfg.UnaryServerInterceptors,
+		StreamServerInterceptors: cliCfg.StreamServerInterceptors,
+		UnaryClientInterceptors:  cliCfg.UnaryClientInterceptors,
+		StreamClientInterceptors: cliCfg.StreamClientInterceptors,
+		ServerOptions:            cliCfg.ServerOptions,
+		DialOptions:              cliCfg.DialOptions,
+	}
+}
+
+func addrPort(a net.Addr) int {
+	switch addr := a.(type) {
+	case *net.TCPAddr:
+		return addr.Port
+	case *net.UDPAddr:
+		return addr.Port
+	default:
+		return 0
+	}
+}
+
 // Client starts operating.
 func (c *Client) Start() {
 	c.node.Start()
@@ -139,6 +276,48 @@ func (c *Client) Members() []string {
 	return c.node.LiveMembers()
 }
 
+// Returns the address (ip:port, rpc endpoint) of all members believed to be alive
+// whose attributes match the given selector.
+// The selector consists of comma separated requirements, each being one of
+// "key=value", "key!=value", "key" (present) or "!key" (not present), e.g. "zone=eu-west,!canary".
+// Returns an error if the selector is invalid.
+func (c *Client) MembersWhere(selector string) ([]string, error) {
+	sel, err := discovery.ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.node.MembersWhere(sel), nil
+}
+
+// Replaces the attributes (labels) of the client, signed and disseminated to all members.
+// Keys can not be empty or contain any of '=!,', at most 32 attributes are allowed.
+func (c *Client) SetAttributes(attrs map[string]string) error {
+	return c.node.SetAttributes(attrs)
+}
+
+// Replaces the addresses (ip:port) other members use to reach the client, e.g. after moving to a new host.
+// The new addresses are signed and disseminated to all members, overriding the ones in the certificate.
+// Listening on the new addresses is left to the caller.
+func (c *Client) SetAddress(rpcAddr, pingAddr string) error {
+	return c.node.SetAddress(rpcAddr, pingAddr, c.node.HttpAddr())
+}
+
+// Returns the attributes (labels) of the client.
+func (c *Client) Attributes() map[string]string {
+	return c.node.Attributes()
+}
+
+// Returns statistics of the pooled rpc connections to other members, sorted by address.
+// Returns nil if the transport does not pool connections.
+func (c *Client) ConnStats() []comm.ConnStats {
+	if p, ok := c.comm.(interface{ ConnStats() []comm.ConnStats }); ok {
+		return p.ConnStats()
+	}
+
+	return nil
+}
+
 // Returns ifrit's internal ID generated by the trusted CA
 func (c *Client) Id() string {
 	return c.node.Id()
@@ -191,6 +370,39 @@ func (c *Client) SendToId(destId []byte, data []byte) (chan *core.Message, error
 	return ch, err
 }
 
+// Returns the address of the member responsible for the given key on the given ring (1 to number of rings).
+// Keys are placed on the rings the same way as members, the responsible member
+// is the first live member at or after the key's position, which may be the client itself.
+// Returns an error if the ring number is invalid.
+func (c *Client) Lookup(key []byte, ringNum uint32) (string, error) {
+	return c.node.Lookup(key, ringNum)
+}
+
+// Returns the addresses of n distinct members responsible for the given key.
+// The responsible member of each ring comes first, followed by their ring successors.
+// Fewer than n addresses are returned if there are not enough live members.
+func (c *Client) Replicas(key []byte, n int) []string {
+	return c.node.Replicas(key, n)
+}
+
+// Same as SendTo, but destination is the member responsible for the given key on the first ring.
+// See Lookup for details.
+func (c *Client) SendToKey(key []byte, data []byte) (chan *core.Message, error) {
+	addr, err := c.node.Lookup(key, keyRing)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.SendTo(addr, data), nil
+}
+
+// Returns all changes to the ring mask of the client, oldest first.
+// Rings are disabled when the client rebuts accusations, and re-enabled
+// after reactivate_timeout seconds without any accusations.
+func (c *Client) MaskHistory() []discovery.MaskChange {
+	return c.node.MaskHistory()
+}
+
 // Returns a pair of channels used for bi-directional streams, given the destination. The first channel
 // is the input stream to the server and the second stream is the reply stream from the server.
 // To close the stream, close the input channel. The reply stream is open as long as the server sends messages
@@ -214,6 +426,23 @@ func (c *Client) RegisterStreamHandler(streamHandler func(chan []byte, chan []by
 	c.node.SetStreamHandler(streamHandler)
 }
 
+// Sends the content of the reader to the given destination address, split into chunks over a stream.
+// Each chunk carries a hash and the receiver verifies a digest of the entire payload,
+// if the connection drops the transfer resumes from the last offset acknowledged by the receiver.
+// Blocks until the receiver's blob handler returned, its error is returned to the caller.
+// The context bounds the entire transfer, including resumed attempts.
+func (c *Client) SendBlob(ctx context.Context, dest string, r io.Reader) error {
+	return c.node.SendBlob(ctx, dest, r)
+}
+
+// Registers the given function as the blob handler.
+// Invoked once a payload sent through SendBlob has been received and verified,
+// the reader is only valid until the handler returns.
+// The returned error is sent back to the sender.
+func (c *Client) RegisterBlobHandler(blobHandler func(io.Reader) error) {
+	c.node.SetBlobHandler(blobHandler)
+}
+
 // Registers the given function as the message handler.
 // Invoked each time the ifrit client receives an application message (another client sent it through SendTo), this callback will be invoked.
 // The returned byte slice will be sent back as the response.
@@ -236,6 +465,7 @@ func (c *Client) RegisterGossipHandler(gossipHandler func([]byte) ([]byte, error
 // Invoked when ifrit receives a response after gossiping application data.
 // All responses originates from a gossip handler invocation.
 // If the ResponseHandler is not registered or nil, responses will be discarded.
+// Gossip partners are contacted in parallel, the handler can be invoked concurrently.
 func (c *Client) RegisterResponseHandler(responseHandler func([]byte)) {
 	c.node.SetResponseHandler(responseHandler)
 }
@@ -254,6 +484,14 @@ func (c *Client) SetGossipContent(data []byte) error {
 	return nil
 }
 
+// Renews the certificate of the client through the CA with a newly generated key pair,
+// keeping the Ifrit id. The key algorithm is taken from the config, so it can be changed on renewal.
+// Other members replace the certificate once it has spread through gossip.
+// A stored identity is replaced with the renewed one.
+func (c *Client) RenewCertificate() error {
+	return c.node.RenewCertificate()
+}
+
 func (c *Client) SavePrivateKey(path string) error {
 	return c.node.SavePrivateKey(path)
 }
@@ -281,8 +519,26 @@ func readConfig() error {
 	viper.SetDefault("ping_limit", 3)
 	viper.SetDefault("pings_per_interval", 3)
 	viper.SetDefault("removal_timeout", 60)
+	viper.SetDefault("expire_timeout", 600)
+	viper.SetDefault("revocation_interval", 60)
+	viper.SetDefault("reactivate_timeout", 3600)
 	viper.SetDefault("max_concurrent_messages", 5)
 	viper.SetDefault("use_compression", true)
+	viper.SetDefault("gossip_compression", "gzip")
+	viper.SetDefault("message_compression", "gzip")
+	viper.SetDefault("compression_threshold", 1024)
+	viper.SetDefault("gossip_timeout", 3000)
+	viper.SetDefault("rebuttal_timeout", 3000)
+	viper.SetDefault("message_timeout", 10000)
+	viper.SetDefault("gossip_retries", 2)
+	viper.SetDefault("max_connections", 128)
+	viper.SetDefault("connection_idle_timeout", 300)
+	viper.SetDefault("key_algorithm", "ecdsa")
+	viper.SetDefault("key_passphrase", "")
+	viper.SetDefault("key_passphrase_file", "")
+	viper.SetDefault("use_relay", false)
+	viper.SetDefault("relay_max_hops", 16)
+	viper.SetDefault("signature_cache_size", 4096)
 
 	// Visualizer specific
 	viper.SetDefault("viz_update_interval", 10)
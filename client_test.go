@@ -0,0 +1,218 @@
+package ifrit
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/joonnna/ifrit/cauth"
+	"github.com/joonnna/ifrit/memnet"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestAdvertisedAddrs(t *testing.T) {
+	rpc, ping := &net.TCPAddr{Port: 8000}, &net.UDPAddr{Port: 9000}
+
+	rpcAddr, pingAddr, err := advertisedAddrs(&ClientConfig{Hostname: "10.0.0.1"}, rpc, ping)
+	require.NoError(t, err, "Bound addresses rejected.")
+	assert.Equal(t, "10.0.0.1:8000", rpcAddr, "Wrong default rpc address.")
+	assert.Equal(t, "10.0.0.1:9000", pingAddr, "Wrong default ping address.")
+
+	cfg := &ClientConfig{
+		Hostname:           "172.17.0.2",
+		AdvertisedAddr:     "203.0.113.5:30000",
+		AdvertisedPingAddr: "203.0.113.5:30001",
+	}
+
+	rpcAddr, pingAddr, err = advertisedAddrs(cfg, rpc, ping)
+	require.NoError(t, err, "Advertised addresses rejected.")
+	assert.Equal(t, "203.0.113.5:30000", rpcAddr, "Advertised rpc address not used.")
+	assert.Equal(t, "203.0.113.5:30001", pingAddr, "Advertised ping address not used.")
+
+	_, _, err = advertisedAddrs(&ClientConfig{Hostname: "10.0.0.1", AdvertisedAddr: "10.0.0.1"}, rpc, ping)
+	assert.EqualError(t, err, errAdvertised.Error(), "Address without port accepted.")
+
+	_, _, err = advertisedAddrs(&ClientConfig{}, rpc, ping)
+	assert.EqualError(t, err, errAdvertised.Error(), "Address without host accepted.")
+}
+
+func TestNewClientWithTransport(t *testing.T) {
+	chdirConfig(t, "use_viz: false\n")
+
+	network, err := memnet.NewNetwork(3, 1, 1)
+	require.NoError(t, err, "Failed to create network.")
+
+	var clients []*Client
+
+	for i := 0; i < 2; i++ {
+		id, err := network.NewIdentity()
+		require.NoError(t, err, "Failed to create identity.")
+
+		c, p, err := network.NewTransport(id)
+		require.NoError(t, err, "Failed to create transport.")
+
+		client, err := NewClientWithTransport(&ClientConfig{}, c, p, id)
+		require.NoError(t, err, "Failed to create client.")
+
+		c.Start()
+		p.Start()
+
+		assert.Equal(t, c.Addr(), client.Addr(), "Client address not taken from the identity.")
+		assert.Nil(t, client.ConnStats(), "Connection stats without a pooling transport.")
+
+		clients = append(clients, client)
+	}
+
+	var received []byte
+
+	// The first client is the entry peer of the second one, blobs are only sent to known peers.
+	clients[0].RegisterBlobHandler(func(r io.Reader) error {
+		data, err := ioutil.ReadAll(r)
+		received = data
+		return err
+	})
+
+	err = clients[1].SendBlob(context.Background(), clients[0].Addr(), bytes.NewReader([]byte("data")))
+	require.NoError(t, err, "Failed to send through the transport.")
+	assert.Equal(t, []byte("data"), received, "Wrong payload received.")
+
+	_, err = NewClientWithTransport(nil, nil, nil, nil)
+	assert.EqualError(t, err, errNoClientArg.Error(), "Missing config accepted.")
+}
+
+func TestIpv6Clients(t *testing.T) {
+	l, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skip("Ipv6 loopback unavailable: ", err)
+	}
+
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	require.NoError(t, err, "Failed to split address.")
+	l.Close()
+
+	ca, err := cauth.NewCa(t.TempDir())
+	require.NoError(t, err, "Failed to create CA.")
+	require.NoError(t, ca.NewGroup(3, 3), "Failed to create group.")
+
+	go ca.Start("::1", port)
+	defer ca.Shutdown()
+
+	chdirConfig(t, "use_viz: false\n")
+
+	// Overrides a config file found elsewhere, e.g. in /var/tmp.
+	setConfig(t, map[string]interface{}{
+		"use_ca":           true,
+		"ca_addr":          net.JoinHostPort("::1", port),
+		"gossip_interval":  1,
+		"monitor_interval": 1,
+	})
+
+	var clients []*Client
+
+	for i := 0; i < 3; i++ {
+		var client *Client
+
+		// The CA may not be listening yet.
+		tcpPort, udpPort := orderedPorts(t)
+
+		require.Eventually(t, func() bool {
+			client, err = NewClient(&ClientConfig{Hostname: "::1", TcpPort: tcpPort, UdpPort: udpPort})
+			return err == nil
+		}, time.Second*5, time.Millisecond*100, "Failed to create client.")
+
+		host, _, err := net.SplitHostPort(client.Addr())
+		require.NoError(t, err, "Client address does not parse.")
+		assert.Equal(t, "::1", host, "Client not on the ipv6 loopback.")
+
+		client.RegisterMsgHandler(func(data []byte) ([]byte, error) {
+			return data, nil
+		})
+
+		go client.Start()
+		defer client.Stop()
+
+		clients = append(clients, client)
+	}
+
+	require.Eventually(t, func() bool {
+		for _, c := range clients {
+			if len(c.Members()) != len(clients)-1 {
+				return false
+			}
+		}
+		return true
+	}, time.Second*20, time.Millisecond*100, "Clients did not discover each other.")
+
+	for _, src := range clients {
+		for _, dst := range clients {
+			if src == dst {
+				continue
+			}
+
+			resp := <-src.SendTo(dst.Addr(), []byte("data"))
+			require.NotNil(t, resp, "Message from %s to %s not delivered.", src.Addr(), dst.Addr())
+			assert.Equal(t, []byte("data"), resp.Data, "Wrong response.")
+		}
+	}
+}
+
+// Returns free tcp and udp ports on the ipv6 loopback.
+// Certificates encode the rpc and ping address as a set, which is sorted,
+// so the ports are picked with the rpc address sorting first.
+func orderedPorts(t *testing.T) (int, int) {
+	for {
+		l, err := net.Listen("tcp", "[::1]:0")
+		require.NoError(t, err, "Failed to find a free tcp port.")
+
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv6loopback})
+		require.NoError(t, err, "Failed to find a free udp port.")
+
+		tcpPort, udpPort := l.Addr().(*net.TCPAddr).Port, conn.LocalAddr().(*net.UDPAddr).Port
+
+		l.Close()
+		conn.Close()
+
+		if rpc, ping := strconv.Itoa(tcpPort), strconv.Itoa(udpPort); len(rpc) == len(ping) && rpc < ping {
+			return tcpPort, udpPort
+		}
+	}
+}
+
+// Changes into a temporary directory holding the given ifrit config.
+func chdirConfig(t *testing.T, config string) {
+	dir := t.TempDir()
+
+	err := ioutil.WriteFile(filepath.Join(dir, "ifrit_config.yaml"), []byte(config), 0644)
+	require.NoError(t, err, "Failed to write config.")
+
+	wd, err := os.Getwd()
+	require.NoError(t, err, "Failed to get working directory.")
+
+	require.NoError(t, os.Chdir(dir), "Failed to change directory.")
+
+	t.Cleanup(func() {
+		os.Chdir(wd)
+	})
+}
+
+// Overrides the given config values for the duration of the test.
+func setConfig(t *testing.T, values map[string]interface{}) {
+	for k, v := range values {
+		prev := viper.Get(k)
+		viper.Set(k, v)
+
+		k := k
+		t.Cleanup(func() {
+			viper.Set(k, prev)
+		})
+	}
+}
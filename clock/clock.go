@@ -0,0 +1,127 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock abstracts the passing of time, letting protocol loops and
+// timeouts be driven by a manual clock in tests and simulations.
+type Clock interface {
+	Now() time.Time
+	Since(time.Time) time.Duration
+	After(time.Duration) <-chan time.Time
+	Sleep(time.Duration)
+}
+
+type realClock struct {
+}
+
+// Returns a clock backed by the time package.
+func New() Clock {
+	return realClock{}
+}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// Manual is a clock which only moves when advanced.
+// Channels returned by After fire once the clock has been advanced past their deadline.
+type Manual struct {
+	now     time.Time
+	waiters []*waiter
+	mutex   sync.Mutex
+}
+
+type waiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// Creates a manual clock starting at the given time.
+func NewManual(start time.Time) *Manual {
+	return &Manual{
+		now: start,
+	}
+}
+
+func (m *Manual) Now() time.Time {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.now
+}
+
+func (m *Manual) Since(t time.Time) time.Duration {
+	return m.Now().Sub(t)
+}
+
+func (m *Manual) After(d time.Duration) <-chan time.Time {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	w := &waiter{
+		deadline: m.now.Add(d),
+		ch:       make(chan time.Time, 1),
+	}
+
+	if d <= 0 {
+		w.ch <- m.now
+	} else {
+		m.waiters = append(m.waiters, w)
+	}
+
+	return w.ch
+}
+
+// Blocks until the clock has been advanced by the given duration.
+func (m *Manual) Sleep(d time.Duration) {
+	<-m.After(d)
+}
+
+// Moves the clock forward, firing all waiters whose deadline
+// has passed in deadline order.
+func (m *Manual) Advance(d time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.now = m.now.Add(d)
+
+	sort.SliceStable(m.waiters, func(i, j int) bool {
+		return m.waiters[i].deadline.Before(m.waiters[j].deadline)
+	})
+
+	remaining := m.waiters[:0]
+
+	for _, w := range m.waiters {
+		if w.deadline.After(m.now) {
+			remaining = append(remaining, w)
+		} else {
+			w.ch <- w.deadline
+		}
+	}
+
+	m.waiters = remaining
+}
+
+// Returns the number of goroutines currently waiting on the clock.
+func (m *Manual) Waiters() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return len(m.waiters)
+}
@@ -0,0 +1,103 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ClockTestSuite struct {
+	suite.Suite
+
+	start time.Time
+	c     *Manual
+}
+
+func TestClockTestSuite(t *testing.T) {
+	suite.Run(t, new(ClockTestSuite))
+}
+
+func (suite *ClockTestSuite) SetupTest() {
+	suite.start = time.Unix(0, 0)
+	suite.c = NewManual(suite.start)
+}
+
+func (suite *ClockTestSuite) TestNowAndSince() {
+	assert.Equal(suite.T(), suite.start, suite.c.Now(), "Wrong start time.")
+
+	suite.c.Advance(time.Minute)
+
+	assert.Equal(suite.T(), suite.start.Add(time.Minute), suite.c.Now(), "Clock did not advance.")
+	assert.Equal(suite.T(), time.Minute, suite.c.Since(suite.start), "Wrong elapsed time.")
+}
+
+func (suite *ClockTestSuite) TestAfter() {
+	ch := suite.c.After(time.Second * 10)
+
+	suite.c.Advance(time.Second * 5)
+
+	select {
+	case <-ch:
+		suite.T().Fatal("Fired before deadline.")
+	default:
+	}
+
+	suite.c.Advance(time.Second * 5)
+
+	select {
+	case t := <-ch:
+		assert.Equal(suite.T(), suite.start.Add(time.Second*10), t, "Wrong fire time.")
+	default:
+		suite.T().Fatal("Did not fire at deadline.")
+	}
+
+	assert.Zero(suite.T(), suite.c.Waiters(), "Fired waiter not removed.")
+}
+
+func (suite *ClockTestSuite) TestAfterNonPositive() {
+	select {
+	case <-suite.c.After(0):
+	default:
+		suite.T().Fatal("Zero duration did not fire immediately.")
+	}
+}
+
+func (suite *ClockTestSuite) TestAdvanceFiresInDeadlineOrder() {
+	late := suite.c.After(time.Second * 3)
+	early := suite.c.After(time.Second)
+
+	require.Equal(suite.T(), 2, suite.c.Waiters(), "Wrong number of waiters.")
+
+	suite.c.Advance(time.Second * 2)
+
+	assert.Len(suite.T(), early, 1, "Early waiter not fired.")
+	assert.Len(suite.T(), late, 0, "Late waiter fired.")
+
+	suite.c.Advance(time.Second)
+
+	assert.Len(suite.T(), late, 1, "Late waiter not fired.")
+}
+
+func (suite *ClockTestSuite) TestSleep() {
+	done := make(chan struct{})
+
+	go func() {
+		suite.c.Sleep(time.Second)
+		close(done)
+	}()
+
+	for suite.c.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	suite.c.Advance(time.Second)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		suite.T().Fatal("Sleep did not return.")
+	}
+}
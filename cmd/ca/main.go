@@ -13,6 +13,7 @@ import (
 
 	log "github.com/inconshreveable/log15"
 	"github.com/joonnna/ifrit/cauth"
+	"github.com/joonnna/ifrit/keys"
 )
 
 var DefaultPermission = os.FileMode(0750)
@@ -27,6 +28,10 @@ var Config = struct {
 	NumRings     uint32 `default:"3"`
 	NumBootNodes uint32 `default:"5"`
 	LogFile      string `default:""`
+
+	// Encrypts the CA private key, the content of KeyPassphraseFile takes precedence.
+	KeyPassphrase     string `default:""`
+	KeyPassphraseFile string `default:""`
 }{}
 
 // saveState saves ca private key and public certificates to disk.
@@ -63,6 +68,7 @@ func main() {
 	args.StringVar(&Config.Host, "host", Config.Host, "Hostname.")
 	args.IntVar(&Config.Port, "port", Config.Port, "Port number.")
 	args.StringVar(&Config.Path, "path", Config.Path, "Path to runtime files.")
+	args.StringVar(&Config.KeyPassphraseFile, "keyfile", Config.KeyPassphraseFile, "File containing the passphrase of the private key.")
 	args.BoolVar(&createNew, "new", false, "Initialize new CA structure.")
 	args.Parse(os.Args[1:])
 
@@ -80,10 +86,19 @@ func main() {
 	var ca *cauth.Ca
 	var err error
 
+	passphrase, err := keys.ReadPassphrase(Config.KeyPassphrase, Config.KeyPassphraseFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	// Keeps the passphrase out of the printed config.
+	Config.KeyPassphrase = ""
+
 	if !createNew {
-		ca, err = cauth.LoadCa(Config.Path, Config.NumRings, Config.NumBootNodes)
+		ca, err = cauth.LoadCaWithPassphrase(Config.Path, passphrase, Config.NumRings, Config.NumBootNodes)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error loading CA. Run with --new option if CA does not exit.")
+			fmt.Fprintln(os.Stderr, "Error loading CA. Run with --new option if CA does not exit.", err)
 			os.Exit(1)
 		}
 	} else {
@@ -102,6 +117,8 @@ func main() {
 			os.Exit(1)
 		}
 
+		ca.SetPassphrase(passphrase)
+
 		// Add initial group.
 		err = ca.NewGroup(Config.NumRings, Config.NumBootNodes)
 		if err != nil {
@@ -0,0 +1,213 @@
+package comm
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/joonnna/ifrit/cauth"
+	"github.com/joonnna/ifrit/keys"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type CaTestSuite struct {
+	suite.Suite
+
+	ca     *cauth.Ca
+	caAddr string
+	path   string
+}
+
+func TestCaTestSuite(t *testing.T) {
+	r := log.Root()
+
+	r.SetHandler(log.DiscardHandler())
+
+	suite.Run(t, new(CaTestSuite))
+}
+
+func (suite *CaTestSuite) SetupSuite() {
+	path, err := ioutil.TempDir("", "ca")
+	require.NoError(suite.T(), err, "Failed to create directory.")
+
+	suite.path = path
+
+	ca, err := cauth.NewCa(path)
+	require.NoError(suite.T(), err, "Failed to create CA.")
+	require.NoError(suite.T(), ca.NewGroup(3, 3), "Failed to create group.")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(suite.T(), err, "Failed to find a free port.")
+
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	require.NoError(suite.T(), err, "Failed to split address.")
+	l.Close()
+
+	go ca.Start("127.0.0.1", port)
+
+	suite.ca = ca
+	suite.caAddr = net.JoinHostPort("127.0.0.1", port)
+
+	for i := 0; i < 50; i++ {
+		if c, err := net.Dial("tcp", suite.caAddr); err == nil {
+			c.Close()
+			return
+		}
+
+		time.Sleep(time.Millisecond * 20)
+	}
+
+	suite.T().Fatal("CA did not start.")
+}
+
+func (suite *CaTestSuite) TearDownSuite() {
+	suite.ca.Shutdown()
+	os.RemoveAll(suite.path)
+}
+
+func (suite *CaTestSuite) TestRenew() {
+	defer viper.Set("key_algorithm", keys.ECDSA)
+
+	name := pkix.Name{
+		Locality: []string{"127.0.0.1:1000", "127.0.0.1:1001"},
+	}
+
+	cu, err := NewCu(name, suite.caAddr, "127.0.0.1")
+	require.NoError(suite.T(), err, "Failed to create crypto unit.")
+
+	path := filepath.Join(suite.path, "node")
+	require.NoError(suite.T(), cu.SavePrivateKey(path), "Failed to save key.")
+	require.NoError(suite.T(), cu.SaveCertificate(path), "Failed to save certificate.")
+
+	prev, prevPriv := cu.Certificate(), cu.Priv()
+
+	viper.Set("key_algorithm", keys.Ed25519)
+
+	cert, err := cu.Renew()
+	require.NoError(suite.T(), err, "Failed to renew certificate.")
+
+	assert.Equal(suite.T(), prev.SubjectKeyId, cert.SubjectKeyId, "Renewed certificate has another id.")
+	assert.Equal(suite.T(), prev.Subject.Locality, cert.Subject.Locality, "Renewed certificate has other addresses.")
+	assert.NotEqual(suite.T(), prev.SerialNumber, cert.SerialNumber, "Renewed certificate has the same serial number.")
+	assert.NoError(suite.T(), cert.CheckSignatureFrom(cu.CaCertificate()), "Renewed certificate not signed by the CA.")
+	assert.Equal(suite.T(), cert, cu.Certificate(), "Renewed certificate not in use.")
+
+	_, ok := cu.Priv().(ed25519.PrivateKey)
+	assert.True(suite.T(), ok, "Renewed key not of the configured algorithm.")
+
+	r, s, err := cu.Sign([]byte("data"))
+	require.NoError(suite.T(), err, "Failed to sign.")
+	assert.True(suite.T(), keys.Verify(cert.PublicKey, []byte("data"), r, s), "Not signing with the renewed key.")
+
+	rl, err := x509.ParseRevocationList(suite.revocationList(suite.ca))
+	require.NoError(suite.T(), err, "Failed to parse revocation list.")
+	assert.True(suite.T(), revokedSerial(rl, prev), "Previous certificate not revoked.")
+
+	c := &Comm{}
+	c.SetCertificateRecord(knownCerts{string(cert.SubjectKeyId): cert})
+
+	assert.Equal(suite.T(), errStaleCert, c.verifyPeer([][]byte{prev.Raw}, nil), "Previous certificate accepted in handshake.")
+	assert.NoError(suite.T(), c.verifyPeer([][]byte{cert.Raw}, nil), "Renewed certificate refused in handshake.")
+
+	stale := &CryptoUnit{caAddr: suite.caAddr, ca: cu.CaCertificate(), priv: prevPriv, self: prev}
+
+	_, err = stale.Renew()
+	assert.Error(suite.T(), err, "Superseded certificate renewed.")
+
+	loaded, err := LoadCu(cu.getStorePath(), name, suite.caAddr)
+	require.NoError(suite.T(), err, "Failed to load renewed identity.")
+	assert.Equal(suite.T(), cert.Raw, loaded.Certificate().Raw, "Stored certificate not renewed.")
+	assert.Equal(suite.T(), cu.Priv(), loaded.Priv(), "Stored key not renewed.")
+
+	_, err = (&CryptoUnit{self: cert}).Renew()
+	assert.Equal(suite.T(), errNoCa, err, "Renewed without a CA.")
+}
+
+func (suite *CaTestSuite) TestRestoredState() {
+	name := pkix.Name{
+		Locality: []string{"127.0.0.1:1000", "127.0.0.1:1001"},
+	}
+
+	revoked, err := NewCu(name, suite.caAddr, "127.0.0.1")
+	require.NoError(suite.T(), err, "Failed to create crypto unit.")
+
+	issued, err := NewCu(name, suite.caAddr, "127.0.0.1")
+	require.NoError(suite.T(), err, "Failed to create crypto unit.")
+
+	require.NoError(suite.T(), suite.ca.RevokeId(revoked.Certificate().SubjectKeyId), "Failed to revoke by id.")
+
+	prev, err := x509.ParseRevocationList(suite.revocationList(suite.ca))
+	require.NoError(suite.T(), err, "Failed to parse revocation list.")
+
+	require.NoError(suite.T(), suite.ca.SavePrivateKey(), "Failed to save CA key.")
+	require.NoError(suite.T(), suite.ca.SaveCertificate(), "Failed to save CA certificate.")
+
+	loaded, err := cauth.LoadCa(suite.path, 3, 3)
+	require.NoError(suite.T(), err, "Failed to load CA.")
+
+	rl, err := x509.ParseRevocationList(suite.revocationList(loaded))
+	require.NoError(suite.T(), err, "Failed to parse revocation list.")
+
+	assert.Equal(suite.T(), prev.Number, rl.Number, "Revocation list number not restored.")
+	assert.True(suite.T(), revokedSerial(rl, revoked.Certificate()), "Revocation not restored.")
+
+	require.NoError(suite.T(), loaded.RevokeId(issued.Certificate().SubjectKeyId), "Id issued before restart not revoked.")
+
+	rl, err = x509.ParseRevocationList(suite.revocationList(loaded))
+	require.NoError(suite.T(), err, "Failed to parse revocation list.")
+
+	assert.True(suite.T(), rl.Number.Cmp(prev.Number) > 0, "Revocation list number not increased after restart.")
+	assert.True(suite.T(), revokedSerial(rl, issued.Certificate()), "Certificate not revoked after restart.")
+}
+
+func (suite *CaTestSuite) TestSingleGroup() {
+	assert.Error(suite.T(), suite.ca.NewGroup(3, 3), "Created a second group.")
+
+	name := pkix.Name{
+		Locality: []string{"127.0.0.1:1000", "127.0.0.1:1001"},
+	}
+
+	cu, err := NewCu(name, suite.caAddr, "127.0.0.1")
+	require.NoError(suite.T(), err, "Failed to create crypto unit.")
+
+	require.NoError(suite.T(), suite.ca.RevokeSerial(cu.Certificate().SerialNumber), "Failed to revoke by serial.")
+
+	rl, err := x509.ParseRevocationList(suite.revocationList(suite.ca))
+	require.NoError(suite.T(), err, "Failed to parse revocation list.")
+
+	assert.True(suite.T(), revokedSerial(rl, cu.Certificate()), "Serial not revoked in the list of the group.")
+	assert.NoError(suite.T(), rl.CheckSignatureFrom(cu.CaCertificate()), "List not signed by the issuing group.")
+}
+
+func (suite *CaTestSuite) revocationList(ca *cauth.Ca) []byte {
+	rl, err := ca.RevocationList()
+	require.NoError(suite.T(), err, "Failed to create revocation list.")
+
+	return rl
+}
+
+type knownCerts map[string]*x509.Certificate
+
+func (k knownCerts) KnownCertificate(id string) *x509.Certificate {
+	return k[id]
+}
+
+func revokedSerial(rl *x509.RevocationList, cert *x509.Certificate) bool {
+	for _, e := range rl.RevokedCertificateEntries {
+		if e.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			return true
+		}
+	}
+
+	return false
+}
@@ -2,91 +2,265 @@ package comm
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 _	"fmt"
 	"errors"
+	"math/rand"
 	"sync"
 	"time"
 	"io"
 
+	"github.com/golang/protobuf/proto"
 	pb "github.com/joonnna/ifrit/protobuf"
 	log "github.com/inconshreveable/log15"
 	"github.com/spf13/viper"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	retryBackoff = time.Millisecond * 100
 )
 
 var (
 	errReachable = errors.New("Remote entity not reachable")
 	errNilConfig = errors.New("Provided tls config was nil")
+	errWrongId   = errors.New("Peer certificate does not carry the expected id")
 )
 
 type gRPCClient struct {
-	allConnections  map[string]*conn
+	allConnections  map[connKey]*conn
+	pinned          map[string]bool
 	connectionMutex sync.RWMutex
 
+	maxConns    int
+	idleTimeout time.Duration
+
+	gossipTimeout   time.Duration
+	messageTimeout  time.Duration
+	rebuttalTimeout time.Duration
+	gossipRetries   int
+
+	gossipCodec       string
+	messageCodec      string
+	compressThreshold int
+
+	exitChan chan bool
+	stopOnce sync.Once
+
+	tlsConfig   *tls.Config
 	dialOptions []grpc.DialOption
 }
 
+// Connections are keyed by the expected id of the peer as well as its address,
+// a connection to an address is never reused for another peer.
+// An empty id accepts any peer certified by the CA.
+type connKey struct {
+	addr string
+	id   string
+}
+
 type conn struct {
 	pb.GossipClient
 	cc *grpc.ClientConn
-}
 
-func newClient(config *tls.Config) (*gRPCClient, error) {
-	var dialOptions []grpc.DialOption
+	created    time.Time
+	lastUsed   time.Time
+	calls      uint64
+	failures   uint64
+	statsMutex sync.RWMutex
+
+	// Number of calls and streams in flight, connections in use are not evicted.
+	inFlight int32
+
+	// Codecs the peer rejected as unsupported.
+	rejected   map[string]bool
+	codecMutex sync.RWMutex
+}
 
+func newClient(config *tls.Config, opts *Options) (*gRPCClient, error) {
 	if config == nil {
 		return nil, errNilConfig
 	}
 
-	creds := credentials.NewTLS(config)
+	// User options come first, the credentials set when dialing take precedence.
+	dialOptions := opts.dialOptions()
 
-	dialOptions = append(dialOptions, grpc.WithTransportCredentials(creds))
 	dialOptions = append(dialOptions, grpc.WithBackoffMaxDelay(time.Minute*1))
 
+	var gossipCodec, messageCodec string
+
 	if compress := viper.GetBool("use_compression"); compress {
-		dialOptions = append(dialOptions,
-			grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)))
+		gossipCodec = viper.GetString("gossip_compression")
+		messageCodec = viper.GetString("message_compression")
+	}
+
+	for _, codec := range []string{gossipCodec, messageCodec} {
+		if err := validCodec(codec); err != nil {
+			return nil, err
+		}
 	}
 
-	return &gRPCClient{
-		allConnections: make(map[string]*conn),
-		dialOptions:    dialOptions,
-	}, nil
+	c := &gRPCClient{
+		allConnections: make(map[connKey]*conn),
+		pinned:         make(map[string]bool),
+		maxConns:       viper.GetInt("max_connections"),
+		idleTimeout:    time.Second * time.Duration(viper.GetInt32("connection_idle_timeout")),
+
+		gossipTimeout:   time.Millisecond * time.Duration(viper.GetInt32("gossip_timeout")),
+		messageTimeout:  time.Millisecond * time.Duration(viper.GetInt32("message_timeout")),
+		rebuttalTimeout: time.Millisecond * time.Duration(viper.GetInt32("rebuttal_timeout")),
+		gossipRetries:   viper.GetInt("gossip_retries"),
+
+		gossipCodec:       gossipCodec,
+		messageCodec:      messageCodec,
+		compressThreshold: viper.GetInt("compression_threshold"),
+
+		exitChan:    make(chan bool),
+		tlsConfig:   config,
+		dialOptions: dialOptions,
+	}
+
+	if c.idleTimeout > 0 {
+		go c.evictLoop()
+	}
+
+	return c, nil
 }
 
-func (c *gRPCClient) Gossip(addr string, args *pb.State) (*pb.StateResponse, error) {
-	conn, err := c.connection(addr)
+// Gossips with the peer at the given address, whose certificate has to carry the given id.
+// Gossiping is idempotent, failed calls are retried with jittered backoff.
+func (c *gRPCClient) Gossip(addr, id string, args *pb.State) (*pb.StateResponse, error) {
+	return c.spread(connKey{addr: addr, id: id}, args, c.gossipTimeout)
+}
+
+// Same as Gossip, but bounded by the rebuttal deadline.
+func (c *gRPCClient) Rebuttal(addr, id string, args *pb.State) (*pb.StateResponse, error) {
+	return c.spread(connKey{addr: addr, id: id}, args, c.rebuttalTimeout)
+}
+
+// Messages are not idempotent and never retried.
+func (c *gRPCClient) Send(addr, id string, args *pb.Msg) (*pb.MsgResponse, error) {
+	conn, err := c.connection(connKey{addr: addr, id: id})
 	if err != nil {
 		return nil, err
 	}
+	defer conn.release()
+
+	ctx, cancel := callContext(c.messageTimeout)
+	defer cancel()
 
-	r, err := conn.Spread(context.Background(), args)
+	var r *pb.MsgResponse
+
+	codec := c.codec(conn, c.messageCodec, proto.Size(args))
+
+	err = conn.compressedCall(codec, func(opts ...grpc.CallOption) error {
+		r, err = conn.Messenger(ctx, args, opts...)
+		return err
+	})
+	conn.used(err)
+
+	return r, err
+}
+
+func (c *gRPCClient) spread(key connKey, args *pb.State, timeout time.Duration) (*pb.StateResponse, error) {
+	var err error
+
+	for attempt := 0; attempt <= c.gossipRetries; attempt++ {
+		var r *pb.StateResponse
+
+		if attempt > 0 {
+			time.Sleep(backoff(attempt))
+		}
+
+		r, err = c.spreadOnce(key, args, timeout)
+		if err == nil {
+			return r, nil
+		}
+
+		if !retryable(err) || attempt == c.gossipRetries {
+			break
+		}
+
+		log.Debug("Retrying gossip", "addr", key.addr, "attempt", attempt+1, "err", err)
+	}
+
+	return nil, err
+}
+
+func (c *gRPCClient) spreadOnce(key connKey, args *pb.State, timeout time.Duration) (*pb.StateResponse, error) {
+	conn, err := c.connection(key)
 	if err != nil {
 		return nil, err
 	}
+	defer conn.release()
 
-	return r, nil
-}
+	ctx, cancel := callContext(timeout)
+	defer cancel()
+
+	var r *pb.StateResponse
+
+	codec := c.codec(conn, c.gossipCodec, proto.Size(args))
 
-func (c *gRPCClient) Send(addr string, args *pb.Msg) (*pb.MsgResponse, error) {
-	conn, err := c.connection(addr)
+	err = conn.compressedCall(codec, func(opts ...grpc.CallOption) error {
+		r, err = conn.Spread(ctx, args, opts...)
+		return err
+	})
+	conn.used(err)
 	if err != nil {
 		return nil, err
 	}
 
-	return conn.Messenger(context.Background(), args)
+	return r, nil
 }
 
-func (c *gRPCClient) StreamMessenger(addr string, input, reply chan []byte) error {
-	conn, err := c.connection(addr)
+// Zero timeouts leave calls without a deadline.
+func callContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// Only failures where the remote peer might not have processed the call are retried.
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+// Exponential backoff, where the second half of each delay is randomized
+// to avoid nodes retrying in lockstep.
+func backoff(attempt int) time.Duration {
+	d := retryBackoff << uint(attempt-1)
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (c *gRPCClient) StreamMessenger(addr, id string, input, reply chan []byte) error {
+	conn, err := c.connection(connKey{addr: addr, id: id})
 	if err != nil {
 		return err
 	}
+	defer conn.release()
 	
-	srv, err := conn.Stream(context.Background()) 
+	// Streams live as long as the producer keeps the input channel open,
+	// hence they have no deadline.
+	// The size of streamed messages is unknown upfront, the threshold does not apply.
+	var opts []grpc.CallOption
+	if codec := c.codec(conn, c.messageCodec, c.compressThreshold); codec != "" {
+		opts = append(opts, grpc.UseCompressor(codec))
+	}
+
+	srv, err := conn.Stream(context.Background(), opts...) 
+	conn.used(err)
 	if err != nil {
 		return err
 	}
@@ -144,49 +318,156 @@ func (c *gRPCClient) StreamMessenger(addr string, input, reply chan []byte) erro
 	return nil
 }
 
-func (c *gRPCClient) CloseConn(addr string) {
-	c.connectionMutex.Lock()
-	defer c.connectionMutex.Unlock()
+// Opens a raw stream to the given address, blob transfers use it
+// to control chunking and acknowledgements themselves.
+// The stream lives as long as the context, the caller cancels it when done.
+func (c *gRPCClient) DialStream(ctx context.Context, addr, id string) (pb.Gossip_StreamClient, error) {
+	conn, err := c.connection(connKey{addr: addr, id: id})
+	if err != nil {
+		return nil, err
+	}
 
-	if conn, ok := c.allConnections[addr]; ok {
-		conn.cc.Close()
-		delete(c.allConnections, addr)
+	var opts []grpc.CallOption
+	if codec := c.codec(conn, c.messageCodec, c.compressThreshold); codec != "" {
+		opts = append(opts, grpc.UseCompressor(codec))
 	}
+
+	s, err := conn.Stream(ctx, opts...)
+	conn.used(err)
+	if err != nil {
+		conn.release()
+		return nil, err
+	}
+
+	go func() {
+		<-s.Context().Done()
+		conn.release()
+	}()
+
+	return s, nil
 }
 
-func (c *gRPCClient) dial(addr string) (*conn, error) {
+// Closes all connections to the given address, regardless of the expected peer id.
+func (c *gRPCClient) CloseConn(addr string) {
 	c.connectionMutex.Lock()
 	defer c.connectionMutex.Unlock()
 
-	if conn, ok := c.allConnections[addr]; ok {
-		return conn, nil
+	for key, conn := range c.allConnections {
+		if key.addr == addr {
+			conn.cc.Close()
+			delete(c.allConnections, key)
+		}
 	}
+}
+
+// Dials the peer without holding the connection lock, dialing blocks if the dial options ask for it.
+// Connections dialed concurrently to the same peer are closed in favour of the pooled one.
+// The returned connection is marked in use, callers release it when done.
+func (c *gRPCClient) dial(key connKey) (*conn, error) {
+	creds := credentials.NewTLS(pinnedIdConfig(c.tlsConfig, key.id))
 
-	cc, err := grpc.Dial(addr, c.dialOptions...)
+	opts := append(append([]grpc.DialOption{}, c.dialOptions...), grpc.WithTransportCredentials(creds))
+
+	cc, err := grpc.Dial(key.addr, opts...)
 	if err != nil {
 		return nil, err
-	} else {
-		connection := &conn{
-			GossipClient: pb.NewGossipClient(cc),
-			cc:           cc,
+	}
+
+	c.connectionMutex.Lock()
+	defer c.connectionMutex.Unlock()
+
+	if conn, ok := c.allConnections[key]; ok {
+		if conn.healthy() {
+			cc.Close()
+			conn.acquire()
+			return conn, nil
 		}
-		c.allConnections[addr] = connection
 
-		return connection, nil
+		log.Debug("Redialing unhealthy connection", "addr", key.addr)
+
+		conn.cc.Close()
+		delete(c.allConnections, key)
+	}
+
+	c.evictLru()
+
+	now := time.Now()
+
+	connection := &conn{
+		GossipClient: pb.NewGossipClient(cc),
+		cc:           cc,
+		created:      now,
+		lastUsed:     now,
 	}
+	connection.acquire()
+	c.allConnections[key] = connection
+
+	return connection, nil
 }
 
-func (c *gRPCClient) connection(addr string) (*conn, error) {
-	if conn := c.getConnection(addr); conn != nil {
+// Returns a pooled or newly dialed connection, marked in use.
+func (c *gRPCClient) connection(key connKey) (*conn, error) {
+	if conn := c.acquireConnection(key); conn != nil {
 		return conn, nil
-	} else {
-		return c.dial(addr)
 	}
+
+	return c.dial(key)
+}
+
+// Returns the healthy pooled connection with the given key marked in use, nil if there is none.
+// Marking it under the lock keeps eviction from closing it in between.
+func (c *gRPCClient) acquireConnection(key connKey) *conn {
+	c.connectionMutex.RLock()
+	defer c.connectionMutex.RUnlock()
+
+	conn, ok := c.allConnections[key]
+	if !ok || !conn.healthy() {
+		return nil
+	}
+
+	conn.acquire()
+
+	return conn
 }
 
-func (c *gRPCClient) getConnection(addr string) *conn {
+func (c *gRPCClient) getConnection(key connKey) *conn {
 	c.connectionMutex.RLock()
 	defer c.connectionMutex.RUnlock()
 
-	return c.allConnections[addr]
+	return c.allConnections[key]
+}
+
+// Returns a copy of the tls config additionally requiring the certificate
+// presented by the peer to carry the given id.
+// The chain and revocation checks of the original config are kept.
+func pinnedIdConfig(config *tls.Config, id string) *tls.Config {
+	if id == "" {
+		return config
+	}
+
+	conf := config.Clone()
+	verify := config.VerifyPeerCertificate
+
+	conf.VerifyPeerCertificate = func(rawCerts [][]byte, chains [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errNoPeerCert
+		}
+
+		cert, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return err
+		}
+
+		if string(cert.SubjectKeyId) != id {
+			return errWrongId
+		}
+
+		if verify == nil {
+			return nil
+		}
+
+		return verify(rawCerts, chains)
+	}
+
+	return conf
 }
@@ -1,26 +1,62 @@
 package comm
 
 import (
-	"crypto/ecdsa"
+	"crypto"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
 	"net"
+	"sync"
 
 	pb "github.com/joonnna/ifrit/protobuf"
+	"github.com/joonnna/ifrit/revocation"
+	"google.golang.org/grpc"
 )
 
 var (
-	errNilCert = errors.New("Given certificate was nil")
-	errNilPriv = errors.New("Given private key was nil")
+	errNilCert    = errors.New("Given certificate was nil")
+	errNilPriv    = errors.New("Given private key was nil")
+	errNoPeerCert = errors.New("Peer presented no certificate")
+	errStaleCert  = errors.New("Peer presented a certificate older than the one known for its id")
 )
 
+// Holds the most recent certificate known for each id, e.g. after peers renewed their certificate.
+type CertificateRecord interface {
+	KnownCertificate(id string) *x509.Certificate
+}
+
+// Options extends the grpc server and the connections created by the comm service,
+// e.g. with logging, tracing, authorisation or metrics.
+// Interceptors run in the given order, before the ifrit services.
+// Options are applied before the ones ifrit relies on, so the tls credentials
+// identifying peers can not be replaced. Options disabling transport security are not supported.
+type Options struct {
+	UnaryServerInterceptors  []grpc.UnaryServerInterceptor
+	StreamServerInterceptors []grpc.StreamServerInterceptor
+	UnaryClientInterceptors  []grpc.UnaryClientInterceptor
+	StreamClientInterceptors []grpc.StreamClientInterceptor
+
+	ServerOptions []grpc.ServerOption
+	DialOptions   []grpc.DialOption
+}
+
 type Comm struct {
 	s *gRPCServer
 	*gRPCClient
+
+	revocations     *revocation.List
+	revocationMutex sync.RWMutex
+
+	record      CertificateRecord
+	recordMutex sync.RWMutex
+
+	// Presented in tls handshakes, replaced when the certificate is renewed.
+	tlsCert      *tls.Certificate
+	tlsCertMutex sync.RWMutex
 }
 
-func NewComm(cert, caCert *x509.Certificate, priv *ecdsa.PrivateKey, l net.Listener) (*Comm, error) {
+// Creates a comm service serving on the given listener, opts may be nil.
+func NewComm(cert, caCert *x509.Certificate, priv crypto.Signer, l net.Listener, opts *Options) (*Comm, error) {
 	if cert == nil {
 		return nil, errNilCert
 	}
@@ -29,24 +65,43 @@ func NewComm(cert, caCert *x509.Certificate, priv *ecdsa.PrivateKey, l net.Liste
 		return nil, errNilPriv
 	}
 
-	serverConf := serverConfig(cert, caCert, priv)
+	c := &Comm{
+		tlsCert: &tls.Certificate{
+			Certificate: [][]byte{cert.Raw},
+			PrivateKey:  priv,
+		},
+	}
+
+	serverConf := serverConfig(cert, caCert, priv, c.verifyPeer)
+	serverConf.Certificates = nil
+	serverConf.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return c.certificate(), nil
+	}
 
-	server, err := newServer(serverConf, l)
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	server, err := newServer(serverConf, l, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	clientConf := clientConfig(cert, caCert, priv)
+	clientConf := clientConfig(cert, caCert, priv, c.verifyPeer)
+	clientConf.Certificates = nil
+	clientConf.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		return c.certificate(), nil
+	}
 
-	client, err := newClient(clientConf)
+	client, err := newClient(clientConf, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Comm{
-		s:          server,
-		gRPCClient: client,
-	}, nil
+	c.s = server
+	c.gRPCClient = client
+
+	return c, nil
 }
 
 func (c *Comm) Register(p pb.GossipServer) {
@@ -59,20 +114,136 @@ func (c *Comm) Start() {
 
 func (c *Comm) Stop() {
 	c.s.stop()
+	c.gRPCClient.stop()
 }
 
 func (c *Comm) Addr() string {
 	return c.s.addr()
 }
 
-func serverConfig(c, caCert *x509.Certificate, key *ecdsa.PrivateKey) *tls.Config {
+// Sets the revocation list consulted during tls handshakes,
+// peers presenting a revoked certificate are refused in both directions.
+func (c *Comm) SetRevocationList(l *revocation.List) {
+	c.revocationMutex.Lock()
+	defer c.revocationMutex.Unlock()
+
+	c.revocations = l
+}
+
+// Sets the record of known certificates consulted during tls handshakes,
+// peers presenting a certificate issued before the one known for their id are refused in both directions.
+// Keys replaced by renewing the certificate can hence not be used to impersonate the peer.
+func (c *Comm) SetCertificateRecord(r CertificateRecord) {
+	c.recordMutex.Lock()
+	defer c.recordMutex.Unlock()
+
+	c.record = r
+}
+
+// Replaces the certificate and key presented to peers, e.g. after renewing the certificate.
+// Established connections are closed, so the following calls present the new certificate.
+func (c *Comm) SetCertificate(cert *x509.Certificate, priv crypto.Signer) error {
+	if cert == nil {
+		return errNilCert
+	}
+
+	if priv == nil {
+		return errNilPriv
+	}
+
+	c.tlsCertMutex.Lock()
+	c.tlsCert = &tls.Certificate{
+		Certificate: [][]byte{cert.Raw},
+		PrivateKey:  priv,
+	}
+	c.tlsCertMutex.Unlock()
+
+	c.gRPCClient.closeAll()
+
+	return nil
+}
+
+func (c *Comm) certificate() *tls.Certificate {
+	c.tlsCertMutex.RLock()
+	defer c.tlsCertMutex.RUnlock()
+
+	return c.tlsCert
+}
+
+func (c *Comm) verifyPeer(rawCerts [][]byte, chains [][]*x509.Certificate) error {
+	c.revocationMutex.RLock()
+	l := c.revocations
+	c.revocationMutex.RUnlock()
+
+	if l != nil {
+		if err := l.VerifyPeerCertificate(rawCerts, chains); err != nil {
+			return err
+		}
+	}
+
+	c.recordMutex.RLock()
+	r := c.record
+	c.recordMutex.RUnlock()
+
+	if r == nil {
+		return nil
+	}
+
+	if len(rawCerts) == 0 {
+		return errNoPeerCert
+	}
+
+	cert, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return err
+	}
+
+	if known := r.KnownCertificate(string(cert.SubjectKeyId)); known != nil && cert.NotBefore.Before(known.NotBefore) {
+		return errStaleCert
+	}
+
+	return nil
+}
+
+func (o *Options) serverOptions() []grpc.ServerOption {
+	ret := append([]grpc.ServerOption{}, o.ServerOptions...)
+
+	if len(o.UnaryServerInterceptors) > 0 {
+		ret = append(ret, grpc.ChainUnaryInterceptor(o.UnaryServerInterceptors...))
+	}
+
+	if len(o.StreamServerInterceptors) > 0 {
+		ret = append(ret, grpc.ChainStreamInterceptor(o.StreamServerInterceptors...))
+	}
+
+	return ret
+}
+
+func (o *Options) dialOptions() []grpc.DialOption {
+	ret := append([]grpc.DialOption{}, o.DialOptions...)
+
+	if len(o.UnaryClientInterceptors) > 0 {
+		ret = append(ret, grpc.WithChainUnaryInterceptor(o.UnaryClientInterceptors...))
+	}
+
+	if len(o.StreamClientInterceptors) > 0 {
+		ret = append(ret, grpc.WithChainStreamInterceptor(o.StreamClientInterceptors...))
+	}
+
+	return ret
+}
+
+type verifyFunc func([][]byte, [][]*x509.Certificate) error
+
+func serverConfig(c, caCert *x509.Certificate, key crypto.Signer, verify verifyFunc) *tls.Config {
 	tlsCert := tls.Certificate{
 		Certificate: [][]byte{c.Raw},
 		PrivateKey:  key,
 	}
 
 	conf := &tls.Config{
-		Certificates: []tls.Certificate{tlsCert},
+		Certificates:          []tls.Certificate{tlsCert},
+		VerifyPeerCertificate: verify,
 	}
 
 	if caCert == nil {
@@ -87,23 +258,68 @@ func serverConfig(c, caCert *x509.Certificate, key *ecdsa.PrivateKey) *tls.Confi
 	return conf
 }
 
-func clientConfig(c, caCert *x509.Certificate, key *ecdsa.PrivateKey) *tls.Config {
+func clientConfig(c, caCert *x509.Certificate, key crypto.Signer, verify verifyFunc) *tls.Config {
 	tlsCert := tls.Certificate{
 		Certificate: [][]byte{c.Raw},
 		PrivateKey:  key,
 	}
 
 	conf := &tls.Config{
-		Certificates: []tls.Certificate{tlsCert},
+		Certificates:          []tls.Certificate{tlsCert},
+		VerifyPeerCertificate: verify,
 	}
 
+	// Peers are identified by their certificate and not by the address they are reached at,
+	// which can change over time. The chain is therefore verified without checking the hostname.
+	conf.InsecureSkipVerify = true
+
 	if caCert != nil {
 		pool := x509.NewCertPool()
 		pool.AddCert(caCert)
 		conf.RootCAs = pool
-	} else {
-		conf.InsecureSkipVerify = true
+
+		conf.VerifyPeerCertificate = func(rawCerts [][]byte, chains [][]*x509.Certificate) error {
+			chains, err := verifyChain(rawCerts, pool)
+			if err != nil {
+				return err
+			}
+
+			if verify == nil {
+				return nil
+			}
+
+			return verify(rawCerts, chains)
+		}
 	}
 
 	return conf
 }
+
+func verifyChain(rawCerts [][]byte, roots *x509.CertPool) ([][]*x509.Certificate, error) {
+	if len(rawCerts) == 0 {
+		return nil, errNoPeerCert
+	}
+
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	return certs[0].Verify(opts)
+}
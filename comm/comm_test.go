@@ -1 +1,449 @@
 package comm
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joonnna/ifrit/keys"
+	pb "github.com/joonnna/ifrit/protobuf"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type CommTestSuite struct {
+	suite.Suite
+
+	caCert *x509.Certificate
+	caPriv crypto.Signer
+}
+
+func TestCommTestSuite(t *testing.T) {
+	suite.Run(t, new(CommTestSuite))
+}
+
+func (suite *CommTestSuite) SetupTest() {
+	caCert, caPriv := genTestCa(suite.T())
+
+	suite.caCert = caCert
+	suite.caPriv = caPriv
+}
+
+func (suite *CommTestSuite) TestClientVerification() {
+	serverCert, serverPriv := genTestCert(suite.T(), suite.caCert, suite.caPriv, 2)
+	clientCert, clientPriv := genTestCert(suite.T(), suite.caCert, suite.caPriv, 3)
+
+	otherCa, otherPriv := genTestCa(suite.T())
+	foreignCert, foreignPriv := genTestCert(suite.T(), otherCa, otherPriv, 4)
+
+	clientConf := clientConfig(clientCert, suite.caCert, clientPriv, nil)
+
+	// Peers are reached through addresses not present in their certificate.
+	clientConf.ServerName = "moved.example.com"
+
+	err := handshake(serverConfig(serverCert, suite.caCert, serverPriv, nil), clientConf)
+	require.NoError(suite.T(), err, "Handshake failed on hostname mismatch.")
+
+	err = handshake(serverConfig(foreignCert, otherCa, foreignPriv, nil), clientConf)
+	require.Error(suite.T(), err, "Certificate from another CA accepted.")
+}
+
+func (suite *CommTestSuite) TestMixedKeyAlgorithms() {
+	ecdsaCert, ecdsaPriv := genTestCert(suite.T(), suite.caCert, suite.caPriv, 2)
+
+	viper.Set("key_algorithm", keys.Ed25519)
+	defer viper.Set("key_algorithm", keys.ECDSA)
+
+	edCert, edPriv := genTestCert(suite.T(), suite.caCert, suite.caPriv, 3)
+
+	_, ok := edCert.PublicKey.(ed25519.PublicKey)
+	require.True(suite.T(), ok, "Certificate does not carry an ed25519 key.")
+
+	err := handshake(serverConfig(edCert, suite.caCert, edPriv, nil), clientConfig(ecdsaCert, suite.caCert, ecdsaPriv, nil))
+	require.NoError(suite.T(), err, "Handshake with ed25519 server failed.")
+
+	err = handshake(serverConfig(ecdsaCert, suite.caCert, ecdsaPriv, nil), clientConfig(edCert, suite.caCert, edPriv, nil))
+	require.NoError(suite.T(), err, "Handshake with ed25519 client failed.")
+}
+
+func (suite *CommTestSuite) TestIpv6Network() {
+	var comms []*Comm
+
+	for i := 0; i < 3; i++ {
+		l, err := net.Listen("tcp", "[::1]:0")
+		if err != nil {
+			suite.T().Skip("Ipv6 loopback unavailable: ", err)
+		}
+
+		addr := l.Addr().String()
+
+		cert, priv := genAddrCert(suite.T(), suite.caCert, suite.caPriv, int64(i+2), addr, "[::1]:0")
+		require.Equal(suite.T(), "::1", cert.IPAddresses[0].String(), "Certificate lacks ipv6 address.")
+
+		c, err := NewComm(cert, suite.caCert, priv, l, nil)
+		require.NoError(suite.T(), err, "Failed to create comm.")
+		require.Equal(suite.T(), addr, c.Addr(), "Wrong listen address.")
+
+		c.Register(&gossipStub{})
+		go c.Start()
+		defer c.Stop()
+
+		comms = append(comms, c)
+	}
+
+	for _, src := range comms {
+		for _, dst := range comms {
+			if src == dst {
+				continue
+			}
+
+			_, err := src.Gossip(dst.Addr(), "", &pb.State{})
+			require.NoErrorf(suite.T(), err, "Gossip from %s to %s failed.", src.Addr(), dst.Addr())
+		}
+	}
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv6loopback})
+	require.NoError(suite.T(), err, "Failed to listen on ipv6 udp.")
+
+	us, err := NewUdpServer(&signerStub{}, conn)
+	require.NoError(suite.T(), err, "Failed to create udp server.")
+
+	go us.Start()
+	defer us.Stop()
+
+	pong, err := us.Ping(conn.LocalAddr().String(), &pb.Ping{Nonce: []byte("nonce")})
+	require.NoError(suite.T(), err, "Ping over ipv6 failed.")
+	require.Equal(suite.T(), []byte("r"), pong.GetSignature().GetR(), "Wrong pong signature.")
+	require.Equal(suite.T(), pb.SignatureAlgorithm_ED25519, pong.GetSignature().GetAlgorithm(), "Wrong pong algorithm.")
+}
+
+func (suite *CommTestSuite) TestGossipRetries() {
+	srv := &flakyStub{failures: 2}
+	client, addr := suite.startComm(srv, nil)
+
+	client.gossipRetries = 1
+
+	_, err := client.Gossip(addr, "", &pb.State{})
+	require.Error(suite.T(), err, "Gossip succeeded without enough retries.")
+	require.Equal(suite.T(), 2, srv.getCalls(), "Wrong number of attempts.")
+
+	client.gossipRetries = 2
+	srv.reset(2)
+
+	_, err = client.Gossip(addr, "", &pb.State{})
+	require.NoError(suite.T(), err, "Gossip failed despite retries.")
+	require.Equal(suite.T(), 3, srv.getCalls(), "Wrong number of attempts.")
+
+	srv.reset(2)
+
+	_, err = client.Send(addr, "", &pb.Msg{})
+	require.Error(suite.T(), err, "Message retried.")
+	require.Equal(suite.T(), 1, srv.getCalls(), "Message retried.")
+}
+
+func (suite *CommTestSuite) TestDeadlines() {
+	srv := &flakyStub{delay: time.Millisecond * 500}
+	client, addr := suite.startComm(srv, nil)
+
+	client.gossipTimeout = time.Millisecond * 50
+	client.messageTimeout = time.Millisecond * 50
+	client.rebuttalTimeout = time.Millisecond * 50
+
+	start := time.Now()
+
+	_, err := client.Gossip(addr, "", &pb.State{})
+	require.Equal(suite.T(), codes.DeadlineExceeded, status.Code(err), "Gossip deadline not enforced.")
+
+	_, err = client.Rebuttal(addr, "", &pb.State{})
+	require.Equal(suite.T(), codes.DeadlineExceeded, status.Code(err), "Rebuttal deadline not enforced.")
+
+	_, err = client.Send(addr, "", &pb.Msg{})
+	require.Equal(suite.T(), codes.DeadlineExceeded, status.Code(err), "Message deadline not enforced.")
+
+	require.True(suite.T(), time.Since(start) < time.Millisecond*500, "Calls waited for the slow peer.")
+
+	client.gossipTimeout = 0
+
+	_, err = client.Gossip(addr, "", &pb.State{})
+	require.NoError(suite.T(), err, "Gossip without deadline failed.")
+}
+
+func (suite *CommTestSuite) TestPinnedId() {
+	client, addr := suite.startComm(&gossipStub{}, nil)
+
+	// The server certificate carries the id of serial 2, the client one of serial 3.
+	serverId, clientId := string(big.NewInt(2).Bytes()), string(big.NewInt(3).Bytes())
+
+	_, err := client.Gossip(addr, serverId, &pb.State{})
+	require.NoError(suite.T(), err, "Gossip to peer with expected id failed.")
+
+	_, err = client.Gossip(addr, clientId, &pb.State{})
+	require.Error(suite.T(), err, "Peer with other id accepted.")
+
+	_, err = client.Gossip(addr, "", &pb.State{})
+	require.NoError(suite.T(), err, "Gossip without expected id failed.")
+
+	stats := client.ConnStats()
+	require.Len(suite.T(), stats, 3, "Connections not keyed by id.")
+	require.Equal(suite.T(), "", stats[0].Id, "Wrong connection id.")
+	require.Equal(suite.T(), serverId, stats[1].Id, "Wrong connection id.")
+	require.Equal(suite.T(), clientId, stats[2].Id, "Wrong connection id.")
+
+	client.CloseConn(addr)
+	require.Empty(suite.T(), client.ConnStats(), "Connections not closed.")
+}
+
+func (suite *CommTestSuite) TestOptions() {
+	var calls []string
+	var mutex sync.Mutex
+
+	record := func(name string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		calls = append(calls, name)
+	}
+
+	opts := &Options{
+		UnaryServerInterceptors: []grpc.UnaryServerInterceptor{
+			func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, h grpc.UnaryHandler) (interface{}, error) {
+				// The ifrit services identify peers through the tls info.
+				if p, ok := peer.FromContext(ctx); !ok {
+					record("noPeer")
+				} else if _, ok := p.AuthInfo.(credentials.TLSInfo); !ok {
+					record("noTls")
+				}
+
+				record("unaryServer")
+				return h(ctx, req)
+			},
+		},
+		StreamServerInterceptors: []grpc.StreamServerInterceptor{
+			func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, h grpc.StreamHandler) error {
+				record("streamServer")
+				return h(srv, ss)
+			},
+		},
+		UnaryClientInterceptors: []grpc.UnaryClientInterceptor{
+			func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+				record("unaryClient")
+				return invoker(ctx, method, req, reply, cc, opts...)
+			},
+		},
+		StreamClientInterceptors: []grpc.StreamClientInterceptor{
+			func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+				record("streamClient")
+				return streamer(ctx, desc, cc, method, opts...)
+			},
+		},
+		// A single interceptor set through an option is combined with the chained ones.
+		ServerOptions: []grpc.ServerOption{
+			grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, h grpc.UnaryHandler) (interface{}, error) {
+				record("serverOption")
+				return h(ctx, req)
+			}),
+		},
+		DialOptions: []grpc.DialOption{grpc.WithUserAgent("test")},
+	}
+
+	client, addr := suite.startComm(&gossipStub{}, opts)
+
+	_, err := client.Gossip(addr, "", &pb.State{})
+	require.NoError(suite.T(), err, "Gossip failed with user options.")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, err := client.DialStream(ctx, addr, "")
+	require.NoError(suite.T(), err, "Failed to open stream.")
+
+	_, err = s.Recv()
+	require.Equal(suite.T(), codes.Unimplemented, status.Code(err), "Stream not served.")
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	require.Equal(suite.T(), []string{"unaryClient", "serverOption", "unaryServer", "streamClient", "streamServer"},
+		calls, "Interceptors not invoked in order.")
+}
+
+// Starts a comm instance serving srv, and returns another comm instance
+// acting as client along with the address of the server.
+func (suite *CommTestSuite) startComm(srv pb.GossipServer, opts *Options) (*Comm, string) {
+	var comms []*Comm
+
+	for i := 0; i < 2; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(suite.T(), err, "Failed to listen.")
+
+		cert, priv := genAddrCert(suite.T(), suite.caCert, suite.caPriv, int64(i+2), l.Addr().String(), "127.0.0.1:0")
+
+		c, err := NewComm(cert, suite.caCert, priv, l, opts)
+		require.NoError(suite.T(), err, "Failed to create comm.")
+
+		comms = append(comms, c)
+	}
+
+	comms[0].Register(srv)
+	go comms[0].Start()
+
+	suite.T().Cleanup(func() {
+		comms[0].Stop()
+		comms[1].Stop()
+	})
+
+	return comms[1], comms[0].Addr()
+}
+
+// Fails the first calls as unavailable, and delays all calls.
+type flakyStub struct {
+	pb.UnimplementedGossipServer
+
+	failures int
+	delay    time.Duration
+	calls    int
+	mutex    sync.Mutex
+}
+
+func (fs *flakyStub) call() error {
+	fs.mutex.Lock()
+	fs.calls++
+	fail := fs.calls <= fs.failures
+	fs.mutex.Unlock()
+
+	time.Sleep(fs.delay)
+
+	if fail {
+		return status.Error(codes.Unavailable, "flaky")
+	}
+
+	return nil
+}
+
+func (fs *flakyStub) getCalls() int {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	return fs.calls
+}
+
+func (fs *flakyStub) reset(failures int) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	fs.calls = 0
+	fs.failures = failures
+}
+
+func (fs *flakyStub) Spread(ctx context.Context, s *pb.State) (*pb.StateResponse, error) {
+	if err := fs.call(); err != nil {
+		return nil, err
+	}
+
+	return &pb.StateResponse{}, nil
+}
+
+func (fs *flakyStub) Messenger(ctx context.Context, m *pb.Msg) (*pb.MsgResponse, error) {
+	if err := fs.call(); err != nil {
+		return nil, err
+	}
+
+	return &pb.MsgResponse{}, nil
+}
+
+type gossipStub struct {
+	pb.UnimplementedGossipServer
+}
+
+func (gs *gossipStub) Spread(ctx context.Context, s *pb.State) (*pb.StateResponse, error) {
+	return &pb.StateResponse{}, nil
+}
+
+type signerStub struct{}
+
+func (ss *signerStub) Sign(data []byte) ([]byte, []byte, error) {
+	return []byte("r"), []byte("s"), nil
+}
+
+func (ss *signerStub) Certificate() *x509.Certificate {
+	return &x509.Certificate{PublicKey: make(ed25519.PublicKey, ed25519.PublicKeySize)}
+}
+
+func handshake(serverConf, clientConf *tls.Config) error {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	go tls.Server(c1, serverConf).Handshake()
+
+	return tls.Client(c2, clientConf).Handshake()
+}
+
+func genTestCa(t testing.TB) (*x509.Certificate, crypto.Signer) {
+	priv, err := genKeys()
+	require.NoError(t, err, "Failed to generate keys.")
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"ifrit"}},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+
+	raw, err := x509.CreateCertificate(rand.Reader, template, template, priv.Public(), priv)
+	require.NoError(t, err, "Failed to create certificate.")
+
+	cert, err := x509.ParseCertificate(raw)
+	require.NoError(t, err, "Failed to parse certificate.")
+
+	return cert, priv
+}
+
+func genTestCert(t testing.TB, caCert *x509.Certificate, caPriv crypto.Signer, serial int64) (*x509.Certificate, crypto.Signer) {
+	return genAddrCert(t, caCert, caPriv, serial, "127.0.0.1:8000", "127.0.0.1:8001")
+}
+
+func genAddrCert(t testing.TB, caCert *x509.Certificate, caPriv crypto.Signer, serial int64, rpcAddr, pingAddr string) (*x509.Certificate, crypto.Signer) {
+	priv, err := genKeys()
+	require.NoError(t, err, "Failed to generate keys.")
+
+	host, _, err := net.SplitHostPort(rpcAddr)
+	require.NoError(t, err, "Invalid address.")
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		SubjectKeyId: big.NewInt(serial).Bytes(),
+		Subject:      pkix.Name{Locality: []string{rpcAddr, pingAddr}},
+		IPAddresses:  []net.IP{net.ParseIP(host)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+
+	raw, err := x509.CreateCertificate(rand.Reader, template, caCert, priv.Public(), caPriv)
+	require.NoError(t, err, "Failed to create certificate.")
+
+	cert, err := x509.ParseCertificate(raw)
+	require.NoError(t, err, "Failed to parse certificate.")
+
+	return cert, priv
+}
@@ -0,0 +1,178 @@
+package comm
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	codecNone   = "none"
+	codecSnappy = "snappy"
+	codecZstd   = "zstd"
+
+	// Upper bound of a decompressed zstd message.
+	maxDecompressed = 64 << 20
+)
+
+var (
+	errUnknownCodec = errors.New("Unknown compression codec, has to be one of none, gzip, snappy or zstd")
+)
+
+func init() {
+	encoding.RegisterCompressor(&snappyCompressor{})
+	encoding.RegisterCompressor(newZstdCompressor())
+}
+
+// Validates the codec name, the empty name disables compression.
+func validCodec(name string) error {
+	switch name {
+	case "", codecNone, gzip.Name, codecSnappy, codecZstd:
+		return nil
+	default:
+		return errUnknownCodec
+	}
+}
+
+// Returns the codec to use for a payload of the given size sent over the connection,
+// or an empty string if the payload should be sent uncompressed.
+// Payloads below the threshold are never compressed, nor are payloads
+// to peers that previously rejected the codec.
+func (c *gRPCClient) codec(cn *conn, name string, size int) string {
+	if name == "" || name == codecNone || size < c.compressThreshold || cn.rejectedCodec(name) {
+		return ""
+	}
+
+	return name
+}
+
+// Performs the call with the given codec, peers not supporting the codec reject the call
+// as unimplemented, in which case the call is repeated uncompressed.
+// The codec is never used towards the peer again, until the connection is replaced.
+func (cn *conn) compressedCall(codec string, call func(...grpc.CallOption) error) error {
+	if codec == "" {
+		return call()
+	}
+
+	err := call(grpc.UseCompressor(codec))
+	if status.Code(err) != codes.Unimplemented {
+		return err
+	}
+
+	cn.rejectCodec(codec)
+
+	return call()
+}
+
+func (cn *conn) rejectCodec(name string) {
+	cn.codecMutex.Lock()
+	defer cn.codecMutex.Unlock()
+
+	if cn.rejected == nil {
+		cn.rejected = make(map[string]bool)
+	}
+
+	cn.rejected[name] = true
+}
+
+func (cn *conn) rejectedCodec(name string) bool {
+	cn.codecMutex.RLock()
+	defer cn.codecMutex.RUnlock()
+
+	return cn.rejected[name]
+}
+
+type snappyCompressor struct{}
+
+func (s *snappyCompressor) Name() string {
+	return codecSnappy
+}
+
+func (s *snappyCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return snappy.NewBufferedWriter(w), nil
+}
+
+func (s *snappyCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	return snappy.NewReader(r), nil
+}
+
+// Zstd encoders are expensive to create, they are pooled and reset for each message.
+// Messages are decoded whole by a shared decoder, as streaming decoders
+// keep running until closed, which grpc never does.
+type zstdCompressor struct {
+	encoders sync.Pool
+	decoder  *zstd.Decoder
+}
+
+type zstdWriter struct {
+	*zstd.Encoder
+	pool *sync.Pool
+}
+
+func newZstdCompressor() *zstdCompressor {
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxDecompressed))
+	if err != nil {
+		panic(err)
+	}
+
+	z := &zstdCompressor{
+		decoder: dec,
+	}
+
+	z.encoders.New = func() interface{} {
+		enc, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil
+		}
+		return enc
+	}
+
+	return z
+}
+
+func (z *zstdCompressor) Name() string {
+	return codecZstd
+}
+
+func (z *zstdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	enc, ok := z.encoders.Get().(*zstd.Encoder)
+	if !ok {
+		return nil, errUnknownCodec
+	}
+
+	enc.Reset(w)
+
+	return &zstdWriter{Encoder: enc, pool: &z.encoders}, nil
+}
+
+func (z *zstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := z.decoder.DecodeAll(data, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(out), nil
+}
+
+// Flushes the message and returns the encoder to the pool.
+func (zw *zstdWriter) Close() error {
+	err := zw.Encoder.Close()
+	zw.pool.Put(zw.Encoder)
+
+	return err
+}
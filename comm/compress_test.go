@@ -0,0 +1,199 @@
+package comm
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	pb "github.com/joonnna/ifrit/protobuf"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+var codecs = []string{gzip.Name, codecSnappy, codecZstd}
+
+func (suite *CommTestSuite) TestCompression() {
+	client, addr := suite.startComm(&gossipStub{}, nil)
+
+	// Records the codec of outgoing calls, the connection is dialed after adding it.
+	h := &codecStats{}
+	client.dialOptions = append(client.dialOptions, grpc.WithStatsHandler(h))
+
+	client.compressThreshold = 64
+
+	small := &pb.State{ExternalGossip: []byte("small")}
+	large := &pb.State{ExternalGossip: bytes.Repeat([]byte("large"), 64)}
+
+	for _, codec := range codecs {
+		client.gossipCodec = codec
+
+		_, err := client.Gossip(addr, "", large)
+		require.NoErrorf(suite.T(), err, "Gossip compressed with %s failed.", codec)
+		require.Equal(suite.T(), codec, h.last, "Large payload not compressed.")
+
+		_, err = client.Gossip(addr, "", small)
+		require.NoErrorf(suite.T(), err, "Gossip with %s failed.", codec)
+		require.Empty(suite.T(), h.last, "Payload below threshold compressed.")
+	}
+
+	client.gossipCodec = codecNone
+
+	_, err := client.Gossip(addr, "", large)
+	require.NoError(suite.T(), err, "Uncompressed gossip failed.")
+	require.Empty(suite.T(), h.last, "Payload compressed with compression disabled.")
+}
+
+func (suite *CommTestSuite) TestCodecFallback() {
+	cn := &conn{}
+
+	var used []string
+
+	call := func(opts ...grpc.CallOption) error {
+		if len(opts) > 0 {
+			used = append(used, codecZstd)
+			return status.Error(codes.Unimplemented, "Decompressor is not installed")
+		}
+
+		used = append(used, "")
+		return nil
+	}
+
+	c := &gRPCClient{}
+
+	require.NoError(suite.T(), cn.compressedCall(c.codec(cn, codecZstd, 0), call), "Fallback call failed.")
+	require.Equal(suite.T(), []string{codecZstd, ""}, used, "Call not repeated uncompressed.")
+
+	require.Empty(suite.T(), c.codec(cn, codecZstd, 0), "Rejected codec used again.")
+	require.Equal(suite.T(), gzip.Name, c.codec(cn, gzip.Name, 0), "Other codec not used.")
+
+	require.Error(suite.T(), validCodec("lz4"), "Unknown codec accepted.")
+}
+
+// Compares the bytes sent and the cpu spent compressing and decompressing
+// a gossip round, the state of a node and the response carrying the state of 64 peers.
+func BenchmarkGossipRound(b *testing.B) {
+	state, resp := gossipRound(b, 64)
+
+	raw := make([][]byte, 0, 2)
+	for _, m := range []proto.Message{state, resp} {
+		data, err := proto.Marshal(m)
+		require.NoError(b, err, "Failed to marshal.")
+		raw = append(raw, data)
+	}
+
+	for _, codec := range append([]string{codecNone}, codecs...) {
+		b.Run(codec, func(b *testing.B) {
+			var size int
+
+			for i := 0; i < b.N; i++ {
+				size = 0
+
+				for _, data := range raw {
+					out := compress(b, codec, data)
+					size += len(out)
+
+					require.Equal(b, data, decompress(b, codec, out), "Corrupted round trip.")
+				}
+			}
+
+			b.ReportMetric(float64(size), "bytes/round")
+		})
+	}
+}
+
+func gossipRound(b *testing.B, peers int) (*pb.State, *pb.StateResponse) {
+	caCert, caPriv := genTestCa(b)
+
+	state := &pb.State{
+		ExistingHosts: make(map[string]uint64),
+	}
+
+	resp := &pb.StateResponse{}
+
+	for i := 0; i < peers; i++ {
+		cert, _ := genAddrCert(b, caCert, caPriv, int64(i+2), fmt.Sprintf("10.0.0.%d:8000", i), "10.0.0.1:8001")
+
+		state.ExistingHosts[string(cert.SubjectKeyId)] = uint64(i)
+
+		resp.Certificates = append(resp.Certificates, &pb.Certificate{Raw: cert.Raw})
+		resp.Notes = append(resp.Notes, &pb.Note{
+			Epoch:     uint64(i),
+			Id:        cert.SubjectKeyId,
+			Mask:      ^uint32(0),
+			Signature: &pb.Signature{R: randomBytes(b, 32), S: randomBytes(b, 32)},
+		})
+	}
+
+	return state, resp
+}
+
+func compress(b *testing.B, codec string, data []byte) []byte {
+	if codec == codecNone {
+		return data
+	}
+
+	var buf bytes.Buffer
+
+	w, err := encoding.GetCompressor(codec).Compress(&buf)
+	require.NoError(b, err, "Failed to create compressor.")
+
+	_, err = w.Write(data)
+	require.NoError(b, err, "Failed to compress.")
+	require.NoError(b, w.Close(), "Failed to flush.")
+
+	return buf.Bytes()
+}
+
+func decompress(b *testing.B, codec string, data []byte) []byte {
+	if codec == codecNone {
+		return data
+	}
+
+	r, err := encoding.GetCompressor(codec).Decompress(bytes.NewReader(data))
+	require.NoError(b, err, "Failed to create decompressor.")
+
+	out, err := ioutil.ReadAll(r)
+	require.NoError(b, err, "Failed to decompress.")
+
+	return out
+}
+
+func randomBytes(b *testing.B, n int) []byte {
+	ret := make([]byte, n)
+
+	_, err := rand.Read(ret)
+	require.NoError(b, err, "Failed to generate bytes.")
+
+	return ret
+}
+
+// Records the codec of the last outgoing call.
+type codecStats struct {
+	last string
+}
+
+func (cs *codecStats) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (cs *codecStats) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	if h, ok := s.(*stats.OutHeader); ok {
+		cs.last = h.Compression
+	}
+}
+
+func (cs *codecStats) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (cs *codecStats) HandleConn(ctx context.Context, s stats.ConnStats) {
+}
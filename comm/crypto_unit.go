@@ -2,10 +2,8 @@ package comm
 
 import (
 	"bytes"
-	"crypto/ecdsa"
-	"crypto/elliptic"
+	"crypto"
 	"crypto/rand"
-	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
@@ -21,10 +19,12 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
+	"sync"
 	"time"
 
 	log "github.com/inconshreveable/log15"
+	"github.com/joonnna/ifrit/keys"
+	"github.com/spf13/viper"
 )
 
 var (
@@ -35,18 +35,30 @@ var (
 	errPemDecode   = errors.New("Unable to decode content in given file")
 	errInvlKeyPath = errors.New("Storage path-argument is invalid")
 	errNoCa        = errors.New("No address for Certificate Authority")
+	errKeyType     = errors.New("Private key is neither an ecdsa nor an ed25519 key")
 )
 
 type CryptoUnit struct {
-	priv   *ecdsa.PrivateKey
 	pk     pkix.Name
 	caAddr string
 
-	self       *x509.Certificate
+	// Replaced together when the certificate is renewed.
+	priv     crypto.Signer
+	self     *x509.Certificate
+	keyMutex sync.RWMutex
+
 	ca         *x509.Certificate
 	numRings   uint32
 	knownCerts []*x509.Certificate
 	trusted    bool
+
+	// Directory holding the stored identity, where the local note is persisted.
+	storePath  string
+	storeMutex sync.RWMutex
+
+	// Epoch of the most recently stored note, older notes are not stored over it.
+	savedEpoch uint64
+	noteMutex  sync.Mutex
 }
 
 type certResponse struct {
@@ -71,12 +83,12 @@ func NewCu(identity pkix.Name, caAddr string, dnsLabel string) (*CryptoUnit, err
 		return nil, errNoAddrs
 	}
 
-	serviceAddr := strings.Split(identity.Locality[0], ":")
-	if len(serviceAddr) <= 0 {
+	host, _, err := net.SplitHostPort(identity.Locality[0])
+	if err != nil || host == "" {
 		return nil, errNoHostIp
 	}
 
-	serviceIP, err := net.LookupIP(serviceAddr[0])
+	serviceIP, err := net.LookupIP(host)
 	if err != nil {
 		return nil, err
 	}
@@ -168,6 +180,7 @@ func LoadCu(certPath string, identity pkix.Name, caAddr string) (*CryptoUnit, er
 		priv:       priv,
 		knownCerts: certs.knownCerts,
 		trusted:    certs.trusted,
+		storePath:  certPath,
 	}, nil
 }
 
@@ -180,8 +193,7 @@ func NewStaticCu(identity pkix.Name, caAddr string, dnsLabel string) (*CryptoUni
 		return nil, errNoAddrs
 	}
 
-	serviceAddr := strings.Split(identity.Locality[0], ":")
-	if len(serviceAddr) <= 0 {
+	if host, _, err := net.SplitHostPort(identity.Locality[0]); err != nil || host == "" {
 		return nil, errNoHostIp
 	}
 
@@ -230,6 +242,9 @@ func (cu *CryptoUnit) Trusted() bool {
 }
 
 func (cu *CryptoUnit) Certificate() *x509.Certificate {
+	cu.keyMutex.RLock()
+	defer cu.keyMutex.RUnlock()
+
 	return cu.self
 }
 
@@ -241,7 +256,10 @@ func (cu *CryptoUnit) NumRings() uint32 {
 	return cu.numRings
 }
 
-func (cu *CryptoUnit) Priv() *ecdsa.PrivateKey {
+func (cu *CryptoUnit) Priv() crypto.Signer {
+	cu.keyMutex.RLock()
+	defer cu.keyMutex.RUnlock()
+
 	return cu.priv
 }
 
@@ -255,39 +273,49 @@ func (cu *CryptoUnit) ContactList() []*x509.Certificate {
 	return ret
 }
 
-func (cu *CryptoUnit) Verify(data, r, s []byte, pub *ecdsa.PublicKey) bool {
-	if pub == nil {
-		log.Error("Peer had no publicKey")
-		return false
+// Fetches the DER encoded revocation list from the CA.
+func (cu *CryptoUnit) FetchRevocationList() ([]byte, error) {
+	if cu.caAddr == "" {
+		return nil, errNoCa
 	}
 
-	var rInt, sInt big.Int
-
-	b := hashContent(data)
+	resp, err := http.Get(fmt.Sprintf("http://%s/revocationList", cu.caAddr))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 
-	rInt.SetBytes(r)
-	sInt.SetBytes(s)
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("CA responded with status: %s", resp.Status))
+	}
 
-	return ecdsa.Verify(pub, b, &rInt, &sInt)
+	return ioutil.ReadAll(resp.Body)
 }
 
-func (cu *CryptoUnit) Sign(data []byte) ([]byte, []byte, error) {
-	hash := hashContent(data)
-
-	r, s, err := ecdsa.Sign(rand.Reader, cu.priv, hash)
-	if err != nil {
-		return nil, nil, err
+// Verifies the signature with the given ecdsa or ed25519 public key.
+func (cu *CryptoUnit) Verify(data, r, s []byte, pub crypto.PublicKey) bool {
+	if pub == nil {
+		log.Error("Peer had no publicKey")
+		return false
 	}
 
-	return r.Bytes(), s.Bytes(), nil
+	return keys.Verify(pub, data, r, s)
+}
+
+// Signs the data with our private key, ed25519 signatures are split into r and s.
+func (cu *CryptoUnit) Sign(data []byte) ([]byte, []byte, error) {
+	return keys.Sign(cu.Priv(), data)
 }
 
 /* Save private key for node crypto-unit to new file in argument directory-path.
  * - marius
  */
 func (cu *CryptoUnit) SavePrivateKey(path string) error {
+	cu.keyMutex.RLock()
+	priv, self := cu.priv, cu.self
+	cu.keyMutex.RUnlock()
 
-	path = filepath.Join(path, fmt.Sprintf("certificate-%s", cu.self.SerialNumber))
+	path = filepath.Join(path, fmt.Sprintf("certificate-%s", self.SerialNumber))
 
 	err := os.MkdirAll(path, fs.ModePerm)
 	if err != nil {
@@ -296,37 +324,30 @@ func (cu *CryptoUnit) SavePrivateKey(path string) error {
 
 	path = filepath.Join(path, "key.pem")
 
-	f, err := os.Create(path)
+	passphrase, err := keyPassphrase()
 	if err != nil {
 		return err
 	}
 
-	keyBytes, err := x509.MarshalECPrivateKey(cu.priv)
+	err = keys.WritePrivateKey(path, priv, passphrase)
 	if err != nil {
 		return err
 	}
 
-	block := &pem.Block{
-		Type:  "EC PRIVATE KEY",
-		Bytes: keyBytes,
-	}
-
-	err = pem.Encode(f, block)
-	if err != nil {
-		return err
-	}
+	log.Info("private-key stored", "path", path, "encrypted", len(passphrase) > 0)
 
-	log.Info("private-key stored", "path", path)
+	cu.setStorePath(filepath.Dir(path))
 
-	return f.Close()
+	return nil
 }
 
 /* Save network-neighbours, ca, and own certificate in new files inside argument path.
  * - marius
  */
 func (cu *CryptoUnit) SaveCertificate(path string) error {
+	self := cu.Certificate()
 
-	path = filepath.Join(path, fmt.Sprintf("certificate-%s", cu.self.SerialNumber))
+	path = filepath.Join(path, fmt.Sprintf("certificate-%s", self.SerialNumber))
 
 	err := os.MkdirAll(path, fs.ModePerm)
 	if err != nil {
@@ -362,15 +383,17 @@ func (cu *CryptoUnit) SaveCertificate(path string) error {
 	/*
 	 * Self.
 	 */
-	fname = filepath.Join(path, fmt.Sprintf("self-%s.pem", cu.self.SerialNumber))
+	fname = filepath.Join(path, fmt.Sprintf("self-%s.pem", self.SerialNumber))
 
-	err = saveCert(cu.self, fname)
+	err = saveCert(self, fname)
 	if err != nil {
 		log.Error(err.Error())
 	}
 
 	log.Info("own-certificate stored", "path", fname)
 
+	cu.setStorePath(path)
+
 	return nil
 }
 
@@ -488,41 +511,68 @@ func loadCert(path string) (*x509.Certificate, error) {
 	return cert, nil
 }
 
-func loadPrivKey(certPath string) (*ecdsa.PrivateKey, error) {
+// Loads the private key stored in the given directory. Keys stored in clear text
+// are encrypted in place when a passphrase is configured, migrating existing identities.
+func loadPrivKey(certPath string) (crypto.Signer, error) {
 	if certPath == "" {
 		return nil, errInvlPath
 	}
 
 	path := filepath.Join(certPath, "key.pem")
 
-	keyPem, err := ioutil.ReadFile(path)
+	passphrase, err := keyPassphrase()
 	if err != nil {
 		return nil, err
 	}
 
-	keyBlock, _ := pem.Decode(keyPem)
-	if keyBlock == nil {
-		return nil, errPemDecode
-	}
-
-	privKey, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	privKey, encrypted, err := keys.ReadPrivateKey(path, passphrase)
 	if err != nil {
 		return nil, err
 	}
 
-	log.Info("private-key loaded", "path", path)
+	if !keys.Supported(privKey.Public()) {
+		return nil, errKeyType
+	}
+
+	log.Info("private-key loaded", "path", path, "encrypted", encrypted)
+
+	if !encrypted && len(passphrase) > 0 {
+		if err := keys.WritePrivateKey(path, privKey, passphrase); err != nil {
+			return nil, err
+		}
+
+		log.Info("private-key encrypted", "path", path)
+	}
 
 	return privKey, nil
 }
 
-func sendCertRequest(privKey *ecdsa.PrivateKey, caAddr string, pk pkix.Name, dnsLabel string) (*certSet, error) {
+// Returns the configured passphrase protecting the stored private key,
+// empty if the key is stored in clear text.
+func keyPassphrase() ([]byte, error) {
+	return keys.ReadPassphrase(viper.GetString("key_passphrase"), viper.GetString("key_passphrase_file"))
+}
+
+func sendCertRequest(privKey crypto.Signer, caAddr string, pk pkix.Name, dnsLabel string) (*certSet, error) {
 	var certs certResponse
 	set := &certSet{}
 
 	template := x509.CertificateRequest{
-		SignatureAlgorithm: x509.ECDSAWithSHA256,
+		SignatureAlgorithm: keys.X509Algorithm(privKey),
 		Subject:            pk,
-		DNSNames:           []string{dnsLabel},
+	}
+
+	// Ip literals (both ipv4 and ipv6) are not valid dns names.
+	if ip := net.ParseIP(dnsLabel); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{dnsLabel}
+	}
+
+	if host, _, err := net.SplitHostPort(pk.Locality[0]); err == nil {
+		if ip := net.ParseIP(host); ip != nil && !containsIP(template.IPAddresses, ip) {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		}
 	}
 
 	certReqBytes, err := x509.CreateCertificateRequest(rand.Reader, &template, privKey)
@@ -564,7 +614,7 @@ func sendCertRequest(privKey *ecdsa.PrivateKey, caAddr string, pk pkix.Name, dns
 	return set, nil
 }
 
-func selfSignedCert(priv *ecdsa.PrivateKey, pk pkix.Name) (*certSet, error) {
+func selfSignedCert(priv crypto.Signer, pk pkix.Name) (*certSet, error) {
 	ringBytes := make([]byte, 4)
 	binary.LittleEndian.PutUint32(ringBytes[0:], uint32(32))
 
@@ -579,12 +629,12 @@ func selfSignedCert(priv *ecdsa.PrivateKey, pk pkix.Name) (*certSet, error) {
 		return nil, err
 	}
 
-	serviceAddr := strings.Split(pk.Locality[0], ":")
-	if len(serviceAddr) <= 0 {
+	host, _, err := net.SplitHostPort(pk.Locality[0])
+	if err != nil {
 		return nil, errNoHostIp
 	}
 
-	ip := net.ParseIP(serviceAddr[0])
+	ip := net.ParseIP(host)
 	if ip == nil {
 		return nil, errNoHostIp
 	}
@@ -598,7 +648,7 @@ func selfSignedCert(priv *ecdsa.PrivateKey, pk pkix.Name) (*certSet, error) {
 		NotBefore:             time.Now().AddDate(-10, 0, 0),
 		NotAfter:              time.Now().AddDate(10, 0, 0),
 		ExtraExtensions:       []pkix.Extension{ext},
-		PublicKey:             priv.PublicKey,
+		PublicKey:             priv.Public(),
 		IPAddresses:           []net.IP{ip},
 		IsCA:                  true,
 		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth,
@@ -637,17 +687,17 @@ func genSerialNumber() (*big.Int, error) {
 	return s, nil
 }
 
-func genKeys() (*ecdsa.PrivateKey, error) {
-	privKey, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
-	if err != nil {
-		return nil, err
-	}
-
-	return privKey, nil
+// Generates a key pair of the algorithm given by key_algorithm in the config.
+func genKeys() (crypto.Signer, error) {
+	return keys.Generate(viper.GetString("key_algorithm"))
 }
 
-func hashContent(data []byte) []byte {
-	h := sha256.New()
-	h.Write(data)
-	return h.Sum(nil)
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
 }
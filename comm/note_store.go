@@ -0,0 +1,114 @@
+package comm
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+)
+
+const noteFile = "note.json"
+
+var errNoStorePath = errors.New("Identity is not stored, no path to store note in")
+
+type storedNote struct {
+	Epoch uint64
+	Mask  uint32
+}
+
+// Returns the epoch and mask of the last local note stored next to the key material.
+// If the identity was loaded from storage without a stored note, an epoch derived
+// from the current time is returned instead, together with a zero mask.
+// Such identities were stored before notes were, their epochs started at one and
+// grew by one per note, far below the current time in nanoseconds.
+// The fallback is only taken once, the note issued from it is stored right away.
+func (cu *CryptoUnit) LoadNote() (uint64, uint32, error) {
+	var n storedNote
+
+	path := cu.getStorePath()
+	if path == "" {
+		return 0, 0, errNoStorePath
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(path, noteFile))
+	if os.IsNotExist(err) {
+		return uint64(time.Now().UnixNano()), 0, nil
+	} else if err != nil {
+		return 0, 0, err
+	}
+
+	err = json.Unmarshal(content, &n)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return n.Epoch, n.Mask, nil
+}
+
+// Stores the epoch and mask of the local note next to the key material,
+// does nothing if the identity has not been stored.
+func (cu *CryptoUnit) SaveNote(epoch uint64, mask uint32) error {
+	path := cu.getStorePath()
+	if path == "" {
+		return nil
+	}
+
+	content, err := json.Marshal(storedNote{Epoch: epoch, Mask: mask})
+	if err != nil {
+		return err
+	}
+
+	cu.noteMutex.Lock()
+	defer cu.noteMutex.Unlock()
+
+	// Notes saved concurrently may arrive out of order.
+	if epoch < cu.savedEpoch {
+		return nil
+	}
+
+	// Write and rename to never leave a partially written note behind.
+	f, err := ioutil.TempFile(path, ".note-*.json")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(f.Name())
+
+	if _, err = f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	err = os.Rename(f.Name(), filepath.Join(path, noteFile))
+	if err != nil {
+		return err
+	}
+
+	cu.savedEpoch = epoch
+
+	log.Debug("note stored", "path", path, "epoch", epoch)
+
+	return nil
+}
+
+func (cu *CryptoUnit) setStorePath(path string) {
+	cu.storeMutex.Lock()
+	defer cu.storeMutex.Unlock()
+
+	cu.storePath = path
+}
+
+func (cu *CryptoUnit) getStorePath() string {
+	cu.storeMutex.RLock()
+	defer cu.storeMutex.RUnlock()
+
+	return cu.storePath
+}
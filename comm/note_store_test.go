@@ -0,0 +1,96 @@
+package comm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type NoteStoreTestSuite struct {
+	suite.Suite
+
+	path string
+}
+
+func TestNoteStoreTestSuite(t *testing.T) {
+	suite.Run(t, new(NoteStoreTestSuite))
+}
+
+func (suite *NoteStoreTestSuite) SetupTest() {
+	path, err := ioutil.TempDir("", "notestore")
+	require.NoError(suite.T(), err, "Failed to create directory.")
+
+	suite.path = path
+}
+
+func (suite *NoteStoreTestSuite) TearDownTest() {
+	os.RemoveAll(suite.path)
+}
+
+func (suite *NoteStoreTestSuite) TestLoadNote() {
+	cu := &CryptoUnit{}
+
+	_, _, err := cu.LoadNote()
+	require.EqualError(suite.T(), err, errNoStorePath.Error(), "Loaded note without a stored identity.")
+
+	require.NoError(suite.T(), cu.SaveNote(1, 1), "Failed to ignore save without a stored identity.")
+
+	cu.setStorePath(suite.path)
+
+	epoch, mask, err := cu.LoadNote()
+	require.NoError(suite.T(), err, "Failed to derive epoch without a stored note.")
+	require.True(suite.T(), epoch > 1, "Derived epoch is not more recent than the initial one.")
+	require.Zero(suite.T(), mask, "Mask derived without a stored note.")
+
+	later, _, err := cu.LoadNote()
+	require.NoError(suite.T(), err, "Failed to derive epoch without a stored note.")
+	require.True(suite.T(), later >= epoch, "Derived epoch is not monotonic.")
+
+	require.NoError(suite.T(), cu.SaveNote(5, 7), "Failed to save note.")
+
+	epoch, mask, err = cu.LoadNote()
+	require.NoError(suite.T(), err, "Failed to load note.")
+	require.Equal(suite.T(), uint64(5), epoch, "Wrong epoch loaded.")
+	require.Equal(suite.T(), uint32(7), mask, "Wrong mask loaded.")
+
+	files, err := ioutil.ReadDir(suite.path)
+	require.NoError(suite.T(), err, "Failed to read directory.")
+	require.Equal(suite.T(), 1, len(files), "Temporary note file left behind.")
+
+	require.NoError(suite.T(), ioutil.WriteFile(filepath.Join(suite.path, noteFile), []byte("garbage"), 0600))
+
+	_, _, err = cu.LoadNote()
+	require.Error(suite.T(), err, "Loaded malformed note.")
+}
+
+func (suite *NoteStoreTestSuite) TestConcurrentSaves() {
+	cu := &CryptoUnit{}
+	cu.setStorePath(suite.path)
+
+	var wg sync.WaitGroup
+
+	for i := 1; i <= 50; i++ {
+		wg.Add(1)
+		go func(epoch uint64) {
+			defer wg.Done()
+			require.NoError(suite.T(), cu.SaveNote(epoch, 1), "Failed to save note.")
+		}(uint64(i))
+	}
+
+	wg.Wait()
+
+	epoch, _, err := cu.LoadNote()
+	require.NoError(suite.T(), err, "Failed to load note.")
+	require.Equal(suite.T(), uint64(50), epoch, "Older note stored over a more recent one.")
+
+	require.NoError(suite.T(), cu.SaveNote(10, 1), "Failed to save note.")
+
+	epoch, _, err = cu.LoadNote()
+	require.NoError(suite.T(), err, "Failed to load note.")
+	require.Equal(suite.T(), uint64(50), epoch, "Older note stored over a more recent one.")
+}
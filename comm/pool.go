@@ -0,0 +1,207 @@
+package comm
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"google.golang.org/grpc/connectivity"
+)
+
+// Statistics of a single pooled connection.
+type ConnStats struct {
+	Addr string
+
+	// Id the peer certificate is required to carry, empty if any certified peer is accepted.
+	Id string
+
+	// Connectivity state of the underlying grpc connection, e.g. "READY" or "TRANSIENT_FAILURE".
+	State string
+
+	// Pinned connections (ring neighbours) are never evicted.
+	Pinned bool
+
+	Created  time.Time
+	LastUsed time.Time
+
+	Calls    uint64
+	Failures uint64
+}
+
+// Replaces the set of pinned addresses, connections to pinned addresses
+// are exempt from idle and LRU eviction.
+// Used to keep connections to ring neighbours open.
+func (c *gRPCClient) Pin(addrs []string) {
+	pinned := make(map[string]bool, len(addrs))
+	for _, a := range addrs {
+		pinned[a] = true
+	}
+
+	c.connectionMutex.Lock()
+	defer c.connectionMutex.Unlock()
+
+	c.pinned = pinned
+}
+
+// Returns statistics of all pooled connections, sorted by address.
+func (c *gRPCClient) ConnStats() []ConnStats {
+	c.connectionMutex.RLock()
+	defer c.connectionMutex.RUnlock()
+
+	ret := make([]ConnStats, 0, len(c.allConnections))
+
+	for key, conn := range c.allConnections {
+		s := conn.stats()
+		s.Addr = key.addr
+		s.Id = key.id
+		s.Pinned = c.pinned[key.addr]
+		ret = append(ret, s)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Addr == ret[j].Addr {
+			return ret[i].Id < ret[j].Id
+		}
+		return ret[i].Addr < ret[j].Addr
+	})
+
+	return ret
+}
+
+func (c *gRPCClient) stop() {
+	c.stopOnce.Do(func() {
+		close(c.exitChan)
+	})
+
+	c.closeAll()
+}
+
+// Closes all connections, later calls establish new ones.
+func (c *gRPCClient) closeAll() {
+	c.connectionMutex.Lock()
+	defer c.connectionMutex.Unlock()
+
+	for key, conn := range c.allConnections {
+		conn.cc.Close()
+		delete(c.allConnections, key)
+	}
+}
+
+// Periodically closes connections idle for longer than the idle timeout.
+func (c *gRPCClient) evictLoop() {
+	for {
+		select {
+		case <-c.exitChan:
+			return
+		case <-time.After(c.idleTimeout / 2):
+			c.evictIdle(time.Now())
+		}
+	}
+}
+
+func (c *gRPCClient) evictIdle(now time.Time) {
+	c.connectionMutex.Lock()
+	defer c.connectionMutex.Unlock()
+
+	for key, conn := range c.allConnections {
+		if c.pinned[key.addr] || conn.busy() || now.Sub(conn.getLastUsed()) < c.idleTimeout {
+			continue
+		}
+
+		log.Debug("Closing idle connection", "addr", key.addr)
+
+		conn.cc.Close()
+		delete(c.allConnections, key)
+	}
+}
+
+// Closes the least recently used connections that are neither pinned nor in use,
+// until there is room for a new connection.
+// Must be called while holding the connection lock.
+func (c *gRPCClient) evictLru() {
+	if c.maxConns <= 0 {
+		return
+	}
+
+	for len(c.allConnections) >= c.maxConns {
+		var lruKey connKey
+		var lru *conn
+
+		for key, conn := range c.allConnections {
+			if c.pinned[key.addr] || conn.busy() {
+				continue
+			}
+
+			if lru == nil || conn.getLastUsed().Before(lru.getLastUsed()) {
+				lruKey, lru = key, conn
+			}
+		}
+
+		// All connections are pinned or in use, exceeding the limit is preferred
+		// over losing connections to ring neighbours or failing calls in flight.
+		if lru == nil {
+			return
+		}
+
+		log.Debug("Evicting connection", "addr", lruKey.addr)
+
+		lru.cc.Close()
+		delete(c.allConnections, lruKey)
+	}
+}
+
+// Connections that are shut down or failing are redialed,
+// instead of waiting for the grpc reconnect backoff.
+func (cn *conn) healthy() bool {
+	switch cn.cc.GetState() {
+	case connectivity.Shutdown, connectivity.TransientFailure:
+		return false
+	default:
+		return true
+	}
+}
+
+func (cn *conn) acquire() {
+	atomic.AddInt32(&cn.inFlight, 1)
+}
+
+func (cn *conn) release() {
+	atomic.AddInt32(&cn.inFlight, -1)
+}
+
+func (cn *conn) busy() bool {
+	return atomic.LoadInt32(&cn.inFlight) > 0
+}
+
+func (cn *conn) used(err error) {
+	cn.statsMutex.Lock()
+	defer cn.statsMutex.Unlock()
+
+	cn.lastUsed = time.Now()
+	cn.calls++
+
+	if err != nil {
+		cn.failures++
+	}
+}
+
+func (cn *conn) getLastUsed() time.Time {
+	cn.statsMutex.RLock()
+	defer cn.statsMutex.RUnlock()
+
+	return cn.lastUsed
+}
+
+func (cn *conn) stats() ConnStats {
+	cn.statsMutex.RLock()
+	defer cn.statsMutex.RUnlock()
+
+	return ConnStats{
+		State:    cn.cc.GetState().String(),
+		Created:  cn.created,
+		LastUsed: cn.lastUsed,
+		Calls:    cn.calls,
+		Failures: cn.failures,
+	}
+}
@@ -0,0 +1,178 @@
+package comm
+
+import (
+	"testing"
+	"time"
+
+	pb "github.com/joonnna/ifrit/protobuf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+type PoolTestSuite struct {
+	suite.Suite
+
+	c *gRPCClient
+}
+
+func TestPoolTestSuite(t *testing.T) {
+	suite.Run(t, new(PoolTestSuite))
+}
+
+func (suite *PoolTestSuite) SetupTest() {
+	caCert, caPriv := genTestCa(suite.T())
+	cert, priv := genTestCert(suite.T(), caCert, caPriv, 2)
+
+	c, err := newClient(clientConfig(cert, caCert, priv, nil), &Options{})
+	require.NoError(suite.T(), err, "Failed to create client.")
+
+	suite.c = c
+}
+
+func (suite *PoolTestSuite) TearDownTest() {
+	suite.c.stop()
+}
+
+func (suite *PoolTestSuite) TestEvictLru() {
+	suite.c.maxConns = 2
+	suite.c.Pin([]string{"127.0.0.1:1"})
+
+	pinned := suite.dial("127.0.0.1:1")
+	suite.dial("127.0.0.1:2")
+
+	// The pinned connection is the least recently used one.
+	pinned.lastUsed = time.Now().Add(-time.Hour)
+
+	suite.dial("127.0.0.1:3")
+
+	require.Equal(suite.T(), []string{"127.0.0.1:1", "127.0.0.1:3"}, suite.addrs(),
+		"Wrong connection evicted.")
+
+	suite.c.Pin([]string{"127.0.0.1:1", "127.0.0.1:3"})
+	suite.dial("127.0.0.1:4")
+
+	require.Equal(suite.T(), []string{"127.0.0.1:1", "127.0.0.1:3", "127.0.0.1:4"}, suite.addrs(),
+		"Pinned connection evicted.")
+}
+
+func (suite *PoolTestSuite) TestEvictIdle() {
+	suite.c.idleTimeout = time.Minute
+	suite.c.Pin([]string{"127.0.0.1:1"})
+
+	suite.dial("127.0.0.1:1")
+	suite.dial("127.0.0.1:2")
+	recent := suite.dial("127.0.0.1:3")
+
+	now := time.Now().Add(time.Minute * 2)
+	recent.lastUsed = now
+
+	suite.c.evictIdle(now)
+
+	require.Equal(suite.T(), []string{"127.0.0.1:1", "127.0.0.1:3"}, suite.addrs(),
+		"Wrong idle connections evicted.")
+}
+
+func (suite *PoolTestSuite) TestConnStatsAndRedial() {
+	// Nothing listens on the address, calls fail and the connection becomes unhealthy.
+	addr := "127.0.0.1:1"
+
+	_, err := suite.c.Gossip(addr, "", &pb.State{})
+	require.Error(suite.T(), err, "Gossip to unreachable address succeeded.")
+
+	stats := suite.c.ConnStats()
+	require.Len(suite.T(), stats, 1, "Wrong number of connections.")
+	assert.Equal(suite.T(), addr, stats[0].Addr, "Wrong address.")
+	assert.Equal(suite.T(), uint64(1), stats[0].Calls, "Wrong number of calls.")
+	assert.Equal(suite.T(), uint64(1), stats[0].Failures, "Wrong number of failures.")
+	assert.False(suite.T(), stats[0].Pinned, "Connection wrongly pinned.")
+
+	failed := suite.c.getConnection(connKey{addr: addr})
+
+	require.Eventually(suite.T(), func() bool {
+		return failed.cc.GetState() == connectivity.TransientFailure
+	}, time.Second*5, time.Millisecond*10, "Connection never failed.")
+
+	redialed, err := suite.c.connection(connKey{addr: addr})
+	require.NoError(suite.T(), err, "Failed to redial.")
+	require.NotEqual(suite.T(), failed, redialed, "Unhealthy connection reused.")
+	require.Equal(suite.T(), connectivity.Shutdown, failed.cc.GetState(), "Unhealthy connection not closed.")
+}
+
+func (suite *PoolTestSuite) TestBusyNotEvicted() {
+	suite.c.maxConns = 1
+	suite.c.idleTimeout = time.Minute
+
+	busy, err := suite.c.connection(connKey{addr: "127.0.0.1:1"})
+	require.NoError(suite.T(), err, "Failed to dial.")
+
+	suite.c.evictIdle(time.Now().Add(time.Minute * 2))
+	suite.dial("127.0.0.1:2")
+
+	require.Equal(suite.T(), []string{"127.0.0.1:1", "127.0.0.1:2"}, suite.addrs(),
+		"Connection evicted with a call in flight.")
+	require.NotEqual(suite.T(), connectivity.Shutdown, busy.cc.GetState(), "Connection in use closed.")
+
+	busy.release()
+
+	suite.dial("127.0.0.1:3")
+
+	require.Equal(suite.T(), []string{"127.0.0.1:3"}, suite.addrs(), "Released connections not evicted.")
+}
+
+func (suite *PoolTestSuite) TestDialOutsideLock() {
+	// Nothing listens on the address, blocking dials wait for the timeout.
+	suite.c.dialOptions = []grpc.DialOption{grpc.WithBlock(), grpc.WithTimeout(time.Second)}
+
+	done := make(chan error)
+
+	go func() {
+		_, err := suite.c.dial(connKey{addr: "127.0.0.1:1"})
+		done <- err
+	}()
+
+	stats := make(chan []ConnStats)
+
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		stats <- suite.c.ConnStats()
+	}()
+
+	select {
+	case s := <-stats:
+		assert.Empty(suite.T(), s, "Connection pooled before it was dialed.")
+	case <-time.After(time.Millisecond * 500):
+		suite.T().Fatal("Pool blocked by a pending dial.")
+	}
+
+	assert.Error(suite.T(), <-done, "Blocking dial to unreachable address succeeded.")
+
+	suite.c.dialOptions = nil
+
+	first := suite.dial("127.0.0.1:2")
+	second := suite.dial("127.0.0.1:2")
+
+	assert.Equal(suite.T(), first, second, "Pooled connection replaced by a concurrent dial.")
+	assert.Equal(suite.T(), []string{"127.0.0.1:2"}, suite.addrs(), "Connection pooled twice.")
+}
+
+func (suite *PoolTestSuite) dial(addr string) *conn {
+	c, err := suite.c.dial(connKey{addr: addr})
+	require.NoError(suite.T(), err, "Failed to dial.")
+
+	c.release()
+
+	return c
+}
+
+func (suite *PoolTestSuite) addrs() []string {
+	var ret []string
+
+	for _, s := range suite.c.ConnStats() {
+		ret = append(ret, s.Addr)
+	}
+
+	return ret
+}
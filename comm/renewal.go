@@ -0,0 +1,151 @@
+package comm
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/joonnna/ifrit/keys"
+)
+
+var (
+	errRenewedCert = errors.New("Renewed certificate does not carry our id and new key")
+)
+
+// Body of certificate renewal requests, the certificate request is signed by the current key.
+type renewalRequest struct {
+	Certificate []byte
+	Request     []byte
+	R           []byte
+	S           []byte
+}
+
+// Renews the certificate through the CA, replacing the key pair with a newly generated one
+// while keeping the id. The configured key algorithm is used, letting nodes migrate algorithm.
+// If the identity has been stored, the stored key and certificate are replaced as well.
+func (cu *CryptoUnit) Renew() (*x509.Certificate, error) {
+	if cu.caAddr == "" {
+		return nil, errNoCa
+	}
+
+	curr := cu.Certificate()
+
+	priv, err := genKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	template := x509.CertificateRequest{
+		SignatureAlgorithm: keys.X509Algorithm(priv),
+		Subject:            curr.Subject,
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &template, priv)
+	if err != nil {
+		return nil, err
+	}
+
+	r, s, err := cu.Sign(csr)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := cu.sendRenewal(&renewalRequest{
+		Certificate: curr.Raw,
+		Request:     csr,
+		R:           r,
+		S:           s,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(cert.SubjectKeyId, curr.SubjectKeyId) || !samePublicKey(cert.PublicKey, priv.Public()) {
+		return nil, errRenewedCert
+	}
+
+	if err := cert.CheckSignatureFrom(cu.ca); err != nil {
+		return nil, err
+	}
+
+	cu.keyMutex.Lock()
+	cu.priv, cu.self = priv, cert
+	cu.keyMutex.Unlock()
+
+	log.Info("Renewed certificate", "serial", cert.SerialNumber.String())
+
+	// The CA has already superseded the previous certificate,
+	// failing to store the renewed one must not discard it.
+	if path := cu.getStorePath(); path != "" {
+		if err := storeRenewed(path, priv, cert, curr); err != nil {
+			log.Error(err.Error())
+		}
+	}
+
+	return cert, nil
+}
+
+func (cu *CryptoUnit) sendRenewal(req *renewalRequest) (*x509.Certificate, error) {
+	var certs certResponse
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.Post(fmt.Sprintf("http://%s/certificateRenewal", cu.caAddr), "application/json", bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return nil, errors.New(fmt.Sprintf("CA refused renewal: %s", strings.TrimSpace(string(msg))))
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&certs)
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(certs.OwnCert)
+}
+
+// Replaces the stored key and certificate with the renewed ones.
+func storeRenewed(path string, priv crypto.Signer, cert, prev *x509.Certificate) error {
+	passphrase, err := keyPassphrase()
+	if err != nil {
+		return err
+	}
+
+	err = saveCert(cert, filepath.Join(path, fmt.Sprintf("self-%s.pem", cert.SerialNumber)))
+	if err != nil {
+		return err
+	}
+
+	err = keys.WritePrivateKey(filepath.Join(path, "key.pem"), priv, passphrase)
+	if err != nil {
+		return err
+	}
+
+	log.Info("renewed identity stored", "path", path)
+
+	return os.Remove(filepath.Join(path, fmt.Sprintf("self-%s.pem", prev.SerialNumber)))
+}
+
+func samePublicKey(a, b crypto.PublicKey) bool {
+	k, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+
+	return ok && k.Equal(b)
+}
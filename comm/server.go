@@ -30,13 +30,14 @@ type gRPCServer struct {
 	listenAddr string
 }
 
-func newServer(config *tls.Config, l net.Listener) (*gRPCServer, error) {
-	var serverOpts []grpc.ServerOption
-
+func newServer(config *tls.Config, l net.Listener, opts *Options) (*gRPCServer, error) {
 	if config == nil {
 		return nil, errNilConfig
 	}
 
+	// User options come first, the credentials and keepalive set below take precedence.
+	serverOpts := opts.serverOptions()
+
 	keepAlive := keepalive.ServerParameters{
 		MaxConnectionIdle: time.Minute * 5,
 		Time:              time.Minute * 5,
@@ -1,11 +1,13 @@
 package comm
 
 import (
+	"crypto/x509"
 	"net"
 	"time"
 
 	"github.com/golang/protobuf/proto"
 	log "github.com/inconshreveable/log15"
+	"github.com/joonnna/ifrit/keys"
 	pb "github.com/joonnna/ifrit/protobuf"
 )
 
@@ -21,6 +23,7 @@ type UDPServer struct {
 
 type pongSigner interface {
 	Sign([]byte) ([]byte, []byte, error)
+	Certificate() *x509.Certificate
 }
 
 func NewUdpServer(ps pongSigner, conn *net.UDPConn) (*UDPServer, error) {
@@ -93,10 +96,17 @@ func (us *UDPServer) Start() {
 				continue
 			}
 
+			alg, err := keys.Algorithm(us.Certificate().PublicKey)
+			if err != nil {
+				log.Error(err.Error())
+				continue
+			}
+
 			pong := &pb.Pong{
 				Signature: &pb.Signature{
-					R: r,
-					S: s,
+					R:         r,
+					S:         s,
+					Algorithm: alg,
 				},
 			}
 
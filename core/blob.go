@@ -0,0 +1,575 @@
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	pb "github.com/joonnna/ifrit/protobuf"
+	"golang.org/x/net/context"
+)
+
+const (
+	blobChunkSize = 64 << 10
+
+	// Number of chunks sent ahead of the last acknowledgement.
+	blobWindow = 16
+
+	// Number of streams opened per transfer before giving up.
+	blobAttempts   = 5
+	blobBackoff    = time.Millisecond * 200
+	blobAckTimeout = time.Second * 10
+
+	// Incoming transfers without activity are discarded after the expiry.
+	blobExpiry = time.Minute * 5
+
+	maxBlobSize = 256 << 20
+
+	// Incoming transfers of a single sender are buffered in memory up to these limits.
+	maxSenderBlobs     = 4
+	maxSenderBlobBytes = maxBlobSize
+
+	// Number of completed transfers whose result is kept for resumed streams.
+	maxBlobResults = 1024
+)
+
+var (
+	errNoBlobHandler = errors.New("No blob handler registered")
+	errBlobTooLarge  = errors.New("Blob exceeds the maximum size")
+	errBlobDigest    = errors.New("Blob digest did not match the received data")
+	errBlobHash      = errors.New("Chunk hash did not match the chunk data")
+	errBlobGap       = errors.New("Chunk offset is beyond the received data")
+	errBlobOpen      = errors.New("Blob transfer was not opened by an empty chunk")
+	errBlobChunk     = errors.New("Message on blob stream carried no chunk")
+	errBlobOffset    = errors.New("Receiver offset is outside of the buffered data")
+	errBlobClosed    = errors.New("Blob stream closed before the transfer completed")
+	errBlobTimeout   = errors.New("No blob acknowledgement received in time")
+	errBlobTransfers = errors.New("Sender has too many blob transfers in flight")
+	errBlobBuffered  = errors.New("Sender has too much blob data buffered")
+)
+
+// Sender side of a blob transfer.
+// Chunks are kept until acknowledged, so they can be resent on a new stream.
+type outboundBlob struct {
+	id   []byte
+	src  io.Reader
+	hash hash.Hash
+
+	// Unacknowledged chunks, in order.
+	pending []*pb.BlobChunk
+
+	// Offset of the next chunk read from src.
+	offset uint64
+	read   bool
+}
+
+// Receiver side of a blob transfer.
+type inboundBlob struct {
+	key    string
+	sender string
+
+	// Bytes accounted to the sender, guarded by the blob mutex of the node.
+	buffered uint64
+
+	data bytes.Buffer
+	size uint64
+	hash hash.Hash
+
+	// Unix nano time of the last received chunk, read without
+	// waiting for a blob handler to return.
+	lastActive int64
+
+	// Set while the blob handler runs, the transfer is not expired meanwhile.
+	handling int32
+
+	// Set once the transfer completed, resumed streams are told the result.
+	done bool
+	err  string
+
+	mutex sync.Mutex
+}
+
+// Sends the content of the reader to the given address in chunks over a stream.
+// If the stream breaks, a new stream is opened and the transfer resumes
+// from the last offset acknowledged by the receiver.
+// Returns once the receiver has verified the blob and its blob handler returned,
+// the error returned by the handler is returned to the caller.
+func (n *Node) SendBlob(ctx context.Context, dest string, r io.Reader) error {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+
+	b := &outboundBlob{
+		id:   id,
+		src:  r,
+		hash: sha256.New(),
+	}
+
+	for attempt := 1; ; attempt++ {
+		resume, err := n.sendBlob(ctx, dest, b)
+		if err == nil || !resume || attempt == blobAttempts {
+			return err
+		}
+
+		log.Debug("Resuming blob transfer", "addr", dest, "offset", b.acked(), "err", err)
+
+		select {
+		case <-n.getClock().After(blobBackoff * time.Duration(attempt)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Runs the transfer over a single stream,
+// returns whether the transfer can be resumed on a new stream if it failed.
+func (n *Node) sendBlob(ctx context.Context, dest string, b *outboundBlob) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	id, err := n.addrToId(dest)
+	if err != nil {
+		return false, err
+	}
+
+	s, err := n.comm.DialStream(ctx, dest, id)
+	if err != nil {
+		return true, err
+	}
+
+	// The receiver replies to the opening chunk with its current offset.
+	open := &pb.Msg{
+		Blob: &pb.BlobChunk{TransferId: b.id, Offset: b.acked()},
+	}
+
+	if err := s.Send(open); err != nil {
+		return true, err
+	}
+
+	acks := newAckQueue(s)
+
+	// Nothing is sent before the receiver tells where to resume.
+	var opened bool
+	var sent int
+
+	for {
+		for ; opened && sent < blobWindow; sent++ {
+			if sent == len(b.pending) {
+				if err := b.readChunk(); err != nil {
+					return false, err
+				}
+
+				if sent == len(b.pending) {
+					break
+				}
+			}
+
+			if err := s.Send(&pb.Msg{Blob: b.pending[sent]}); err != nil {
+				return true, err
+			}
+		}
+
+		select {
+		case <-acks.notify:
+			a, err := acks.latest()
+			if err != nil {
+				return true, err
+			}
+
+			if a.GetError() != "" {
+				return false, errors.New(a.GetError())
+			}
+
+			if a.GetDone() {
+				return false, nil
+			}
+
+			acked, err := b.ack(a.GetOffset())
+			if err != nil {
+				return false, err
+			}
+
+			if opened {
+				sent -= acked
+			} else {
+				opened = true
+				sent = 0
+			}
+
+		case <-n.getClock().After(blobAckTimeout):
+			return true, errBlobTimeout
+
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+}
+
+// Receives acknowledgements from a blob stream, only the latest one is kept.
+// Acknowledgements are cumulative, and the final one is never followed by another,
+// hence the receiver is never blocked by a sender busy sending chunks.
+type ackQueue struct {
+	notify chan struct{}
+
+	ack   *pb.BlobAck
+	err   error
+	mutex sync.Mutex
+}
+
+func newAckQueue(s pb.Gossip_StreamClient) *ackQueue {
+	q := &ackQueue{
+		notify: make(chan struct{}, 1),
+	}
+
+	go func() {
+		for {
+			resp, err := s.Recv()
+			if err == io.EOF {
+				err = errBlobClosed
+			}
+
+			q.mutex.Lock()
+			q.ack, q.err = resp.GetBlobAck(), err
+			q.mutex.Unlock()
+
+			select {
+			case q.notify <- struct{}{}:
+			default:
+			}
+
+			// The stream ends after the final or a refusing acknowledgement,
+			// which must not be replaced by the end of stream error.
+			if a := resp.GetBlobAck(); err != nil || a.GetDone() || a.GetError() != "" {
+				return
+			}
+		}
+	}()
+
+	return q
+}
+
+func (q *ackQueue) latest() (*pb.BlobAck, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.ack, q.err
+}
+
+// Reads the next chunk from the source, unless the last chunk was already read.
+// The last chunk carries the digest of the entire blob, it is empty
+// if the blob size is a multiple of the chunk size.
+func (b *outboundBlob) readChunk() error {
+	if b.read {
+		return nil
+	}
+
+	buf := make([]byte, blobChunkSize)
+
+	num, err := io.ReadFull(b.src, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	data := buf[:num]
+	b.hash.Write(data)
+
+	c := &pb.BlobChunk{
+		TransferId: b.id,
+		Offset:     b.offset,
+		Data:       data,
+		Hash:       hashContent(data),
+	}
+
+	if num < blobChunkSize {
+		c.Last = true
+		c.Digest = b.hash.Sum(nil)
+		b.read = true
+	}
+
+	b.offset += uint64(num)
+	b.pending = append(b.pending, c)
+
+	return nil
+}
+
+// Drops the chunks the receiver has acknowledged, returns the number of dropped chunks.
+// The last chunk is only acknowledged by the receiver completing the transfer.
+func (b *outboundBlob) ack(offset uint64) (int, error) {
+	if offset < b.acked() || offset > b.offset {
+		return 0, errBlobOffset
+	}
+
+	var num int
+
+	for _, c := range b.pending {
+		if c.GetLast() || c.GetOffset()+uint64(len(c.GetData())) > offset {
+			break
+		}
+		num++
+	}
+
+	b.pending = b.pending[num:]
+
+	return num, nil
+}
+
+// Returns the offset up to which the receiver has acknowledged the blob.
+func (b *outboundBlob) acked() uint64 {
+	if len(b.pending) > 0 {
+		return b.pending[0].GetOffset()
+	}
+
+	return b.offset
+}
+
+// Receives a blob transfer opened (or resumed) by the given chunk.
+// Every chunk in order is acknowledged with the received offset.
+// Chunks failing their hash or arriving out of order abort the stream,
+// the sender resumes on a new stream from the acknowledged offset.
+func (n *Node) receiveBlob(srv pb.Gossip_StreamServer, open *pb.BlobChunk) error {
+	cert, err := n.validateCtx(srv.Context())
+	if err != nil {
+		return err
+	}
+
+	if n.revocations.IsRevoked(cert) {
+		return errRevokedCert
+	}
+
+	if open.GetLast() || len(open.GetData()) > 0 {
+		return errBlobOpen
+	}
+
+	handler := n.getBlobHandler()
+	if handler == nil {
+		return srv.Send(&pb.MsgResponse{BlobAck: &pb.BlobAck{Error: errNoBlobHandler.Error()}})
+	}
+
+	b, err := n.inboundBlob(string(cert.SubjectKeyId), string(open.GetTransferId()))
+	if err != nil {
+		return srv.Send(&pb.MsgResponse{BlobAck: &pb.BlobAck{Error: err.Error()}})
+	}
+
+	if err := srv.Send(&pb.MsgResponse{BlobAck: b.ack()}); err != nil {
+		return err
+	}
+
+	for {
+		msg, err := srv.Recv()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		c := msg.GetBlob()
+		if c == nil {
+			return errBlobChunk
+		}
+
+		a, err := n.receiveChunk(b, c, handler)
+		if err != nil {
+			log.Debug("Aborting blob stream", "err", err)
+			return err
+		}
+
+		if err := srv.Send(&pb.MsgResponse{BlobAck: a}); err != nil {
+			return err
+		}
+
+		if a.GetDone() {
+			return nil
+		}
+	}
+}
+
+// Appends the chunk to the blob, duplicate chunks are skipped.
+// The blob handler is called once the last chunk is received and the digest verified.
+func (n *Node) receiveChunk(b *inboundBlob, c *pb.BlobChunk, handler processBlob) (*pb.BlobAck, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	atomic.StoreInt64(&b.lastActive, n.getClock().Now().UnixNano())
+
+	if b.done || c.GetOffset() < b.size {
+		return b.ackLocked(), nil
+	}
+
+	if c.GetOffset() > b.size {
+		return nil, errBlobGap
+	}
+
+	if !bytes.Equal(hashContent(c.GetData()), c.GetHash()) {
+		return nil, errBlobHash
+	}
+
+	if b.size+uint64(len(c.GetData())) > maxBlobSize {
+		n.completeBlob(b, errBlobTooLarge)
+		return b.ackLocked(), nil
+	}
+
+	if err := n.reserveBlob(b, uint64(len(c.GetData()))); err != nil {
+		return nil, err
+	}
+
+	b.data.Write(c.GetData())
+	b.hash.Write(c.GetData())
+	b.size += uint64(len(c.GetData()))
+
+	if !c.GetLast() {
+		return b.ackLocked(), nil
+	}
+
+	if !bytes.Equal(b.hash.Sum(nil), c.GetDigest()) {
+		n.completeBlob(b, errBlobDigest)
+		return b.ackLocked(), nil
+	}
+
+	atomic.StoreInt32(&b.handling, 1)
+	err := handler(bytes.NewReader(b.data.Bytes()))
+	atomic.StoreInt64(&b.lastActive, n.getClock().Now().UnixNano())
+	atomic.StoreInt32(&b.handling, 0)
+
+	n.completeBlob(b, err)
+
+	return b.ackLocked(), nil
+}
+
+// Returns the transfer with the given id from the given sender, creating it if it does not exist.
+// Resuming a completed transfer returns its result, new transfers are refused
+// while the sender has too many in flight. Transfers without recent activity are discarded.
+func (n *Node) inboundBlob(sender, id string) (*inboundBlob, error) {
+	n.blobMutex.Lock()
+	defer n.blobMutex.Unlock()
+
+	now := n.getClock().Now()
+	key := sender + id
+
+	var inFlight int
+
+	for k, b := range n.blobs {
+		if atomic.LoadInt32(&b.handling) == 0 && now.Sub(time.Unix(0, atomic.LoadInt64(&b.lastActive))) >= blobExpiry {
+			log.Debug("Discarding expired blob transfer")
+			n.releaseBlobLocked(b)
+			delete(n.blobs, k)
+			continue
+		}
+
+		if b.sender == sender {
+			inFlight++
+		}
+	}
+
+	if b, ok := n.blobs[key]; ok {
+		return b, nil
+	}
+
+	if res, ok := n.blobResults[key]; ok {
+		return &inboundBlob{key: key, sender: sender, done: true, err: res}, nil
+	}
+
+	if inFlight >= maxSenderBlobs {
+		return nil, errBlobTransfers
+	}
+
+	b := &inboundBlob{
+		key:        key,
+		sender:     sender,
+		hash:       sha256.New(),
+		lastActive: now.UnixNano(),
+	}
+	n.blobs[key] = b
+
+	return b, nil
+}
+
+// Accounts the given number of bytes to the sender of the transfer,
+// fails if the sender would exceed its buffered bytes.
+func (n *Node) reserveBlob(b *inboundBlob, num uint64) error {
+	n.blobMutex.Lock()
+	defer n.blobMutex.Unlock()
+
+	if n.blobBytes[b.sender]+num > maxSenderBlobBytes {
+		return errBlobBuffered
+	}
+
+	n.blobBytes[b.sender] += num
+	b.buffered += num
+
+	return nil
+}
+
+// Completes the transfer and drops it, only its result is kept for resumed streams.
+// Must be called with the transfer mutex held.
+func (n *Node) completeBlob(b *inboundBlob, err error) {
+	b.complete(err)
+
+	n.blobMutex.Lock()
+	defer n.blobMutex.Unlock()
+
+	if n.blobs[b.key] != b {
+		return
+	}
+
+	n.releaseBlobLocked(b)
+	delete(n.blobs, b.key)
+
+	if _, ok := n.blobResults[b.key]; !ok {
+		n.blobResultOrder = append(n.blobResultOrder, b.key)
+	}
+	n.blobResults[b.key] = b.err
+
+	if len(n.blobResultOrder) > maxBlobResults {
+		delete(n.blobResults, n.blobResultOrder[0])
+		n.blobResultOrder = n.blobResultOrder[1:]
+	}
+}
+
+// Must be called with the blob mutex held.
+func (n *Node) releaseBlobLocked(b *inboundBlob) {
+	if b.buffered == 0 {
+		return
+	}
+
+	if n.blobBytes[b.sender] -= b.buffered; n.blobBytes[b.sender] == 0 {
+		delete(n.blobBytes, b.sender)
+	}
+
+	b.buffered = 0
+}
+
+func (b *inboundBlob) ack() *pb.BlobAck {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.ackLocked()
+}
+
+func (b *inboundBlob) ackLocked() *pb.BlobAck {
+	return &pb.BlobAck{
+		Offset: b.size,
+		Done:   b.done,
+		Error:  b.err,
+	}
+}
+
+// Marks the transfer as completed with the given result and releases the data,
+// the offset of completed transfers is the size of the blob.
+func (b *inboundBlob) complete(err error) {
+	b.done = true
+	b.data = bytes.Buffer{}
+
+	if err != nil {
+		b.err = err.Error()
+	}
+}
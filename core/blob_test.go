@@ -0,0 +1,372 @@
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	log "github.com/inconshreveable/log15"
+	"github.com/joonnna/ifrit/clock"
+	"github.com/joonnna/ifrit/memnet"
+	pb "github.com/joonnna/ifrit/protobuf"
+	"github.com/joonnna/ifrit/transport"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+type BlobTestSuite struct {
+	suite.Suite
+
+	sender, receiver *Node
+
+	streams *flakyStreams
+
+	received      [][]byte
+	receivedMutex sync.Mutex
+}
+
+func TestBlobTestSuite(t *testing.T) {
+	r := log.Root()
+
+	r.SetHandler(log.DiscardHandler())
+
+	viper.Set("use_viz", false)
+
+	suite.Run(t, new(BlobTestSuite))
+}
+
+func (suite *BlobTestSuite) SetupTest() {
+	network, err := memnet.NewNetwork(3, 1, 1)
+	require.NoError(suite.T(), err, "Failed to create network.")
+
+	nodes := make([]*Node, 0, 2)
+
+	for i := 0; i < 2; i++ {
+		id, err := network.NewIdentity()
+		require.NoError(suite.T(), err, "Failed to create identity.")
+
+		comm, ping, err := network.NewTransport(id)
+		require.NoError(suite.T(), err, "Failed to create transport.")
+
+		var c transport.Comm = comm
+		if i == 0 {
+			suite.streams = &flakyStreams{Comm: comm}
+			c = suite.streams
+		}
+
+		n, err := NewNode(c, ping, id, id)
+		require.NoError(suite.T(), err, "Failed to create node.")
+
+		comm.Start()
+		ping.Start()
+
+		nodes = append(nodes, n)
+	}
+
+	suite.sender, suite.receiver = nodes[0], nodes[1]
+
+	// Blobs are only sent to known peers.
+	err = suite.sender.evalCertificate(suite.receiver.cm.Certificate())
+	require.NoError(suite.T(), err, "Failed to add receiver.")
+	suite.received = nil
+
+	suite.receiver.SetBlobHandler(func(r io.Reader) error {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+
+		suite.receivedMutex.Lock()
+		defer suite.receivedMutex.Unlock()
+
+		suite.received = append(suite.received, data)
+
+		return nil
+	})
+}
+
+func (suite *BlobTestSuite) TestSendBlob() {
+	sizes := []int{0, 100, blobChunkSize * 2, blobChunkSize*blobWindow*2 + 100}
+
+	for _, size := range sizes {
+		data := randomBlob(suite.T(), size)
+
+		err := suite.sender.SendBlob(context.Background(), suite.receiver.Addr(), bytes.NewReader(data))
+		require.NoErrorf(suite.T(), err, "Failed to send blob of size %d.", size)
+
+		require.Equal(suite.T(), data, suite.lastReceived(), "Received blob differs.")
+	}
+
+	assert.Len(suite.T(), suite.received, len(sizes), "Handler not invoked exactly once per blob.")
+	assert.Equal(suite.T(), len(sizes), suite.streams.opened(), "Transfers were resumed without faults.")
+}
+
+func (suite *BlobTestSuite) TestResume() {
+	data := randomBlob(suite.T(), blobChunkSize*8+100)
+
+	// Each stream but the last one breaks, the transfer has to resume on a new stream.
+	suite.streams.faults = []blobFault{
+		{offset: blobChunkSize * 2, action: "corrupt"},
+		{offset: blobChunkSize * 4, action: "drop"},
+		{offset: blobChunkSize * 6, action: "break"},
+		{offset: blobChunkSize * 7, action: "duplicate"},
+	}
+
+	err := suite.sender.SendBlob(context.Background(), suite.receiver.Addr(), bytes.NewReader(data))
+	require.NoError(suite.T(), err, "Failed to send blob.")
+
+	require.Equal(suite.T(), data, suite.lastReceived(), "Received blob differs.")
+	assert.Len(suite.T(), suite.received, 1, "Handler not invoked exactly once.")
+	assert.Equal(suite.T(), 4, suite.streams.opened(), "Transfer not resumed after each broken stream.")
+}
+
+func (suite *BlobTestSuite) TestHandlerError() {
+	handlerErr := errors.New("handler error")
+
+	suite.receiver.SetBlobHandler(func(r io.Reader) error {
+		return handlerErr
+	})
+
+	err := suite.sender.SendBlob(context.Background(), suite.receiver.Addr(), bytes.NewReader([]byte("data")))
+	require.EqualError(suite.T(), err, handlerErr.Error(), "Handler error not returned to sender.")
+
+	suite.receiver.SetBlobHandler(nil)
+
+	err = suite.sender.SendBlob(context.Background(), suite.receiver.Addr(), bytes.NewReader([]byte("data")))
+	require.EqualError(suite.T(), err, errNoBlobHandler.Error(), "Blob accepted without handler.")
+
+	assert.Equal(suite.T(), 2, suite.streams.opened(), "Rejected transfers were resumed.")
+}
+
+func (suite *BlobTestSuite) TestCompletedTransfer() {
+	data := []byte("data")
+
+	err := suite.sender.SendBlob(context.Background(), suite.receiver.Addr(), bytes.NewReader(data))
+	require.NoError(suite.T(), err, "Failed to send blob.")
+
+	n := suite.receiver
+
+	n.blobMutex.Lock()
+	assert.Empty(suite.T(), n.blobs, "Completed transfer kept.")
+	assert.Empty(suite.T(), n.blobBytes, "Bytes of completed transfer still accounted.")
+	require.Len(suite.T(), n.blobResultOrder, 1, "Result of completed transfer not kept.")
+	key := n.blobResultOrder[0]
+	n.blobMutex.Unlock()
+
+	sender := string(suite.sender.cm.Certificate().SubjectKeyId)
+
+	b, err := n.inboundBlob(sender, key[len(sender):])
+	require.NoError(suite.T(), err, "Failed to resume completed transfer.")
+	assert.True(suite.T(), b.ack().GetDone(), "Resumed transfer not reported as completed.")
+	assert.Len(suite.T(), suite.received, 1, "Handler invoked again for resumed transfer.")
+}
+
+func (suite *BlobTestSuite) TestSlowHandler() {
+	n := suite.receiver
+
+	c := clock.NewManual(time.Now())
+	n.SetClock(c)
+
+	// The handler outlives the expiry of the transfer, while another transfer triggers expiry.
+	n.SetBlobHandler(func(r io.Reader) error {
+		c.Advance(blobExpiry * 2)
+
+		_, err := n.inboundBlob("other", "transfer")
+		return err
+	})
+
+	err := suite.sender.SendBlob(context.Background(), n.Addr(), bytes.NewReader([]byte("data")))
+	require.NoError(suite.T(), err, "Failed to send blob.")
+
+	n.blobMutex.Lock()
+	defer n.blobMutex.Unlock()
+
+	assert.Len(suite.T(), n.blobResults, 1, "Result of transfer expired while handling not kept.")
+	assert.Len(suite.T(), n.blobs, 1, "Transfer expired while handling kept.")
+}
+
+func (suite *BlobTestSuite) TestSenderLimits() {
+	n := suite.receiver
+
+	for i := 0; i < maxSenderBlobs; i++ {
+		_, err := n.inboundBlob("sender", fmt.Sprintf("transfer%d", i))
+		require.NoError(suite.T(), err, "Transfer refused below the limit.")
+	}
+
+	_, err := n.inboundBlob("sender", "transfer0")
+	assert.NoError(suite.T(), err, "Transfer in flight refused.")
+
+	_, err = n.inboundBlob("sender", "other")
+	assert.Equal(suite.T(), errBlobTransfers, err, "Transfer accepted above the limit.")
+
+	b, err := n.inboundBlob("other", "transfer0")
+	require.NoError(suite.T(), err, "Transfer of another sender refused.")
+
+	data := []byte("data")
+	c := &pb.BlobChunk{Data: data, Hash: hashContent(data)}
+
+	n.blobMutex.Lock()
+	n.blobBytes["other"] = maxSenderBlobBytes - 1
+	n.blobMutex.Unlock()
+
+	_, err = n.receiveChunk(b, c, nil)
+	assert.Equal(suite.T(), errBlobBuffered, err, "Chunk accepted above the buffered bytes.")
+
+	n.blobMutex.Lock()
+	delete(n.blobBytes, "other")
+	n.blobMutex.Unlock()
+
+	a, err := n.receiveChunk(b, c, nil)
+	require.NoError(suite.T(), err, "Chunk refused below the buffered bytes.")
+	assert.Equal(suite.T(), uint64(len(data)), a.GetOffset(), "Chunk not appended.")
+
+	n.blobMutex.Lock()
+	assert.Equal(suite.T(), uint64(len(data)), n.blobBytes["other"], "Buffered bytes not accounted.")
+	n.blobMutex.Unlock()
+
+	c = &pb.BlobChunk{Offset: uint64(len(data)), Last: true, Hash: hashContent(nil), Digest: []byte("wrong")}
+
+	a, err = n.receiveChunk(b, c, nil)
+	require.NoError(suite.T(), err, "Last chunk refused.")
+	assert.Equal(suite.T(), errBlobDigest.Error(), a.GetError(), "Wrong digest accepted.")
+
+	n.blobMutex.Lock()
+	assert.Empty(suite.T(), n.blobBytes, "Bytes of completed transfer still accounted.")
+	n.blobMutex.Unlock()
+
+	_, err = n.inboundBlob("sender", "other")
+	assert.Equal(suite.T(), errBlobTransfers, err, "Completed transfer of another sender freed a slot.")
+}
+
+func (suite *BlobTestSuite) TestReceiverOffset() {
+	b := &outboundBlob{
+		src:  bytes.NewReader(randomBlob(suite.T(), blobChunkSize*2+1)),
+		hash: sha256.New(),
+	}
+
+	for i := 0; i < 3; i++ {
+		require.NoError(suite.T(), b.readChunk(), "Failed to read chunk.")
+	}
+
+	require.True(suite.T(), b.read, "Last chunk not marked.")
+
+	num, err := b.ack(blobChunkSize)
+	require.NoError(suite.T(), err, "Valid offset rejected.")
+	assert.Equal(suite.T(), 1, num, "Wrong number of chunks acknowledged.")
+
+	_, err = b.ack(0)
+	assert.Equal(suite.T(), errBlobOffset, err, "Offset before buffered data accepted.")
+
+	num, err = b.ack(blobChunkSize*2 + 1)
+	require.NoError(suite.T(), err, "Valid offset rejected.")
+	assert.Equal(suite.T(), 1, num, "Last chunk acknowledged before completion.")
+}
+
+func (suite *BlobTestSuite) lastReceived() []byte {
+	suite.receivedMutex.Lock()
+	defer suite.receivedMutex.Unlock()
+
+	if len(suite.received) == 0 {
+		return nil
+	}
+
+	return suite.received[len(suite.received)-1]
+}
+
+func randomBlob(t *testing.T, size int) []byte {
+	ret := make([]byte, size)
+
+	_, err := rand.Read(ret)
+	require.NoError(t, err, "Failed to generate blob.")
+
+	return ret
+}
+
+type blobFault struct {
+	offset uint64
+	action string
+}
+
+// Applies the n-th fault to the n-th stream, on the first chunk sent at the fault offset.
+type flakyStreams struct {
+	*memnet.Comm
+
+	faults     []blobFault
+	numStreams int
+	mutex      sync.Mutex
+}
+
+func (fs *flakyStreams) DialStream(ctx context.Context, addr, id string) (pb.Gossip_StreamClient, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	s, err := fs.Comm.DialStream(ctx, addr, id)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	ret := &flakyStream{Gossip_StreamClient: s, cancel: cancel}
+
+	if fs.numStreams < len(fs.faults) {
+		ret.fault = &fs.faults[fs.numStreams]
+	}
+
+	fs.numStreams++
+
+	return ret, nil
+}
+
+func (fs *flakyStreams) opened() int {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	return fs.numStreams
+}
+
+type flakyStream struct {
+	pb.Gossip_StreamClient
+	cancel context.CancelFunc
+	fault  *blobFault
+}
+
+func (s *flakyStream) Send(m *pb.Msg) error {
+	c := m.GetBlob()
+	if s.fault == nil || len(c.GetData()) == 0 || c.GetOffset() != s.fault.offset {
+		return s.Gossip_StreamClient.Send(m)
+	}
+
+	action := s.fault.action
+	s.fault = nil
+
+	switch action {
+	case "corrupt":
+		corrupted := proto.Clone(m).(*pb.Msg)
+		corrupted.Blob.Data[0]++
+		return s.Gossip_StreamClient.Send(corrupted)
+	case "drop":
+		return nil
+	case "duplicate":
+		if err := s.Gossip_StreamClient.Send(m); err != nil {
+			return err
+		}
+	case "break":
+		s.cancel()
+		return errors.New("Connection lost")
+	}
+
+	return s.Gossip_StreamClient.Send(m)
+}
@@ -0,0 +1,156 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	log "github.com/inconshreveable/log15"
+	"github.com/joonnna/ifrit/memnet"
+	pb "github.com/joonnna/ifrit/protobuf"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ConvergenceTestSuite struct {
+	suite.Suite
+
+	nodes []*Node
+}
+
+func TestConvergenceTestSuite(t *testing.T) {
+	r := log.Root()
+
+	r.SetHandler(log.DiscardHandler())
+
+	viper.Set("use_viz", false)
+
+	suite.Run(t, new(ConvergenceTestSuite))
+}
+
+func (suite *ConvergenceTestSuite) SetupTest() {
+	numNodes := 500
+	if testing.Short() || raceEnabled {
+		numNodes = 50
+	}
+
+	network, err := memnet.NewNetwork(10, 10, 1)
+	require.NoError(suite.T(), err, "Failed to create network.")
+
+	suite.nodes = nil
+
+	for i := 0; i < numNodes; i++ {
+		id, err := network.NewIdentity()
+		require.NoError(suite.T(), err, "Failed to create identity.")
+
+		suite.addNode(network, id)
+	}
+}
+
+func (suite *ConvergenceTestSuite) addNode(network *memnet.Network, id *memnet.Identity) {
+	c, p, err := network.NewTransport(id)
+	require.NoError(suite.T(), err, "Failed to create transport.")
+
+	n, err := NewNode(c, p, id, id)
+	require.NoError(suite.T(), err, "Failed to create node.")
+
+	c.Start()
+	p.Start()
+
+	suite.nodes = append(suite.nodes, n)
+}
+
+func (suite *ConvergenceTestSuite) TestFullAndLiveViewConvergence() {
+	maxRounds := 100
+	expected := len(suite.nodes) - 1
+
+	for round := 1; round <= maxRounds; round++ {
+		for _, n := range suite.nodes {
+			n.protocol().Gossip(n)
+		}
+
+		if suite.converged(expected) {
+			suite.T().Logf("Converged after %d rounds", round)
+			return
+		}
+	}
+
+	for _, n := range suite.nodes {
+		require.Len(suite.T(), n.view.Full(), expected, "Full view did not converge.")
+		require.Len(suite.T(), n.view.Live(), expected, "Live view did not converge.")
+	}
+}
+
+// Members with ecdsa and ed25519 keys have to accept each others notes,
+// accusations and pongs.
+func (suite *ConvergenceTestSuite) TestMixedKeyAlgorithms() {
+	network, err := memnet.NewNetwork(5, 5, 2)
+	require.NoError(suite.T(), err, "Failed to create network.")
+
+	suite.nodes = nil
+
+	for i := 0; i < 20; i++ {
+		var id *memnet.Identity
+
+		if i%2 == 0 {
+			id, err = network.NewIdentity()
+		} else {
+			_, priv, keyErr := ed25519.GenerateKey(rand.Reader)
+			require.NoError(suite.T(), keyErr, "Failed to generate key.")
+
+			id, err = network.NewIdentityWithKey(priv)
+		}
+		require.NoError(suite.T(), err, "Failed to create identity.")
+
+		suite.addNode(network, id)
+	}
+
+	expected := len(suite.nodes) - 1
+
+	for round := 1; round <= 100 && !suite.converged(expected); round++ {
+		for _, n := range suite.nodes {
+			n.protocol().Gossip(n)
+		}
+	}
+
+	require.True(suite.T(), suite.converged(expected), "Mixed network did not converge.")
+
+	for _, n := range suite.nodes {
+		for _, p := range n.view.Live() {
+			require.NoError(suite.T(), n.fd.probe(p), "Pong signature rejected.")
+		}
+	}
+
+	src, dest := suite.nodes[0], suite.nodes[1]
+	accused := src.view.Peer(dest.self.Id)
+
+	require.Equal(suite.T(), pb.SignatureAlgorithm_ED25519, accused.Note().ToPbMsg().GetSignature().GetAlgorithm(), "Note names the wrong algorithm.")
+
+	err = accused.CreateAccusation(accused.Note(), src.self, 1, src.cs)
+	require.NoError(suite.T(), err, "Failed to create accusation.")
+
+	acc := accused.RingAccusation(1).ToPbMsg()
+	sign := acc.GetSignature()
+	acc.Signature = nil
+
+	b, err := proto.Marshal(acc)
+	require.NoError(suite.T(), err, "Failed to marshal accusation.")
+
+	accuser := dest.view.Peer(src.self.Id).PublicKey()
+	require.True(suite.T(), validSignature(dest.cs, b, sign, accuser), "Accusation signature rejected.")
+
+	sign.Algorithm = pb.SignatureAlgorithm_ED25519
+	require.False(suite.T(), validSignature(dest.cs, b, sign, accuser), "Signature naming another algorithm accepted.")
+}
+
+func (suite *ConvergenceTestSuite) converged(expected int) bool {
+	for _, n := range suite.nodes {
+		if len(n.view.Full()) != expected || len(n.view.Live()) != expected {
+			return false
+		}
+	}
+
+	return true
+}
@@ -1,11 +1,11 @@
 package discovery
 
 import (
-	"crypto/ecdsa"
-	"crypto/rand"
+	"crypto"
 	"errors"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/joonnna/ifrit/keys"
 	pb "github.com/joonnna/ifrit/protobuf"
 )
 
@@ -35,14 +35,11 @@ func (a Accusation) IsAccuser(id string) bool {
 
 func (a Accusation) ToPbMsg() *pb.Accusation {
 	return &pb.Accusation{
-		Epoch:   a.epoch,
-		Accuser: []byte(a.accuser),
-		Accused: []byte(a.accused),
-		RingNum: a.ringNum,
-		Signature: &pb.Signature{
-			R: a.r,
-			S: a.s,
-		},
+		Epoch:     a.epoch,
+		Accuser:   []byte(a.accuser),
+		Accused:   []byte(a.accused),
+		RingNum:   a.ringNum,
+		Signature: a.signature.toPbMsg(),
 	}
 }
 
@@ -53,7 +50,7 @@ func (a Accusation) ToPbMsg() *pb.Accusation {
 */
 
 // ONLY for testing
-func NewAccusation(epoch uint64, accused, accuser string, ringNum uint32, priv *ecdsa.PrivateKey) *pb.Accusation {
+func NewAccusation(epoch uint64, accused, accuser string, ringNum uint32, priv crypto.Signer) *pb.Accusation {
 	a := &Accusation{
 		accused: accused,
 		accuser: accuser,
@@ -83,7 +80,7 @@ func NewUnsignedAccusation(epoch uint64, accused, accuser string, ringNum uint32
 }
 
 // ONLY for testing
-func signAcc(a *Accusation, privKey *ecdsa.PrivateKey) error {
+func signAcc(a *Accusation, privKey crypto.Signer) error {
 	if privKey == nil {
 		return errNoPrivKey
 	}
@@ -100,16 +97,15 @@ func signAcc(a *Accusation, privKey *ecdsa.PrivateKey) error {
 		return err
 	}
 
-	hash := hashContent(b)
-
-	r, s, err := ecdsa.Sign(rand.Reader, privKey, hash)
+	sign, err := keys.NewSignature(privKey, b)
 	if err != nil {
 		return err
 	}
 
 	a.signature = &signature{
-		r: r.Bytes(),
-		s: s.Bytes(),
+		r:         sign.GetR(),
+		s:         sign.GetS(),
+		algorithm: sign.GetAlgorithm(),
 	}
 
 	return nil
@@ -0,0 +1,231 @@
+package discovery
+
+import (
+	"errors"
+	"net"
+
+	log "github.com/inconshreveable/log15"
+	pb "github.com/joonnna/ifrit/protobuf"
+)
+
+const maxAddressLength = 256
+
+var (
+	errInvalidAddress = errors.New("Address record contains an invalid address")
+	errUnknownAddr    = errors.New("No peer known at the address")
+	errAmbiguousAddr  = errors.New("Several peers known at the address")
+	errAddrTaken      = errors.New("Address record reuses the rpc address of another live peer")
+)
+
+// Returns an error if the address record of a note is invalid,
+// notes without an address record are valid.
+func ValidAddress(a *pb.Address) error {
+	if a == nil {
+		return nil
+	}
+
+	for _, addr := range []string{a.GetRpcAddr(), a.GetPingAddr()} {
+		if err := validHostPort(addr); err != nil {
+			return err
+		}
+	}
+
+	if http := a.GetHttpAddr(); http != "" {
+		return validHostPort(http)
+	}
+
+	return nil
+}
+
+// Returns an error if the address record of a note from the given peer claims
+// the rpc address of this node or of another live peer, which would leave
+// neither reachable by address. Addresses of peers no longer alive can be taken over.
+func (v *View) ValidAddressOwner(id string, a *pb.Address) error {
+	if a == nil {
+		return nil
+	}
+
+	addr := a.GetRpcAddr()
+
+	if addr == v.self.Addr() {
+		return errAddrTaken
+	}
+
+	for _, p := range v.Live() {
+		if p.Id != id && p.Addr() == addr {
+			return errAddrTaken
+		}
+	}
+
+	return nil
+}
+
+// Replaces the addresses of the local peer by issuing a new note with a higher epoch,
+// it has to be gossiped to take effect. The http address is optional.
+func (v *View) SetAddress(rpcAddr, pingAddr, httpAddr string) error {
+	addr := &pb.Address{
+		RpcAddr:  rpcAddr,
+		PingAddr: pingAddr,
+		HttpAddr: httpAddr,
+	}
+
+	if err := ValidAddress(addr); err != nil {
+		return err
+	}
+
+	v.self.noteMutex.Lock()
+	defer v.self.noteMutex.Unlock()
+
+	newNote := v.nextLocalNote(v.self.note.mask)
+	newNote.address = addr
+
+	err := v.signLocalNote(newNote)
+	if err != nil {
+		return err
+	}
+
+	v.self.setAddress(rpcAddr, pingAddr, httpAddr, newNote.epoch)
+
+	return nil
+}
+
+// Applies the address record of the most recent note of the peer,
+// falling back to the addresses of its certificate if the note has none.
+// Connections to a stale address are closed, and failed pings against it forgotten.
+// Ring positions only depend on ids, neighbour relations are therefore left untouched.
+func (v *View) UpdateAddress(p *Peer) {
+	var rpcAddr, pingAddr, httpAddr string
+
+	note := p.Note()
+	if note == nil {
+		return
+	}
+
+	if a := note.address; a != nil {
+		rpcAddr, pingAddr, httpAddr = a.GetRpcAddr(), a.GetPingAddr(), a.GetHttpAddr()
+	} else if cert := p.certificate(); cert != nil {
+		rpcAddr, pingAddr, httpAddr = certAddress(cert.Subject.Locality)
+	} else {
+		return
+	}
+
+	// The index only holds peers in the full view, which can not change while it is locked.
+	v.addrMutex.Lock()
+	oldRpc, oldPing, changed := p.setAddress(rpcAddr, pingAddr, httpAddr, note.epoch)
+	if changed && oldRpc != rpcAddr && v.Exists(p.Id) {
+		v.unindexAddr(oldRpc, p.Id)
+		v.indexAddr(rpcAddr, p.Id)
+	}
+	v.addrMutex.Unlock()
+
+	if !changed {
+		return
+	}
+
+	if oldRpc != rpcAddr {
+		v.cm.CloseConn(oldRpc)
+	}
+
+	if oldPing != pingAddr {
+		p.ResetPing()
+	}
+
+	log.Info("Peer changed address", "old", oldRpc, "new", rpcAddr, "epoch", note.epoch)
+}
+
+// Returns the id of the peer in the full view reached at the given rpc address.
+// Peers reusing the address of another one can not be told apart, hence an error is returned
+// until the address record of either peer changes or either is removed.
+func (v *View) AddrToId(addr string) (string, error) {
+	v.addrMutex.RLock()
+	defer v.addrMutex.RUnlock()
+
+	ids := v.addrIndex[addr]
+
+	if len(ids) == 0 {
+		return "", errUnknownAddr
+	}
+
+	if len(ids) > 1 {
+		return "", errAmbiguousAddr
+	}
+
+	for id := range ids {
+		return id, nil
+	}
+
+	return "", errUnknownAddr
+}
+
+// Has to be called with the address mutex held.
+func (v *View) indexAddr(addr, id string) {
+	ids, ok := v.addrIndex[addr]
+	if !ok {
+		ids = make(map[string]bool)
+		v.addrIndex[addr] = ids
+	}
+
+	ids[id] = true
+}
+
+// Has to be called with the address mutex held.
+func (v *View) unindexAddr(addr, id string) {
+	if ids, ok := v.addrIndex[addr]; ok {
+		delete(ids, id)
+
+		if len(ids) == 0 {
+			delete(v.addrIndex, addr)
+		}
+	}
+}
+
+// Returns the previous rpc and ping addresses, and whether anything changed.
+// Addresses from notes older than the ones already applied are ignored.
+func (p *Peer) setAddress(rpcAddr, pingAddr, httpAddr string, epoch uint64) (string, string, bool) {
+	p.addrMutex.Lock()
+	defer p.addrMutex.Unlock()
+
+	oldRpc, oldPing := p.addr, p.pingAddr
+
+	if epoch < p.addrEpoch {
+		return oldRpc, oldPing, false
+	}
+
+	if rpcAddr == p.addr && pingAddr == p.pingAddr && httpAddr == p.httpAddr {
+		return oldRpc, oldPing, false
+	}
+
+	p.addr = rpcAddr
+	p.pingAddr = pingAddr
+	p.httpAddr = httpAddr
+	p.addrEpoch = epoch
+
+	return oldRpc, oldPing, true
+}
+
+func certAddress(locality []string) (string, string, string) {
+	var http string
+
+	if len(locality) < 2 {
+		return "", "", ""
+	}
+
+	if len(locality) == 3 {
+		http = locality[2]
+	}
+
+	return locality[0], locality[1], http
+}
+
+func validHostPort(addr string) error {
+	if addr == "" || len(addr) > maxAddressLength {
+		return errInvalidAddress
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host == "" || port == "" {
+		return errInvalidAddress
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package discovery
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	pb "github.com/joonnna/ifrit/protobuf"
+)
+
+const (
+	maxAttributes      = 32
+	maxAttributeKey    = 64
+	maxAttributeValue  = 256
+	selectorSeparator  = ","
+	selectorEquals     = "="
+	selectorNotEquals  = "!="
+	selectorNotPresent = "!"
+)
+
+var (
+	errTooManyAttributes = errors.New("Too many attributes")
+	errAttributeKey      = errors.New("Attribute key is empty, too long or contains any of '=!,'")
+	errAttributeValue    = errors.New("Attribute value is too long")
+	errAttributeOrder    = errors.New("Attribute keys are not sorted or not unique")
+	errInvalidSelector   = errors.New("Selector is invalid")
+)
+
+// Matches peers on their attributes.
+type Selector struct {
+	requirements []requirement
+}
+
+type requirement struct {
+	key   string
+	value string
+	op    string
+}
+
+// Parses a selector consisting of comma separated requirements,
+// each requirement is one of "key=value", "key!=value", "key" (present) or "!key" (not present).
+// A peer matches the selector if it satisfies all requirements, the empty selector matches all peers.
+func ParseSelector(s string) (*Selector, error) {
+	sel := &Selector{}
+
+	if strings.TrimSpace(s) == "" {
+		return sel, nil
+	}
+
+	for _, part := range strings.Split(s, selectorSeparator) {
+		var r requirement
+
+		part = strings.TrimSpace(part)
+
+		if idx := strings.Index(part, selectorNotEquals); idx != -1 {
+			r = requirement{key: part[:idx], value: part[idx+len(selectorNotEquals):], op: selectorNotEquals}
+		} else if idx := strings.Index(part, selectorEquals); idx != -1 {
+			r = requirement{key: part[:idx], value: part[idx+len(selectorEquals):], op: selectorEquals}
+		} else if strings.HasPrefix(part, selectorNotPresent) {
+			r = requirement{key: part[len(selectorNotPresent):], op: selectorNotPresent}
+		} else {
+			r = requirement{key: part}
+		}
+
+		r.key = strings.TrimSpace(r.key)
+		r.value = strings.TrimSpace(r.value)
+
+		if r.key == "" || strings.ContainsAny(r.key, "=!") {
+			return nil, errInvalidSelector
+		}
+
+		sel.requirements = append(sel.requirements, r)
+	}
+
+	return sel, nil
+}
+
+// Returns true if the given attributes satisfy all requirements of the selector.
+func (s *Selector) Matches(attrs map[string]string) bool {
+	for _, r := range s.requirements {
+		value, exists := attrs[r.key]
+
+		switch r.op {
+		case selectorEquals:
+			if !exists || value != r.value {
+				return false
+			}
+		case selectorNotEquals:
+			if exists && value == r.value {
+				return false
+			}
+		case selectorNotPresent:
+			if exists {
+				return false
+			}
+		default:
+			if !exists {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Returns the attributes of the peer, from its most recent note.
+func (p *Peer) Attributes() map[string]string {
+	note := p.Note()
+	if note == nil {
+		return nil
+	}
+
+	return copyAttributes(note.attributes)
+}
+
+// Converts attributes received in a note, they have to be sorted by key
+// to keep the signature over them deterministic.
+func AttributesFromPb(attrs []*pb.Attribute) (map[string]string, error) {
+	if len(attrs) == 0 {
+		return nil, nil
+	}
+
+	if len(attrs) > maxAttributes {
+		return nil, errTooManyAttributes
+	}
+
+	ret := make(map[string]string)
+
+	for i, a := range attrs {
+		if i > 0 && attrs[i-1].GetKey() >= a.GetKey() {
+			return nil, errAttributeOrder
+		}
+
+		ret[a.GetKey()] = a.GetValue()
+	}
+
+	if err := validAttributes(ret); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func attributesToPb(attrs map[string]string) []*pb.Attribute {
+	if len(attrs) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	ret := make([]*pb.Attribute, 0, len(keys))
+	for _, k := range keys {
+		ret = append(ret, &pb.Attribute{Key: k, Value: attrs[k]})
+	}
+
+	return ret
+}
+
+func validAttributes(attrs map[string]string) error {
+	if len(attrs) > maxAttributes {
+		return errTooManyAttributes
+	}
+
+	for k, v := range attrs {
+		if k == "" || len(k) > maxAttributeKey || strings.ContainsAny(k, "=!,") {
+			return errAttributeKey
+		}
+
+		if len(v) > maxAttributeValue {
+			return errAttributeValue
+		}
+	}
+
+	return nil
+}
+
+func copyAttributes(attrs map[string]string) map[string]string {
+	if attrs == nil {
+		return nil
+	}
+
+	ret := make(map[string]string, len(attrs))
+	for k, v := range attrs {
+		ret[k] = v
+	}
+
+	return ret
+}
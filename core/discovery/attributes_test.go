@@ -0,0 +1,126 @@
+package discovery
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	pb "github.com/joonnna/ifrit/protobuf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type AttributesTestSuite struct {
+	suite.Suite
+}
+
+func TestAttributesTestSuite(t *testing.T) {
+	suite.Run(t, new(AttributesTestSuite))
+}
+
+func (suite *AttributesTestSuite) TestParseSelector() {
+	invalid := []string{"=eu", "!=eu", "!", "zone,,role", "zo!ne=eu", "!zone=eu"}
+
+	for _, s := range invalid {
+		_, err := ParseSelector(s)
+		assert.EqualErrorf(suite.T(), err, errInvalidSelector.Error(), "Invalid selector %q accepted.", s)
+	}
+
+	valid := []string{"", " ", "zone", "!canary", "zone=eu", "zone!=eu", "zone = eu , !canary", "zone="}
+
+	for _, s := range valid {
+		_, err := ParseSelector(s)
+		assert.NoErrorf(suite.T(), err, "Valid selector %q rejected.", s)
+	}
+}
+
+func (suite *AttributesTestSuite) TestMatches() {
+	attrs := map[string]string{
+		"zone":    "eu",
+		"version": "1.2",
+		"canary":  "",
+	}
+
+	tests := []struct {
+		selector string
+		out      bool
+	}{
+		{"", true},
+		{"zone", true},
+		{"role", false},
+		{"!role", true},
+		{"!canary", false},
+		{"zone=eu", true},
+		{"zone=us", false},
+		{"role=eu", false},
+		{"zone!=us", true},
+		{"zone!=eu", false},
+		{"role!=eu", true},
+		{"canary=", true},
+		{"zone=eu,version=1.2", true},
+		{"zone=eu,version=1.3", false},
+		{"zone=eu, canary", true},
+	}
+
+	for _, t := range tests {
+		sel, err := ParseSelector(t.selector)
+		require.NoErrorf(suite.T(), err, "Valid selector %q rejected.", t.selector)
+
+		assert.Equalf(suite.T(), t.out, sel.Matches(attrs), "Invalid match for %q.", t.selector)
+	}
+
+	sel, err := ParseSelector("zone")
+	require.NoError(suite.T(), err, "Valid selector rejected.")
+	assert.False(suite.T(), sel.Matches(nil), "Matched peer without attributes.")
+
+	sel, err = ParseSelector("!zone")
+	require.NoError(suite.T(), err, "Valid selector rejected.")
+	assert.True(suite.T(), sel.Matches(nil), "Did not match peer without attributes.")
+}
+
+func (suite *AttributesTestSuite) TestAttributesFromPb() {
+	attrs := map[string]string{
+		"b": "2",
+		"a": "1",
+		"c": "",
+	}
+
+	converted := attributesToPb(attrs)
+	require.Equal(suite.T(), 3, len(converted), "Wrong number of converted attributes.")
+	assert.Equal(suite.T(), "a", converted[0].GetKey(), "Attributes not sorted.")
+	assert.Equal(suite.T(), "c", converted[2].GetKey(), "Attributes not sorted.")
+
+	back, err := AttributesFromPb(converted)
+	require.NoError(suite.T(), err, "Valid attributes rejected.")
+	assert.Equal(suite.T(), attrs, back, "Attributes changed by conversion.")
+
+	back, err = AttributesFromPb(nil)
+	require.NoError(suite.T(), err, "Empty attributes rejected.")
+	assert.Nil(suite.T(), back, "Empty attributes converted to non-nil map.")
+
+	unsorted := []*pb.Attribute{{Key: "b"}, {Key: "a"}}
+	_, err = AttributesFromPb(unsorted)
+	assert.EqualError(suite.T(), err, errAttributeOrder.Error(), "Unsorted attributes accepted.")
+
+	duplicate := []*pb.Attribute{{Key: "a", Value: "1"}, {Key: "a", Value: "2"}}
+	_, err = AttributesFromPb(duplicate)
+	assert.EqualError(suite.T(), err, errAttributeOrder.Error(), "Duplicate attributes accepted.")
+
+	_, err = AttributesFromPb([]*pb.Attribute{{Key: ""}})
+	assert.EqualError(suite.T(), err, errAttributeKey.Error(), "Empty key accepted.")
+
+	_, err = AttributesFromPb([]*pb.Attribute{{Key: "a=b"}})
+	assert.EqualError(suite.T(), err, errAttributeKey.Error(), "Reserved character in key accepted.")
+
+	_, err = AttributesFromPb([]*pb.Attribute{{Key: "a", Value: strings.Repeat("v", maxAttributeValue+1)}})
+	assert.EqualError(suite.T(), err, errAttributeValue.Error(), "Too long value accepted.")
+
+	var tooMany []*pb.Attribute
+	for i := 0; i <= maxAttributes; i++ {
+		tooMany = append(tooMany, &pb.Attribute{Key: fmt.Sprintf("key%03d", i)})
+	}
+
+	_, err = AttributesFromPb(tooMany)
+	assert.EqualError(suite.T(), err, errTooManyAttributes.Error(), "Too many attributes accepted.")
+}
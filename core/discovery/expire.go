@@ -0,0 +1,210 @@
+package discovery
+
+import (
+	"crypto/x509"
+	"errors"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+)
+
+var (
+	errNotExpired  = errors.New("Peer is not expired")
+	errStaleRejoin = errors.New("Expired peer tried to rejoin without a fresh note")
+	errCertExpired = errors.New("Certificate has expired")
+)
+
+// Remembers an expired peer so that stale certificates and notes
+// still gossiped by others do not bring it back.
+type tombstone struct {
+	cert      *x509.Certificate
+	epoch     uint64
+	timeStamp time.Time
+}
+
+func (v *View) setDown(id string) {
+	v.expireMutex.Lock()
+	defer v.expireMutex.Unlock()
+
+	v.downMap[id] = v.getClock().Now()
+}
+
+func (v *View) clearDown(id string) {
+	v.expireMutex.Lock()
+	defer v.expireMutex.Unlock()
+
+	delete(v.downMap, id)
+}
+
+func (v *View) downSince(id string) (time.Time, bool) {
+	v.expireMutex.RLock()
+	defer v.expireMutex.RUnlock()
+
+	t, ok := v.downMap[id]
+
+	return t, ok
+}
+
+// Returns true if the peer has recently been expired from the full view.
+func (v *View) Expired(id string) bool {
+	v.expireMutex.RLock()
+	defer v.expireMutex.RUnlock()
+
+	_, ok := v.expiredMap[id]
+
+	return ok
+}
+
+// Returns the certificate of a recently expired peer, nil if not expired.
+func (v *View) ExpiredCertificate(id string) *x509.Certificate {
+	v.expireMutex.RLock()
+	defer v.expireMutex.RUnlock()
+
+	if t, ok := v.expiredMap[id]; ok {
+		return t.cert
+	}
+
+	return nil
+}
+
+// Returns true if the certificate is no longer valid according to the view clock.
+func (v *View) CertExpired(cert *x509.Certificate) bool {
+	return v.getClock().Now().After(cert.NotAfter)
+}
+
+// Brings an expired peer back into the full view,
+// only allowed with a more recent note than the one it expired with.
+func (v *View) Rejoin(id string, epoch uint64) (*Peer, error) {
+	v.expireMutex.Lock()
+
+	t, ok := v.expiredMap[id]
+	if !ok {
+		v.expireMutex.Unlock()
+		return nil, errNotExpired
+	}
+
+	if epoch <= t.epoch {
+		v.expireMutex.Unlock()
+		return nil, errStaleRejoin
+	}
+
+	delete(v.expiredMap, id)
+
+	v.expireMutex.Unlock()
+
+	if v.CertExpired(t.cert) {
+		return nil, errCertExpired
+	}
+
+	if err := v.AddFull(id, t.cert); err != nil && err != errPeerAlreadyExists {
+		return nil, err
+	}
+
+	return v.Peer(id), nil
+}
+
+// Removes peers from the full view which have been out of the live view
+// longer than the expire timeout, or whose certificate has expired.
+// Expired peers are no longer advertised to others.
+func (v *View) CheckExpired() {
+	now := v.getClock().Now()
+
+	for _, p := range v.Full() {
+		if now.After(p.certificate().NotAfter) {
+			log.Debug("Certificate expired, removing from full view", "addr", p.Addr())
+			v.removeFull(p, false)
+			continue
+		}
+
+		if v.expireTimeout <= 0 {
+			continue
+		}
+
+		if since, ok := v.downSince(p.Id); ok && now.Sub(since) > v.expireTimeout {
+			log.Debug("Peer expired, removing from full view", "addr", p.Addr())
+			v.removeFull(p, true)
+		}
+	}
+
+	v.expireMutex.Lock()
+	defer v.expireMutex.Unlock()
+
+	for id, t := range v.expiredMap {
+		if now.Sub(t.timeStamp) > v.expireTimeout || now.After(t.cert.NotAfter) {
+			delete(v.expiredMap, id)
+		}
+	}
+}
+
+func (v *View) removeFull(p *Peer, tomb bool) {
+	var epoch uint64
+
+	if v.IsAlive(p.Id) {
+		v.RemoveLive(p.Id)
+	}
+
+	v.DeleteTimeout(p.Id)
+
+	v.rebuttalMutex.Lock()
+	delete(v.rebuttals, p.Id)
+	v.rebuttalMutex.Unlock()
+
+	v.addrMutex.Lock()
+	v.viewMutex.Lock()
+	delete(v.viewMap, p.Id)
+	v.unindexAddr(p.Addr(), p.Id)
+	v.viewMutex.Unlock()
+	v.addrMutex.Unlock()
+
+	if note := p.Note(); note != nil {
+		epoch = note.epoch
+	}
+
+	v.expireMutex.Lock()
+	defer v.expireMutex.Unlock()
+
+	delete(v.downMap, p.Id)
+
+	if tomb {
+		v.expiredMap[p.Id] = &tombstone{
+			cert:      p.certificate(),
+			epoch:     epoch,
+			timeStamp: v.getClock().Now(),
+		}
+		v.refreshNote = true
+	}
+}
+
+// Issues a new note with a higher epoch if peers expired since the last call.
+// Expiry is mutual during a partition, the expired peers only let this node
+// rejoin their views with a more recent note than the one it expired with.
+// Refreshes happen at most once per expire timeout, so a node losing peers one
+// by one does not bump and store its epoch for each of them.
+// Peers expiring meanwhile are covered by the next refresh, delaying their
+// rejoin by at most one expire timeout.
+func (v *View) RefreshExpiredNote() bool {
+	now := v.getClock().Now()
+
+	v.expireMutex.Lock()
+	if !v.refreshNote || now.Sub(v.noteRefreshed) < v.expireTimeout {
+		v.expireMutex.Unlock()
+		return false
+	}
+	v.refreshNote = false
+	v.noteRefreshed = now
+	v.expireMutex.Unlock()
+
+	v.self.noteMutex.Lock()
+	defer v.self.noteMutex.Unlock()
+
+	newNote := v.nextLocalNote(v.self.note.mask)
+
+	if err := v.signLocalNote(newNote); err != nil {
+		log.Error(err.Error())
+		return false
+	}
+
+	log.Info("Refreshed note after expiring peers", "epoch", newNote.epoch)
+
+	return true
+}
@@ -0,0 +1,225 @@
+package discovery
+
+import (
+	"errors"
+	"math/bits"
+)
+
+var (
+	errIdNotFound = errors.New("ring id not found.")
+)
+
+const (
+	maxIndexLevel = 32
+)
+
+// ringIndex keeps the ring ids of a single ring sorted in a skip list,
+// giving O(log n) insert, remove, successor and predecessor queries.
+// Node levels are derived from the id hashes, which are uniformly distributed,
+// so the structure is deterministic for a given set of members.
+type ringIndex struct {
+	head   *indexNode
+	tail   *indexNode
+	level  int
+	length int
+}
+
+type indexNode struct {
+	id   *ringId
+	next []*indexNode
+	prev *indexNode
+}
+
+func newRingIndex() *ringIndex {
+	return &ringIndex{
+		head:  &indexNode{next: make([]*indexNode, maxIndexLevel)},
+		level: 1,
+	}
+}
+
+// Returns the last node with a lower id than the given one at each level.
+func (ri *ringIndex) path(id *ringId) [maxIndexLevel]*indexNode {
+	var update [maxIndexLevel]*indexNode
+
+	curr := ri.head
+
+	for i := ri.level - 1; i >= 0; i-- {
+		for curr.next[i] != nil && curr.next[i].id.compare(id) == -1 {
+			curr = curr.next[i]
+		}
+		update[i] = curr
+	}
+
+	return update
+}
+
+// Adds the id to the index, returns errSameId if an id with
+// the same hash is already present.
+func (ri *ringIndex) insert(id *ringId) error {
+	update := ri.path(id)
+
+	if n := update[0].next[0]; n != nil && n.id.equal(id) {
+		return errSameId
+	}
+
+	lvl := nodeLevel(id.hash)
+	if lvl > ri.level {
+		for i := ri.level; i < lvl; i++ {
+			update[i] = ri.head
+		}
+		ri.level = lvl
+	}
+
+	n := &indexNode{
+		id:   id,
+		next: make([]*indexNode, lvl),
+	}
+
+	for i := 0; i < lvl; i++ {
+		n.next[i] = update[i].next[i]
+		update[i].next[i] = n
+	}
+
+	if update[0] != ri.head {
+		n.prev = update[0]
+	}
+
+	if n.next[0] != nil {
+		n.next[0].prev = n
+	} else {
+		ri.tail = n
+	}
+
+	ri.length++
+
+	return nil
+}
+
+func (ri *ringIndex) remove(id *ringId) error {
+	update := ri.path(id)
+
+	n := update[0].next[0]
+	if n == nil || !n.id.equal(id) {
+		return errIdNotFound
+	}
+
+	for i := 0; i < len(n.next); i++ {
+		if update[i].next[i] == n {
+			update[i].next[i] = n.next[i]
+		}
+	}
+
+	if n.next[0] != nil {
+		n.next[0].prev = n.prev
+	} else {
+		ri.tail = n.prev
+	}
+
+	for ri.level > 1 && ri.head.next[ri.level-1] == nil {
+		ri.level--
+	}
+
+	ri.length--
+
+	return nil
+}
+
+// Returns the stored id with the same hash as the given one, nil if not present.
+func (ri *ringIndex) get(id *ringId) *ringId {
+	update := ri.path(id)
+
+	if n := update[0].next[0]; n != nil && n.id.equal(id) {
+		return n.id
+	}
+
+	return nil
+}
+
+// Returns the first id following the given one on the ring,
+// the id does not have to be present in the index.
+func (ri *ringIndex) successor(id *ringId) *ringId {
+	if ri.length == 0 {
+		return nil
+	}
+
+	update := ri.path(id)
+
+	n := update[0].next[0]
+	if n != nil && n.id.equal(id) {
+		n = n.next[0]
+	}
+
+	if n == nil {
+		n = ri.head.next[0]
+	}
+
+	return n.id
+}
+
+// Returns the first id at or following the given one on the ring,
+// the id does not have to be present in the index.
+func (ri *ringIndex) ceiling(id *ringId) *ringId {
+	if ri.length == 0 {
+		return nil
+	}
+
+	update := ri.path(id)
+
+	n := update[0].next[0]
+	if n == nil {
+		n = ri.head.next[0]
+	}
+
+	return n.id
+}
+
+// Returns the first id preceding the given one on the ring,
+// the id does not have to be present in the index.
+func (ri *ringIndex) predecessor(id *ringId) *ringId {
+	if ri.length == 0 {
+		return nil
+	}
+
+	update := ri.path(id)
+
+	if n := update[0]; n != ri.head {
+		return n.id
+	}
+
+	return ri.tail.id
+}
+
+func (ri *ringIndex) len() int {
+	return ri.length
+}
+
+// Returns all ids in ascending order.
+func (ri *ringIndex) ids() []*ringId {
+	ret := make([]*ringId, 0, ri.length)
+
+	for n := ri.head.next[0]; n != nil; n = n.next[0] {
+		ret = append(ret, n.id)
+	}
+
+	return ret
+}
+
+// Each level is kept with probability 1/4,
+// decided by the trailing bits of the hash.
+func nodeLevel(hash []byte) int {
+	lvl := 1
+
+	for i := len(hash) - 1; i >= 0 && lvl < maxIndexLevel; i-- {
+		if hash[i] != 0 {
+			lvl += bits.TrailingZeros8(hash[i]) / 2
+			break
+		}
+		lvl += 4
+	}
+
+	if lvl > maxIndexLevel {
+		lvl = maxIndexLevel
+	}
+
+	return lvl
+}
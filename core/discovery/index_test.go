@@ -0,0 +1,242 @@
+package discovery
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	benchMembers = 10000
+	benchRings   = 10
+)
+
+type IndexTestSuite struct {
+	suite.Suite
+
+	index *ringIndex
+	ids   []*ringId
+}
+
+func TestIndexTestSuite(t *testing.T) {
+	r := log.Root()
+
+	r.SetHandler(log.DiscardHandler())
+	suite.Run(t, new(IndexTestSuite))
+}
+
+func (suite *IndexTestSuite) SetupTest() {
+	suite.index = newRingIndex()
+	suite.ids = nil
+
+	for i := 0; i < 100; i++ {
+		id := &ringId{
+			hash: hashId(1, []byte(fmt.Sprintf("testId%d", i))),
+		}
+
+		require.NoError(suite.T(), suite.index.insert(id), "Failed to insert id.")
+
+		suite.ids = append(suite.ids, id)
+	}
+
+	sort.Slice(suite.ids, func(i, j int) bool {
+		return suite.ids[i].compare(suite.ids[j]) == -1
+	})
+}
+
+func (suite *IndexTestSuite) TestInsert() {
+	require.Equal(suite.T(), len(suite.ids), suite.index.len(), "Wrong number of ids.")
+	assert.Equal(suite.T(), suite.ids, suite.index.ids(), "Ids not kept in ascending order.")
+
+	for _, id := range suite.ids {
+		assert.Equal(suite.T(), id, suite.index.get(id), "Inserted id not found.")
+	}
+}
+
+func (suite *IndexTestSuite) TestInsertCollision() {
+	dup := &ringId{
+		hash: suite.ids[10].hash,
+		p:    &Peer{Id: "collision"},
+	}
+
+	assert.EqualError(suite.T(), suite.index.insert(dup), errSameId.Error(),
+		"Should refuse an id with an existing hash.")
+	assert.Equal(suite.T(), len(suite.ids), suite.index.len(), "Collision altered the index.")
+	assert.Equal(suite.T(), suite.ids[10], suite.index.get(dup), "Collision replaced the existing id.")
+}
+
+func (suite *IndexTestSuite) TestRemove() {
+	for i := 0; i < len(suite.ids); i += 2 {
+		require.NoError(suite.T(), suite.index.remove(suite.ids[i]), "Failed to remove id.")
+	}
+
+	assert.Equal(suite.T(), len(suite.ids)/2, suite.index.len(), "Wrong number of ids after removal.")
+
+	for i, id := range suite.ids {
+		if i%2 == 0 {
+			assert.Nil(suite.T(), suite.index.get(id), "Removed id still present.")
+		} else {
+			assert.Equal(suite.T(), id, suite.index.get(id), "Remaining id not found.")
+		}
+	}
+
+	assert.EqualError(suite.T(), suite.index.remove(suite.ids[0]), errIdNotFound.Error(),
+		"Should return error when removing a non-existing id.")
+
+	for _, id := range suite.index.ids() {
+		require.NoError(suite.T(), suite.index.remove(id), "Failed to remove id.")
+	}
+
+	assert.Zero(suite.T(), suite.index.len(), "Index not empty.")
+	assert.Nil(suite.T(), suite.index.successor(suite.ids[0]), "Empty index returned a successor.")
+	assert.Nil(suite.T(), suite.index.predecessor(suite.ids[0]), "Empty index returned a predecessor.")
+}
+
+func (suite *IndexTestSuite) TestSuccessorAndPredecessor() {
+	num := len(suite.ids)
+
+	for i, id := range suite.ids {
+		assert.Equal(suite.T(), suite.ids[(i+1)%num], suite.index.successor(id), "Wrong successor.")
+		assert.Equal(suite.T(), suite.ids[(i-1+num)%num], suite.index.predecessor(id), "Wrong predecessor.")
+	}
+
+	between := &ringId{
+		hash: genHigherId(suite.ids[5].hash, 1),
+	}
+
+	assert.Equal(suite.T(), suite.ids[6], suite.index.successor(between), "Wrong successor of non-member.")
+	assert.Equal(suite.T(), suite.ids[5], suite.index.predecessor(between), "Wrong predecessor of non-member.")
+
+	low := &ringId{
+		hash: []byte{0},
+	}
+
+	assert.Equal(suite.T(), suite.ids[0], suite.index.successor(low), "Successor should wrap around.")
+	assert.Equal(suite.T(), suite.ids[num-1], suite.index.predecessor(low), "Predecessor should wrap around.")
+}
+
+func (suite *IndexTestSuite) TestCeiling() {
+	num := len(suite.ids)
+
+	for _, id := range suite.ids {
+		assert.Equal(suite.T(), id, suite.index.ceiling(id), "Member should be its own ceiling.")
+	}
+
+	between := &ringId{
+		hash: genHigherId(suite.ids[5].hash, 1),
+	}
+
+	assert.Equal(suite.T(), suite.ids[6], suite.index.ceiling(between), "Wrong ceiling of non-member.")
+
+	high := &ringId{
+		hash: genHigherId(suite.ids[num-1].hash, 1),
+	}
+
+	assert.Equal(suite.T(), suite.ids[0], suite.index.ceiling(high), "Ceiling should wrap around.")
+}
+
+func (suite *IndexTestSuite) TestSingleMember() {
+	index := newRingIndex()
+	id := suite.ids[0]
+
+	require.NoError(suite.T(), index.insert(id), "Failed to insert id.")
+
+	assert.Equal(suite.T(), id, index.successor(id), "Single member should be its own successor.")
+	assert.Equal(suite.T(), id, index.predecessor(id), "Single member should be its own predecessor.")
+}
+
+func (suite *IndexTestSuite) TestNodeLevel() {
+	assert.Equal(suite.T(), 1, nodeLevel([]byte{1}), "Odd hash should have level 1.")
+	assert.Equal(suite.T(), 2, nodeLevel([]byte{4}), "Wrong level.")
+	assert.Equal(suite.T(), 5, nodeLevel([]byte{1, 0}), "Wrong level across bytes.")
+	assert.Equal(suite.T(), maxIndexLevel, nodeLevel(make([]byte, 32)), "Level not capped.")
+}
+
+func benchPeers(num int) []*Peer {
+	peers := make([]*Peer, 0, num)
+
+	for i := 0; i < num; i++ {
+		peers = append(peers, &Peer{
+			Id:   fmt.Sprintf("benchId%d", i),
+			addr: fmt.Sprintf("benchAddr%d", i),
+		})
+	}
+
+	return peers
+}
+
+func benchRingsWithMembers(b *testing.B, peers []*Peer) *rings {
+	rs, err := createRings(&Peer{Id: "selfPeer"}, benchRings)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, p := range peers {
+		rs.add(p)
+	}
+
+	return rs
+}
+
+func BenchmarkRingsAdd(b *testing.B) {
+	r := log.Root()
+	r.SetHandler(log.DiscardHandler())
+
+	peers := benchPeers(benchMembers)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		benchRingsWithMembers(b, peers)
+	}
+}
+
+func BenchmarkRingsChurn(b *testing.B) {
+	r := log.Root()
+	r.SetHandler(log.DiscardHandler())
+
+	peers := benchPeers(benchMembers)
+	rs := benchRingsWithMembers(b, peers)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		p := peers[i%len(peers)]
+
+		rs.remove(p)
+		rs.add(p)
+	}
+}
+
+func BenchmarkRingsFindNeighbours(b *testing.B) {
+	r := log.Root()
+	r.SetHandler(log.DiscardHandler())
+
+	peers := benchPeers(benchMembers)
+	rs := benchRingsWithMembers(b, peers)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		rs.findNeighbours(peers[i%len(peers)].Id)
+	}
+}
+
+func BenchmarkRingsIsPredecessor(b *testing.B) {
+	r := log.Root()
+	r.SetHandler(log.DiscardHandler())
+
+	peers := benchPeers(benchMembers)
+	rs := benchRingsWithMembers(b, peers)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		rs.isPredecessor(peers[i%len(peers)], peers[(i+1)%len(peers)], uint32(i%benchRings)+1)
+	}
+}
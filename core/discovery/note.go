@@ -1,10 +1,10 @@
 package discovery
 
 import (
-	"crypto/ecdsa"
-	"crypto/rand"
+	"crypto"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/joonnna/ifrit/keys"
 	pb "github.com/joonnna/ifrit/protobuf"
 )
 
@@ -13,6 +13,10 @@ type Note struct {
 	mask  uint32
 	id    string
 	*signature
+
+	// Signed together with the rest of the note, never modified after creation.
+	attributes map[string]string
+	address    *pb.Address
 }
 
 func (n Note) IsRingDisabled(ringNum, numRings uint32) bool {
@@ -36,14 +40,21 @@ func (n *Note) IsMoreRecent(other uint64) bool {
 }
 
 func (n *Note) ToPbMsg() *pb.Note {
+	msg := n.unsignedPbMsg()
+
+	msg.Signature = n.signature.toPbMsg()
+
+	return msg
+}
+
+// Returns the note without its signature, which is what the signature covers.
+func (n *Note) unsignedPbMsg() *pb.Note {
 	return &pb.Note{
-		Epoch: n.epoch,
-		Id:    []byte(n.id),
-		Mask:  n.mask,
-		Signature: &pb.Signature{
-			R: n.r,
-			S: n.s,
-		},
+		Epoch:      n.epoch,
+		Id:         []byte(n.id),
+		Mask:       n.mask,
+		Attributes: attributesToPb(n.attributes),
+		Address:    n.address,
 	}
 }
 
@@ -54,7 +65,7 @@ func (n *Note) ToPbMsg() *pb.Note {
 */
 
 // ONLY FOR TESTING
-func NewNote(id string, epoch uint64, mask uint32, priv *ecdsa.PrivateKey) *pb.Note {
+func NewNote(id string, epoch uint64, mask uint32, priv crypto.Signer) *pb.Note {
 	n := &Note{
 		id:    id,
 		epoch: epoch,
@@ -69,6 +80,40 @@ func NewNote(id string, epoch uint64, mask uint32, priv *ecdsa.PrivateKey) *pb.N
 	return n.ToPbMsg()
 }
 
+// ONLY FOR TESTING
+func NewAttributeNote(id string, epoch uint64, mask uint32, attrs map[string]string, priv crypto.Signer) *pb.Note {
+	n := &Note{
+		id:         id,
+		epoch:      epoch,
+		mask:       mask,
+		attributes: attrs,
+	}
+
+	err := signNote(n, priv)
+	if err != nil {
+		panic(err)
+	}
+
+	return n.ToPbMsg()
+}
+
+// ONLY FOR TESTING
+func NewAddressNote(id string, epoch uint64, mask uint32, addr *pb.Address, priv crypto.Signer) *pb.Note {
+	n := &Note{
+		id:      id,
+		epoch:   epoch,
+		mask:    mask,
+		address: addr,
+	}
+
+	err := signNote(n, priv)
+	if err != nil {
+		panic(err)
+	}
+
+	return n.ToPbMsg()
+}
+
 // ONLY FOR TESTING
 func NewUnsignedNote(id string, epoch uint64, mask uint32) *pb.Note {
 	n := &Note{
@@ -82,32 +127,25 @@ func NewUnsignedNote(id string, epoch uint64, mask uint32) *pb.Note {
 }
 
 // ONLY FOR TESTING
-func signNote(n *Note, privKey *ecdsa.PrivateKey) error {
+func signNote(n *Note, privKey crypto.Signer) error {
 	if privKey == nil {
 		return errNoPrivKey
 	}
 
-	noteMsg := &pb.Note{
-		Epoch: n.epoch,
-		Id:    []byte(n.id),
-		Mask:  n.mask,
-	}
-
-	b, err := proto.Marshal(noteMsg)
+	b, err := proto.Marshal(n.unsignedPbMsg())
 	if err != nil {
 		return err
 	}
 
-	hash := hashContent(b)
-
-	r, s, err := ecdsa.Sign(rand.Reader, privKey, hash)
+	sign, err := keys.NewSignature(privKey, b)
 	if err != nil {
 		return err
 	}
 
 	n.signature = &signature{
-		r: r.Bytes(),
-		s: s.Bytes(),
+		r:         sign.GetR(),
+		s:         sign.GetS(),
+		algorithm: sign.GetAlgorithm(),
 	}
 
 	return nil
@@ -1,15 +1,17 @@
 package discovery
 
 import (
-	"crypto/ecdsa"
+	"crypto"
 	"crypto/x509"
 	"errors"
 	"math"
+	"math/big"
 	"sync"
 	"time"
 
 	"github.com/golang/protobuf/proto"
 	log "github.com/inconshreveable/log15"
+	"github.com/joonnna/ifrit/keys"
 	pb "github.com/joonnna/ifrit/protobuf"
 )
 
@@ -33,11 +35,15 @@ var (
 )
 
 type Peer struct {
-	Addr     string
-	PingAddr string
+	addr     string
+	pingAddr string
 
 	// Debuging and experiments only.
-	HttpAddr string
+	httpAddr string
+
+	// Epoch of the note which set the addresses, zero if they stem from the certificate.
+	addrEpoch uint64
+	addrMutex sync.RWMutex
 
 	noteMutex sync.RWMutex
 	note      *Note
@@ -45,18 +51,32 @@ type Peer struct {
 	accuseMutex sync.RWMutex
 	accusations map[uint32]*Accusation
 
-	Id        string
+	Id string
+
+	// Replaced when the peer renews its certificate.
 	cert      *x509.Certificate
-	publicKey *ecdsa.PublicKey
+	publicKey crypto.PublicKey
+	algorithm pb.SignatureAlgorithm
+	renewed   bool
+	certMutex sync.RWMutex
 
 	nPing      uint32
 	nPingMutex sync.RWMutex
 }
 
-// Ecdsa signature values
+// Signature values, ed25519 signatures are split into r and s.
 type signature struct {
-	r []byte
-	s []byte
+	r         []byte
+	s         []byte
+	algorithm pb.SignatureAlgorithm
+}
+
+func (s *signature) toPbMsg() *pb.Signature {
+	return &pb.Signature{
+		R:         s.r,
+		S:         s.s,
+		Algorithm: s.algorithm,
+	}
 }
 
 type timeout struct {
@@ -67,10 +87,8 @@ type timeout struct {
 }
 
 func newPeer(cert *x509.Certificate, numRings uint32) (*Peer, error) {
-	var ok bool
 	var i uint32
 	var http string
-	var pb *ecdsa.PublicKey
 
 	if numRings == 0 {
 		return nil, errNoRings
@@ -90,7 +108,8 @@ func newPeer(cert *x509.Certificate, numRings uint32) (*Peer, error) {
 		return nil, errPeerId
 	}
 
-	if pb, ok = cert.PublicKey.(*ecdsa.PublicKey); !ok {
+	alg, err := keys.Algorithm(cert.PublicKey)
+	if err != nil {
 		return nil, errPubKey
 	}
 
@@ -101,30 +120,82 @@ func newPeer(cert *x509.Certificate, numRings uint32) (*Peer, error) {
 	}
 
 	return &Peer{
-		Addr:        cert.Subject.Locality[0],
-		PingAddr:    cert.Subject.Locality[1],
-		HttpAddr:    http,
+		addr:        cert.Subject.Locality[0],
+		pingAddr:    cert.Subject.Locality[1],
+		httpAddr:    http,
 		cert:        cert,
 		Id:          string(cert.SubjectKeyId),
-		publicKey:   pb,
+		publicKey:   cert.PublicKey,
+		algorithm:   alg,
 		accusations: accMap,
 	}, nil
 
 }
 
+// Returns the rpc address of the peer.
+func (p *Peer) Addr() string {
+	p.addrMutex.RLock()
+	defer p.addrMutex.RUnlock()
+
+	return p.addr
+}
+
+// Returns the ping address of the peer.
+func (p *Peer) PingAddr() string {
+	p.addrMutex.RLock()
+	defer p.addrMutex.RUnlock()
+
+	return p.pingAddr
+}
+
+// Returns the http address of the peer, only used for debugging and experiments.
+func (p *Peer) HttpAddr() string {
+	p.addrMutex.RLock()
+	defer p.addrMutex.RUnlock()
+
+	return p.httpAddr
+}
+
 func (p *Peer) Certificate() []byte {
-	if p.cert == nil {
+	cert := p.certificate()
+	if cert == nil {
 		log.Error("Peer had no certificate")
 		return nil
 	}
 
-	return p.cert.Raw
+	return cert.Raw
+}
+
+func (p *Peer) SerialNumber() *big.Int {
+	cert := p.certificate()
+	if cert == nil {
+		return nil
+	}
+
+	return cert.SerialNumber
 }
 
-func (p *Peer) PublicKey() *ecdsa.PublicKey {
+func (p *Peer) PublicKey() crypto.PublicKey {
+	p.certMutex.RLock()
+	defer p.certMutex.RUnlock()
+
 	return p.publicKey
 }
 
+func (p *Peer) certificate() *x509.Certificate {
+	p.certMutex.RLock()
+	defer p.certMutex.RUnlock()
+
+	return p.cert
+}
+
+func (p *Peer) signatureAlgorithm() pb.SignatureAlgorithm {
+	p.certMutex.RLock()
+	defer p.certMutex.RUnlock()
+
+	return p.algorithm
+}
+
 func (p *Peer) CreateAccusation(accused *Note, self *Peer, ringNum uint32, sign signer) error {
 	p.accuseMutex.Lock()
 	defer p.accuseMutex.Unlock()
@@ -162,18 +233,20 @@ func (p *Peer) CreateAccusation(accused *Note, self *Peer, ringNum uint32, sign
 	}
 
 	acc.signature = &signature{
-		r: r,
-		s: s,
+		r:         r,
+		s:         s,
+		algorithm: self.signatureAlgorithm(),
 	}
 
 	p.accusations[acc.ringNum] = acc
 
-	log.Debug("Added accusation", "addr", p.Addr, "ring", acc.ringNum)
+	log.Debug("Added accusation", "addr", p.Addr(), "ring", acc.ringNum)
 
 	return nil
 }
 
-func (p *Peer) AddAccusation(accused, accuser string, epoch uint64, ringNum uint32, r, s []byte) error {
+// Adds the accusation signed by the accuser with the given algorithm.
+func (p *Peer) AddAccusation(accused, accuser string, epoch uint64, ringNum uint32, r, s []byte, alg pb.SignatureAlgorithm) error {
 	p.accuseMutex.Lock()
 	defer p.accuseMutex.Unlock()
 
@@ -203,14 +276,15 @@ func (p *Peer) AddAccusation(accused, accuser string, epoch uint64, ringNum uint
 		epoch:   epoch,
 		ringNum: ringNum,
 		signature: &signature{
-			r: r,
-			s: s,
+			r:         r,
+			s:         s,
+			algorithm: alg,
 		},
 	}
 
 	p.accusations[a.ringNum] = a
 
-	log.Debug("Added accusation", "addr", p.Addr, "ring", a.ringNum)
+	log.Debug("Added accusation", "addr", p.Addr(), "ring", a.ringNum)
 
 	return nil
 }
@@ -303,18 +377,21 @@ func (p *Peer) IsAccused() bool {
 	return false
 }
 
-func (p *Peer) AddNote(mask uint32, epoch uint64, r, s []byte) {
+func (p *Peer) AddNote(mask uint32, epoch uint64, attrs map[string]string, addr *pb.Address, r, s []byte) {
 	p.noteMutex.Lock()
 	defer p.noteMutex.Unlock()
 
 	if p.note == nil || p.note.IsMoreRecent(epoch) {
 		p.note = &Note{
-			id:    p.Id,
-			mask:  mask,
-			epoch: epoch,
+			id:         p.Id,
+			mask:       mask,
+			epoch:      epoch,
+			attributes: attrs,
+			address:    addr,
 			signature: &signature{
-				r: r,
-				s: s,
+				r:         r,
+				s:         s,
+				algorithm: p.signatureAlgorithm(),
 			},
 		}
 	}
@@ -331,18 +408,18 @@ func (p *Peer) Info() (*pb.Certificate, *pb.Note, []*pb.Accusation) {
 	var c *pb.Certificate
 	var n *pb.Note
 
-	if p.cert != nil {
+	if cert := p.certificate(); cert != nil {
 		c = &pb.Certificate{
-			Raw: p.cert.Raw,
+			Raw: cert.Raw,
 		}
 	} else {
-		log.Error("Had no certificate for peer", "addr", p.Addr)
+		log.Error("Had no certificate for peer", "addr", p.Addr())
 	}
 
 	if note := p.Note(); note != nil {
 		n = note.ToPbMsg()
 	} else {
-		log.Debug("No note existed for peer", "addr", p.Addr)
+		log.Debug("No note existed for peer", "addr", p.Addr())
 	}
 
 	accs := p.AllAccusations()
@@ -383,7 +460,7 @@ func (p *Peer) NumPing() uint32 {
 */
 
 // ONLY for testing
-func (p *Peer) NewNote(priv *ecdsa.PrivateKey, epoch uint64) {
+func (p *Peer) NewNote(priv crypto.Signer, epoch uint64) {
 	p.note = &Note{
 		id:    p.Id,
 		mask:  math.MaxUint32,
@@ -405,8 +482,9 @@ func (p *Peer) AddTestAccusation(a *pb.Accusation) {
 		accused: string(a.GetAccused()),
 		ringNum: a.GetRingNum(),
 		signature: &signature{
-			r: a.GetSignature().GetR(),
-			s: a.GetSignature().GetS(),
+			r:         a.GetSignature().GetR(),
+			s:         a.GetSignature().GetS(),
+			algorithm: a.GetSignature().GetAlgorithm(),
 		},
 	}
 	p.accusations[acc.ringNum] = acc
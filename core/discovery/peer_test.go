@@ -1,7 +1,9 @@
 package discovery
 
 import (
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/x509"
@@ -12,6 +14,7 @@ import (
 	"testing"
 
 	log "github.com/inconshreveable/log15"
+	pb "github.com/joonnna/ifrit/protobuf"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
@@ -105,6 +108,17 @@ func (suite *PeerTestSuite) TestNewPeer() {
 		},
 	}
 
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(suite.T(), err, "Failed to generate ed25519 key.")
+
+	edCert := &x509.Certificate{
+		SubjectKeyId: []byte("testId"),
+		Subject: pkix.Name{
+			Locality: []string{"rpcAddr", "pingAddr", "httpAddr"},
+		},
+		PublicKey: edPub,
+	}
+
 	tests := []struct {
 		in       *x509.Certificate
 		numRings uint32
@@ -115,7 +129,7 @@ func (suite *PeerTestSuite) TestNewPeer() {
 		httpAddr  string
 		accMapLen int
 		id        string
-		pub       ecdsa.PublicKey
+		alg       pb.SignatureAlgorithm
 	}{
 		{
 			in:        validCert,
@@ -156,6 +170,18 @@ func (suite *PeerTestSuite) TestNewPeer() {
 			numRings: suite.numRings,
 			err:      errPubKey,
 		},
+
+		{
+			in:        edCert,
+			numRings:  suite.numRings,
+			err:       nil,
+			addr:      edCert.Subject.Locality[0],
+			pingAddr:  edCert.Subject.Locality[1],
+			httpAddr:  edCert.Subject.Locality[2],
+			accMapLen: int(suite.numRings),
+			id:        string(edCert.SubjectKeyId),
+			alg:       pb.SignatureAlgorithm_ED25519,
+		},
 	}
 
 	for i, t := range tests {
@@ -167,13 +193,15 @@ func (suite *PeerTestSuite) TestNewPeer() {
 		} else {
 			require.NotNilf(suite.T(), p, "Invalid output for test %d", i)
 
-			require.Equalf(suite.T(), t.addr, p.Addr, "Invalid addr for test %d", i)
-			require.Equalf(suite.T(), t.pingAddr, p.PingAddr,
+			require.Equalf(suite.T(), t.addr, p.Addr(), "Invalid addr for test %d", i)
+			require.Equalf(suite.T(), t.pingAddr, p.PingAddr(),
 				"Invalid pingAddr for test %d", i)
-			require.Equalf(suite.T(), t.httpAddr, p.HttpAddr, "Invalid error for test %d", i)
+			require.Equalf(suite.T(), t.httpAddr, p.HttpAddr(), "Invalid error for test %d", i)
 			require.Equalf(suite.T(), t.accMapLen, len(p.accusations),
 				"Invalid len of accusations for test %d", i)
 			require.Equalf(suite.T(), t.id, p.Id, "Invalid id for test %d", i)
+			require.Equalf(suite.T(), t.in.PublicKey, p.PublicKey(), "Invalid public key for test %d", i)
+			require.Equalf(suite.T(), t.alg, p.algorithm, "Invalid algorithm for test %d", i)
 		}
 
 	}
@@ -220,7 +248,7 @@ func (suite *PeerTestSuite) TestPublicKey() {
 
 	tests := []struct {
 		p   *Peer
-		out *ecdsa.PublicKey
+		out crypto.PublicKey
 	}{
 		{
 			p:   p,
@@ -411,7 +439,7 @@ func (suite *PeerTestSuite) TestAddAccusation() {
 	}
 
 	for i, t := range tests {
-		err := t.p.AddAccusation(t.acc, t.accuser, t.epoch, t.ringNum, t.r, t.s)
+		err := t.p.AddAccusation(t.acc, t.accuser, t.epoch, t.ringNum, t.r, t.s, pb.SignatureAlgorithm_ECDSA)
 		require.Equalf(suite.T(), t.err, err, "Invalid error for test %d", i)
 
 		if t.err == nil {
@@ -707,7 +735,7 @@ func (suite *PeerTestSuite) TestAddNote() {
 
 	for i, t := range tests {
 		old := t.p.Note()
-		t.p.AddNote(t.mask, t.epoch, t.r, t.s)
+		t.p.AddNote(t.mask, t.epoch, nil, nil, t.r, t.s)
 		new := t.p.Note()
 
 		if t.replace {
@@ -0,0 +1,151 @@
+package discovery
+
+import (
+	"errors"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// Upper bound on the number of local mask changes remembered.
+const maxMaskHistory = 100
+
+var errEarlyReactivation = errors.New("Rings reactivated before an accusation-free period passed")
+
+// A change of the local note mask, disabled rings have their bit cleared.
+type MaskChange struct {
+	Epoch uint64
+	Mask  uint32
+	Time  time.Time
+}
+
+// Re-enables all disabled rings by issuing a new note with a higher epoch,
+// if no accusation has been rebutted for the configured period.
+// Returns true if a new note was issued, it has to be gossiped to take effect.
+func (v *View) ReactivateRings() bool {
+	if v.reactivateTimeout <= 0 {
+		return false
+	}
+
+	v.self.noteMutex.Lock()
+	defer v.self.noteMutex.Unlock()
+
+	full := fullMask(v.rings.numRings)
+
+	if v.self.note.mask == full {
+		return false
+	}
+
+	if v.getClock().Since(v.lastRebuttal) < v.reactivateTimeout {
+		return false
+	}
+
+	newNote := v.nextLocalNote(full)
+
+	err := v.signLocalNote(newNote)
+	if err != nil {
+		log.Error(err.Error())
+		return false
+	}
+
+	v.deactivatedRings = 0
+
+	log.Info("Reactivated rings", "epoch", newNote.epoch)
+
+	return true
+}
+
+// Records that the peer was accused, restarting its accusation-free period.
+func (v *View) RecordAccusation(id string) {
+	v.rebuttalMutex.Lock()
+	defer v.rebuttalMutex.Unlock()
+
+	v.rebuttals[id] = v.getClock().Now()
+}
+
+// Records the mask of an accepted note from the peer, disabling rings
+// (a rebuttal) restarts the accusation-free period of the peer.
+func (v *View) RecordMask(id string, prev *Note, mask uint32) {
+	disabled := fullMask(v.rings.numRings) &^ mask
+
+	if disabled&^disabledRings(prev, v.rings.numRings) == 0 {
+		return
+	}
+
+	v.RecordAccusation(id)
+}
+
+// Returns an error if the mask re-enables rings disabled by the previous note
+// of the peer, before the peer went a reactivation period without being accused
+// or rebutting. Reactivations are refused if reactivation is disabled.
+// The period is measured from when this node saw the last accusation or rebuttal,
+// members learning of it later refuse the reactivation until their own period passed.
+// The peer keeps gossiping its note, so every member accepts it eventually,
+// at most one reactivation period after it learned of the last accusation.
+func (v *View) ValidReactivation(id string, prev *Note, mask uint32) error {
+	if disabledRings(prev, v.rings.numRings)&mask == 0 {
+		return nil
+	}
+
+	if v.reactivateTimeout <= 0 {
+		return errEarlyReactivation
+	}
+
+	v.rebuttalMutex.RLock()
+	defer v.rebuttalMutex.RUnlock()
+
+	if v.getClock().Since(v.rebuttals[id]) < v.reactivateTimeout {
+		return errEarlyReactivation
+	}
+
+	return nil
+}
+
+// Returns the rings disabled by the note, none if there is no note.
+func disabledRings(n *Note, numRings uint32) uint32 {
+	if n == nil {
+		return 0
+	}
+
+	return fullMask(numRings) &^ n.mask
+}
+
+// Returns all changes to the local note mask, oldest first.
+func (v *View) MaskHistory() []MaskChange {
+	v.maskMutex.RLock()
+	defer v.maskMutex.RUnlock()
+
+	ret := make([]MaskChange, len(v.maskHistory))
+	copy(ret, v.maskHistory)
+
+	return ret
+}
+
+func (v *View) recordMask(n *Note) {
+	v.maskMutex.Lock()
+	defer v.maskMutex.Unlock()
+
+	if l := len(v.maskHistory); l > 0 && v.maskHistory[l-1].Mask == n.mask {
+		return
+	}
+
+	v.maskHistory = append(v.maskHistory, MaskChange{
+		Epoch: n.epoch,
+		Mask:  n.mask,
+		Time:  v.getClock().Now(),
+	})
+
+	if len(v.maskHistory) > maxMaskHistory {
+		v.maskHistory = v.maskHistory[1:]
+	}
+}
+
+func fullMask(numRings uint32) uint32 {
+	var i, mask uint32
+
+	for i = 0; i < numRings; i++ {
+		mask = setBit(mask, i)
+	}
+
+	return mask
+}
@@ -0,0 +1,112 @@
+package discovery
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/joonnna/ifrit/keys"
+)
+
+var (
+	errRenewedId    = errors.New("Renewed certificate carries another id")
+	errStaleCert    = errors.New("Certificate is not more recent than the current one")
+	errUnknownPeer  = errors.New("Peer of renewed certificate not found in full view")
+	errSameCert     = errors.New("Certificate is already in use")
+	errRenewedLocal = errors.New("Renewed local certificate carries another id")
+)
+
+// Replaces the certificate of a peer in the full view with a renewed one.
+// The caller has to verify the certificate, the continuity with the current certificate
+// is checked here: the renewed certificate has to carry the same id and be issued later.
+// Notes signed with the previous key are no longer accepted afterwards.
+func (v *View) RenewCertificate(cert *x509.Certificate) error {
+	if cert == nil {
+		return errNoCert
+	}
+
+	p := v.Peer(string(cert.SubjectKeyId))
+	if p == nil {
+		return errUnknownPeer
+	}
+
+	if err := p.renewCertificate(cert); err != nil {
+		return err
+	}
+
+	log.Info("Peer renewed its certificate", "addr", p.Addr(), "serial", cert.SerialNumber.String())
+
+	return nil
+}
+
+// Replaces the local certificate with a renewed one and issues a new local note
+// signed with the new key, which has to be in use by the signer already.
+// The note has to be gossiped to take effect.
+func (v *View) RenewLocalCertificate(cert *x509.Certificate) error {
+	if cert == nil {
+		return errNoCert
+	}
+
+	if string(cert.SubjectKeyId) != v.self.Id {
+		return errRenewedLocal
+	}
+
+	if err := v.self.renewCertificate(cert); err != nil {
+		return err
+	}
+
+	v.self.noteMutex.Lock()
+	defer v.self.noteMutex.Unlock()
+
+	return v.signLocalNote(v.nextLocalNote(v.self.note.mask))
+}
+
+// Returns the certificate of the peer with the given id, also of recently expired peers.
+// Returns nil if the id is unknown.
+func (v *View) KnownCertificate(id string) *x509.Certificate {
+	if p := v.Peer(id); p != nil {
+		return p.certificate()
+	}
+
+	return v.ExpiredCertificate(id)
+}
+
+func (p *Peer) renewCertificate(cert *x509.Certificate) error {
+	if string(cert.SubjectKeyId) != p.Id {
+		return errRenewedId
+	}
+
+	alg, err := keys.Algorithm(cert.PublicKey)
+	if err != nil {
+		return errPubKey
+	}
+
+	p.certMutex.Lock()
+	defer p.certMutex.Unlock()
+
+	if bytes.Equal(p.cert.Raw, cert.Raw) {
+		return errSameCert
+	}
+
+	// Certificates carry their issuing time with a resolution of seconds,
+	// a stale certificate can hence never replace a more recent one.
+	if !cert.NotBefore.After(p.cert.NotBefore) {
+		return errStaleCert
+	}
+
+	p.cert = cert
+	p.publicKey = cert.PublicKey
+	p.algorithm = alg
+	p.renewed = true
+
+	return nil
+}
+
+// Returns true if the peer has replaced the certificate it joined with.
+func (p *Peer) Renewed() bool {
+	p.certMutex.RLock()
+	defer p.certMutex.RUnlock()
+
+	return p.renewed
+}
@@ -5,6 +5,8 @@ import (
 	"crypto/sha256"
 	"errors"
 	"fmt"
+	"math/big"
+	"sort"
 
 	log "github.com/inconshreveable/log15"
 )
@@ -13,7 +15,6 @@ var (
 	errSameId             = errors.New("Nodes have identical id!?!?!?")
 	errAlreadyExists      = errors.New("Node already exists")
 	errRemoveSelf         = errors.New("Tried to remove myself from ring?!")
-	errLostSelf           = errors.New("Lost track of myself within ring")
 	errRingMemberNotFound = errors.New("Ring member not found")
 	errInvalidRingNum     = errors.New("Invalid ring number")
 	errNoSelf             = errors.New("No self id provided")
@@ -21,6 +22,9 @@ var (
 	errRingIdNotFound     = errors.New("Peer with the provided id not found")
 )
 
+// Number of positions on a ring, ids are placed by their sha256 hash.
+var ringSize = new(big.Int).Lsh(big.NewInt(1), 256)
+
 type rings struct {
 	ringMap  map[uint32]*ring
 	numRings uint32
@@ -33,11 +37,9 @@ type ring struct {
 
 	peerToRing map[string]*ringId
 
-	succList []*ringId
-	length   int
+	index *ringIndex
 
-	selfIdx uint32
-	selfId  *ringId
+	selfId *ringId
 }
 
 type ringId struct {
@@ -77,17 +79,36 @@ func createRings(self *Peer, numRings uint32) (*rings, error) {
 	return rs, nil
 }
 
-func (rs *rings) add(p *Peer) []string {
+// Adds the peer to all rings, returns the addresses of replaced neighbours.
+// Peers colliding with another peer on any ring are added to none of them.
+func (rs *rings) add(p *Peer) ([]string, error) {
+	if err := rs.collides(p.Id); err != nil {
+		return nil, err
+	}
+
 	oldNeighbours := make([]string, 0)
 
 	for _, ring := range rs.ringMap {
-		old := ring.add(p)
-		if old != nil {
-			oldNeighbours = append(oldNeighbours, old...)
+		old, err := ring.add(p)
+		if err != nil {
+			return nil, err
 		}
+
+		oldNeighbours = append(oldNeighbours, old...)
 	}
 
-	return oldNeighbours
+	return oldNeighbours, nil
+}
+
+// Returns errSameId if the id hashes to the position of another peer on any ring.
+func (rs *rings) collides(id string) error {
+	for _, ring := range rs.ringMap {
+		if err := ring.collides(id); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func (rs *rings) remove(p *Peer) {
@@ -214,6 +235,109 @@ func (rs *rings) shouldBeMyNeighbour(id string) bool {
 	return false
 }
 
+// Returns the peer responsible for the given key on the given ring,
+// which is the first peer placed at or after the key's ring position.
+func (rs *rings) responsible(ringNum uint32, key []byte) (*Peer, error) {
+	r, ok := rs.ringMap[ringNum]
+	if !ok {
+		return nil, errInvalidRingNum
+	}
+
+	return r.index.ceiling(keyId(ringNum, key)).p, nil
+}
+
+// Returns up to num distinct peers responsible for the given key.
+// The first candidate on each ring is the responsible peer, further candidates
+// are their successors, visited round-robin across rings.
+func (rs *rings) replicas(key []byte, num int) []*Peer {
+	var i uint32
+
+	ret := make([]*Peer, 0, num)
+	exists := make(map[string]bool)
+
+	curr := make([]*ringId, rs.numRings)
+	ids := make([]*ringId, rs.numRings)
+
+	for i = 0; i < rs.numRings; i++ {
+		ids[i] = keyId(i+1, key)
+	}
+
+	members := rs.ringMap[1].index.len()
+
+	for step := 0; step < members && len(ret) < num; step++ {
+		for i = 0; i < rs.numRings && len(ret) < num; i++ {
+			r := rs.ringMap[i+1]
+
+			if curr[i] == nil {
+				curr[i] = r.index.ceiling(ids[i])
+			} else {
+				curr[i] = r.index.successor(curr[i])
+			}
+
+			p := curr[i].p
+			if _, ok := exists[p.Id]; !ok {
+				exists[p.Id] = true
+				ret = append(ret, p)
+			}
+		}
+	}
+
+	return ret
+}
+
+// Returns my ring successors closer to the peer with the given id than myself, closest first.
+// The distance to a peer is its shortest clockwise distance on any ring,
+// each step along the successors therefore gets closer to the peer.
+func (rs *rings) closerSuccessors(id string) []*Peer {
+	var ret []*Peer
+
+	own := rs.distance(rs.self.Id, id)
+	dists := make(map[string]*big.Int)
+
+	for _, r := range rs.ringMap {
+		succ := r.successor().p
+		if succ.Id == rs.self.Id {
+			continue
+		}
+
+		if _, ok := dists[succ.Id]; ok {
+			continue
+		}
+
+		if d := rs.distance(succ.Id, id); d.Cmp(own) < 0 {
+			dists[succ.Id] = d
+			ret = append(ret, succ)
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return dists[ret[i].Id].Cmp(dists[ret[j].Id]) < 0
+	})
+
+	return ret
+}
+
+// Returns the shortest clockwise distance from one id to another across all rings.
+func (rs *rings) distance(from, to string) *big.Int {
+	var ret *big.Int
+
+	for num := range rs.ringMap {
+		start := new(big.Int).SetBytes(hashId(num, []byte(from)))
+		end := new(big.Int).SetBytes(hashId(num, []byte(to)))
+
+		d := end.Sub(end, start)
+		if d.Sign() < 0 {
+			d.Add(d, ringSize)
+		}
+
+		if ret == nil || d.Cmp(ret) < 0 {
+			ret = d
+		}
+	}
+
+	return ret
+}
+
 func newRing(ringNum uint32, self *Peer) *ring {
 	id := &ringId{
 		p:    self,
@@ -222,24 +346,23 @@ func newRing(ringNum uint32, self *Peer) *ring {
 
 	r := &ring{
 		ringNum:    ringNum,
-		succList:   []*ringId{id},
+		index:      newRingIndex(),
 		selfId:     id,
 		peerToRing: make(map[string]*ringId),
-		length:     1,
 	}
 
+	r.index.insert(id)
 	r.peerToRing[self.Id] = id
 
 	return r
 }
 
-func (r *ring) add(p *Peer) []string {
-	var idx int
+func (r *ring) add(p *Peer) ([]string, error) {
 	var oldNeighbours []string
 
 	if _, ok := r.peerToRing[p.Id]; ok {
-		log.Error("Peer already exists in ring", "ringNum", r.ringNum, "addr", p.Addr)
-		return nil
+		log.Error("Peer already exists in ring", "ringNum", r.ringNum, "addr", p.Addr())
+		return nil, nil
 	}
 
 	hash := hashId(r.ringNum, []byte(p.Id))
@@ -252,35 +375,40 @@ func (r *ring) add(p *Peer) []string {
 	oldSucc := r.successor()
 	oldPrev := r.predecessor()
 
-	r.succList, idx = insert(r.succList, id, r.length)
-	if uint32(idx) <= r.selfIdx {
-		r.selfIdx += 1
+	// Two different ids hashing to the same ring position would make
+	// neighbour relations ambiguous, refuse the newcomer instead.
+	if err := r.index.insert(id); err != nil {
+		return nil, err
 	}
-	r.length++
 
 	if new := r.successor(); !new.equal(oldSucc) {
-		oldNeighbours = append(oldNeighbours, oldSucc.p.Addr)
+		oldNeighbours = append(oldNeighbours, oldSucc.p.Addr())
 	}
 
 	if new := r.predecessor(); !new.equal(oldPrev) {
-		oldNeighbours = append(oldNeighbours, oldPrev.p.Addr)
-	}
-
-	if eq := r.succList[r.selfIdx].equal(r.selfId); !eq {
-		log.Error(errLostSelf.Error())
+		oldNeighbours = append(oldNeighbours, oldPrev.p.Addr())
 	}
 
 	r.peerToRing[p.Id] = id
 
-	succ := r.succAtIdx(idx).p
-	prev := r.prevAtIdx(idx).p
+	succ := r.index.successor(id).p
+	prev := r.index.predecessor(id).p
 
 	acc := succ.RingAccusation(r.ringNum)
 	if acc != nil && acc.IsAccuser(prev.Id) {
 		succ.RemoveRingAccusation(r.ringNum)
 	}
 
-	return oldNeighbours
+	return oldNeighbours, nil
+}
+
+func (r *ring) collides(id string) error {
+	existing := r.index.get(&ringId{hash: hashId(r.ringNum, []byte(id))})
+	if existing != nil && existing.p.Id != id {
+		return errSameId
+	}
+
+	return nil
 }
 
 func (r *ring) remove(p *Peer) {
@@ -288,36 +416,21 @@ func (r *ring) remove(p *Peer) {
 	var ok bool
 
 	if rId, ok = r.peerToRing[p.Id]; !ok {
-		log.Error("Peer does not exists in ring", "ringNum", r.ringNum, "addr", p.Addr)
+		log.Error("Peer does not exists in ring", "ringNum", r.ringNum, "addr", p.Addr())
 		return
 	}
 
-	if r.length == 0 {
-		log.Error("Successor list is already empty.")
+	if rId.equal(r.selfId) {
+		log.Error(errRemoveSelf.Error())
 		return
 	}
 
-	idx, err := search(r.succList, rId, r.length)
-	if err != nil {
+	if err := r.index.remove(rId); err != nil {
 		log.Error(err.Error())
 		return
 	}
 
-	if uint32(idx) < r.selfIdx {
-		r.selfIdx -= 1
-	} else if uint32(idx) == r.selfIdx {
-		log.Error(errRemoveSelf.Error())
-		return
-	}
-
-	r.succList = append(r.succList[:idx], r.succList[idx+1:]...)
-	r.length--
-
 	delete(r.peerToRing, p.Id)
-
-	if eq := r.succList[r.selfIdx].equal(r.selfId); !eq {
-		log.Error(errLostSelf.Error())
-	}
 }
 
 func (r *ring) isPrev(p, toCheck *Peer) bool {
@@ -334,17 +447,12 @@ func (r *ring) isPrev(p, toCheck *Peer) bool {
 	}
 
 	if !deadAcc && !deadAccuser {
-		if !rId.equal(r.selfId) {
-			i, err := search(r.succList, rId, r.length)
-			if err != nil {
-				log.Error(err.Error())
-				return false
-			}
-
-			return r.prevAtIdx(i).equal(toCheckId)
-		} else {
-			return r.predecessor().equal(toCheckId)
+		if r.index.get(rId) == nil {
+			log.Error(errIdNotFound.Error())
+			return false
 		}
+
+		return r.index.predecessor(rId).equal(toCheckId)
 	} else if deadAcc && !deadAccuser {
 		accId := &ringId{
 			hash: hashId(r.ringNum, []byte(p.Id)),
@@ -352,22 +460,14 @@ func (r *ring) isPrev(p, toCheck *Peer) bool {
 
 		// No need for self check, i will never consider myself dead.
 
-		_, prev := findSuccAndPrev(r.succList, accId, r.length)
-
-		return isBetween(prev, accId, toCheckId)
+		return isBetween(r.index.predecessor(accId), accId, toCheckId)
 
 	} else if !deadAcc && deadAccuser {
 		accuserId := &ringId{
 			hash: hashId(r.ringNum, []byte(toCheck.Id)),
 		}
 
-		if !rId.equal(r.selfId) {
-			_, prev := findSuccAndPrev(r.succList, rId, r.length)
-
-			return isBetween(prev, rId, accuserId)
-		} else {
-			return isBetween(r.predecessor(), rId, accuserId)
-		}
+		return isBetween(r.index.predecessor(rId), rId, accuserId)
 	} else {
 		accId := &ringId{
 			hash: hashId(r.ringNum, []byte(p.Id)),
@@ -377,9 +477,7 @@ func (r *ring) isPrev(p, toCheck *Peer) bool {
 			hash: hashId(r.ringNum, []byte(toCheck.Id)),
 		}
 
-		_, prev := findSuccAndPrev(r.succList, accId, r.length)
-
-		return isBetween(prev, accId, accuserId)
+		return isBetween(r.index.predecessor(accId), accId, accuserId)
 	}
 }
 
@@ -387,7 +485,7 @@ func (r *ring) betweenNeighbours(other string) bool {
 	var id *ringId
 	var ok bool
 
-	if r.length <= 1 {
+	if r.index.len() <= 1 {
 		return true
 	}
 
@@ -410,7 +508,7 @@ func (r *ring) neighbours(id string) (*ringId, *ringId) {
 	var ok bool
 	var rId *ringId
 
-	if r.length <= 1 {
+	if r.index.len() <= 1 {
 		return r.selfId, r.selfId
 	}
 
@@ -422,7 +520,7 @@ func (r *ring) neighbours(id string) (*ringId, *ringId) {
 		}
 	}
 
-	return findSuccAndPrev(r.succList, rId, r.length)
+	return r.index.successor(rId), r.index.predecessor(rId)
 }
 
 func isBetween(start, end, new *ringId) bool {
@@ -456,19 +554,22 @@ func isBetween(start, end, new *ringId) bool {
 }
 
 func (r *ring) successor() *ringId {
-	return succ(r.succList, int(r.selfIdx), r.length)
+	return r.index.successor(r.selfId)
 }
 
 func (r *ring) predecessor() *ringId {
-	return prev(r.succList, int(r.selfIdx), r.length)
+	return r.index.predecessor(r.selfId)
 }
 
-func (r *ring) succAtIdx(idx int) *ringId {
-	return succ(r.succList, idx, r.length)
-}
+// Keys are placed on the rings the same way as peer ids.
+// The key is copied as hashId appends to it.
+func keyId(ringNum uint32, key []byte) *ringId {
+	k := make([]byte, len(key))
+	copy(k, key)
 
-func (r *ring) prevAtIdx(idx int) *ringId {
-	return prev(r.succList, idx, r.length)
+	return &ringId{
+		hash: hashId(ringNum, k),
+	}
 }
 
 func hashId(ringNum uint32, id []byte) []byte {
@@ -63,7 +63,7 @@ func (suite *RingsTestSuite) SetupTest() {
 	require.NoError(suite.T(), err, "Could not create rings.")
 
 	for _, r := range rs.ringMap {
-		require.Equal(suite.T(), 1, len(r.succList), "Self peer not in rings.")
+		require.Equal(suite.T(), 1, r.index.len(), "Self peer not in rings.")
 	}
 
 	suite.rings = rs
@@ -133,23 +133,47 @@ func (suite *RingsTestSuite) TestAdd() {
 	suite.rings.add(p)
 
 	for _, r := range suite.rings.ringMap {
-		require.Equal(suite.T(), 2, len(r.succList), "Peer not added to ring.")
+		require.Equal(suite.T(), 2, r.index.len(), "Peer not added to ring.")
 	}
 
 	suite.rings.add(p)
 
 	for _, r := range suite.rings.ringMap {
-		require.Equal(suite.T(), 2, len(r.succList), "Should not be able to add peer twice.")
+		require.Equal(suite.T(), 2, r.index.len(), "Should not be able to add peer twice.")
 	}
 
 	suite.rings.add(suite.rings.self)
 
 	for _, r := range suite.rings.ringMap {
-		require.Equal(suite.T(), 2, len(r.succList), "Should not be able to add self.")
+		require.Equal(suite.T(), 2, r.index.len(), "Should not be able to add self.")
 	}
 
 }
 
+func (suite *RingsTestSuite) TestAddCollision() {
+	p := &Peer{
+		Id: "testId",
+	}
+
+	// Another peer occupies the position of the new one on a single ring.
+	other := &Peer{
+		Id: "otherId",
+	}
+
+	r := suite.rings.ringMap[suite.rings.numRings]
+	id := &ringId{hash: hashId(r.ringNum, []byte(p.Id)), p: other}
+	require.NoError(suite.T(), r.index.insert(id), "Failed to insert colliding id.")
+	r.peerToRing[other.Id] = id
+
+	_, err := suite.rings.add(p)
+	require.EqualError(suite.T(), err, errSameId.Error(), "Colliding peer added.")
+
+	for _, r := range suite.rings.ringMap {
+		_, ok := r.peerToRing[p.Id]
+		assert.False(suite.T(), ok, "Colliding peer added to a ring.")
+	}
+}
+
 func (suite *RingsTestSuite) TestRemove() {
 	p := &Peer{
 		Id: "testId",
@@ -158,25 +182,25 @@ func (suite *RingsTestSuite) TestRemove() {
 	suite.rings.add(p)
 
 	for _, r := range suite.rings.ringMap {
-		require.Equal(suite.T(), 2, len(r.succList), "Peer not added to ring.")
+		require.Equal(suite.T(), 2, r.index.len(), "Peer not added to ring.")
 	}
 
 	suite.rings.remove(p)
 
 	for _, r := range suite.rings.ringMap {
-		require.Equal(suite.T(), 1, len(r.succList), "Peer not removed from rings.")
+		require.Equal(suite.T(), 1, r.index.len(), "Peer not removed from rings.")
 	}
 
 	suite.rings.remove(p)
 
 	for _, r := range suite.rings.ringMap {
-		require.Equal(suite.T(), 1, len(r.succList), "Removing peer twice alters ring state.")
+		require.Equal(suite.T(), 1, r.index.len(), "Removing peer twice alters ring state.")
 	}
 
 	suite.rings.remove(suite.rings.self)
 
 	for _, r := range suite.rings.ringMap {
-		require.Equal(suite.T(), 1, len(r.succList), "Removed self.")
+		require.Equal(suite.T(), 1, r.index.len(), "Removed self.")
 	}
 
 }
@@ -336,6 +360,99 @@ func (suite *RingsTestSuite) TestShouldBeMyNeighbour() {
 	assert.True(suite.T(), suite.rings.shouldBeMyNeighbour(p.Id), "Should be neighbour with the only existing peer.")
 }
 
+func (suite *RingsTestSuite) TestResponsible() {
+	key := []byte("testKey")
+
+	p, err := suite.rings.responsible(1, key)
+	require.NoError(suite.T(), err, "Returned error on valid ring.")
+	assert.Equal(suite.T(), suite.rings.self, p, "Should be responsible with only myself in rings.")
+
+	for i := 0; i < 20; i++ {
+		suite.rings.add(&Peer{
+			Id: fmt.Sprintf("testId%d", i),
+		})
+	}
+
+	for _, r := range suite.rings.ringMap {
+		p, err := suite.rings.responsible(r.ringNum, key)
+		require.NoError(suite.T(), err, "Returned error on valid ring.")
+
+		kId := keyId(r.ringNum, key)
+		pId := r.peerToRing[p.Id]
+
+		assert.True(suite.T(), isBetween(r.index.predecessor(pId), pId, kId),
+			"Key not placed between responsible peer and its predecessor.")
+		assert.NotEqual(suite.T(), 0, r.index.predecessor(pId).compare(kId),
+			"Predecessor placed at key should be responsible.")
+	}
+
+	_, err = suite.rings.responsible(suite.rings.numRings+1, key)
+	assert.EqualError(suite.T(), err, errInvalidRingNum.Error(), "Returned no error with invalid ring number.")
+}
+
+func (suite *RingsTestSuite) TestReplicas() {
+	key := []byte("testKey")
+
+	replicas := suite.rings.replicas(key, 3)
+	require.Len(suite.T(), replicas, 1, "Should only return myself with only myself in rings.")
+
+	for i := 0; i < 20; i++ {
+		suite.rings.add(&Peer{
+			Id: fmt.Sprintf("testId%d", i),
+		})
+	}
+
+	replicas = suite.rings.replicas(key, 10)
+	require.Len(suite.T(), replicas, 10, "Returned wrong number of replicas.")
+
+	first, err := suite.rings.responsible(1, key)
+	require.NoError(suite.T(), err, "Returned error on valid ring.")
+	assert.Equal(suite.T(), first, replicas[0], "First replica should be responsible on the first ring.")
+
+	exists := make(map[string]bool)
+	for _, p := range replicas {
+		_, ok := exists[p.Id]
+		require.False(suite.T(), ok, "All replicas should be unique.")
+		exists[p.Id] = true
+	}
+
+	assert.Equal(suite.T(), replicas, suite.rings.replicas(key, 10), "Replicas should be stable.")
+	assert.Len(suite.T(), suite.rings.replicas(key, 100), 21, "Should return at most all members.")
+}
+
+func (suite *RingsTestSuite) TestCloserSuccessors() {
+	var peers []*Peer
+
+	for i := 0; i < 20; i++ {
+		p := &Peer{
+			Id: fmt.Sprintf("testId%d", i),
+		}
+		suite.rings.add(p)
+		peers = append(peers, p)
+	}
+
+	dest := peers[7]
+
+	own := suite.rings.distance(suite.rings.self.Id, dest.Id)
+
+	closer := suite.rings.closerSuccessors(dest.Id)
+	require.NotEmpty(suite.T(), closer, "Successor on the closest ring is always closer.")
+
+	prev := big.NewInt(0)
+
+	for _, p := range closer {
+		d := suite.rings.distance(p.Id, dest.Id)
+
+		assert.Equal(suite.T(), -1, d.Cmp(own), "Successor not closer than myself.")
+		assert.NotEqual(suite.T(), -1, d.Cmp(prev), "Successors not ordered by distance.")
+
+		prev = d
+	}
+
+	assert.Equal(suite.T(), 0, suite.rings.distance(dest.Id, dest.Id).Sign(), "Distance to itself not zero.")
+	assert.Empty(suite.T(), suite.rings.closerSuccessors(suite.rings.self.Id), "Successors closer to myself.")
+}
+
 func (suite *RingsTestSuite) TestNewRing() {
 	var ringNum uint32 = 1
 
@@ -345,15 +462,13 @@ func (suite *RingsTestSuite) TestNewRing() {
 
 	r := newRing(ringNum, self)
 
-	assert.Zero(suite.T(), r.selfIdx, "Selfidx should start at 0.")
 	assert.Equal(suite.T(), ringNum, r.ringNum, "Incorrect ringNumber.")
-	require.NotNil(suite.T(), r.succList, "Successor list not allocated..")
+	require.NotNil(suite.T(), r.index, "Ring index not allocated.")
 	require.NotNil(suite.T(), r.peerToRing, "Peer to ring map not allocated.")
 	assert.Equal(suite.T(), self, r.selfId.p, "Self is incorrect.")
 
-	require.Equal(suite.T(), 1, len(r.succList), "Self not added to successor list.")
-	require.Equal(suite.T(), len(r.succList), int(r.length), "Self not added to successor list.")
-	assert.Equal(suite.T(), r.succList[0].p, self, "Self not added to internal ringId.")
+	require.Equal(suite.T(), 1, r.index.len(), "Self not added to successor list.")
+	assert.Equal(suite.T(), r.index.ids()[0].p, self, "Self not added to internal ringId.")
 
 	assert.Equal(suite.T(), 1, len(r.peerToRing), "Self not added to peerToRing map.")
 }
@@ -369,31 +484,24 @@ func (suite *RingTestSuite) TestRingAdd() {
 
 	r.add(p)
 
-	assert.Equal(suite.T(), 2, len(r.succList), "Peer not added to successor list.")
-	assert.Equal(suite.T(), 2, r.length, "Peer not added to successor list.")
+	assert.Equal(suite.T(), 2, r.index.len(), "Peer not added to successor list.")
 	assert.Equal(suite.T(), 2, len(r.peerToRing), "Peer not added to peerToRing map.")
 
-	for idx, rId := range r.succList {
+	for _, rId := range r.index.ids() {
 		if rId.p.Id == p.Id {
 			require.Equal(suite.T(), rId.p, p, "Wrong peer representation stored.")
 			found = true
-			if idx == 0 {
-				require.Equal(suite.T(), r.selfIdx, uint32(1), "Self index not incremented.")
-			} else {
-				require.Equal(suite.T(), r.selfIdx, uint32(0), "Self index should not have been incremented.")
-			}
 		}
 	}
 
-	require.True(suite.T(), found, "Did not find peerId in succList.")
+	require.True(suite.T(), found, "Did not find peerId in ring index.")
 
 	mapPeer, ok := r.peerToRing[p.Id]
 	require.True(suite.T(), ok, "Peer not found in map.")
 	require.Equal(suite.T(), mapPeer.p, p, "Wrong peer representation stored.")
 
 	r.add(p)
-	assert.Equal(suite.T(), 2, len(r.succList), "Adding peer twice should fail.")
-	assert.Equal(suite.T(), 2, r.length, "Adding peer twice should fail.")
+	assert.Equal(suite.T(), 2, r.index.len(), "Adding peer twice should fail.")
 	assert.Equal(suite.T(), 2, len(r.peerToRing), "Adding peer twice should fail.")
 
 	// TODO test for accusation removal.
@@ -409,27 +517,24 @@ func (suite *RingTestSuite) TestRingRemove() {
 	r.add(p)
 
 	r.remove(p)
-	assert.Zero(suite.T(), r.selfIdx, "Self index changed incorrectly.")
+	assert.Equal(suite.T(), r.selfId, r.index.get(r.selfId), "Self removed incorrectly.")
 
-	for _, rId := range r.succList {
+	for _, rId := range r.index.ids() {
 		require.NotEqual(suite.T(), rId.p.Id, p.Id, "Peer still present in ring after being removed.")
 	}
 
-	assert.Equal(suite.T(), 1, r.length, "SuccList has wrong number of elements.")
-	assert.Equal(suite.T(), 1, len(r.succList), "SuccList has wrong number of elements.")
+	assert.Equal(suite.T(), 1, r.index.len(), "SuccList has wrong number of elements.")
 	assert.Equal(suite.T(), 1, len(r.peerToRing), "PeerToRing map has wrong number of elements.")
 
 	r.remove(p)
-	assert.Equal(suite.T(), 1, r.length, "Removing self should fail.")
-	assert.Equal(suite.T(), 1, len(r.succList), "Removing same peer twice should fail.")
+	assert.Equal(suite.T(), 1, r.index.len(), "Removing same peer twice should fail.")
 	assert.Equal(suite.T(), 1, len(r.peerToRing), "Removing same peer twice should fail.")
-	assert.Zero(suite.T(), r.selfIdx, "Self index changed incorrectly.")
+	assert.Equal(suite.T(), r.selfId, r.index.get(r.selfId), "Self removed incorrectly.")
 
 	r.remove(r.selfId.p)
-	assert.Equal(suite.T(), 1, r.length, "Removing self should fail.")
-	assert.Equal(suite.T(), 1, len(r.succList), "Removing self should fail.")
+	assert.Equal(suite.T(), 1, r.index.len(), "Removing self should fail.")
 	assert.Equal(suite.T(), 1, len(r.peerToRing), "Removing self should fail.")
-	assert.Zero(suite.T(), r.selfIdx, "Self index changed incorrectly.")
+	assert.Equal(suite.T(), r.selfId, r.index.get(r.selfId), "Self removed incorrectly.")
 }
 
 func (suite *RingTestSuite) TestIsPrev() {
@@ -443,22 +548,22 @@ func (suite *RingTestSuite) TestIsPrev() {
 		r.add(p)
 	}
 
-	p1 := r.succList[0].p
-	p1Succ := r.succList[1].p
-	p1Prev := r.succList[len(r.succList)-1].p
+	p1 := r.index.ids()[0].p
+	p1Succ := r.index.ids()[1].p
+	p1Prev := r.index.ids()[r.index.len()-1].p
 
 	r.remove(p1)
 
-	p2 := r.succList[3].p
-	p2Succ := r.succList[4].p
-	p2Prev := r.succList[2].p
+	p2 := r.index.ids()[3].p
+	p2Succ := r.index.ids()[4].p
+	p2Prev := r.index.ids()[2].p
 
 	r.remove(p2)
 	r.remove(p2Succ)
 	r.remove(p2Prev)
 
-	p3 := r.succList[6]
-	p3Prev := r.succList[5].p
+	p3 := r.index.ids()[6]
+	p3Prev := r.index.ids()[5].p
 	r.remove(p3.p)
 	r.peerToRing[p3.p.Id] = p3
 
@@ -470,7 +575,7 @@ func (suite *RingTestSuite) TestIsPrev() {
 		out     bool
 	}{
 		{
-			acc:     r.succList[r.selfIdx].p,
+			acc:     r.selfId.p,
 			accuser: selfPrev,
 			out:     true,
 		},
@@ -547,7 +652,7 @@ func (suite *RingTestSuite) TestBetweenNeighbours() {
 
 	succ := r.successor()
 	prev := r.predecessor()
-	for _, rId := range r.succList {
+	for _, rId := range r.index.ids() {
 		if eq := rId.equal(r.selfId); eq {
 			assert.True(suite.T(), r.betweenNeighbours(rId.p.Id), "Should return true with self id.")
 		} else if !succ.equal(rId) && !prev.equal(rId) {
@@ -574,7 +679,7 @@ func (suite *RingTestSuite) TestNeigbours() {
 
 	r.add(p)
 
-	for _, rId := range r.succList {
+	for _, rId := range r.index.ids() {
 		ids = append(ids, rId.p.Id)
 	}
 
@@ -635,11 +740,7 @@ func (suite *RingTestSuite) TestSuccessor() {
 
 	r.add(p)
 
-	if r.selfIdx == 0 {
-		succ = r.succList[1]
-	} else {
-		succ = r.succList[0]
-	}
+	succ = r.peerToRing[p.Id]
 
 	assert.Equal(suite.T(), succ, r.successor(), "Returned wrong successor.")
 
@@ -656,55 +757,11 @@ func (suite *RingTestSuite) TestPredecessor() {
 
 	r.add(p)
 
-	if r.selfIdx == 0 {
-		prev = r.succList[1]
-	} else {
-		prev = r.succList[0]
-	}
+	prev = r.peerToRing[p.Id]
 
 	assert.Equal(suite.T(), prev, r.predecessor(), "Returned wrong predecessor.")
 }
 
-func (suite *RingTestSuite) TestSuccAtIdx() {
-	var idx int
-
-	r := suite.ring
-
-	p := &Peer{
-		Id: "testId",
-	}
-
-	r.add(p)
-
-	if r.selfIdx == 0 {
-		idx = 1
-	} else {
-		idx = 0
-	}
-
-	assert.Equal(suite.T(), r.succList[idx], r.succAtIdx(int(r.selfIdx)), "Returned wrong successor.")
-}
-
-func (suite *RingTestSuite) TestPrevAtIdx() {
-	var idx int
-
-	r := suite.ring
-
-	p := &Peer{
-		Id: "testId",
-	}
-
-	r.add(p)
-
-	if r.selfIdx == 0 {
-		idx = 1
-	} else {
-		idx = 0
-	}
-
-	assert.Equal(suite.T(), r.succList[idx], r.prevAtIdx(int(r.selfIdx)), "Returned wrong predecessor.")
-}
-
 func (suite *RingTestSuite) TestHashId() {
 	r := suite.ring
 
@@ -11,8 +11,8 @@ import (
 
 	gpb "github.com/golang/protobuf/proto"
 	log "github.com/inconshreveable/log15"
+	"github.com/joonnna/ifrit/clock"
 	"github.com/joonnna/ifrit/protobuf"
-	pb "github.com/joonnna/ifrit/protobuf"
 	"github.com/spf13/viper"
 )
 
@@ -37,6 +37,21 @@ type View struct {
 	timeoutMap   map[string]*timeout
 	timeoutMutex sync.RWMutex
 
+	// When peers in the full view were last seen in the live view,
+	// and recently expired peers which may only return with a fresh note.
+	downMap    map[string]time.Time
+	expiredMap map[string]*tombstone
+
+	// Set when peers expired since the local note was last refreshed,
+	// and when it was last refreshed for expired peers.
+	refreshNote   bool
+	noteRefreshed time.Time
+	expireMutex   sync.RWMutex
+
+	// Ids of the peers in the full view, keyed by rpc address.
+	addrIndex map[string]map[string]bool
+	addrMutex sync.RWMutex
+
 	rings *rings
 
 	currGossipRing  uint32
@@ -45,9 +60,25 @@ type View struct {
 	maxByz           uint32
 	deactivatedRings uint32
 
+	// Guarded by the note mutex of the local peer.
+	lastRebuttal      time.Time
+	reactivateTimeout time.Duration
+
+	// When each peer was last accused or disabled rings,
+	// its disabled rings are only reactivated after an accusation-free period.
+	rebuttals     map[string]time.Time
+	rebuttalMutex sync.RWMutex
+
+	maskHistory []MaskChange
+	maskMutex   sync.RWMutex
+
 	removalTimeout float64
+	expireTimeout  time.Duration
 	updateTimeout  time.Duration
 
+	clock      clock.Clock
+	clockMutex sync.RWMutex
+
 	self *Peer
 
 	cm connectionManager
@@ -65,8 +96,6 @@ type signer interface {
 }
 
 func NewView(numRings uint32, cert *x509.Certificate, cm connectionManager, s signer) (*View, error) {
-	var i, mask uint32
-
 	maxByz := (float64(numRings) / 2.0) - 1
 	if maxByz < 0 {
 		maxByz = 0
@@ -87,6 +116,10 @@ func NewView(numRings uint32, cert *x509.Certificate, cm connectionManager, s si
 		viewMap:         make(map[string]*Peer),
 		liveMap:         make(map[string]*Peer),
 		timeoutMap:      make(map[string]*timeout),
+		downMap:         make(map[string]time.Time),
+		expiredMap:      make(map[string]*tombstone),
+		rebuttals:       make(map[string]time.Time),
+		addrIndex:       make(map[string]map[string]bool),
 		maxByz:          uint32(maxByz),
 		currGossipRing:  1,
 		currMonitorRing: 1,
@@ -94,19 +127,20 @@ func NewView(numRings uint32, cert *x509.Certificate, cm connectionManager, s si
 		cm:              cm,
 		exitChan:        make(chan bool, 1),
 		s:               s,
+		clock:           clock.New(),
 
 		removalTimeout: viper.GetFloat64("dead_timeout"),
+		expireTimeout: time.Second * time.Duration(viper.
+			GetInt32("expire_timeout")),
+		reactivateTimeout: time.Second * time.Duration(viper.
+			GetInt32("reactivate_timeout")),
 		updateTimeout: time.Second * time.Duration(viper.
 			GetInt32("view_update_interval")),
 	}
 
-	for i = 0; i < numRings; i++ {
-		mask = setBit(mask, i)
-	}
-
 	localNote := &Note{
 		epoch: 1,
-		mask:  mask,
+		mask:  fullMask(numRings),
 		id:    self.Id,
 	}
 
@@ -124,8 +158,9 @@ func (v *View) Start() {
 		case <-v.exitChan:
 			log.Info("Stopping view update")
 			return
-		case <-time.After(v.updateTimeout):
-			v.checkTimeouts()
+		case <-v.getClock().After(v.updateTimeout):
+			v.CheckTimeouts()
+			v.CheckExpired()
 		}
 	}
 }
@@ -134,6 +169,21 @@ func (v *View) Stop() {
 	close(v.exitChan)
 }
 
+// Replaces the clock used for timeouts, should be set before the view is started.
+func (v *View) SetClock(c clock.Clock) {
+	v.clockMutex.Lock()
+	defer v.clockMutex.Unlock()
+
+	v.clock = c
+}
+
+func (v *View) getClock() clock.Clock {
+	v.clockMutex.RLock()
+	defer v.clockMutex.RUnlock()
+
+	return v.clock
+}
+
 func (v *View) NumRings() uint32 {
 	return v.rings.numRings
 }
@@ -190,6 +240,18 @@ func (v *View) Live() []*Peer {
 }
 
 func (v *View) AddFull(id string, cert *x509.Certificate) error {
+	// Peers colliding with a live peer on any ring are refused.
+	v.liveMutex.RLock()
+	err := v.rings.collides(id)
+	v.liveMutex.RUnlock()
+	if err != nil {
+		log.Error(err.Error())
+		return err
+	}
+
+	v.addrMutex.Lock()
+	defer v.addrMutex.Unlock()
+
 	v.viewMutex.Lock()
 	defer v.viewMutex.Unlock()
 
@@ -205,6 +267,9 @@ func (v *View) AddFull(id string, cert *x509.Certificate) error {
 	}
 
 	v.viewMap[p.Id] = p
+	v.indexAddr(p.Addr(), p.Id)
+
+	v.setDown(p.Id)
 
 	return nil
 }
@@ -240,21 +305,37 @@ func (v *View) MonitorTarget() (*Peer, uint32) {
 	return v.rings.myRingSuccessor(v.currMonitorRing), ringNum
 }
 
+// Peers that can not be placed on all rings are removed from the full view.
 func (v *View) AddLive(p *Peer) {
+	if err := v.addLive(p); err != nil {
+		log.Error(err.Error(), "addr", p.Addr())
+		v.removeFull(p, false)
+	}
+}
+
+func (v *View) addLive(p *Peer) error {
 	v.liveMutex.Lock()
 	defer v.liveMutex.Unlock()
 
 	if _, ok := v.liveMap[p.Id]; ok {
-		log.Error("Tried to add peer twice to liveMap", "addr", p.Addr)
-		return
+		log.Error("Tried to add peer twice to liveMap", "addr", p.Addr())
+		return nil
+	}
+
+	old, err := v.rings.add(p)
+	if err != nil {
+		return err
 	}
 
 	v.liveMap[p.Id] = p
 
-	old := v.rings.add(p)
+	v.clearDown(p.Id)
+
 	for _, addr := range old {
 		v.cm.CloseConn(addr)
 	}
+
+	return nil
 }
 
 func (v *View) MyRingNeighbours(ringNum uint32) (*Peer, *Peer) {
@@ -280,14 +361,24 @@ func (v *View) RemoveLive(id string) {
 
 		delete(v.liveMap, peer.Id)
 
-		v.cm.CloseConn(peer.Addr)
+		v.setDown(peer.Id)
+
+		v.cm.CloseConn(peer.Addr())
 
-		log.Debug("Removed livePeer", "addr", peer.Addr)
+		log.Debug("Removed livePeer", "addr", peer.Addr())
 	} else {
 		log.Debug("Tried to remove non-existing peer from live view.")
 	}
 }
 
+// Removes the peer from both the full and live view,
+// it can be added again if its certificate is presented later.
+func (v *View) RemoveFull(id string) {
+	if p := v.Peer(id); p != nil {
+		v.removeFull(p, false)
+	}
+}
+
 func (v *View) StartTimer(accused *Peer, n *Note, observer *Peer) error {
 	v.timeoutMutex.Lock()
 	defer v.timeoutMutex.Unlock()
@@ -324,7 +415,7 @@ func (v *View) StartTimer(accused *Peer, n *Note, observer *Peer) error {
 	} else {
 		newTimeout = &timeout{
 			observer:  observer,
-			timeStamp: time.Now(),
+			timeStamp: v.getClock().Now(),
 			lastNote:  n,
 			accused:   accused,
 		}
@@ -332,7 +423,7 @@ func (v *View) StartTimer(accused *Peer, n *Note, observer *Peer) error {
 
 	v.timeoutMap[accused.Id] = newTimeout
 
-	log.Debug("Started timer", "addr", accused.Addr)
+	log.Debug("Started timer", "addr", accused.Addr())
 
 	return nil
 }
@@ -366,15 +457,16 @@ func (v *View) allTimeouts() []*timeout {
 	return ret
 }
 
-func (v *View) checkTimeouts() {
+// Removes all accused peers from the live view whose timeout has expired.
+func (v *View) CheckTimeouts() {
 	timeouts := v.allTimeouts()
 	if numTimeouts := len(timeouts); numTimeouts > 0 {
 		log.Debug("Have timeouts", "amount", numTimeouts)
 	}
 
 	for _, t := range timeouts {
-		if time.Since(t.timeStamp).Seconds() > v.removalTimeout {
-			log.Debug("Timeout expired, removing from live", "addr", t.accused.Addr)
+		if v.getClock().Since(t.timeStamp).Seconds() > v.removalTimeout {
+			log.Debug("Timeout expired, removing from live", "addr", t.accused.Addr())
 			v.RemoveLive(t.accused.Id)
 			v.DeleteTimeout(t.accused.Id)
 		}
@@ -388,6 +480,8 @@ func (v *View) ShouldRebuttal(epoch uint64, ringNum uint32) bool {
 	if eq := v.self.note.Equal(epoch); eq {
 		newMask := v.self.note.mask
 
+		v.lastRebuttal = v.getClock().Now()
+
 		mask, err := v.deactivateRing(ringNum)
 		if err != nil {
 			log.Error(err.Error())
@@ -395,11 +489,7 @@ func (v *View) ShouldRebuttal(epoch uint64, ringNum uint32) bool {
 			newMask = mask
 		}
 
-		newNote := &Note{
-			id:    v.self.Id,
-			epoch: v.self.note.epoch + 1,
-			mask:  newMask,
-		}
+		newNote := v.nextLocalNote(newMask)
 
 		err = v.signLocalNote(newNote)
 		if err != nil {
@@ -414,6 +504,59 @@ func (v *View) ShouldRebuttal(epoch uint64, ringNum uint32) bool {
 	}
 }
 
+// Replaces the local note with one more recent than the given epoch,
+// used to continue from the note of a previous run with the same identity.
+// The given mask is kept if valid, otherwise all rings are enabled.
+func (v *View) RestoreNote(epoch uint64, mask uint32) error {
+	v.self.noteMutex.Lock()
+	defer v.self.noteMutex.Unlock()
+
+	if curr := v.self.note.epoch; curr > epoch {
+		epoch = curr
+	}
+
+	full := fullMask(v.rings.numRings)
+	mask &= full
+
+	if mask == 0 || validMask(mask, v.rings.numRings, v.maxByz) != nil {
+		mask = full
+	}
+
+	newNote := v.nextLocalNote(mask)
+	newNote.epoch = epoch + 1
+
+	err := v.signLocalNote(newNote)
+	if err != nil {
+		return err
+	}
+
+	v.deactivatedRings = v.rings.numRings - uint32(bits.OnesCount32(mask))
+
+	// Disabled rings are kept for a full period before being reactivated.
+	if mask != full {
+		v.lastRebuttal = v.getClock().Now()
+	}
+
+	return nil
+}
+
+// Replaces the attributes of the local note by issuing a new note with a higher epoch,
+// it has to be gossiped to take effect.
+func (v *View) SetAttributes(attrs map[string]string) error {
+	err := validAttributes(attrs)
+	if err != nil {
+		return err
+	}
+
+	v.self.noteMutex.Lock()
+	defer v.self.noteMutex.Unlock()
+
+	newNote := v.nextLocalNote(v.self.note.mask)
+	newNote.attributes = copyAttributes(attrs)
+
+	return v.signLocalNote(newNote)
+}
+
 func (v *View) ShouldBeNeighbour(id string) bool {
 	v.liveMutex.RLock()
 	defer v.liveMutex.RUnlock()
@@ -428,6 +571,30 @@ func (v *View) FindNeighbours(id string) []*Peer {
 	return v.rings.findNeighbours(id)
 }
 
+// Returns the live peer responsible for the given key on the given ring.
+func (v *View) Responsible(ringNum uint32, key []byte) (*Peer, error) {
+	v.liveMutex.RLock()
+	defer v.liveMutex.RUnlock()
+
+	return v.rings.responsible(ringNum, key)
+}
+
+// Returns the live ring successors closer to the peer with the given id than ourselves, closest first.
+func (v *View) CloserSuccessors(id string) []*Peer {
+	v.liveMutex.RLock()
+	defer v.liveMutex.RUnlock()
+
+	return v.rings.closerSuccessors(id)
+}
+
+// Returns up to num distinct live peers responsible for the given key.
+func (v *View) Replicas(key []byte, num int) []*Peer {
+	v.liveMutex.RLock()
+	defer v.liveMutex.RUnlock()
+
+	return v.rings.replicas(key, num)
+}
+
 func (v *View) ValidAccuser(accused, accuser *Peer, ringNum uint32) bool {
 	v.liveMutex.RLock()
 	defer v.liveMutex.RUnlock()
@@ -532,14 +699,20 @@ func (v *View) deactivateRing(ringNumber uint32) (uint32, error) {
 	return clearBit(currMask, ringIdx), nil
 }
 
-func (v *View) signLocalNote(n *Note) error {
-	pbNote := &pb.Note{
-		Epoch: n.epoch,
-		Mask:  n.mask,
-		Id:    []byte(n.id),
+// Returns an unsigned successor of the local note with the given mask,
+// keeping its attributes and address. The caller has to hold the local note mutex.
+func (v *View) nextLocalNote(mask uint32) *Note {
+	return &Note{
+		id:         v.self.Id,
+		epoch:      v.self.note.epoch + 1,
+		mask:       mask,
+		attributes: v.self.note.attributes,
+		address:    v.self.note.address,
 	}
+}
 
-	bytes, err := gpb.Marshal(pbNote)
+func (v *View) signLocalNote(n *Note) error {
+	bytes, err := gpb.Marshal(n.unsignedPbMsg())
 	if err != nil {
 		return err
 	}
@@ -550,12 +723,15 @@ func (v *View) signLocalNote(n *Note) error {
 	}
 
 	n.signature = &signature{
-		r: r,
-		s: s,
+		r:         r,
+		s:         s,
+		algorithm: v.self.signatureAlgorithm(),
 	}
 
 	v.self.note = n
 
+	v.recordMask(n)
+
 	return err
 }
 
@@ -600,6 +776,9 @@ func hasBit(n uint32, pos uint32) bool {
 
 // ONLY for testing
 func (v *View) RemoveTestFull(id string) {
+	if p, ok := v.viewMap[id]; ok {
+		v.unindexAddr(p.Addr(), id)
+	}
 	delete(v.viewMap, id)
 }
 
@@ -8,11 +8,14 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"fmt"
+	"math"
 	"os"
 	"testing"
 	"time"
 
 	log "github.com/inconshreveable/log15"
+	"github.com/joonnna/ifrit/clock"
+	pb "github.com/joonnna/ifrit/protobuf"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
@@ -310,6 +313,35 @@ func (suite *ViewTestSuite) TestAddLive() {
 	assert.True(suite.T(), ok, "Adding peer twice does not alter state.")
 }
 
+func (suite *ViewTestSuite) TestAddCollision() {
+	view := suite.v
+
+	privKey, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	require.NoError(suite.T(), err, "Failed to generate private key.")
+
+	require.NoError(suite.T(), view.AddFull("testId", validCert("testId", privKey.Public())), "Failed to add peer.")
+	p := view.Peer("testId")
+
+	// A live peer occupies the position of the new one on a single ring.
+	other := &Peer{
+		Id: "otherId",
+	}
+
+	r := view.rings.ringMap[view.rings.numRings]
+	id := &ringId{hash: hashId(r.ringNum, []byte(p.Id)), p: other}
+	require.NoError(suite.T(), r.index.insert(id), "Failed to insert colliding id.")
+	r.peerToRing[other.Id] = id
+
+	view.AddLive(p)
+
+	assert.False(suite.T(), view.IsAlive(p.Id), "Colliding peer added to live view.")
+	assert.False(suite.T(), view.Exists(p.Id), "Colliding peer kept in full view.")
+
+	err = view.AddFull("testId", validCert("testId", privKey.Public()))
+	assert.EqualError(suite.T(), err, errSameId.Error(), "Colliding peer added to full view.")
+	assert.False(suite.T(), view.Exists(p.Id), "Colliding peer added to full view.")
+}
+
 func (suite *ViewTestSuite) TestRingNeighbours() {
 	var i uint32
 
@@ -506,7 +538,7 @@ func (suite *ViewTestSuite) TestAllTimeouts() {
 func (suite *ViewTestSuite) TestCheckTimeouts() {
 	view := suite.v
 
-	view.checkTimeouts()
+	view.CheckTimeouts()
 	assert.Zero(suite.T(), len(view.timeoutMap), "Does not alter state when there are no timeouts.")
 
 	accused := &Peer{
@@ -533,7 +565,7 @@ func (suite *ViewTestSuite) TestCheckTimeouts() {
 
 	view.timeoutMap[accused.Id] = t
 
-	view.checkTimeouts()
+	view.CheckTimeouts()
 	require.Equal(suite.T(), 1, len(view.timeoutMap), "Timeout removed before expiration.")
 
 	_, ok := view.timeoutMap[accused.Id]
@@ -542,13 +574,146 @@ func (suite *ViewTestSuite) TestCheckTimeouts() {
 	// 10 years in the past
 	t.timeStamp = t.timeStamp.AddDate(-10, 0, 0)
 
-	view.checkTimeouts()
+	view.CheckTimeouts()
 	require.Zero(suite.T(), len(view.timeoutMap), "Timeout not removed after expiration.")
 
 	_, ok = view.timeoutMap[accused.Id]
 	require.False(suite.T(), ok, "Timeout not removed from map after expiration.")
 }
 
+func (suite *ViewTestSuite) TestCheckExpired() {
+	view := suite.v
+
+	c := clock.NewManual(time.Unix(0, 0))
+	view.SetClock(c)
+	view.expireTimeout = time.Second * 100
+
+	privKey, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	require.NoError(suite.T(), err, "Failed to generate private key.")
+
+	cert := validCert("testId", privKey.Public())
+	cert.NotAfter = c.Now().Add(time.Hour)
+
+	require.NoError(suite.T(), view.AddFull("testId", cert), "Failed to add peer.")
+	p := view.Peer("testId")
+	view.AddLive(p)
+
+	c.Advance(time.Second * 200)
+	view.CheckExpired()
+	require.True(suite.T(), view.Exists(p.Id), "Live peer expired.")
+
+	view.RemoveLive(p.Id)
+
+	c.Advance(time.Second * 50)
+	view.CheckExpired()
+	require.True(suite.T(), view.Exists(p.Id), "Peer expired before timeout.")
+
+	c.Advance(time.Second * 60)
+	view.CheckExpired()
+	require.False(suite.T(), view.Exists(p.Id), "Peer not expired after timeout.")
+	assert.True(suite.T(), view.Expired(p.Id), "Expired peer not remembered.")
+	assert.Equal(suite.T(), cert, view.ExpiredCertificate(p.Id), "Wrong certificate remembered.")
+
+	_, ok := view.State().GetExistingHosts()[p.Id]
+	assert.False(suite.T(), ok, "Expired peer still advertised.")
+
+	c.Advance(time.Second * 110)
+	view.CheckExpired()
+	assert.False(suite.T(), view.Expired(p.Id), "Expired peer remembered forever.")
+
+	cert2 := validCert("testId2", privKey.Public())
+	cert2.NotAfter = c.Now().Add(time.Second * 10)
+
+	require.NoError(suite.T(), view.AddFull("testId2", cert2), "Failed to add peer.")
+	view.AddLive(view.Peer("testId2"))
+
+	c.Advance(time.Second * 20)
+	view.CheckExpired()
+	assert.False(suite.T(), view.Exists("testId2"), "Peer with expired certificate not removed.")
+	assert.False(suite.T(), view.IsAlive("testId2"), "Peer with expired certificate still alive.")
+	assert.False(suite.T(), view.Expired("testId2"), "Peer with expired certificate can not rejoin.")
+}
+
+func (suite *ViewTestSuite) TestRefreshExpiredNote() {
+	view := suite.v
+
+	c := clock.NewManual(time.Unix(0, 0))
+	view.SetClock(c)
+	view.expireTimeout = time.Second * 100
+
+	privKey, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	require.NoError(suite.T(), err, "Failed to generate private key.")
+
+	for _, id := range []string{"testId", "testId2"} {
+		cert := validCert(id, privKey.Public())
+		cert.NotAfter = c.Now().Add(time.Hour)
+
+		require.NoError(suite.T(), view.AddFull(id, cert), "Failed to add peer.")
+		view.AddLive(view.Peer(id))
+	}
+
+	epoch := view.Self().Note().epoch
+
+	require.False(suite.T(), view.RefreshExpiredNote(), "Note refreshed without expired peers.")
+
+	view.RemoveLive("testId")
+	c.Advance(time.Second * 60)
+	view.RemoveLive("testId2")
+
+	c.Advance(time.Second * 41)
+	view.CheckExpired()
+	require.True(suite.T(), view.Expired("testId"), "Peer not expired.")
+
+	require.True(suite.T(), view.RefreshExpiredNote(), "Note not refreshed after expiring peer.")
+	assert.Equal(suite.T(), epoch+1, view.Self().Note().epoch, "Refreshed note not more recent.")
+
+	c.Advance(time.Second * 60)
+	view.CheckExpired()
+	require.True(suite.T(), view.Expired("testId2"), "Peer not expired.")
+
+	assert.False(suite.T(), view.RefreshExpiredNote(), "Note refreshed twice within the expire timeout.")
+	assert.Equal(suite.T(), epoch+1, view.Self().Note().epoch, "Epoch bumped within the expire timeout.")
+
+	c.Advance(time.Second * 41)
+	assert.True(suite.T(), view.RefreshExpiredNote(), "Pending refresh not issued after the expire timeout.")
+	assert.Equal(suite.T(), epoch+2, view.Self().Note().epoch, "Refreshed note not more recent.")
+	assert.False(suite.T(), view.RefreshExpiredNote(), "Note refreshed without newly expired peers.")
+}
+
+func (suite *ViewTestSuite) TestRejoin() {
+	view := suite.v
+
+	c := clock.NewManual(time.Unix(0, 0))
+	view.SetClock(c)
+	view.expireTimeout = time.Second * 100
+
+	privKey, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	require.NoError(suite.T(), err, "Failed to generate private key.")
+
+	cert := validCert("testId", privKey.Public())
+	cert.NotAfter = c.Now().Add(time.Hour)
+
+	require.NoError(suite.T(), view.AddFull("testId", cert), "Failed to add peer.")
+	view.Peer("testId").NewNote(privKey, 2)
+
+	_, err = view.Rejoin("testId", 3)
+	assert.EqualError(suite.T(), err, errNotExpired.Error(), "Rejoined without being expired.")
+
+	c.Advance(time.Second * 101)
+	view.CheckExpired()
+	require.True(suite.T(), view.Expired("testId"), "Peer not expired.")
+
+	_, err = view.Rejoin("testId", 2)
+	assert.EqualError(suite.T(), err, errStaleRejoin.Error(), "Rejoined with old note.")
+	assert.False(suite.T(), view.Exists("testId"), "Stale rejoin added peer.")
+
+	p, err := view.Rejoin("testId", 3)
+	require.NoError(suite.T(), err, "Failed to rejoin with fresh note.")
+	require.NotNil(suite.T(), p, "Rejoin returned no peer.")
+	assert.True(suite.T(), view.Exists("testId"), "Rejoined peer not in full view.")
+	assert.False(suite.T(), view.Expired("testId"), "Rejoined peer still expired.")
+}
+
 func (suite *ViewTestSuite) TestShouldRebuttal() {
 	view := suite.v
 
@@ -570,6 +735,169 @@ func (suite *ViewTestSuite) TestShouldRebuttal() {
 	assert.True(suite.T(), view.ValidMask(view.self.note.mask), "Mask is not valid after disabling.")
 }
 
+func (suite *ViewTestSuite) TestReactivateRings() {
+	view := suite.v
+
+	c := clock.NewManual(time.Unix(0, 0))
+	view.SetClock(c)
+
+	full := view.self.note.mask
+
+	assert.False(suite.T(), view.ReactivateRings(), "Reactivated with reactivation disabled.")
+
+	view.reactivateTimeout = time.Second * 100
+
+	assert.False(suite.T(), view.ReactivateRings(), "Reactivated with no disabled rings.")
+
+	require.True(suite.T(), view.ShouldRebuttal(view.self.note.epoch, 1), "Failed to rebut.")
+	require.True(suite.T(), view.self.note.IsRingDisabled(1, view.NumRings()), "Ring not disabled.")
+
+	c.Advance(time.Second * 60)
+	assert.False(suite.T(), view.ReactivateRings(), "Reactivated before timeout.")
+
+	// A new accusation restarts the accusation-free period.
+	require.True(suite.T(), view.ShouldRebuttal(view.self.note.epoch, 2), "Failed to rebut.")
+
+	c.Advance(time.Second * 60)
+	assert.False(suite.T(), view.ReactivateRings(), "Reactivated before timeout after new accusation.")
+
+	epoch := view.self.note.epoch
+
+	c.Advance(time.Second * 41)
+	require.True(suite.T(), view.ReactivateRings(), "Did not reactivate after timeout.")
+
+	assert.Equal(suite.T(), full, view.self.note.mask, "Not all rings reactivated.")
+	assert.Equal(suite.T(), epoch+1, view.self.note.epoch, "Epoch not incremented.")
+	assert.Zero(suite.T(), view.deactivatedRings, "Deactivated rings not reset.")
+	assert.NotNil(suite.T(), view.self.note.signature, "New note not signed.")
+
+	assert.False(suite.T(), view.ReactivateRings(), "Reactivated twice.")
+
+	history := view.MaskHistory()
+	require.Equal(suite.T(), 4, len(history), "Invalid mask history length.")
+	assert.Equal(suite.T(), full, history[0].Mask, "Initial mask not recorded.")
+	assert.Equal(suite.T(), clearBit(full, 0), history[1].Mask, "First deactivation not recorded.")
+	assert.Equal(suite.T(), clearBit(clearBit(full, 0), 1), history[2].Mask, "Second deactivation not recorded.")
+	assert.Equal(suite.T(), full, history[3].Mask, "Reactivation not recorded.")
+	assert.Equal(suite.T(), epoch+1, history[3].Epoch, "Wrong reactivation epoch.")
+	assert.Equal(suite.T(), c.Now(), history[3].Time, "Wrong reactivation time.")
+}
+
+func (suite *ViewTestSuite) TestRestoreNote() {
+	view := suite.v
+
+	full := view.self.note.mask
+
+	require.NoError(suite.T(), view.RestoreNote(10, clearBit(full, 0)), "Failed to restore note.")
+	assert.Equal(suite.T(), uint64(11), view.self.note.epoch, "Restored epoch not more recent.")
+	assert.Equal(suite.T(), clearBit(full, 0), view.self.note.mask, "Valid mask not restored.")
+	assert.Equal(suite.T(), uint32(1), view.deactivatedRings, "Deactivated rings not restored.")
+	assert.NotNil(suite.T(), view.self.note.signature, "Restored note not signed.")
+
+	require.NoError(suite.T(), view.RestoreNote(3, 0), "Failed to restore note.")
+	assert.Equal(suite.T(), uint64(12), view.self.note.epoch, "Epoch went backwards.")
+	assert.Equal(suite.T(), full, view.self.note.mask, "Missing mask not replaced.")
+	assert.Zero(suite.T(), view.deactivatedRings, "Deactivated rings not reset.")
+
+	require.NoError(suite.T(), view.RestoreNote(20, 1), "Failed to restore note.")
+	assert.Equal(suite.T(), full, view.self.note.mask, "Invalid mask restored.")
+}
+
+func (suite *ViewTestSuite) TestSetAttributes() {
+	view := suite.v
+
+	attrs := map[string]string{"zone": "eu"}
+
+	epoch := view.self.note.epoch
+
+	require.NoError(suite.T(), view.SetAttributes(attrs), "Failed to set attributes.")
+	assert.Equal(suite.T(), epoch+1, view.self.note.epoch, "Epoch not incremented.")
+	assert.Equal(suite.T(), attrs, view.self.Attributes(), "Attributes not set.")
+
+	attrs["zone"] = "us"
+	assert.Equal(suite.T(), "eu", view.self.Attributes()["zone"], "Attributes not copied.")
+
+	assert.Error(suite.T(), view.SetAttributes(map[string]string{"": "eu"}), "Invalid attributes set.")
+	assert.Equal(suite.T(), epoch+1, view.self.note.epoch, "Epoch incremented by invalid attributes.")
+
+	require.True(suite.T(), view.ShouldRebuttal(view.self.note.epoch, 1), "Failed to rebut.")
+	assert.Equal(suite.T(), "eu", view.self.Attributes()["zone"], "Attributes lost on rebuttal.")
+
+	require.NoError(suite.T(), view.SetAttributes(nil), "Failed to clear attributes.")
+	assert.Nil(suite.T(), view.self.Attributes(), "Attributes not cleared.")
+}
+
+func (suite *ViewTestSuite) TestSetAddress() {
+	view := suite.v
+
+	epoch := view.self.note.epoch
+
+	require.NoError(suite.T(), view.SetAddress("10.0.0.1:1000", "10.0.0.1:2000", ""), "Failed to set address.")
+	assert.Equal(suite.T(), epoch+1, view.self.note.epoch, "Epoch not incremented.")
+	assert.Equal(suite.T(), "10.0.0.1:1000", view.self.Addr(), "Rpc address not set.")
+	assert.Equal(suite.T(), "10.0.0.1:2000", view.self.PingAddr(), "Ping address not set.")
+	assert.Equal(suite.T(), "10.0.0.1:1000", view.selfNote().GetAddress().GetRpcAddr(), "Address not in note.")
+
+	invalid := [][]string{
+		{"", "10.0.0.1:2000"},
+		{"10.0.0.1", "10.0.0.1:2000"},
+		{"10.0.0.1:1000", ":2000"},
+	}
+
+	for _, a := range invalid {
+		assert.Errorf(suite.T(), view.SetAddress(a[0], a[1], ""), "Invalid address %v set.", a)
+	}
+
+	assert.Equal(suite.T(), epoch+1, view.self.note.epoch, "Epoch incremented by invalid address.")
+
+	require.True(suite.T(), view.ShouldRebuttal(view.self.note.epoch, 1), "Failed to rebut.")
+	assert.Equal(suite.T(), "10.0.0.1:1000", view.selfNote().GetAddress().GetRpcAddr(), "Address lost on rebuttal.")
+}
+
+func (suite *ViewTestSuite) TestUpdateAddress() {
+	cm := &cmStub{}
+	suite.v.cm = cm
+	view := suite.v
+
+	privKey, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	require.NoError(suite.T(), err, "Failed to generate private key.")
+
+	require.NoError(suite.T(), view.AddFull("testId", validCert("testId", privKey.Public())), "Failed to add peer.")
+	p := view.Peer("testId")
+	view.AddLive(p)
+
+	cm.closed = nil
+
+	view.UpdateAddress(p)
+	assert.Equal(suite.T(), "rpcAddr", p.Addr(), "Address changed without note.")
+
+	addr := &pb.Address{RpcAddr: "10.0.0.1:1000", PingAddr: "10.0.0.1:2000"}
+
+	p.IncrementPing()
+	p.AddNote(math.MaxUint32, 2, nil, addr, nil, nil)
+	view.UpdateAddress(p)
+
+	assert.Equal(suite.T(), "10.0.0.1:1000", p.Addr(), "Rpc address not updated.")
+	assert.Equal(suite.T(), "10.0.0.1:2000", p.PingAddr(), "Ping address not updated.")
+	assert.Equal(suite.T(), "", p.HttpAddr(), "Http address not updated.")
+	assert.Equal(suite.T(), []string{"rpcAddr"}, cm.closed, "Stale connection not closed.")
+	assert.Zero(suite.T(), p.NumPing(), "Pings against stale address not forgotten.")
+	assert.True(suite.T(), view.IsAlive(p.Id), "Peer removed from live view.")
+	assert.Equal(suite.T(), p, view.rings.ringMap[1].successor().p, "Peer moved on ring.")
+
+	view.UpdateAddress(p)
+	assert.Equal(suite.T(), 1, len(cm.closed), "Connection closed without address change.")
+
+	_, _, changed := p.setAddress("10.0.0.2:1000", "10.0.0.2:2000", "", 1)
+	assert.False(suite.T(), changed, "Address from older note applied.")
+
+	// Notes without an address record fall back to the certificate.
+	p.AddNote(math.MaxUint32, 3, nil, nil, nil, nil)
+	view.UpdateAddress(p)
+	assert.Equal(suite.T(), "rpcAddr", p.Addr(), "Certificate address not restored.")
+	assert.Equal(suite.T(), "pingAddr", p.PingAddr(), "Certificate address not restored.")
+}
+
 func (suite *ViewTestSuite) TestShouldBeNeighbour() {
 	view := suite.v
 
@@ -880,10 +1208,11 @@ func validCert(id string, pub crypto.PublicKey) *x509.Certificate {
 }
 
 type cmStub struct {
+	closed []string
 }
 
 func (cm *cmStub) CloseConn(addr string) {
-
+	cm.closed = append(cm.closed, addr)
 }
 
 type signerStub struct {
@@ -8,6 +8,7 @@ import (
 	"github.com/golang/protobuf/proto"
 	"github.com/joonnna/ifrit/core/discovery"
 	pb "github.com/joonnna/ifrit/protobuf"
+	"github.com/joonnna/ifrit/transport"
 )
 
 var (
@@ -16,19 +17,12 @@ var (
 )
 
 type failureDetector struct {
-	ps             pingService
+	ps             transport.Ping
 	cs             cryptoService
 	maxFailedPings uint32
 }
 
-type pingService interface {
-	Pause(time.Duration)
-	Ping(string, *pb.Ping) (*pb.Pong, error)
-	Start()
-	Stop()
-}
-
-func newFd(ps pingService, cs cryptoService, maxPing uint32) *failureDetector {
+func newFd(ps transport.Ping, cs cryptoService, maxPing uint32) *failureDetector {
 	return &failureDetector{
 		ps:             ps,
 		cs:             cs,
@@ -45,7 +39,7 @@ func (fd *failureDetector) probe(dest *discovery.Peer) error {
 		Nonce: genNonce(),
 	}
 
-	pong, err := fd.ps.Ping(dest.PingAddr, msg)
+	pong, err := fd.ps.Ping(dest.PingAddr(), msg)
 	if err != nil {
 		dest.IncrementPing()
 		if dest.NumPing() >= fd.maxFailedPings {
@@ -55,18 +49,15 @@ func (fd *failureDetector) probe(dest *discovery.Peer) error {
 		return err
 	}
 
-	pong.Signature = nil
-	bytes, err := proto.Marshal(pong)
+	// The pong carries the signature of the ping it answers,
+	// it has no content of its own to sign.
+	bytes, err := proto.Marshal(msg)
 	if err != nil {
 		return err
 	}
 
-	if sign := pong.GetSignature(); sign == nil {
+	if valid := validSignature(fd.cs, bytes, pong.GetSignature(), dest.PublicKey()); !valid {
 		return errInvalidPongSignature
-	} else {
-		if valid := fd.cs.Verify(bytes, sign.GetR(), sign.GetS(), dest.PublicKey()); !valid {
-			return errInvalidPongSignature
-		}
 	}
 
 	dest.ResetPing()
@@ -1 +1,73 @@
 package core
+
+import (
+	"testing"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/joonnna/ifrit/memnet"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type FailureDetectorTestSuite struct {
+	suite.Suite
+
+	src, dest *Node
+}
+
+func TestFailureDetectorTestSuite(t *testing.T) {
+	r := log.Root()
+
+	r.SetHandler(log.DiscardHandler())
+
+	suite.Run(t, new(FailureDetectorTestSuite))
+}
+
+func (suite *FailureDetectorTestSuite) SetupTest() {
+	network, err := memnet.NewNetwork(3, 1, 1)
+	require.NoError(suite.T(), err, "Failed to create network.")
+
+	var nodes []*Node
+
+	for i := 0; i < 2; i++ {
+		id, err := network.NewIdentity()
+		require.NoError(suite.T(), err, "Failed to create identity.")
+
+		c, p, err := network.NewTransport(id)
+		require.NoError(suite.T(), err, "Failed to create transport.")
+
+		n, err := NewNode(c, p, id, id)
+		require.NoError(suite.T(), err, "Failed to create node.")
+
+		c.Start()
+		p.Start()
+
+		nodes = append(nodes, n)
+	}
+
+	// Only the first node is in the contact list of the second.
+	suite.dest, suite.src = nodes[0], nodes[1]
+}
+
+func (suite *FailureDetectorTestSuite) TestProbe() {
+	p := suite.src.view.Peer(suite.dest.self.Id)
+	require.NotNil(suite.T(), p, "Destination not known.")
+
+	p.IncrementPing()
+	p.IncrementPing()
+
+	require.NoError(suite.T(), suite.src.fd.probe(p), "Valid pong rejected.")
+	require.Equal(suite.T(), uint32(0), p.NumPing(), "Valid pong did not reset the failed pings.")
+}
+
+func (suite *FailureDetectorTestSuite) TestUnsignedPong() {
+	p := suite.src.view.Peer(suite.dest.self.Id)
+	require.NotNil(suite.T(), p, "Destination not known.")
+
+	p.IncrementPing()
+
+	fd := newFd(&pingStub{}, suite.src.cs, 3)
+
+	require.EqualError(suite.T(), fd.probe(p), errInvalidPongSignature.Error(), "Unsigned pong accepted.")
+	require.Equal(suite.T(), uint32(1), p.NumPing(), "Unsigned pong reset the failed pings.")
+}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"crypto/x509"
 	"errors"
@@ -9,6 +10,7 @@ import (
 	"github.com/golang/protobuf/proto"
 	log "github.com/inconshreveable/log15"
 	"github.com/joonnna/ifrit/core/discovery"
+	"github.com/joonnna/ifrit/keys"
 	pb "github.com/joonnna/ifrit/protobuf"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/credentials"
@@ -34,10 +36,14 @@ var (
 	errOldNote     = errors.New("Already had the same or a more recent note")
 	errNoPeer      = errors.New("Peer associated with note not found in full view.")
 
-	errNilCert   = errors.New("Certificate was nil.")
-	errSelfCert  = errors.New("Certificate was my own.")
-	errNoCert    = errors.New("No certificate present in tls context.")
-	errInvalidId = errors.New("Id in certificate is of invalid size.")
+	errNilCert     = errors.New("Certificate was nil.")
+	errExpiredCert = errors.New("Certificate has expired.")
+	errRevokedCert = errors.New("Certificate has been revoked.")
+	errSelfCert    = errors.New("Certificate was my own.")
+	errNoCert      = errors.New("No certificate present in tls context.")
+	errInvalidId   = errors.New("Id in certificate is of invalid size.")
+
+	errSelfSignedRenewal = errors.New("Self-signed certificates can not be renewed.")
 )
 
 func (n *Node) Spread(ctx context.Context, args *pb.State) (*pb.StateResponse, error) {
@@ -47,8 +53,16 @@ func (n *Node) Spread(ctx context.Context, args *pb.State) (*pb.StateResponse, e
 		return nil, err
 	}
 
+	if n.revocations.IsRevoked(cert) {
+		return nil, errRevokedCert
+	}
+
 	reply := &pb.StateResponse{}
 
+	if n.revocations.Number() > args.GetRevocationNumber() {
+		reply.RevocationList = n.revocations.Raw()
+	}
+
 	remoteId := string(cert.SubjectKeyId[:])
 	peer := n.view.Peer(remoteId)
 	if peer != nil {
@@ -127,31 +141,66 @@ func (n *Node) Spread(ctx context.Context, args *pb.State) (*pb.StateResponse, e
 }
 
 func (n *Node) Messenger(ctx context.Context, args *pb.Msg) (*pb.MsgResponse, error) {
-	var replyContent []byte
-
-	_, err := n.validateCtx(ctx)
+	cert, err := n.validateCtx(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	if handler := n.getMsgHandler(); handler != nil {
-		replyContent, err = handler(args.GetContent())
-		return &pb.MsgResponse{Content: replyContent, Error: err.Error()}, nil
+	if n.revocations.IsRevoked(cert) {
+		return nil, errRevokedCert
+	}
+
+	if r := args.GetRelay(); r != nil {
+		return n.handleRelay(r)
+	}
+
+	return n.handleMsg(args.GetContent()), nil
+}
+
+// Passes the content to the message handler and returns its reply.
+func (n *Node) handleMsg(content []byte) *pb.MsgResponse {
+	handler := n.getMsgHandler()
+	if handler == nil {
+		return &pb.MsgResponse{}
+	}
+
+	replyContent, err := handler(content)
+
+	resp := &pb.MsgResponse{Content: replyContent}
+	if err != nil {
+		resp.Error = err.Error()
 	}
-	return &pb.MsgResponse{}, nil
+
+	return resp
 }
 
 func (n *Node) Stream(srv pb.Gossip_StreamServer) error {
+	first, err := srv.Recv()
+	if err == io.EOF {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// Blob transfers are streams opened by a chunk.
+	if open := first.GetBlob(); open != nil {
+		return n.receiveBlob(srv, open)
+	}
+
 	// Channels used for bi-directional communication
 	input := make(chan []byte)
 	reply := make(chan []byte)
 	defer close(input)
 
-	if handler := n.getStreamHandler(); handler != nil {		
+	if handler := n.getStreamHandler(); handler != nil {
 		go n.runStreamHandler(handler, input, reply)
 		go n.replyStream(reply, srv)
 		ctx := srv.Context()
 
+		input <- first.GetContent()
+
 		for {
 			select {
 			case <-ctx.Done():
@@ -202,6 +251,11 @@ func (n *Node) mergeViews(given map[string]uint64, reply *pb.StateResponse) {
 				reply.Notes = append(reply.Notes, note.ToPbMsg())
 			}
 		} else if note := p.Note(); note != nil && note.IsMoreRecent(given[p.Id]) {
+			// Notes of renewed peers are signed by a key the receiver might not know yet.
+			if p.Renewed() {
+				reply.Certificates = append(reply.Certificates,
+					&pb.Certificate{Raw: p.Certificate()})
+			}
 			reply.Notes = append(reply.Notes, note.ToPbMsg())
 		}
 
@@ -216,6 +270,10 @@ func (n *Node) mergeViews(given map[string]uint64, reply *pb.StateResponse) {
 	localNote := n.self.Note()
 
 	if epoch, exists := given[n.self.Id]; !exists || localNote.IsMoreRecent(epoch) {
+		if n.self.Renewed() {
+			reply.Certificates = append(reply.Certificates,
+				&pb.Certificate{Raw: n.cm.Certificate().Raw})
+		}
 		reply.Notes = append(reply.Notes, localNote.ToPbMsg())
 	}
 }
@@ -225,6 +283,11 @@ func (n *Node) mergeNotes(notes []*pb.Note) {
 		return
 	}
 
+	// Signatures are verified in parallel up front, the evaluation then finds them cached.
+	if n.sigs.batching(len(notes)) {
+		n.sigs.verifyBatch(n.cs, n.signedNotes(notes))
+	}
+
 	for _, newNote := range notes {
 		if n.self.Id == string(newNote.GetId()) {
 			continue
@@ -242,6 +305,10 @@ func (n *Node) mergeAccusations(accusations []*pb.Accusation) {
 		return
 	}
 
+	if n.sigs.batching(len(accusations)) {
+		n.sigs.verifyBatch(n.cs, n.signedAccusations(accusations))
+	}
+
 	for _, acc := range accusations {
 		accId := string(acc.GetAccused())
 		accuserId := string(acc.GetAccuser())
@@ -262,7 +329,7 @@ func (n *Node) mergeAccusations(accusations []*pb.Accusation) {
 
 		err := n.evalAccusation(acc, accuser, accused)
 		if err != nil {
-			log.Debug(err.Error(), "ringNum", acc.GetRingNum(), "epoch", acc.GetEpoch(), "accused", accused.Addr, "accuser", accuser.Addr)
+			log.Debug(err.Error(), "ringNum", acc.GetRingNum(), "epoch", acc.GetEpoch(), "accused", accused.Addr(), "accuser", accuser.Addr())
 		}
 	}
 }
@@ -282,6 +349,12 @@ func (n *Node) mergeCertificates(certs []*pb.Certificate) {
 			continue
 		}
 
+		// Known certificates have already been verified,
+		// avoid checking the same signatures on every gossip reply.
+		if p := n.view.Peer(string(cert.SubjectKeyId)); p != nil && bytes.Equal(p.Certificate(), cert.Raw) {
+			continue
+		}
+
 		err = n.evalCertificate(cert)
 		if err != nil {
 			log.Debug(err.Error())
@@ -289,15 +362,38 @@ func (n *Node) mergeCertificates(certs []*pb.Certificate) {
 	}
 }
 
+func (n *Node) mergeRevocationList(raw []byte) {
+	if raw == nil {
+		return
+	}
+
+	updated, err := n.revocations.Update(raw)
+	if err != nil {
+		log.Debug(err.Error())
+		return
+	}
+
+	if updated {
+		n.removeRevoked()
+	}
+}
+
+// Removes all peers with a revoked certificate from the full and live view.
+func (n *Node) removeRevoked() {
+	for _, p := range n.view.Full() {
+		if n.revocations.Revoked(p.SerialNumber()) {
+			n.view.RemoveFull(p.Id)
+			log.Info("Removed peer with revoked certificate", "addr", p.Addr())
+		}
+	}
+}
+
 func (n *Node) evalAccusation(a *pb.Accusation, accuserPeer, p *discovery.Peer) error {
 	sign := a.GetSignature()
 	if sign == nil {
 		return errInvalidSignature
 	}
 
-	r := sign.GetR()
-	s := sign.GetS()
-
 	epoch := a.GetEpoch()
 	ringNum := a.GetRingNum()
 
@@ -312,11 +408,12 @@ func (n *Node) evalAccusation(a *pb.Accusation, accuserPeer, p *discovery.Peer)
 			return errInvalidAccuser
 		}
 
-		if valid := n.cs.Verify(bytes, r, s, accuserPeer.PublicKey()); !valid {
+		if valid := n.sigs.valid(n.cs, accuserPeer.Id, bytes, sign, accuserPeer.PublicKey()); !valid {
 			return errInvalidSignature
 		}
 
 		if rebut := n.view.ShouldRebuttal(epoch, ringNum); rebut {
+			n.saveNote()
 			n.protocol().Rebuttal(n)
 			return nil
 		} else {
@@ -343,15 +440,17 @@ func (n *Node) evalAccusation(a *pb.Accusation, accuserPeer, p *discovery.Peer)
 			return errInvalidAccuser
 		}
 
-		if valid := n.cs.Verify(bytes, r, s, accuserPeer.PublicKey()); !valid {
+		if valid := n.sigs.valid(n.cs, accuserPeer.Id, bytes, sign, accuserPeer.PublicKey()); !valid {
 			return errInvalidSignature
 		}
 
-		err := p.AddAccusation(p.Id, accuserPeer.Id, epoch, ringNum, sign.GetR(), sign.GetS())
+		err := p.AddAccusation(p.Id, accuserPeer.Id, epoch, ringNum, sign.GetR(), sign.GetS(), sign.GetAlgorithm())
 		if err != nil {
 			return err
 		}
 
+		n.view.RecordAccusation(p.Id)
+
 		live := n.view.IsAlive(p.Id)
 		if exists := n.view.HasTimer(p.Id); !exists && live {
 			n.view.StartTimer(p, p.Note(), accuserPeer)
@@ -377,7 +476,11 @@ func (n *Node) evalNote(newNote *pb.Note) error {
 
 	p := n.view.Peer(string(newNote.GetId()))
 	if p == nil {
-		return errNoPeer
+		rejoined, err := n.evalRejoin(newNote, sign)
+		if err != nil {
+			return err
+		}
+		p = rejoined
 	}
 
 	note := p.Note()
@@ -390,6 +493,19 @@ func (n *Node) evalNote(newNote *pb.Note) error {
 		return errInvalidMask
 	}
 
+	attrs, err := discovery.AttributesFromPb(newNote.GetAttributes())
+	if err != nil {
+		return err
+	}
+
+	if err := discovery.ValidAddress(newNote.GetAddress()); err != nil {
+		return err
+	}
+
+	if err := n.view.ValidAddressOwner(p.Id, newNote.GetAddress()); err != nil {
+		return err
+	}
+
 	newNote.Signature = nil
 	bytes, err := proto.Marshal(newNote)
 	if err != nil {
@@ -401,21 +517,31 @@ func (n *Node) evalNote(newNote *pb.Note) error {
 	if numAccs := len(accusations); numAccs == 0 {
 		// Want to store the most recent note
 		if note == nil || note.IsMoreRecent(epoch) {
-			if valid := n.cs.Verify(bytes, r, s, p.PublicKey()); !valid {
+			if valid := n.sigs.valid(n.cs, p.Id, bytes, sign, p.PublicKey()); !valid {
 				return errInvalidSignature
 			}
 
-			p.AddNote(mask, epoch, r, s)
+			if err := n.view.ValidReactivation(p.Id, note, mask); err != nil {
+				return err
+			}
+
+			p.AddNote(mask, epoch, attrs, newNote.GetAddress(), r, s)
+			n.view.RecordMask(p.Id, note, mask)
+			n.view.UpdateAddress(p)
 
 			if alive := n.view.IsAlive(p.Id); !alive {
 				n.view.AddLive(p)
 			}
 		}
 	} else {
-		if valid := n.cs.Verify(bytes, r, s, p.PublicKey()); !valid {
+		if valid := n.sigs.valid(n.cs, p.Id, bytes, sign, p.PublicKey()); !valid {
 			return errInvalidSignature
 		}
 
+		if err := n.view.ValidReactivation(p.Id, note, mask); err != nil {
+			return err
+		}
+
 		// Peer is accused, need to check if this note invalidates any accusations.
 		for _, a := range accusations {
 			if a.IsMoreRecent(epoch) {
@@ -424,7 +550,9 @@ func (n *Node) evalNote(newNote *pb.Note) error {
 		}
 
 		if note == nil || note.IsMoreRecent(epoch) {
-			p.AddNote(mask, epoch, r, s)
+			p.AddNote(mask, epoch, attrs, newNote.GetAddress(), r, s)
+			n.view.RecordMask(p.Id, note, mask)
+			n.view.UpdateAddress(p)
 		}
 
 		// All accusations has to be invalidated before we add peer back to full view.
@@ -439,13 +567,41 @@ func (n *Node) evalNote(newNote *pb.Note) error {
 				n.view.AddLive(p)
 			}
 
-			log.Debug("Rebuttal received", "epoch", epoch, "addr", p.Addr)
+			log.Debug("Rebuttal received", "epoch", epoch, "addr", p.Addr())
 		}
 	}
 
 	return nil
 }
 
+// Expired peers are only let back into the full view with a correctly
+// signed note more recent than the one they expired with.
+func (n *Node) evalRejoin(newNote *pb.Note, sign *pb.Signature) (*discovery.Peer, error) {
+	id := string(newNote.GetId())
+
+	cert := n.view.ExpiredCertificate(id)
+	if cert == nil {
+		return nil, errNoPeer
+	}
+
+	if !keys.Supported(cert.PublicKey) {
+		return nil, errNoPeer
+	}
+
+	newNote.Signature = nil
+	bytes, err := proto.Marshal(newNote)
+	newNote.Signature = sign
+	if err != nil {
+		return nil, err
+	}
+
+	if valid := n.sigs.valid(n.cs, id, bytes, sign, cert.PublicKey); !valid {
+		return nil, errInvalidSignature
+	}
+
+	return n.view.Rejoin(id, newNote.GetEpoch())
+}
+
 func (n *Node) evalCertificate(cert *x509.Certificate) error {
 	if cert == nil {
 		return errNilCert
@@ -461,6 +617,14 @@ func (n *Node) evalCertificate(cert *x509.Certificate) error {
 		return errInvalidId
 	}
 
+	if n.view.CertExpired(cert) {
+		return errExpiredCert
+	}
+
+	if n.revocations.IsRevoked(cert) {
+		return errRevokedCert
+	}
+
 	if caCert := n.cm.CaCertificate(); caCert != nil {
 		err := cert.CheckSignatureFrom(caCert)
 		if err != nil {
@@ -473,8 +637,16 @@ func (n *Node) evalCertificate(cert *x509.Certificate) error {
 		}
 	}
 
-	if exists := n.view.Exists(id); !exists {
+	// Expired peers are added back once they present a fresh note.
+	if exists := n.view.Exists(id); !exists && !n.view.Expired(id) {
 		n.view.AddFull(id, cert)
+	} else if p := n.view.Peer(id); p != nil && !bytes.Equal(p.Certificate(), cert.Raw) {
+		// Anyone can issue a self-signed certificate carrying a known id.
+		if n.cm.CaCertificate() == nil {
+			return errSelfSignedRenewal
+		}
+
+		return n.view.RenewCertificate(cert)
 	}
 
 	return nil
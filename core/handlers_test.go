@@ -18,8 +18,11 @@ import (
 	"time"
 
 	log "github.com/inconshreveable/log15"
+	"github.com/joonnna/ifrit/clock"
 	"github.com/joonnna/ifrit/core/discovery"
+	"github.com/joonnna/ifrit/memnet"
 	"github.com/joonnna/ifrit/protobuf"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"golang.org/x/net/context"
@@ -673,6 +676,419 @@ func (suite *HandlerTestSuite) TestEvalNote() {
 	}
 }
 
+func (suite *HandlerTestSuite) TestEvalReactivationNote() {
+	viper.Set("reactivate_timeout", 100)
+	defer viper.Set("reactivate_timeout", 0)
+
+	c := clock.NewManual(time.Now())
+
+	node, err := NewNode(&commStub{}, &pingStub{}, &cmStub{cert: genCert(suite.priv, 10)}, &cryptoStub{priv: suite.priv})
+	require.NoError(suite.T(), err, "Failed to create node.")
+
+	node.SetClock(c)
+
+	p, priv, err := addPeer(node)
+	require.NoError(suite.T(), err, "Could not add peer.")
+
+	rings := node.view.NumRings()
+	full := uint32(math.MaxUint32)
+	disabled := full &^ 1
+
+	require.NoError(suite.T(), node.evalNote(discovery.NewNote(p.Id, 2, disabled, priv)),
+		"Valid deactivation rejected.")
+	require.True(suite.T(), p.Note().IsRingDisabled(1, rings), "Ring not disabled.")
+
+	err = node.evalNote(discovery.NewNote(p.Id, 3, full, suite.priv))
+	require.EqualError(suite.T(), err, errInvalidSignature.Error(), "Forged reactivation accepted.")
+	require.True(suite.T(), p.Note().IsRingDisabled(1, rings), "Ring reactivated by forged note.")
+
+	// Reactivation can not be used to sneak in more disabled rings than allowed.
+	tooMany := full << (rings/2 + 1)
+	err = node.evalNote(discovery.NewNote(p.Id, 3, tooMany, priv))
+	require.EqualError(suite.T(), err, errInvalidMask.Error(), "Too many disabled rings accepted.")
+
+	// Rings are only reactivated after a period without accusations.
+	c.Advance(time.Second * 99)
+
+	err = node.evalNote(discovery.NewNote(p.Id, 3, full, priv))
+	require.Error(suite.T(), err, "Early reactivation accepted.")
+	require.True(suite.T(), p.Note().IsRingDisabled(1, rings), "Ring reactivated early.")
+
+	c.Advance(time.Second * 2)
+
+	require.NoError(suite.T(), node.evalNote(discovery.NewNote(p.Id, 3, full, priv)),
+		"Valid reactivation rejected.")
+	require.False(suite.T(), p.Note().IsRingDisabled(1, rings), "Ring not reactivated.")
+
+	// Replaying the old note must not disable the ring again.
+	err = node.evalNote(discovery.NewNote(p.Id, 2, disabled, priv))
+	require.EqualError(suite.T(), err, errOldNote.Error(), "Old note accepted after reactivation.")
+	require.False(suite.T(), p.Note().IsRingDisabled(1, rings), "Ring disabled by replayed note.")
+
+	// Accusations restart the period.
+	require.NoError(suite.T(), node.evalNote(discovery.NewNote(p.Id, 4, disabled, priv)),
+		"Valid deactivation rejected.")
+
+	c.Advance(time.Second * 101)
+	node.view.RecordAccusation(p.Id)
+
+	err = node.evalNote(discovery.NewNote(p.Id, 5, full, priv))
+	require.Error(suite.T(), err, "Reactivation accepted right after an accusation.")
+
+	c.Advance(time.Second * 101)
+
+	require.NoError(suite.T(), node.evalNote(discovery.NewNote(p.Id, 5, full, priv)),
+		"Valid reactivation rejected.")
+}
+
+func (suite *HandlerTestSuite) TestEvalDelayedReactivation() {
+	viper.Set("reactivate_timeout", 100)
+	defer viper.Set("reactivate_timeout", 0)
+
+	early, err := NewNode(&commStub{}, &pingStub{}, &cmStub{cert: genCert(suite.priv, 10)}, &cryptoStub{priv: suite.priv})
+	require.NoError(suite.T(), err, "Failed to create node.")
+
+	late, err := NewNode(&commStub{}, &pingStub{}, &cmStub{cert: genCert(suite.priv, 10)}, &cryptoStub{priv: suite.priv})
+	require.NoError(suite.T(), err, "Failed to create node.")
+
+	c := clock.NewManual(time.Now())
+	early.SetClock(c)
+	late.SetClock(c)
+
+	p, priv, err := addPeer(early)
+	require.NoError(suite.T(), err, "Could not add peer.")
+
+	cert, err := x509.ParseCertificate(p.Certificate())
+	require.NoError(suite.T(), err, "Could not parse certificate.")
+
+	require.NoError(suite.T(), late.view.AddFull(p.Id, cert), "Failed to add peer.")
+	late.view.AddLive(late.view.Peer(p.Id))
+
+	full := uint32(math.MaxUint32)
+
+	// The rebuttal reaches the late observer some time after the early one.
+	require.NoError(suite.T(), early.evalNote(discovery.NewNote(p.Id, 2, full&^1, priv)),
+		"Valid deactivation rejected.")
+	c.Advance(time.Second * 50)
+	require.NoError(suite.T(), late.evalNote(discovery.NewNote(p.Id, 2, full&^1, priv)),
+		"Valid deactivation rejected.")
+
+	c.Advance(time.Second * 51)
+
+	require.NoError(suite.T(), early.evalNote(discovery.NewNote(p.Id, 3, full, priv)),
+		"Valid reactivation rejected.")
+	require.Error(suite.T(), late.evalNote(discovery.NewNote(p.Id, 3, full, priv)),
+		"Reactivation accepted before the period passed locally.")
+	require.True(suite.T(), late.view.Peer(p.Id).Note().IsRingDisabled(1, late.view.NumRings()),
+		"Ring reactivated early.")
+
+	// The same note gossiped again is accepted once the local period passed.
+	c.Advance(time.Second * 50)
+	require.NoError(suite.T(), late.evalNote(discovery.NewNote(p.Id, 3, full, priv)),
+		"Delayed reactivation rejected.")
+	require.False(suite.T(), late.view.Peer(p.Id).Note().IsRingDisabled(1, late.view.NumRings()),
+		"Ring not reactivated.")
+}
+
+func (suite *HandlerTestSuite) TestEvalReactivationDisabled() {
+	node := suite.n
+
+	p := node.view.Live()[0]
+	priv := suite.privMap[p.Id]
+
+	full := uint32(math.MaxUint32)
+
+	require.NoError(suite.T(), node.evalNote(discovery.NewNote(p.Id, 2, full&^1, priv)),
+		"Valid deactivation rejected.")
+
+	err := node.evalNote(discovery.NewNote(p.Id, 3, full, priv))
+	require.Error(suite.T(), err, "Reactivation accepted with reactivation disabled.")
+}
+
+func (suite *HandlerTestSuite) TestEvalRestartedNote() {
+	node := suite.n
+
+	p := node.view.Live()[0]
+	priv := suite.privMap[p.Id]
+
+	cert, err := x509.ParseCertificate(p.Certificate())
+	require.NoError(suite.T(), err, "Could not parse certificate.")
+
+	full := uint32(math.MaxUint32)
+	disabled := full &^ 1
+
+	// Peer rebutted a few times before restarting.
+	require.NoError(suite.T(), node.evalNote(discovery.NewNote(p.Id, 7, disabled, priv)),
+		"Valid note rejected.")
+
+	restarted, err := NewNode(&commStub{}, &pingStub{}, &cmStub{cert: cert}, &cryptoStub{priv: priv})
+	require.NoError(suite.T(), err, "Failed to create node.")
+
+	err = node.evalNote(restarted.self.Note().ToPbMsg())
+	require.EqualError(suite.T(), err, errOldNote.Error(), "Note from restart without stored epoch accepted.")
+
+	store := &noteStoreStub{cmStub: cmStub{cert: cert}, epoch: 7, mask: disabled}
+
+	restarted, err = NewNode(&commStub{}, &pingStub{}, store, &cryptoStub{priv: priv})
+	require.NoError(suite.T(), err, "Failed to create node.")
+
+	note := restarted.self.Note().ToPbMsg()
+	require.Equal(suite.T(), uint64(8), note.GetEpoch(), "Restored epoch not more recent.")
+	require.Equal(suite.T(), disabled, note.GetMask(), "Restored mask not kept.")
+	require.Equal(suite.T(), uint64(8), store.epoch, "Restored note not persisted.")
+
+	require.NoError(suite.T(), node.evalNote(note), "Note from restart with stored epoch rejected.")
+	require.Equal(suite.T(), uint64(8), p.Note().ToPbMsg().GetEpoch(), "Restarted note not stored.")
+}
+
+func (suite *HandlerTestSuite) TestEvalNoteAttributes() {
+	node := suite.n
+
+	live := node.view.Live()
+	p := live[0]
+	priv := suite.privMap[p.Id]
+
+	mask := uint32(math.MaxUint32)
+	attrs := map[string]string{"zone": "eu", "role": "canary"}
+
+	require.NoError(suite.T(), node.evalNote(discovery.NewAttributeNote(p.Id, 2, mask, attrs, priv)),
+		"Note with attributes rejected.")
+	require.Equal(suite.T(), attrs, p.Attributes(), "Attributes not stored.")
+
+	tampered := discovery.NewAttributeNote(p.Id, 3, mask, attrs, priv)
+	tampered.Attributes[1].Value = "eu-west"
+	require.EqualError(suite.T(), node.evalNote(tampered), errInvalidSignature.Error(),
+		"Tampered attributes accepted.")
+	require.Equal(suite.T(), "eu", p.Attributes()["zone"], "Tampered attributes stored.")
+
+	unsorted := discovery.NewAttributeNote(p.Id, 3, mask, attrs, priv)
+	unsorted.Attributes[0], unsorted.Attributes[1] = unsorted.Attributes[1], unsorted.Attributes[0]
+	require.Error(suite.T(), node.evalNote(unsorted), "Unsorted attributes accepted.")
+
+	sel, err := discovery.ParseSelector("zone=eu,role=canary")
+	require.NoError(suite.T(), err, "Valid selector rejected.")
+
+	members := node.MembersWhere(sel)
+	require.Equal(suite.T(), 1, len(members), "Wrong number of matching members.")
+	require.Equal(suite.T(), p.Addr(), members[0], "Wrong matching member.")
+
+	sel, err = discovery.ParseSelector("role!=canary")
+	require.NoError(suite.T(), err, "Valid selector rejected.")
+	require.Equal(suite.T(), len(live)-1, len(node.MembersWhere(sel)), "Wrong number of non-matching members.")
+
+	require.NoError(suite.T(), node.evalNote(discovery.NewAttributeNote(p.Id, 3, mask, nil, priv)),
+		"Note clearing attributes rejected.")
+	require.Nil(suite.T(), p.Attributes(), "Attributes not cleared.")
+}
+
+func (suite *HandlerTestSuite) TestEvalNoteAddress() {
+	node := suite.n
+
+	p := node.view.Live()[0]
+	priv := suite.privMap[p.Id]
+
+	mask := uint32(math.MaxUint32)
+	addr := &proto.Address{RpcAddr: "10.0.0.1:1000", PingAddr: "10.0.0.1:2000"}
+
+	require.NoError(suite.T(), node.evalNote(discovery.NewAddressNote(p.Id, 2, mask, addr, priv)),
+		"Note with address rejected.")
+	require.Equal(suite.T(), "10.0.0.1:1000", p.Addr(), "Rpc address not updated.")
+	require.Equal(suite.T(), "10.0.0.1:2000", p.PingAddr(), "Ping address not updated.")
+
+	addrs, err := node.IdToAddr([]byte(p.Id))
+	require.NoError(suite.T(), err, "Failed to look up peer.")
+	require.Equal(suite.T(), "10.0.0.1:1000", addrs, "Lookup returned stale address.")
+
+	tampered := discovery.NewAddressNote(p.Id, 3, mask, addr, priv)
+	tampered.Address.RpcAddr = "10.0.0.66:1000"
+	require.EqualError(suite.T(), node.evalNote(tampered), errInvalidSignature.Error(),
+		"Tampered address accepted.")
+	require.Equal(suite.T(), "10.0.0.1:1000", p.Addr(), "Tampered address applied.")
+
+	invalid := &proto.Address{RpcAddr: "10.0.0.1", PingAddr: "10.0.0.1:2000"}
+	require.Error(suite.T(), node.evalNote(discovery.NewAddressNote(p.Id, 3, mask, invalid, priv)),
+		"Invalid address accepted.")
+	require.Equal(suite.T(), "10.0.0.1:1000", p.Addr(), "Invalid address applied.")
+
+	// Claiming the address of another live peer would make both unreachable.
+	var q *discovery.Peer
+	for _, l := range node.view.Live() {
+		if l.Id != p.Id {
+			q = l
+		}
+	}
+	qPriv := suite.privMap[q.Id]
+	qAddr := q.Addr()
+
+	taken := &proto.Address{RpcAddr: p.Addr(), PingAddr: "10.0.0.2:2000"}
+
+	err = node.evalNote(discovery.NewAddressNote(q.Id, 2, mask, taken, qPriv))
+	require.Error(suite.T(), err, "Address of a live peer taken over.")
+	require.Equal(suite.T(), qAddr, q.Addr(), "Taken address applied.")
+
+	self := &proto.Address{RpcAddr: node.self.Addr(), PingAddr: "10.0.0.2:2000"}
+	err = node.evalNote(discovery.NewAddressNote(q.Id, 2, mask, self, qPriv))
+	require.Error(suite.T(), err, "Address of the local node taken over.")
+
+	// Addresses of peers no longer alive can be taken over.
+	node.view.RemoveLive(p.Id)
+
+	require.NoError(suite.T(), node.evalNote(discovery.NewAddressNote(q.Id, 2, mask, taken, qPriv)),
+		"Address of a dead peer not taken over.")
+	require.Equal(suite.T(), p.Addr(), q.Addr(), "Address not applied.")
+}
+
+func (suite *HandlerTestSuite) TestEvalRejoin() {
+	viper.Set("expire_timeout", 100)
+	defer viper.Set("expire_timeout", 0)
+
+	c := clock.NewManual(time.Now())
+
+	node, err := NewNode(&commStub{}, &pingStub{}, &cmStub{cert: genCert(suite.priv, 10)}, &cryptoStub{priv: suite.priv})
+	require.NoError(suite.T(), err, "Failed to create node.")
+
+	node.SetClock(c)
+
+	p, priv, err := addPeer(node)
+	require.NoError(suite.T(), err, "Could not add peer.")
+
+	cert, err := x509.ParseCertificate(p.Certificate())
+	require.NoError(suite.T(), err, "Could not parse certificate.")
+
+	mask := uint32(math.MaxUint32)
+
+	node.view.RemoveLive(p.Id)
+
+	c.Advance(time.Second * 101)
+	node.view.CheckExpired()
+	require.False(suite.T(), node.view.Exists(p.Id), "Peer not expired.")
+
+	require.NoError(suite.T(), node.evalCertificate(cert), "Failed to evaluate certificate.")
+	require.False(suite.T(), node.view.Exists(p.Id), "Expired peer added back by certificate.")
+
+	err = node.evalNote(discovery.NewNote(p.Id, 1, mask, priv))
+	require.Error(suite.T(), err, "Expired peer added back by old note.")
+	require.False(suite.T(), node.view.Exists(p.Id), "Expired peer added back by old note.")
+
+	err = node.evalNote(discovery.NewNote(p.Id, 2, mask, suite.priv))
+	require.EqualError(suite.T(), err, errInvalidSignature.Error(), "Expired peer added back by forged note.")
+	require.False(suite.T(), node.view.Exists(p.Id), "Expired peer added back by forged note.")
+
+	require.NoError(suite.T(), node.evalNote(discovery.NewNote(p.Id, 2, mask, priv)), "Fresh note rejected.")
+	require.True(suite.T(), node.view.Exists(p.Id), "Peer did not rejoin full view.")
+	require.True(suite.T(), node.view.IsAlive(p.Id), "Peer did not rejoin live view.")
+}
+
+func (suite *HandlerTestSuite) TestMergeRevocationList() {
+	caPriv, err := genKeys()
+	require.NoError(suite.T(), err, "Failed to generate keys")
+
+	caCert := genCert(caPriv, 10)
+
+	node, err := NewNode(&commStub{}, &pingStub{}, &cmStub{cert: genCert(suite.priv, 10), caCert: caCert}, &cryptoStub{priv: suite.priv})
+	require.NoError(suite.T(), err, "Failed to create node.")
+
+	revoked, _, err := addPeer(node)
+	require.NoError(suite.T(), err, "Could not add peer.")
+
+	other, _, err := addPeer(node)
+	require.NoError(suite.T(), err, "Could not add peer.")
+
+	revokedCert, err := x509.ParseCertificate(revoked.Certificate())
+	require.NoError(suite.T(), err, "Could not parse certificate.")
+
+	node.mergeRevocationList(genRevocationList(caPriv, caCert, 1, revoked.SerialNumber()))
+
+	require.False(suite.T(), node.view.Exists(revoked.Id), "Revoked peer still in full view.")
+	require.False(suite.T(), node.view.IsAlive(revoked.Id), "Revoked peer still in live view.")
+	require.True(suite.T(), node.view.Exists(other.Id), "Non-revoked peer removed.")
+	require.Equal(suite.T(), uint64(1), node.collectGossipContent().GetRevocationNumber(),
+		"Revocation number not gossiped.")
+
+	require.Equal(suite.T(), errRevokedCert, node.evalCertificate(revokedCert),
+		"Revoked certificate accepted.")
+	require.False(suite.T(), node.view.Exists(revoked.Id), "Revoked peer added back.")
+
+	forgedPriv, err := genKeys()
+	require.NoError(suite.T(), err, "Failed to generate keys")
+
+	node.mergeRevocationList(genRevocationList(forgedPriv, caCert, 2, other.SerialNumber()))
+	require.True(suite.T(), node.view.Exists(other.Id), "Peer removed by forged revocation list.")
+
+	node.mergeRevocationList(genRevocationList(caPriv, caCert, 1, other.SerialNumber()))
+	require.True(suite.T(), node.view.Exists(other.Id), "Peer removed by old revocation list.")
+
+	node.mergeRevocationList(genRevocationList(caPriv, caCert, 2, revoked.SerialNumber(), other.SerialNumber()))
+	require.False(suite.T(), node.view.Exists(other.Id), "Peer not removed by new revocation list.")
+	require.Equal(suite.T(), errRevokedCert, node.evalCertificate(revokedCert),
+		"Previously revoked certificate accepted.")
+}
+
+func (suite *HandlerTestSuite) TestPartitionHeal() {
+	viper.Set("expire_timeout", 100)
+	defer viper.Set("expire_timeout", 0)
+
+	network, err := memnet.NewNetwork(3, 1, 1)
+	require.NoError(suite.T(), err, "Failed to create network.")
+
+	c := clock.NewManual(time.Now())
+
+	var nodes []*Node
+
+	for i := 0; i < 2; i++ {
+		id, err := network.NewIdentity()
+		require.NoError(suite.T(), err, "Failed to create identity.")
+
+		comm, ping, err := network.NewTransport(id)
+		require.NoError(suite.T(), err, "Failed to create transport.")
+
+		n, err := NewNode(comm, ping, id, id)
+		require.NoError(suite.T(), err, "Failed to create node.")
+
+		n.SetClock(c)
+
+		nodes = append(nodes, n)
+	}
+
+	a, b := nodes[0], nodes[1]
+
+	require.NoError(suite.T(), a.evalCertificate(b.cm.Certificate()), "Failed to add peer.")
+	require.NoError(suite.T(), a.evalNote(b.self.Note().ToPbMsg()), "Failed to add note.")
+	require.NoError(suite.T(), b.evalCertificate(a.cm.Certificate()), "Failed to add peer.")
+	require.NoError(suite.T(), b.evalNote(a.self.Note().ToPbMsg()), "Failed to add note.")
+
+	require.False(suite.T(), a.view.RefreshExpiredNote(), "Note refreshed without expired peers.")
+
+	// Both sides of the partition lose each other.
+	a.view.RemoveLive(b.self.Id)
+	b.view.RemoveLive(a.self.Id)
+
+	c.Advance(time.Second * 101)
+	a.view.CheckExpired()
+	b.view.CheckExpired()
+
+	require.False(suite.T(), a.view.Exists(b.self.Id), "Peer not expired.")
+	require.False(suite.T(), b.view.Exists(a.self.Id), "Peer not expired.")
+
+	// The partition heals, the note each side expired with is refused.
+	epoch := a.self.Note().ToPbMsg().GetEpoch()
+
+	err = b.evalNote(a.self.Note().ToPbMsg())
+	require.Error(suite.T(), err, "Peer rejoined with the note it expired with.")
+
+	require.True(suite.T(), a.view.RefreshExpiredNote(), "Note not refreshed after expiring peers.")
+	require.False(suite.T(), a.view.RefreshExpiredNote(), "Note refreshed twice.")
+	require.Equal(suite.T(), epoch+1, a.self.Note().ToPbMsg().GetEpoch(), "Refreshed note not more recent.")
+
+	require.NoError(suite.T(), b.evalNote(a.self.Note().ToPbMsg()), "Refreshed note rejected.")
+	require.True(suite.T(), b.view.Exists(a.self.Id), "Peer did not rejoin full view.")
+	require.True(suite.T(), b.view.IsAlive(a.self.Id), "Peer did not rejoin live view.")
+
+	require.True(suite.T(), b.view.RefreshExpiredNote(), "Note not refreshed after expiring peers.")
+	require.NoError(suite.T(), a.evalNote(b.self.Note().ToPbMsg()), "Refreshed note rejected.")
+	require.True(suite.T(), a.view.IsAlive(b.self.Id), "Peer did not rejoin live view.")
+}
+
 func (suite *HandlerTestSuite) TestEvalCertificate() {
 	node := suite.n
 
@@ -1009,7 +1425,7 @@ func selfSignedCert(priv *ecdsa.PrivateKey, pk pkix.Name) (*x509.Certificate, er
 		NotBefore:             time.Now().AddDate(-10, 0, 0),
 		NotAfter:              time.Now().AddDate(10, 0, 0),
 		ExtraExtensions:       []pkix.Extension{ext},
-		PublicKey:             priv.PublicKey,
+		PublicKey:             &priv.PublicKey,
 		IPAddresses:           []net.IP{ip},
 		IsCA:                  true,
 		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth,
@@ -1032,6 +1448,34 @@ func selfSignedCert(priv *ecdsa.PrivateKey, pk pkix.Name) (*x509.Certificate, er
 	return parsed, nil
 }
 
+func genRevocationList(priv *ecdsa.PrivateKey, caCert *x509.Certificate, number int64, serials ...*big.Int) []byte {
+	var entries []x509.RevocationListEntry
+
+	for _, s := range serials {
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   s,
+			RevocationTime: time.Now(),
+		})
+	}
+
+	template := &x509.RevocationList{
+		RevokedCertificateEntries: entries,
+		Number:                    big.NewInt(number),
+		ThisUpdate:                time.Now(),
+		NextUpdate:                time.Now().Add(time.Hour),
+	}
+
+	issuer := *caCert
+	issuer.KeyUsage |= x509.KeyUsageCRLSign
+
+	raw, err := x509.CreateRevocationList(rand.Reader, template, &issuer, priv)
+	if err != nil {
+		panic(err)
+	}
+
+	return raw
+}
+
 func genId() []byte {
 	nonce := make([]byte, 32)
 	rand.Read(nonce)
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/joonnna/ifrit/clock"
 	"github.com/joonnna/ifrit/protobuf"
 )
 
@@ -16,6 +17,7 @@ func (n *Node) collectGossipContent() *proto.State {
 	msg := n.view.State()
 
 	msg.ExternalGossip = n.getExternalGossip()
+	msg.RevocationNumber = n.revocations.Number()
 
 	return msg
 }
@@ -48,6 +50,23 @@ func (n *Node) getGossipTimeout() time.Duration {
 	return n.gossipTimeout
 }
 
+// Replaces the clock driving gossip, monitoring and view timeouts.
+// Has to be set before the node is started.
+func (n *Node) SetClock(c clock.Clock) {
+	n.clockMutex.Lock()
+	defer n.clockMutex.Unlock()
+
+	n.clock = c
+	n.view.SetClock(c)
+}
+
+func (n *Node) getClock() clock.Clock {
+	n.clockMutex.RLock()
+	defer n.clockMutex.RUnlock()
+
+	return n.clock
+}
+
 // Exposed to let ifrit client set directly
 func (n *Node) SetExternalGossipContent(data []byte) {
 	n.externalGossipMutex.Lock()
@@ -121,4 +140,19 @@ func (n *Node) getStreamHandler() streamMsg {
 	defer n.streamHandlerMutex.RUnlock()
 
 	return n.streamHandler
+}
+
+// Expose so that client can set new handler directly
+func (n *Node) SetBlobHandler(newHandler processBlob) {
+	n.blobHandlerMutex.Lock()
+	defer n.blobHandlerMutex.Unlock()
+
+	n.blobHandler = newHandler
+}
+
+func (n *Node) getBlobHandler() processBlob {
+	n.blobHandlerMutex.RLock()
+	defer n.blobHandlerMutex.RUnlock()
+
+	return n.blobHandler
 }
\ No newline at end of file
@@ -1,15 +1,20 @@
 package core
 
 import (
-	"crypto/ecdsa"
+	"crypto"
 	"crypto/x509"
 	"errors"
+	"io"
 	"sync"
 	"time"
 
 	log "github.com/inconshreveable/log15"
+	"github.com/joonnna/ifrit/clock"
 	"github.com/joonnna/ifrit/core/discovery"
+	"github.com/joonnna/ifrit/keys"
 	pb "github.com/joonnna/ifrit/protobuf"
+	"github.com/joonnna/ifrit/revocation"
+	"github.com/joonnna/ifrit/transport"
 	"github.com/joonnna/workerpool"
 	"github.com/spf13/viper"
 )
@@ -19,6 +24,7 @@ var (
 	errNoData       = errors.New("Gossip data has zero length")
 	errNoCaAddr     = errors.New("No ca addr set in config with use_ca enabled")
 	errNoEntryAddrs = errors.New("No entry_addrs set in config with use_ca disabled")
+	errNoRenewal    = errors.New("Certificate manager does not support renewal")
 )
 
 type Message struct {
@@ -29,6 +35,7 @@ type Message struct {
 
 type processMsg func([]byte) ([]byte, error)
 type streamMsg func(chan []byte, chan []byte)
+type processBlob func(io.Reader) error
 
 type Node struct {
 	view *discovery.View
@@ -52,6 +59,12 @@ type Node struct {
 	monitorTimeout   time.Duration
 	nodeDeadTimeout  float64
 
+	clock      clock.Clock
+	clockMutex sync.RWMutex
+
+	revocations       *revocation.List
+	revocationTimeout time.Duration
+
 	msgHandler      processMsg
 	msgHandlerMutex sync.RWMutex
 
@@ -67,36 +80,46 @@ type Node struct {
 	streamHandler      streamMsg
 	streamHandlerMutex sync.RWMutex
 
+	blobHandler      processBlob
+	blobHandlerMutex sync.RWMutex
+
+	// Incoming blob transfers, keyed by sender id and transfer id.
+	// Completed transfers are dropped, keeping only their result.
+	blobs           map[string]*inboundBlob
+	blobBytes       map[string]uint64
+	blobResults     map[string]string
+	blobResultOrder []string
+	blobMutex       sync.Mutex
+
 	dispatcher *workerpool.Dispatcher
 
 	entryAddrs []string
 
 	fd *failureDetector
 
-	comm commService
+	comm transport.Comm
 	cs   cryptoService
 	cm   certManager
 
-	useViz bool
-	viz    *viz
-}
+	// Signatures of notes and accusations already verified.
+	sigs *signatureCache
+
+	// Messages to unreachable peers are relayed through the rings.
+	useRelay     bool
+	relayMaxHops uint32
 
-type commService interface {
-	Register(pb.GossipServer)
-	CloseConn(string)
-	Addr() string
-	Start()
-	Stop()
+	// Nonces of delivered relay messages, keyed by source id.
+	relayNonces     map[string]*nonceSet
+	relayNonceMutex sync.Mutex
 
-	Gossip(string, *pb.State) (*pb.StateResponse, error)
-	Send(string, *pb.Msg) (*pb.MsgResponse, error)
-	StreamMessenger(string, chan []byte, chan []byte) error
+	useViz bool
+	viz    *viz
 }
 
 type certManager interface {
 	Certificate() *x509.Certificate
 	CaCertificate() *x509.Certificate
-	Priv() *ecdsa.PrivateKey // Added for Saving private-key.
+	Priv() crypto.Signer // Added for Saving private-key.
 	ContactList() []*x509.Certificate
 	NumRings() uint32
 	Trusted() bool
@@ -104,8 +127,37 @@ type certManager interface {
 	SaveCertificate(string) error
 }
 
+// Implemented by certificate managers able to fetch the revocation list from the CA.
+type revocationFetcher interface {
+	FetchRevocationList() ([]byte, error)
+}
+
+// Implemented by certificate managers able to persist the local note,
+// letting restarted nodes continue with a more recent epoch.
+type noteStore interface {
+	LoadNote() (uint64, uint32, error)
+	SaveNote(uint64, uint32) error
+}
+
+// Implemented by certificate managers able to renew their certificate,
+// replacing the key pair while keeping the id.
+type certificateRenewer interface {
+	Renew() (*x509.Certificate, error)
+}
+
+// Implemented by comm services presenting the local certificate to peers.
+type certificatePresenter interface {
+	SetCertificate(*x509.Certificate, crypto.Signer) error
+}
+
+// Implemented by comm services pooling connections,
+// connections to pinned addresses are kept open.
+type connectionPinner interface {
+	Pin([]string)
+}
+
 type cryptoService interface {
-	Verify([]byte, []byte, []byte, *ecdsa.PublicKey) bool
+	Verify([]byte, []byte, []byte, crypto.PublicKey) bool
 	Sign([]byte) ([]byte, []byte, error)
 }
 
@@ -123,8 +175,16 @@ func (n *Node) gossipLoop() {
 		case <-n.exitChan:
 			log.Info("Exiting gossiping")
 			return
-		case <-time.After(n.getGossipTimeout()):
+		case <-n.getClock().After(n.getGossipTimeout()):
+			// A new note is spread by the following gossip round.
+			if n.view.ReactivateRings() {
+				n.saveNote()
+			}
+			if n.view.RefreshExpiredNote() {
+				n.saveNote()
+			}
 			n.protocol().Gossip(n)
+			n.pinNeighbours()
 		}
 	}
 }
@@ -137,13 +197,94 @@ func (n *Node) monitorLoop() {
 		case <-n.exitChan:
 			log.Info("Stopping monitoring")
 			return
-		case <-time.After(n.monitorTimeout):
+		case <-n.getClock().After(n.monitorTimeout):
 			n.protocol().Monitor(n)
 		}
 	}
 }
 
-func NewNode(comm commService, ps pingService, cm certManager, cs cryptoService) (*Node, error) {
+// Periodically fetches the revocation list from the CA,
+// more recent lists are also gossiped between peers.
+func (n *Node) revocationLoop(f revocationFetcher) {
+	defer n.wg.Done()
+
+	n.fetchRevocationList(f)
+
+	for {
+		select {
+		case <-n.exitChan:
+			log.Info("Stopping revocation fetching")
+			return
+		case <-n.getClock().After(n.revocationTimeout):
+			n.fetchRevocationList(f)
+		}
+	}
+}
+
+func (n *Node) fetchRevocationList(f revocationFetcher) {
+	raw, err := f.FetchRevocationList()
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+
+	n.mergeRevocationList(raw)
+}
+
+func (n *Node) restoreNote() {
+	s, ok := n.cm.(noteStore)
+	if !ok {
+		return
+	}
+
+	epoch, mask, err := s.LoadNote()
+	if err != nil {
+		log.Debug(err.Error())
+		return
+	}
+
+	err = n.view.RestoreNote(epoch, mask)
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+
+	n.saveNote()
+}
+
+// Persists the local note, has to be called each time it changes.
+func (n *Node) saveNote() {
+	s, ok := n.cm.(noteStore)
+	if !ok {
+		return
+	}
+
+	note := n.self.Note().ToPbMsg()
+
+	err := s.SaveNote(note.GetEpoch(), note.GetMask())
+	if err != nil {
+		log.Error(err.Error())
+	}
+}
+
+// Pins the connections to the current ring neighbours.
+func (n *Node) pinNeighbours() {
+	p, ok := n.comm.(connectionPinner)
+	if !ok {
+		return
+	}
+
+	var addrs []string
+
+	for _, neighbour := range n.view.MyNeighbours() {
+		addrs = append(addrs, neighbour.Addr())
+	}
+
+	p.Pin(addrs)
+}
+
+// Creates a node communicating through the given transports.
+func NewNode(comm transport.Comm, ps transport.Ping, cm certManager, cs cryptoService) (*Node, error) {
 	var perInterval int
 
 	v, err := discovery.NewView(cm.NumRings(), cm.Certificate(), comm, cs)
@@ -171,10 +312,22 @@ func NewNode(comm commService, ps pingService, cm certManager, cs cryptoService)
 		entryAddrs:       viper.GetStringSlice("entry_addrs"),
 		p:                correct{},
 		pingsPerInterval: perInterval,
+		clock:            clock.New(),
+		revocations:      revocation.NewList(cm.CaCertificate()),
+		blobs:            make(map[string]*inboundBlob),
+		blobBytes:        make(map[string]uint64),
+		blobResults:      make(map[string]string),
+		revocationTimeout: time.Second * time.Duration(viper.
+			GetInt32("revocation_interval")),
+
+		useRelay:     viper.GetBool("use_relay"),
+		relayMaxHops: uint32(viper.GetInt32("relay_max_hops")),
+		relayNonces:  make(map[string]*nonceSet),
 
 		fd:   newFd(ps, cs, uint32(viper.GetInt32("ping_limit"))),
 		cm:   cm,
 		cs:   cs,
+		sigs: newSignatureCache(viper.GetInt("signature_cache_size")),
 		comm: comm,
 		self: v.Self(),
 		view: v,
@@ -192,6 +345,8 @@ func NewNode(comm commService, ps pingService, cm certManager, cs cryptoService)
 		n.viz = viz
 	}
 
+	n.restoreNote()
+
 	n.comm.Register(n)
 
 	if n.cm.CaCertificate() != nil {
@@ -234,6 +389,36 @@ func (n *Node) Sign(content []byte) ([]byte, []byte, error) {
 	return r, s, nil
 }
 
+// Signs the data, the signature names the algorithm of our key.
+func (n *Node) signature(data []byte) (*pb.Signature, error) {
+	alg, err := keys.Algorithm(n.self.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+
+	r, s, err := n.cs.Sign(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.Signature{R: r, S: s, Algorithm: alg}, nil
+}
+
+// Returns true if the signature is valid for the data and the given key,
+// signatures naming another algorithm than the one of the key are rejected.
+// Signatures without an algorithm are ecdsa signatures.
+func validSignature(cs cryptoService, data []byte, sign *pb.Signature, pub crypto.PublicKey) bool {
+	if sign == nil {
+		return false
+	}
+
+	if alg, err := keys.Algorithm(pub); err != nil || alg != sign.GetAlgorithm() {
+		return false
+	}
+
+	return cs.Verify(data, sign.GetR(), sign.GetS(), pub)
+}
+
 func (n *Node) Verify(r, s, content []byte, id string) bool {
 	p := n.view.Peer(id)
 	if p == nil {
@@ -249,7 +434,30 @@ func (n *Node) IdToAddr(id []byte) (string, error) {
 		return "", errors.New("Could not find peer with specified id")
 	}
 
-	return p.Addr, nil
+	return p.Addr(), nil
+}
+
+// Returns the address of the live peer responsible for the given key on the given ring.
+func (n *Node) Lookup(key []byte, ringNum uint32) (string, error) {
+	p, err := n.view.Responsible(ringNum, key)
+	if err != nil {
+		return "", err
+	}
+
+	return p.Addr(), nil
+}
+
+// Returns the addresses of up to num distinct live peers responsible for the given key.
+func (n *Node) Replicas(key []byte, num int) []string {
+	replicas := n.view.Replicas(key, num)
+
+	ret := make([]string, 0, len(replicas))
+
+	for _, p := range replicas {
+		ret = append(ret, p.Addr())
+	}
+
+	return ret
 }
 
 func (n *Node) SendMessages(dest []string, ch chan *Message, data []byte) {
@@ -276,13 +484,31 @@ func (n *Node) SendStream(ch chan<- []byte, data []byte) {
 }
 
 func (n *Node) openStream(dest string, input, reply chan []byte) {
-	if err := n.comm.StreamMessenger(dest, input, reply); err != nil {
+	id, err := n.addrToId(dest)
+	if err != nil {
+		log.Error(err.Error(), "addr", dest)
+		return
+	}
+
+	if err := n.comm.StreamMessenger(dest, id, input, reply); err != nil {
 		log.Error(err.Error())
 	}
 }
 
 func (n *Node) sendMsg(dest string, ch chan *Message, msg *pb.Msg) {
-	reply, err := n.comm.Send(dest, msg)
+	id, err := n.addrToId(dest)
+	if err != nil {
+		log.Error(err.Error(), "addr", dest)
+		ch <- nil
+		return
+	}
+
+	reply, err := n.comm.Send(dest, id, msg)
+	if err != nil && n.useRelay {
+		log.Debug("Relaying message", "addr", dest, "err", err)
+		reply, err = n.relayMsg(id, msg)
+	}
+
 	if err != nil {
 		log.Error(err.Error())
 		ch <- nil
@@ -291,6 +517,17 @@ func (n *Node) sendMsg(dest string, ch chan *Message, msg *pb.Msg) {
 	ch <- &Message{Data: reply.GetContent(), Error: errors.New(reply.GetError())}
 }
 
+// Returns the id of the known peer at the given address, the certificate presented
+// at the address has to carry it. Unknown addresses and addresses shared by
+// several known peers are refused, any certified peer could answer at them.
+func (n *Node) addrToId(addr string) (string, error) {
+	if addr == n.self.Addr() {
+		return n.self.Id, nil
+	}
+
+	return n.view.AddrToId(addr)
+}
+
 func (n *Node) isStopping() bool {
 	n.exitMutex.Lock()
 	defer n.exitMutex.Unlock()
@@ -327,22 +564,73 @@ func (n *Node) LiveMembers() []string {
 	ret := make([]string, 0, len(live))
 
 	for _, p := range n.view.Live() {
-		ret = append(ret, p.Addr)
+		ret = append(ret, p.Addr())
+	}
+
+	return ret
+}
+
+// Returns the addresses of all live peers whose attributes match the selector.
+func (n *Node) MembersWhere(sel *discovery.Selector) []string {
+	var ret []string
+
+	for _, p := range n.view.Live() {
+		if sel.Matches(p.Attributes()) {
+			ret = append(ret, p.Addr())
+		}
 	}
 
 	return ret
 }
 
+// Replaces the attributes of the local node, they are signed as part of
+// a new note which is spread by the following gossip rounds.
+func (n *Node) SetAttributes(attrs map[string]string) error {
+	err := n.view.SetAttributes(attrs)
+	if err != nil {
+		return err
+	}
+
+	n.saveNote()
+
+	return nil
+}
+
+// Replaces the addresses other peers use to reach the local node,
+// they are signed as part of a new note which is spread by the following gossip rounds.
+func (n *Node) SetAddress(rpcAddr, pingAddr, httpAddr string) error {
+	err := n.view.SetAddress(rpcAddr, pingAddr, httpAddr)
+	if err != nil {
+		return err
+	}
+
+	n.saveNote()
+
+	return nil
+}
+
+// Returns the attributes of the local node.
+func (n *Node) Attributes() map[string]string {
+	return n.self.Attributes()
+}
+
+// Returns the advertised ping address of the local node.
+func (n *Node) PingAddr() string {
+	return n.self.PingAddr()
+}
+
 func (n *Node) HttpAddr() string {
-	return n.self.HttpAddr
+	return n.self.HttpAddr()
 }
 
 func (n *Node) Id() string {
 	return n.self.Id
 }
 
+// Returns the advertised rpc address of the local node, which may differ
+// from the address the rpc server is bound to.
 func (n *Node) Addr() string {
-	return n.comm.Addr()
+	return n.self.Addr()
 }
 
 func (n *Node) Start() {
@@ -356,6 +644,11 @@ func (n *Node) Start() {
 	go n.gossipLoop()
 	go n.monitorLoop()
 
+	if f, ok := n.cm.(revocationFetcher); ok && n.cm.CaCertificate() != nil && n.revocationTimeout > 0 {
+		n.wg.Add(1)
+		go n.revocationLoop(f)
+	}
+
 	n.dispatcher.Start()
 
 	if n.useViz {
@@ -368,7 +661,8 @@ func (n *Node) Start() {
 	// TODO retry if we fail to contact them?
 	if n.cm.CaCertificate() == nil {
 		for _, addr := range n.entryAddrs {
-			reply, err := n.comm.Gossip(addr, msg)
+			// Entry peers are unknown, any certified peer is accepted.
+			reply, err := n.comm.Gossip(addr, "", msg)
 			if err != nil {
 				log.Error(err.Error(), "addr", addr)
 				continue
@@ -385,10 +679,63 @@ func (n *Node) Start() {
 	n.Stop()
 }
 
+// Returns all changes to the local ring mask, oldest first.
+func (n *Node) MaskHistory() []discovery.MaskChange {
+	return n.view.MaskHistory()
+}
+
+// Returns the revocation list used by the node,
+// can be consulted by the transport during tls handshakes.
+func (n *Node) RevocationList() *revocation.List {
+	return n.revocations
+}
+
+// Returns the most recent certificate known for the given id, nil if the id is unknown.
+// Peers presenting an older certificate for the id, with a key replaced by renewal, are refused.
+func (n *Node) KnownCertificate(id string) *x509.Certificate {
+	return n.view.KnownCertificate(id)
+}
+
+// Renews the local certificate with a new key pair, keeping the id.
+// The renewed certificate spreads along with a new note signed by the new key,
+// peers replace the certificate they know once they receive both.
+func (n *Node) RenewCertificate() error {
+	r, ok := n.cm.(certificateRenewer)
+	if !ok {
+		return errNoRenewal
+	}
+
+	cert, err := r.Renew()
+	if err != nil {
+		return err
+	}
+
+	if p, ok := n.comm.(certificatePresenter); ok {
+		if err := p.SetCertificate(cert, n.cm.Priv()); err != nil {
+			return err
+		}
+	}
+
+	if err := n.view.RenewLocalCertificate(cert); err != nil {
+		return err
+	}
+
+	n.saveNote()
+
+	return nil
+}
+
 func (n *Node) SavePrivateKey(path string) error {
 	return n.cm.SavePrivateKey(path)
 }
 
 func (n *Node) SaveCertificate(path string) error {
-	return n.cm.SaveCertificate(path)
+	err := n.cm.SaveCertificate(path)
+	if err != nil {
+		return err
+	}
+
+	n.saveNote()
+
+	return nil
 }
@@ -1,12 +1,13 @@
 package core
 
 import (
+	"crypto"
 	"crypto/ecdsa"
-	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
-	"math/big"
+	"errors"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
@@ -16,6 +17,8 @@ import (
 	"github.com/stretchr/testify/suite"
 	"golang.org/x/net/context"
 
+	"github.com/joonnna/ifrit/keys"
+	"github.com/joonnna/ifrit/memnet"
 	pb "github.com/joonnna/ifrit/protobuf"
 )
 
@@ -76,6 +79,159 @@ func (suite *NodeTestSuite) TestGossip() {
 
 }
 
+func (suite *NodeTestSuite) TestPinNeighbours() {
+	priv, err := genKeys()
+	require.NoError(suite.T(), err, "Failed to generate keys")
+
+	cs := &pinStub{}
+
+	n, err := NewNode(cs, &pingStub{}, &cmStub{cert: genCert(priv, 10)}, &cryptoStub{priv: priv})
+	require.NoError(suite.T(), err, "Failed to create node.")
+
+	for i := 0; i < 5; i++ {
+		_, _, err := addPeer(n)
+		require.NoError(suite.T(), err, "Could not add peer.")
+	}
+
+	var expected []string
+	for _, p := range n.view.MyNeighbours() {
+		expected = append(expected, p.Addr())
+	}
+
+	n.pinNeighbours()
+
+	require.NotEmpty(suite.T(), cs.pinned, "No connections pinned.")
+	require.Equal(suite.T(), expected, cs.pinned, "Pinned connections are not the ring neighbours.")
+}
+
+func (suite *NodeTestSuite) TestParallelGossip() {
+	priv, err := genKeys()
+	require.NoError(suite.T(), err, "Failed to generate keys")
+
+	cs := &slowStub{delay: time.Millisecond * 200}
+
+	n, err := NewNode(cs, &pingStub{}, &cmStub{cert: genCert(priv, 10)}, &cryptoStub{priv: priv})
+	require.NoError(suite.T(), err, "Failed to create node.")
+
+	for i := 0; i < 5; i++ {
+		_, _, err := addPeer(n)
+		require.NoError(suite.T(), err, "Could not add peer.")
+	}
+
+	partners := len(n.view.GossipPartners())
+	require.True(suite.T(), partners > 1, "Not enough gossip partners.")
+
+	start := time.Now()
+	correct{}.Gossip(n)
+	elapsed := time.Since(start)
+
+	require.Equal(suite.T(), partners, cs.calls, "Not all partners contacted.")
+	require.Equal(suite.T(), partners, cs.maxInFlight, "Partners not contacted in parallel.")
+	require.True(suite.T(), elapsed < cs.delay*time.Duration(partners), "Round delayed by slow partners.")
+
+	cs.calls, cs.maxInFlight = 0, 0
+
+	correct{}.Rebuttal(n)
+
+	require.Equal(suite.T(), partners, cs.calls, "Rebuttal not spread to all partners.")
+	require.Equal(suite.T(), partners, cs.maxInFlight, "Rebuttal not spread in parallel.")
+}
+
+func (suite *NodeTestSuite) TestAddrToId() {
+	network, err := memnet.NewNetwork(3, 1, 1)
+	require.NoError(suite.T(), err, "Failed to create network.")
+
+	var nodes []*Node
+
+	for i := 0; i < 3; i++ {
+		id, err := network.NewIdentity()
+		require.NoError(suite.T(), err, "Failed to create identity.")
+
+		comm, ping, err := network.NewTransport(id)
+		require.NoError(suite.T(), err, "Failed to create transport.")
+
+		n, err := NewNode(comm, ping, id, id)
+		require.NoError(suite.T(), err, "Failed to create node.")
+
+		nodes = append(nodes, n)
+	}
+
+	n, p1, p2 := nodes[0], nodes[1], nodes[2]
+
+	for _, p := range nodes[1:] {
+		require.NoError(suite.T(), n.evalCertificate(p.cm.Certificate()), "Failed to add peer.")
+	}
+
+	id, err := n.addrToId(p1.Addr())
+	require.NoError(suite.T(), err, "Known address refused.")
+	require.Equal(suite.T(), p1.self.Id, id, "Wrong id for known address.")
+
+	id, err = n.addrToId(n.Addr())
+	require.NoError(suite.T(), err, "Own address refused.")
+	require.Equal(suite.T(), n.self.Id, id, "Wrong id for own address.")
+
+	_, err = n.addrToId("unknown:1234")
+	require.Error(suite.T(), err, "Id returned for unknown address.")
+
+	// The second peer takes over the address of the first one.
+	require.NoError(suite.T(), p2.SetAddress(p1.Addr(), p1.PingAddr(), ""), "Failed to set address.")
+	require.NoError(suite.T(), n.evalNote(p2.self.Note().ToPbMsg()), "Failed to apply address record.")
+
+	_, err = n.addrToId(p1.Addr())
+	require.Error(suite.T(), err, "Id returned for address shared by two peers.")
+
+	_, err = n.addrToId(p2.cm.Certificate().Subject.Locality[0])
+	require.Error(suite.T(), err, "Id returned for abandoned address.")
+
+	n.view.RemoveFull(p1.self.Id)
+
+	id, err = n.addrToId(p1.Addr())
+	require.NoError(suite.T(), err, "Address refused after removing the previous peer.")
+	require.Equal(suite.T(), p2.self.Id, id, "Wrong id for recycled address.")
+}
+
+// Delays all gossip, recording the number of concurrent calls.
+type slowStub struct {
+	commStub
+
+	delay       time.Duration
+	calls       int
+	inFlight    int
+	maxInFlight int
+	mutex       sync.Mutex
+}
+
+func (ss *slowStub) Gossip(addr, id string, m *pb.State) (*pb.StateResponse, error) {
+	ss.mutex.Lock()
+	ss.calls++
+	ss.inFlight++
+	if ss.inFlight > ss.maxInFlight {
+		ss.maxInFlight = ss.inFlight
+	}
+	ss.mutex.Unlock()
+
+	time.Sleep(ss.delay)
+
+	ss.mutex.Lock()
+	ss.inFlight--
+	ss.mutex.Unlock()
+
+	return &pb.StateResponse{}, nil
+}
+
+func (ss *slowStub) Rebuttal(addr, id string, m *pb.State) (*pb.StateResponse, error) {
+	return ss.Gossip(addr, id, m)
+}
+
+type pinStub struct {
+	commStub
+	pinned []string
+}
+
+func (ps *pinStub) Pin(addrs []string) {
+	ps.pinned = addrs
+}
+
 type clientStub struct {
 }
 
@@ -130,14 +286,27 @@ func (cs *commStub) Start() {
 func (cs *commStub) Stop() {
 }
 
-func (cs *commStub) Gossip(addr string, m *pb.State) (*pb.StateResponse, error) {
+func (cs *commStub) Gossip(addr, id string, m *pb.State) (*pb.StateResponse, error) {
+	return &pb.StateResponse{}, nil
+}
+
+func (cs *commStub) Rebuttal(addr, id string, m *pb.State) (*pb.StateResponse, error) {
 	return &pb.StateResponse{}, nil
 }
 
-func (cs *commStub) Send(addr string, m *pb.Msg) (*pb.MsgResponse, error) {
+func (cs *commStub) Send(addr, id string, m *pb.Msg) (*pb.MsgResponse, error) {
 	return &pb.MsgResponse{}, nil
 }
 
+func (cs *commStub) StreamMessenger(addr, id string, input, reply chan []byte) error {
+	close(reply)
+	return nil
+}
+
+func (cs *commStub) DialStream(ctx context.Context, addr, id string) (pb.Gossip_StreamClient, error) {
+	return nil, errors.New("Streams not supported")
+}
+
 type pingStub struct {
 }
 
@@ -159,35 +328,22 @@ type cryptoStub struct {
 	priv *ecdsa.PrivateKey
 }
 
-func (cs *cryptoStub) Verify(data, r, s []byte, pub *ecdsa.PublicKey) bool {
+func (cs *cryptoStub) Verify(data, r, s []byte, pub crypto.PublicKey) bool {
 	if pub == nil {
 		log.Error("Peer had no publicKey")
 		return false
 	}
 
-	var rInt, sInt big.Int
-
-	b := hashContent(data)
-
-	rInt.SetBytes(r)
-	sInt.SetBytes(s)
-
-	return ecdsa.Verify(pub, b, &rInt, &sInt)
+	return keys.Verify(pub, data, r, s)
 }
 
 func (cs *cryptoStub) Sign(data []byte) ([]byte, []byte, error) {
-	hash := hashContent(data)
-
-	r, s, err := ecdsa.Sign(rand.Reader, cs.priv, hash)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	return r.Bytes(), s.Bytes(), nil
+	return keys.Sign(cs.priv, data)
 }
 
 type cmStub struct {
-	cert *x509.Certificate
+	cert   *x509.Certificate
+	caCert *x509.Certificate
 }
 
 func (cm *cmStub) Certificate() *x509.Certificate {
@@ -195,7 +351,7 @@ func (cm *cmStub) Certificate() *x509.Certificate {
 }
 
 func (cm *cmStub) CaCertificate() *x509.Certificate {
-	return nil
+	return cm.caCert
 }
 
 func (cm *cmStub) ContactList() []*x509.Certificate {
@@ -209,3 +365,32 @@ func (cm *cmStub) NumRings() uint32 {
 func (cm *cmStub) Trusted() bool {
 	return false
 }
+
+func (cm *cmStub) Priv() crypto.Signer {
+	return nil
+}
+
+func (cm *cmStub) SavePrivateKey(path string) error {
+	return nil
+}
+
+func (cm *cmStub) SaveCertificate(path string) error {
+	return nil
+}
+
+type noteStoreStub struct {
+	cmStub
+
+	epoch uint64
+	mask  uint32
+}
+
+func (ns *noteStoreStub) LoadNote() (uint64, uint32, error) {
+	return ns.epoch, ns.mask, nil
+}
+
+func (ns *noteStoreStub) SaveNote(epoch uint64, mask uint32) error {
+	ns.epoch = epoch
+	ns.mask = mask
+	return nil
+}
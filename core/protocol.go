@@ -1,6 +1,8 @@
 package core
 
 import (
+	"sync"
+
 	log "github.com/inconshreveable/log15"
 	"github.com/joonnna/ifrit/core/discovery"
 	pb "github.com/joonnna/ifrit/protobuf"
@@ -26,13 +28,12 @@ func (c correct) Rebuttal(n *Node) {
 		OwnNote: noteMsg,
 	}
 
-	for _, p := range neighbours {
-		_, err := n.comm.Gossip(p.Addr, msg)
+	forEachPartner(neighbours, func(p *discovery.Peer) {
+		_, err := n.comm.Rebuttal(p.Addr(), p.Id, msg)
 		if err != nil {
-			log.Error(err.Error(), "addr", p.Addr)
-			continue
+			log.Error(err.Error(), "addr", p.Addr())
 		}
-	}
+	})
 }
 
 func (c correct) Gossip(n *Node) {
@@ -40,15 +41,16 @@ func (c correct) Gossip(n *Node) {
 
 	neighbours := n.view.GossipPartners()
 
-	for _, p := range neighbours {
-		reply, err := n.comm.Gossip(p.Addr, msg)
+	forEachPartner(neighbours, func(p *discovery.Peer) {
+		reply, err := n.comm.Gossip(p.Addr(), p.Id, msg)
 		if err != nil {
-			log.Error(err.Error(), "addr", p.Addr)
-			continue
+			log.Error(err.Error(), "addr", p.Addr())
+			return
 		}
 
-		//log.Debug("Gossiped", "addr", p.Addr)
+		//log.Debug("Gossiped", "addr", p.Addr())
 
+		n.mergeRevocationList(reply.GetRevocationList())
 		n.mergeCertificates(reply.GetCertificates())
 		n.mergeNotes(reply.GetNotes())
 		n.mergeAccusations(reply.GetAccusations())
@@ -58,7 +60,24 @@ func (c correct) Gossip(n *Node) {
 				handler(r)
 			}
 		}
+	})
+}
+
+// Contacts all partners of a round in parallel, so one slow partner
+// does not delay the others, and returns when all calls have completed.
+func forEachPartner(partners []*discovery.Peer, f func(*discovery.Peer)) {
+	var wg sync.WaitGroup
+
+	for _, p := range partners {
+		wg.Add(1)
+
+		go func(p *discovery.Peer) {
+			defer wg.Done()
+			f(p)
+		}(p)
 	}
+
+	wg.Wait()
 }
 
 func (c correct) Monitor(n *Node) {
@@ -70,7 +89,7 @@ func (c correct) Monitor(n *Node) {
 
 		err := n.fd.probe(p)
 		if err == errDead {
-			log.Debug("Successor dead, accusing", "succ", p.Addr, "ringNum", ringNum)
+			log.Debug("Successor dead, accusing", "succ", p.Addr(), "ringNum", ringNum)
 			peerNote := p.Note()
 
 			// Will always have note for a peer in our liveView, except when the peer stems
@@ -80,7 +99,7 @@ func (c correct) Monitor(n *Node) {
 			if peerNote == nil {
 				n.view.RemoveLive(p.Id)
 				log.Debug("Removing live peer due to not having note and being accused",
-					"addr", p.Addr)
+					"addr", p.Addr())
 				continue
 			}
 
@@ -0,0 +1,7 @@
+//go:build race
+// +build race
+
+package core
+
+// The race detector slows tests down by an order of magnitude.
+const raceEnabled = true
@@ -0,0 +1,236 @@
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	log "github.com/inconshreveable/log15"
+	"github.com/joonnna/ifrit/core/discovery"
+	pb "github.com/joonnna/ifrit/protobuf"
+)
+
+var (
+	errRelayDisabled = errors.New("Relaying is disabled")
+	errRelayHops     = errors.New("Relayed message exceeded the maximum number of hops")
+	errRelayRoute    = errors.New("No ring successor closer to the relay destination")
+	errRelaySource   = errors.New("Source of relayed message not found in full view")
+	errRelayDest     = errors.New("Relay destination not found in full view")
+	errRelayReply    = errors.New("Reply to relayed message carried an invalid signature")
+	errRelayReplay   = errors.New("Relayed message was already delivered")
+	errRelayNonce    = errors.New("Relayed message carried no nonce")
+	errRelayExpired  = errors.New("Relayed message expired or expires too far in the future")
+)
+
+// Relayed messages are refused once expired, the destination remembers
+// the nonces of delivered messages until they expire.
+// Messages expiring more than twice the period ahead are refused,
+// tolerating clocks of source and destination differing by up to the period.
+const relayExpiry = time.Minute
+
+// Nonces of relayed messages delivered from a single source, with their expiry.
+type nonceSet struct {
+	expiry map[string]time.Time
+}
+
+// Sends the message to the peer with the given id through the rings,
+// used when the peer can not be reached directly.
+// The message is signed by us and the reply is signed by the destination,
+// hence relaying peers can neither forge nor alter either of them.
+func (n *Node) relayMsg(destId string, msg *pb.Msg) (*pb.MsgResponse, error) {
+	dest := n.view.Peer(destId)
+	if dest == nil {
+		return nil, errRelayDest
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	r := &pb.RelayMsg{
+		Source:      []byte(n.self.Id),
+		Destination: []byte(destId),
+		Content:     msg.GetContent(),
+		Nonce:       nonce,
+		Expiry:      n.getClock().Now().Add(relayExpiry).UnixNano(),
+	}
+
+	b, err := proto.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Signature, err = n.signature(b)
+	if err != nil {
+		return nil, err
+	}
+
+	// The destination is skipped, we already failed to reach it.
+	// If no other successor is closer, the message starts at one of our
+	// other ring neighbours, which is still routed towards the destination.
+	var next []*discovery.Peer
+	added := map[string]bool{destId: true}
+
+	for _, p := range append(n.view.CloserSuccessors(destId), n.view.MyNeighbours()...) {
+		if !added[p.Id] {
+			added[p.Id] = true
+			next = append(next, p)
+		}
+	}
+
+	resp, err := n.forwardRelay(r, next)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err = relayReply(resp, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	if !validSignature(n.cs, b, resp.GetSignature(), dest.PublicKey()) {
+		return nil, errRelayReply
+	}
+
+	return resp, nil
+}
+
+// Handles a relayed message, either delivering it to the message handler
+// if we are the destination or forwarding it to a ring successor closer to the destination.
+// Replies are returned to the previous hop, thus following the message path back to the source.
+func (n *Node) handleRelay(r *pb.RelayMsg) (*pb.MsgResponse, error) {
+	if !n.useRelay {
+		return nil, errRelayDisabled
+	}
+
+	if r.GetHops() >= n.relayMaxHops {
+		return nil, errRelayHops
+	}
+
+	src := n.view.Peer(string(r.GetSource()))
+	if src == nil {
+		return nil, errRelaySource
+	}
+
+	b, err := proto.Marshal(&pb.RelayMsg{
+		Source:      r.GetSource(),
+		Destination: r.GetDestination(),
+		Content:     r.GetContent(),
+		Nonce:       r.GetNonce(),
+		Expiry:      r.GetExpiry(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !validSignature(n.cs, b, r.GetSignature(), src.PublicKey()) {
+		return nil, errInvalidSignature
+	}
+
+	if len(r.GetNonce()) == 0 {
+		return nil, errRelayNonce
+	}
+
+	expiry := time.Unix(0, r.GetExpiry())
+	if now := n.getClock().Now(); now.After(expiry) || expiry.After(now.Add(relayExpiry*2)) {
+		return nil, errRelayExpired
+	}
+
+	if string(r.GetDestination()) != n.self.Id {
+		fwd := proto.Clone(r).(*pb.RelayMsg)
+		fwd.Hops++
+
+		// Only the source falls back to other successors, otherwise an unreachable
+		// destination would make the number of attempts grow exponentially with the hops.
+		next := n.view.CloserSuccessors(string(r.GetDestination()))
+		if len(next) > 1 {
+			next = next[:1]
+		}
+
+		return n.forwardRelay(fwd, next)
+	}
+
+	// Hops can resend signed messages, the hop count is not signed either.
+	// Nonces are remembered until the message expires, after which it is refused.
+	if n.relayDelivered(string(r.GetSource()), r.GetNonce(), expiry) {
+		return nil, errRelayReplay
+	}
+
+	resp := n.handleMsg(r.GetContent())
+
+	b, err = relayReply(resp, r.GetNonce())
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Signature, err = n.signature(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// Forwards the relayed message to the first of the given successors,
+// falling back to the next one if a successor fails.
+func (n *Node) forwardRelay(r *pb.RelayMsg, next []*discovery.Peer) (*pb.MsgResponse, error) {
+	for _, p := range next {
+		resp, err := n.comm.Send(p.Addr(), p.Id, &pb.Msg{Relay: r})
+		if err != nil {
+			log.Debug("Failed to relay message", "addr", p.Addr(), "err", err)
+			continue
+		}
+
+		return resp, nil
+	}
+
+	return nil, errRelayRoute
+}
+
+// Returns the bytes signed by the destination of a relayed message,
+// the reply bound to the nonce of the message.
+func relayReply(resp *pb.MsgResponse, nonce []byte) ([]byte, error) {
+	b, err := proto.Marshal(&pb.MsgResponse{
+		Content: resp.GetContent(),
+		Error:   resp.GetError(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.Join([][]byte{b, nonce}, nil), nil
+}
+
+// Records the nonce of a relayed message delivered from the given source,
+// returns true if it had already been delivered. Expired nonces are forgotten.
+func (n *Node) relayDelivered(src string, nonce []byte, expiry time.Time) bool {
+	n.relayNonceMutex.Lock()
+	defer n.relayNonceMutex.Unlock()
+
+	set, ok := n.relayNonces[src]
+	if !ok {
+		set = &nonceSet{expiry: make(map[string]time.Time)}
+		n.relayNonces[src] = set
+	}
+
+	now := n.getClock().Now()
+
+	for k, e := range set.expiry {
+		if now.After(e) {
+			delete(set.expiry, k)
+		}
+	}
+
+	key := string(nonce)
+
+	if _, ok := set.expiry[key]; ok {
+		return true
+	}
+
+	set.expiry[key] = expiry
+
+	return false
+}
@@ -0,0 +1,268 @@
+package core
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	log "github.com/inconshreveable/log15"
+	"github.com/joonnna/ifrit/clock"
+	"github.com/joonnna/ifrit/memnet"
+	pb "github.com/joonnna/ifrit/protobuf"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type RelayTestSuite struct {
+	suite.Suite
+
+	nodes []*Node
+
+	// Transport of the first node, the source of all messages.
+	comm *partitionedComm
+}
+
+func TestRelayTestSuite(t *testing.T) {
+	r := log.Root()
+
+	r.SetHandler(log.DiscardHandler())
+
+	viper.Set("use_viz", false)
+	viper.Set("use_relay", true)
+	viper.Set("relay_max_hops", 16)
+
+	suite.Run(t, new(RelayTestSuite))
+}
+
+func (suite *RelayTestSuite) SetupTest() {
+	network, err := memnet.NewNetwork(3, 1, 1)
+	require.NoError(suite.T(), err, "Failed to create network.")
+
+	suite.nodes = nil
+
+	for i := 0; i < 10; i++ {
+		id, err := network.NewIdentity()
+		require.NoError(suite.T(), err, "Failed to create identity.")
+
+		comm, ping, err := network.NewTransport(id)
+		require.NoError(suite.T(), err, "Failed to create transport.")
+
+		var c = &partitionedComm{Comm: comm, blocked: make(map[string]bool)}
+		if i == 0 {
+			suite.comm = c
+		}
+
+		n, err := NewNode(c, ping, id, id)
+		require.NoError(suite.T(), err, "Failed to create node.")
+
+		comm.Start()
+		ping.Start()
+
+		suite.nodes = append(suite.nodes, n)
+	}
+
+	for _, n := range suite.nodes {
+		for _, other := range suite.nodes {
+			if n == other {
+				continue
+			}
+
+			require.NoError(suite.T(), n.evalCertificate(other.cm.Certificate()), "Failed to add peer.")
+			n.view.AddLive(n.view.Peer(other.self.Id))
+		}
+
+		id := n.self.Id
+		n.SetMsgHandler(func(data []byte) ([]byte, error) {
+			return append([]byte(id), data...), nil
+		})
+	}
+}
+
+func (suite *RelayTestSuite) TestRelay() {
+	src := suite.nodes[0]
+
+	for _, dest := range suite.nodes[1:] {
+		suite.comm.block(dest.Addr())
+
+		msg := suite.send(dest)
+		require.NotNil(suite.T(), msg, "Relayed message failed.")
+		assert.Equal(suite.T(), append([]byte(dest.self.Id), []byte("data")...), msg.Data, "Reply not from destination.")
+	}
+
+	assert.NotZero(suite.T(), suite.comm.relayed(), "Messages not relayed.")
+
+	src.useRelay = false
+
+	assert.Nil(suite.T(), suite.send(suite.nodes[1]), "Message relayed with relaying disabled.")
+}
+
+func (suite *RelayTestSuite) TestForgedReply() {
+	dest := suite.nodes[1]
+
+	suite.comm.block(dest.Addr())
+	suite.comm.tamper = true
+
+	assert.Nil(suite.T(), suite.send(dest), "Altered reply accepted.")
+}
+
+func (suite *RelayTestSuite) TestHandleRelay() {
+	src, hop, dest := suite.nodes[0], suite.nodes[1], suite.nodes[2]
+
+	r := suite.relayMsg(src, dest, []byte("nonce"), time.Now().Add(relayExpiry))
+
+	resp, err := hop.handleRelay(r)
+	require.NoError(suite.T(), err, "Valid relay message rejected.")
+
+	b, err := relayReply(resp, r.GetNonce())
+	require.NoError(suite.T(), err, "Failed to marshal reply.")
+	assert.True(suite.T(), validSignature(src.cs, b, resp.GetSignature(), src.view.Peer(dest.self.Id).PublicKey()), "Reply signature invalid.")
+
+	forged := proto.Clone(r).(*pb.RelayMsg)
+	forged.Content = []byte("forged")
+
+	_, err = hop.handleRelay(forged)
+	assert.Equal(suite.T(), errInvalidSignature, err, "Altered message relayed.")
+
+	exceeded := proto.Clone(r).(*pb.RelayMsg)
+	exceeded.Hops = hop.relayMaxHops
+
+	_, err = hop.handleRelay(exceeded)
+	assert.Equal(suite.T(), errRelayHops, err, "Message relayed beyond the maximum number of hops.")
+}
+
+func (suite *RelayTestSuite) TestReplayedRelay() {
+	src, dest := suite.nodes[0], suite.nodes[2]
+
+	var delivered int
+
+	dest.SetMsgHandler(func(data []byte) ([]byte, error) {
+		delivered++
+		return data, nil
+	})
+
+	r := suite.relayMsg(src, dest, []byte("nonce"), time.Now().Add(relayExpiry))
+
+	_, err := dest.handleRelay(r)
+	require.NoError(suite.T(), err, "Valid relay message rejected.")
+
+	// A hop on the path resends the message, with another hop count.
+	replayed := proto.Clone(r).(*pb.RelayMsg)
+	replayed.Hops++
+
+	_, err = dest.handleRelay(replayed)
+	assert.Equal(suite.T(), errRelayReplay, err, "Replayed message delivered.")
+	assert.Equal(suite.T(), 1, delivered, "Message handler ran for the replayed message.")
+
+	_, err = dest.handleRelay(suite.relayMsg(src, dest, nil, time.Now().Add(relayExpiry)))
+	assert.Equal(suite.T(), errRelayNonce, err, "Message without a nonce delivered.")
+}
+
+func (suite *RelayTestSuite) TestExpiredRelay() {
+	src, dest := suite.nodes[0], suite.nodes[2]
+
+	c := clock.NewManual(time.Now())
+	dest.SetClock(c)
+
+	var delivered int
+
+	dest.SetMsgHandler(func(data []byte) ([]byte, error) {
+		delivered++
+		return data, nil
+	})
+
+	r := suite.relayMsg(src, dest, []byte("nonce"), c.Now().Add(relayExpiry))
+
+	_, err := dest.handleRelay(r)
+	require.NoError(suite.T(), err, "Valid relay message rejected.")
+
+	// Once expired, the nonce is forgotten and the message is refused by its expiry instead.
+	c.Advance(relayExpiry + time.Second)
+
+	_, err = dest.handleRelay(suite.relayMsg(src, dest, []byte("other"), c.Now().Add(relayExpiry)))
+	require.NoError(suite.T(), err, "Valid relay message rejected.")
+	assert.Len(suite.T(), dest.relayNonces[src.self.Id].expiry, 1, "Expired nonce remembered.")
+
+	_, err = dest.handleRelay(r)
+	assert.Equal(suite.T(), errRelayExpired, err, "Expired message delivered.")
+
+	// Messages expiring far ahead would keep their nonces around.
+	_, err = dest.handleRelay(suite.relayMsg(src, dest, []byte("future"), c.Now().Add(relayExpiry*3)))
+	assert.Equal(suite.T(), errRelayExpired, err, "Message expiring too far ahead delivered.")
+
+	assert.Equal(suite.T(), 2, delivered, "Message handler ran for a refused message.")
+}
+
+// Returns a relay message from the source to the destination, signed by the source.
+func (suite *RelayTestSuite) relayMsg(src, dest *Node, nonce []byte, expiry time.Time) *pb.RelayMsg {
+	r := &pb.RelayMsg{
+		Source:      []byte(src.self.Id),
+		Destination: []byte(dest.self.Id),
+		Content:     []byte("data"),
+		Nonce:       nonce,
+		Expiry:      expiry.UnixNano(),
+	}
+
+	b, err := proto.Marshal(r)
+	require.NoError(suite.T(), err, "Failed to marshal.")
+
+	r.Signature, err = src.signature(b)
+	require.NoError(suite.T(), err, "Failed to sign.")
+
+	return r
+}
+
+func (suite *RelayTestSuite) send(dest *Node) *Message {
+	ch := make(chan *Message, 1)
+
+	suite.nodes[0].sendMsg(dest.Addr(), ch, &pb.Msg{Content: []byte("data")})
+
+	return <-ch
+}
+
+// Fails direct messages to blocked addresses, as if they were behind a firewall.
+type partitionedComm struct {
+	*memnet.Comm
+
+	blocked    map[string]bool
+	tamper     bool
+	numRelayed int
+	mutex      sync.Mutex
+}
+
+func (pc *partitionedComm) Send(addr, id string, args *pb.Msg) (*pb.MsgResponse, error) {
+	pc.mutex.Lock()
+	blocked := pc.blocked[addr] && args.GetRelay() == nil
+	if args.GetRelay() != nil {
+		pc.numRelayed++
+	}
+	pc.mutex.Unlock()
+
+	if blocked {
+		return nil, errors.New("Connection refused")
+	}
+
+	resp, err := pc.Comm.Send(addr, id, args)
+	if err == nil && pc.tamper {
+		resp.Content = []byte("tampered")
+	}
+
+	return resp, err
+}
+
+func (pc *partitionedComm) block(addr string) {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	pc.blocked[addr] = true
+}
+
+func (pc *partitionedComm) relayed() int {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+
+	return pc.numRelayed
+}
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"testing"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/joonnna/ifrit/memnet"
+	pb "github.com/joonnna/ifrit/protobuf"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type RenewTestSuite struct {
+	suite.Suite
+
+	nodes []*Node
+}
+
+func TestRenewTestSuite(t *testing.T) {
+	r := log.Root()
+
+	r.SetHandler(log.DiscardHandler())
+
+	viper.Set("use_viz", false)
+
+	suite.Run(t, new(RenewTestSuite))
+}
+
+func (suite *RenewTestSuite) SetupTest() {
+	network, err := memnet.NewNetwork(3, 1, 1)
+	require.NoError(suite.T(), err, "Failed to create network.")
+
+	suite.nodes = nil
+
+	for i := 0; i < 3; i++ {
+		id, err := network.NewIdentity()
+		require.NoError(suite.T(), err, "Failed to create identity.")
+
+		comm, ping, err := network.NewTransport(id)
+		require.NoError(suite.T(), err, "Failed to create transport.")
+
+		n, err := NewNode(comm, ping, id, id)
+		require.NoError(suite.T(), err, "Failed to create node.")
+
+		comm.Start()
+		ping.Start()
+
+		suite.nodes = append(suite.nodes, n)
+	}
+
+	for _, n := range suite.nodes {
+		for _, other := range suite.nodes {
+			if n != other {
+				require.NoError(suite.T(), n.evalCertificate(other.cm.Certificate()), "Failed to add peer.")
+				require.NoError(suite.T(), n.evalNote(other.self.Note().ToPbMsg()), "Failed to add note.")
+			}
+		}
+	}
+}
+
+func (suite *RenewTestSuite) TestRenewCertificate() {
+	renewed, observer := suite.nodes[0], suite.nodes[1]
+
+	prev := renewed.cm.Certificate()
+	prevEpoch := renewed.self.Note().ToPbMsg().GetEpoch()
+
+	require.NoError(suite.T(), renewed.RenewCertificate(), "Failed to renew certificate.")
+
+	cert := renewed.cm.Certificate()
+	assert.Equal(suite.T(), prev.SubjectKeyId, cert.SubjectKeyId, "Renewed certificate has another id.")
+	assert.NotEqual(suite.T(), prev.Raw, cert.Raw, "Certificate not renewed.")
+	assert.Equal(suite.T(), cert.Raw, renewed.self.Certificate(), "Local peer not renewed.")
+	assert.True(suite.T(), renewed.self.Note().ToPbMsg().GetEpoch() > prevEpoch, "No new note issued.")
+
+	note := renewed.self.Note().ToPbMsg()
+
+	require.NoError(suite.T(), observer.evalCertificate(cert), "Renewed certificate rejected.")
+
+	p := observer.view.Peer(renewed.self.Id)
+	assert.Equal(suite.T(), cert.Raw, p.Certificate(), "Certificate not replaced.")
+	assert.Equal(suite.T(), cert.PublicKey, p.PublicKey(), "Public key not replaced.")
+	assert.NoError(suite.T(), observer.evalNote(note), "Note signed with the renewed key rejected.")
+
+	assert.Error(suite.T(), observer.evalCertificate(prev), "Previous certificate replaced the renewed one.")
+	assert.Equal(suite.T(), cert.Raw, p.Certificate(), "Certificate replaced by the previous one.")
+}
+
+func (suite *RenewTestSuite) TestSpreadRenewedCertificate() {
+	renewed, gossiper, receiver := suite.nodes[0], suite.nodes[1], suite.nodes[2]
+
+	require.NoError(suite.T(), renewed.RenewCertificate(), "Failed to renew certificate.")
+
+	cert := renewed.cm.Certificate()
+
+	// The gossiper learns the renewed certificate directly from the renewed node.
+	reply := &pb.StateResponse{}
+	renewed.mergeViews(gossiper.view.State().GetExistingHosts(), reply)
+
+	gossiper.mergeCertificates(reply.GetCertificates())
+	gossiper.mergeNotes(reply.GetNotes())
+
+	assert.Equal(suite.T(), cert.Raw, gossiper.view.Peer(renewed.self.Id).Certificate(), "Renewed certificate not received from its owner.")
+
+	// Others learn it along with the more recent note.
+	reply = &pb.StateResponse{}
+	gossiper.mergeViews(receiver.view.State().GetExistingHosts(), reply)
+
+	receiver.mergeCertificates(reply.GetCertificates())
+	receiver.mergeNotes(reply.GetNotes())
+
+	p := receiver.view.Peer(renewed.self.Id)
+	assert.Equal(suite.T(), cert.Raw, p.Certificate(), "Renewed certificate not spread.")
+	assert.Equal(suite.T(), renewed.self.Note().ToPbMsg().GetEpoch(), p.Note().ToPbMsg().GetEpoch(), "Note signed with the renewed key not spread.")
+}
@@ -0,0 +1,272 @@
+package core
+
+import (
+	"container/list"
+	"crypto"
+	"crypto/sha256"
+	"encoding/binary"
+	"runtime"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	pb "github.com/joonnna/ifrit/protobuf"
+)
+
+// Replies carrying fewer signed items are verified sequentially.
+const minBatchVerify = 4
+
+// Bounded cache of verified signatures, keyed by signer id and a hash of the
+// signed data and signature. Gossip replies carry the same notes and accusations
+// round after round, cached signatures are not verified again.
+// Only valid signatures are cached, the least recently used are evicted first.
+type signatureCache struct {
+	size    int
+	entries map[signatureKey]*list.Element
+	order   *list.List
+	mutex   sync.Mutex
+}
+
+type signatureKey struct {
+	id   string
+	hash [sha256.Size]byte
+}
+
+type signatureEntry struct {
+	key signatureKey
+	pub crypto.PublicKey
+}
+
+// A signed item of a gossip reply, verified before it is evaluated.
+type signedItem struct {
+	id   string
+	data []byte
+	sign *pb.Signature
+	pub  crypto.PublicKey
+}
+
+// Creates a cache holding up to size signatures, caching is disabled if size is not positive.
+func newSignatureCache(size int) *signatureCache {
+	return &signatureCache{
+		size:    size,
+		entries: make(map[signatureKey]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Returns true if the signature of the given signer is valid for the data and key,
+// see validSignature. Signatures are only verified if not found in the cache.
+func (sc *signatureCache) valid(cs cryptoService, id string, data []byte, sign *pb.Signature, pub crypto.PublicKey) bool {
+	if sign == nil {
+		return false
+	}
+
+	if sc.size <= 0 {
+		return validSignature(cs, data, sign, pub)
+	}
+
+	key := signatureKey{id: id, hash: signatureHash(data, sign)}
+
+	if sc.contains(key, pub) {
+		return true
+	}
+
+	if !validSignature(cs, data, sign, pub) {
+		return false
+	}
+
+	sc.add(key, pub)
+
+	return true
+}
+
+// The key is part of the entry, a renewed key does not validate signatures cached for the previous one.
+func (sc *signatureCache) contains(key signatureKey, pub crypto.PublicKey) bool {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	e, ok := sc.entries[key]
+	if !ok || !samePublicKey(e.Value.(*signatureEntry).pub, pub) {
+		return false
+	}
+
+	sc.order.MoveToFront(e)
+
+	return true
+}
+
+func (sc *signatureCache) add(key signatureKey, pub crypto.PublicKey) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	if e, ok := sc.entries[key]; ok {
+		e.Value.(*signatureEntry).pub = pub
+		sc.order.MoveToFront(e)
+		return
+	}
+
+	sc.entries[key] = sc.order.PushFront(&signatureEntry{key: key, pub: pub})
+
+	for sc.order.Len() > sc.size {
+		last := sc.order.Back()
+		sc.order.Remove(last)
+		delete(sc.entries, last.Value.(*signatureEntry).key)
+	}
+}
+
+func (sc *signatureCache) numEntries() int {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	return sc.order.Len()
+}
+
+// Returns true if replies carrying the given number of signed items are verified in batches.
+func (sc *signatureCache) batching(num int) bool {
+	return sc.size > 0 && num >= minBatchVerify
+}
+
+// Verifies the signatures of the given items in parallel, filling the cache.
+// Invalid signatures are left for the sequential evaluation to reject.
+func (sc *signatureCache) verifyBatch(cs cryptoService, items []*signedItem) {
+	if len(items) == 0 {
+		return
+	}
+
+	workers := runtime.NumCPU()
+	if workers > len(items) {
+		workers = len(items)
+	}
+
+	ch := make(chan *signedItem)
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for item := range ch {
+				sc.valid(cs, item.id, item.data, item.sign, item.pub)
+			}
+		}()
+	}
+
+	for _, item := range items {
+		ch <- item
+	}
+
+	close(ch)
+	wg.Wait()
+}
+
+// Lengths are included, the boundaries between data and signature can not be shifted.
+func signatureHash(data []byte, sign *pb.Signature) [sha256.Size]byte {
+	h := sha256.New()
+
+	for _, b := range [][]byte{data, sign.GetR(), sign.GetS()} {
+		var l [8]byte
+		binary.BigEndian.PutUint64(l[:], uint64(len(b)))
+		h.Write(l[:])
+		h.Write(b)
+	}
+
+	var alg [4]byte
+	binary.BigEndian.PutUint32(alg[:], uint32(sign.GetAlgorithm()))
+	h.Write(alg[:])
+
+	var ret [sha256.Size]byte
+	copy(ret[:], h.Sum(nil))
+
+	return ret
+}
+
+func samePublicKey(a, b crypto.PublicKey) bool {
+	k, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+
+	return ok && k.Equal(b)
+}
+
+// Collects the notes of a gossip reply that evalNote would verify.
+func (n *Node) signedNotes(notes []*pb.Note) []*signedItem {
+	var items []*signedItem
+
+	for _, newNote := range notes {
+		id := string(newNote.GetId())
+		if id == n.self.Id {
+			continue
+		}
+
+		sign := newNote.GetSignature()
+		if sign == nil {
+			continue
+		}
+
+		p := n.view.Peer(id)
+		if p == nil {
+			continue
+		}
+
+		if note := p.Note(); note != nil && !note.IsMoreRecent(newNote.GetEpoch()) {
+			continue
+		}
+
+		newNote.Signature = nil
+		b, err := proto.Marshal(newNote)
+		newNote.Signature = sign
+		if err != nil {
+			continue
+		}
+
+		items = append(items, &signedItem{id: id, data: b, sign: sign, pub: p.PublicKey()})
+	}
+
+	return items
+}
+
+// Collects the accusations of a gossip reply that evalAccusation would verify.
+func (n *Node) signedAccusations(accusations []*pb.Accusation) []*signedItem {
+	var items []*signedItem
+
+	for _, acc := range accusations {
+		accId := string(acc.GetAccused())
+		accuserId := string(acc.GetAccuser())
+
+		sign := acc.GetSignature()
+		if sign == nil {
+			continue
+		}
+
+		accuser := n.view.Peer(accuserId)
+		if accuser == nil {
+			continue
+		}
+
+		if accId != n.self.Id {
+			accused := n.view.Peer(accId)
+			if accused == nil {
+				continue
+			}
+
+			note := accused.Note()
+			if note == nil || !note.Equal(acc.GetEpoch()) {
+				continue
+			}
+
+			a := accused.RingAccusation(acc.GetRingNum())
+			if a != nil && a.Equal(accId, accuserId, acc.GetRingNum(), acc.GetEpoch()) {
+				continue
+			}
+		}
+
+		acc.Signature = nil
+		b, err := proto.Marshal(acc)
+		acc.Signature = sign
+		if err != nil {
+			continue
+		}
+
+		items = append(items, &signedItem{id: accuserId, data: b, sign: sign, pub: accuser.PublicKey()})
+	}
+
+	return items
+}
@@ -0,0 +1,243 @@
+package core
+
+import (
+	"crypto"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/joonnna/ifrit/keys"
+	"github.com/joonnna/ifrit/memnet"
+	pb "github.com/joonnna/ifrit/protobuf"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+// Counts the signatures verified.
+type countingCs struct {
+	verified int32
+}
+
+func (cs *countingCs) Verify(data, r, s []byte, pub crypto.PublicKey) bool {
+	atomic.AddInt32(&cs.verified, 1)
+
+	return keys.Verify(pub, data, r, s)
+}
+
+func (cs *countingCs) Sign([]byte) ([]byte, []byte, error) {
+	return nil, nil, nil
+}
+
+func (cs *countingCs) count() int {
+	return int(atomic.LoadInt32(&cs.verified))
+}
+
+type SignatureTestSuite struct {
+	suite.Suite
+
+	priv crypto.Signer
+}
+
+func TestSignatureTestSuite(t *testing.T) {
+	r := log.Root()
+
+	r.SetHandler(log.DiscardHandler())
+
+	suite.Run(t, new(SignatureTestSuite))
+}
+
+func (suite *SignatureTestSuite) SetupSuite() {
+	priv, err := keys.Generate(keys.ECDSA)
+	require.NoError(suite.T(), err, "Failed to generate key.")
+
+	suite.priv = priv
+}
+
+func (suite *SignatureTestSuite) sign(data []byte) *pb.Signature {
+	sign, err := keys.NewSignature(suite.priv, data)
+	require.NoError(suite.T(), err, "Failed to sign.")
+
+	return sign
+}
+
+func (suite *SignatureTestSuite) TestValid() {
+	cs := &countingCs{}
+	sc := newSignatureCache(2)
+
+	data := []byte("data")
+	sign := suite.sign(data)
+	pub := suite.priv.Public()
+
+	assert.True(suite.T(), sc.valid(cs, "id", data, sign, pub), "Valid signature rejected.")
+	assert.True(suite.T(), sc.valid(cs, "id", data, sign, pub), "Cached signature rejected.")
+	assert.Equal(suite.T(), 1, cs.count(), "Cached signature verified again.")
+
+	assert.False(suite.T(), sc.valid(cs, "id", []byte("other"), sign, pub), "Signature valid for other data.")
+	assert.False(suite.T(), sc.valid(cs, "id", []byte("other"), sign, pub), "Signature valid for other data.")
+	assert.Equal(suite.T(), 3, cs.count(), "Invalid signature cached.")
+
+	other, err := keys.Generate(keys.ECDSA)
+	require.NoError(suite.T(), err, "Failed to generate key.")
+
+	assert.False(suite.T(), sc.valid(cs, "id", data, sign, other.Public()), "Cached signature valid for another key.")
+	assert.True(suite.T(), sc.valid(cs, "other", data, sign, pub), "Valid signature rejected.")
+	assert.Equal(suite.T(), 5, cs.count(), "Signature cached for another signer.")
+
+	assert.False(suite.T(), sc.valid(cs, "id", data, nil, pub), "Missing signature accepted.")
+}
+
+func (suite *SignatureTestSuite) TestEviction() {
+	cs := &countingCs{}
+	sc := newSignatureCache(2)
+
+	pub := suite.priv.Public()
+
+	var data [][]byte
+	var signs []*pb.Signature
+
+	for i := 0; i < 3; i++ {
+		d := []byte(fmt.Sprintf("data%d", i))
+		data = append(data, d)
+		signs = append(signs, suite.sign(d))
+
+		require.True(suite.T(), sc.valid(cs, "id", d, signs[i], pub), "Valid signature rejected.")
+	}
+
+	assert.Equal(suite.T(), 2, sc.numEntries(), "Cache exceeded its size.")
+
+	sc.valid(cs, "id", data[2], signs[2], pub)
+	assert.Equal(suite.T(), 3, cs.count(), "Recent signature evicted.")
+
+	sc.valid(cs, "id", data[0], signs[0], pub)
+	assert.Equal(suite.T(), 4, cs.count(), "Least recently used signature not evicted.")
+}
+
+func (suite *SignatureTestSuite) TestDisabled() {
+	cs := &countingCs{}
+	sc := newSignatureCache(0)
+
+	data := []byte("data")
+	sign := suite.sign(data)
+
+	assert.True(suite.T(), sc.valid(cs, "id", data, sign, suite.priv.Public()), "Valid signature rejected.")
+	assert.True(suite.T(), sc.valid(cs, "id", data, sign, suite.priv.Public()), "Valid signature rejected.")
+	assert.Equal(suite.T(), 2, cs.count(), "Signature cached with caching disabled.")
+	assert.Equal(suite.T(), 0, sc.numEntries(), "Signature cached with caching disabled.")
+	assert.False(suite.T(), sc.batching(minBatchVerify), "Batching with caching disabled.")
+}
+
+func (suite *SignatureTestSuite) TestVerifyBatch() {
+	cs := &countingCs{}
+	sc := newSignatureCache(64)
+
+	var items []*signedItem
+
+	for i := 0; i < 16; i++ {
+		d := []byte(fmt.Sprintf("data%d", i))
+		sign := suite.sign(d)
+
+		// Every fourth item carries a signature of other data.
+		if i%4 == 0 {
+			d = []byte("other")
+		}
+
+		items = append(items, &signedItem{id: "id", data: d, sign: sign, pub: suite.priv.Public()})
+	}
+
+	require.True(suite.T(), sc.batching(len(items)), "Reply not verified in batches.")
+
+	sc.verifyBatch(cs, items)
+
+	assert.Equal(suite.T(), len(items), cs.count(), "Not all signatures verified.")
+	assert.Equal(suite.T(), 12, sc.numEntries(), "Invalid signatures cached.")
+
+	for _, item := range items {
+		sc.valid(cs, item.id, item.data, item.sign, item.pub)
+	}
+
+	assert.Equal(suite.T(), len(items)+4, cs.count(), "Valid signatures verified again.")
+}
+
+func (suite *SignatureTestSuite) TestMergeNotes() {
+	defer viper.Set("signature_cache_size", 0)
+	viper.Set("use_viz", false)
+	viper.Set("signature_cache_size", 64)
+
+	network, err := memnet.NewNetwork(3, 1, 1)
+	require.NoError(suite.T(), err, "Failed to create network.")
+
+	var nodes []*Node
+
+	for i := 0; i < minBatchVerify+1; i++ {
+		id, err := network.NewIdentity()
+		require.NoError(suite.T(), err, "Failed to create identity.")
+
+		comm, ping, err := network.NewTransport(id)
+		require.NoError(suite.T(), err, "Failed to create transport.")
+
+		n, err := NewNode(comm, ping, id, id)
+		require.NoError(suite.T(), err, "Failed to create node.")
+
+		nodes = append(nodes, n)
+	}
+
+	receiver := nodes[0]
+
+	var notes []*pb.Note
+
+	for _, n := range nodes[1:] {
+		require.NoError(suite.T(), receiver.evalCertificate(n.cm.Certificate()), "Failed to add peer.")
+		notes = append(notes, n.self.Note().ToPbMsg())
+	}
+
+	receiver.mergeNotes(notes)
+
+	assert.Equal(suite.T(), len(notes), receiver.sigs.numEntries(), "Note signatures not cached.")
+
+	for _, n := range nodes[1:] {
+		p := receiver.view.Peer(n.self.Id)
+		require.NotNil(suite.T(), p, "Peer not in full view.")
+		assert.NotNil(suite.T(), p.Note(), "Note not accepted.")
+		assert.True(suite.T(), receiver.view.IsAlive(p.Id), "Peer not added to live view.")
+	}
+}
+
+// Verification of the accusations resent by every gossip reply, with and without the cache.
+func BenchmarkVerifyReply(b *testing.B) {
+	priv, err := keys.Generate(keys.ECDSA)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var items []*signedItem
+
+	for i := 0; i < 64; i++ {
+		d := []byte(fmt.Sprintf("accusation%d", i))
+
+		sign, err := keys.NewSignature(priv, d)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		items = append(items, &signedItem{id: "id", data: d, sign: sign, pub: priv.Public()})
+	}
+
+	for _, size := range []int{0, 4096} {
+		b.Run(fmt.Sprintf("cache=%d", size), func(b *testing.B) {
+			cs := &countingCs{}
+			sc := newSignatureCache(size)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				for _, item := range items {
+					sc.valid(cs, item.id, item.data, item.sign, item.pub)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/joonnna/ifrit/clock"
+	"github.com/joonnna/ifrit/memnet"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type SimulationTestSuite struct {
+	suite.Suite
+}
+
+type simNode struct {
+	*Node
+
+	comm *memnet.Comm
+	ping *memnet.Ping
+}
+
+func TestSimulationTestSuite(t *testing.T) {
+	r := log.Root()
+
+	r.SetHandler(log.DiscardHandler())
+
+	viper.Set("use_viz", false)
+	viper.Set("ping_limit", 3)
+	viper.Set("dead_timeout", 60)
+
+	suite.Run(t, new(SimulationTestSuite))
+}
+
+// Runs the same seeded crash scenario twice and requires
+// accusations and removals to happen at exactly the same steps.
+func (suite *SimulationTestSuite) TestDeterministicFailureDetection() {
+	first := suite.simulate(1)
+	second := suite.simulate(1)
+
+	require.Equal(suite.T(), len(first), len(second), "Runs took a different number of steps.")
+
+	for i := range first {
+		require.Equal(suite.T(), first[i], second[i], fmt.Sprintf("Runs diverged at step %d.", i))
+	}
+}
+
+// Crashes a few nodes of a converged network and steps the remaining nodes
+// until every crashed node is removed from all live views.
+// Returns a snapshot of all timers and live views after each step.
+func (suite *SimulationTestSuite) simulate(seed int64) []string {
+	var steps []string
+
+	numNodes, numCrashed, maxSteps := 30, 3, 100
+
+	c := clock.NewManual(time.Unix(0, 0))
+
+	network, err := memnet.NewNetwork(5, 5, seed)
+	require.NoError(suite.T(), err, "Failed to create network.")
+
+	nodes := make([]*simNode, 0, numNodes)
+
+	for i := 0; i < numNodes; i++ {
+		id, err := network.NewIdentity()
+		require.NoError(suite.T(), err, "Failed to create identity.")
+
+		comm, ping, err := network.NewTransport(id)
+		require.NoError(suite.T(), err, "Failed to create transport.")
+
+		n, err := NewNode(comm, ping, id, id)
+		require.NoError(suite.T(), err, "Failed to create node.")
+
+		n.SetClock(c)
+
+		comm.Start()
+		ping.Start()
+
+		nodes = append(nodes, &simNode{Node: n, comm: comm, ping: ping})
+	}
+
+	for round := 0; round < maxSteps && !simConverged(nodes, numNodes-1); round++ {
+		for _, n := range nodes {
+			n.protocol().Gossip(n.Node)
+		}
+	}
+	require.True(suite.T(), simConverged(nodes, numNodes-1), "Network did not converge.")
+
+	crashed := nodes[numNodes-numCrashed:]
+	alive := nodes[:numNodes-numCrashed]
+
+	for _, n := range crashed {
+		n.comm.Stop()
+		n.ping.Stop()
+	}
+
+	for step := 0; step < maxSteps; step++ {
+		for _, n := range alive {
+			n.protocol().Monitor(n.Node)
+			n.protocol().Gossip(n.Node)
+			n.view.CheckTimeouts()
+		}
+
+		steps = append(steps, snapshot(alive, crashed))
+
+		if simConverged(alive, len(alive)-1) {
+			return steps
+		}
+
+		c.Advance(time.Second * 10)
+	}
+
+	suite.T().Fatal("Crashed nodes were never removed from the live views.")
+
+	return nil
+}
+
+func simConverged(nodes []*simNode, expected int) bool {
+	for _, n := range nodes {
+		if len(n.view.Live()) != expected {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Describes which crashed nodes each alive node has timers for and
+// which remain in its live view.
+func snapshot(alive, crashed []*simNode) string {
+	lines := make([]string, 0, len(alive))
+
+	for _, n := range alive {
+		var timers, live []string
+
+		for _, c := range crashed {
+			if n.view.HasTimer(c.Id()) {
+				timers = append(timers, c.Addr())
+			}
+
+			if n.view.IsAlive(c.Id()) {
+				live = append(live, c.Addr())
+			}
+		}
+
+		sort.Strings(timers)
+		sort.Strings(live)
+
+		lines = append(lines, fmt.Sprintf("%s timers=%v live=%v", n.Addr(), timers, live))
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -126,7 +126,7 @@ func (v *viz) periodicallyPause(d time.Duration) {
 			v.n.fd.stopServing(d)
 		}
 
-		time.Sleep(d * 3)
+		v.n.getClock().Sleep(d * 3)
 	}
 }
 
@@ -147,7 +147,7 @@ func (v *viz) updateState() {
 		case <-v.exitChan:
 			return
 
-		case <-time.After(v.updateTimeout):
+		case <-v.n.getClock().After(v.updateTimeout):
 			for i = 1; i <= rings; i++ {
 				s := v.newState(i)
 
@@ -170,14 +170,14 @@ func (v *viz) newState(ringId uint32) *state {
 
 	succ, prev := v.n.view.MyRingNeighbours(ringId)
 	if succ != nil {
-		succId = fmt.Sprintf("%s|%d", succ.Addr, ringId)
+		succId = fmt.Sprintf("%s|%d", succ.Addr(), ringId)
 	}
 	if prev != nil {
-		prevId = fmt.Sprintf("%s|%d", prev.Addr, ringId)
+		prevId = fmt.Sprintf("%s|%d", prev.Addr(), ringId)
 	}
 
 	return &state{
-		ID:       fmt.Sprintf("%s|%d", v.n.self.Addr, ringId),
+		ID:       fmt.Sprintf("%s|%d", v.n.self.Addr(), ringId),
 		Next:     succId,
 		Prev:     prevId,
 		HttpAddr: v.httpAddr,
@@ -0,0 +1,214 @@
+package fault
+
+import (
+	"crypto"
+	"crypto/x509"
+
+	"github.com/golang/protobuf/proto"
+	log "github.com/inconshreveable/log15"
+	pb "github.com/joonnna/ifrit/protobuf"
+	"github.com/joonnna/ifrit/transport"
+	"golang.org/x/net/context"
+)
+
+// Named to keep the embedded field distinct from the Comm type.
+type commService interface {
+	transport.Comm
+}
+
+// Comm wraps a comm service and injects faults on all outgoing calls.
+type Comm struct {
+	commService
+	inj *Injector
+}
+
+// Wraps the given comm service, faults are controlled through the injector.
+func NewComm(c transport.Comm, inj *Injector) *Comm {
+	return &Comm{
+		commService: c,
+		inj:         inj,
+	}
+}
+
+// Forwards pinned addresses to the wrapped comm service, if it pools connections.
+func (c *Comm) Pin(addrs []string) {
+	if p, ok := c.commService.(interface{ Pin([]string) }); ok {
+		p.Pin(addrs)
+	}
+}
+
+// Forwards a renewed certificate to the wrapped comm service, if it presents one to peers.
+func (c *Comm) SetCertificate(cert *x509.Certificate, priv crypto.Signer) error {
+	if s, ok := c.commService.(interface {
+		SetCertificate(*x509.Certificate, crypto.Signer) error
+	}); ok {
+		return s.SetCertificate(cert, priv)
+	}
+
+	return nil
+}
+
+func (c *Comm) Gossip(addr, id string, args *pb.State) (*pb.StateResponse, error) {
+	copies, corrupt, err := c.inj.apply(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if corrupt {
+		args = c.corruptState(args)
+	}
+
+	for i := 1; i < copies; i++ {
+		if _, err := c.commService.Gossip(addr, id, proto.Clone(args).(*pb.State)); err != nil {
+			log.Debug(err.Error(), "addr", addr)
+		}
+	}
+
+	return c.commService.Gossip(addr, id, args)
+}
+
+func (c *Comm) Rebuttal(addr, id string, args *pb.State) (*pb.StateResponse, error) {
+	copies, corrupt, err := c.inj.apply(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if corrupt {
+		args = c.corruptState(args)
+	}
+
+	for i := 1; i < copies; i++ {
+		if _, err := c.commService.Rebuttal(addr, id, proto.Clone(args).(*pb.State)); err != nil {
+			log.Debug(err.Error(), "addr", addr)
+		}
+	}
+
+	return c.commService.Rebuttal(addr, id, args)
+}
+
+func (c *Comm) Send(addr, id string, args *pb.Msg) (*pb.MsgResponse, error) {
+	copies, corrupt, err := c.inj.apply(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if corrupt {
+		args = c.corruptMsg(args)
+	}
+
+	for i := 1; i < copies; i++ {
+		if _, err := c.commService.Send(addr, id, args); err != nil {
+			log.Debug(err.Error(), "addr", addr)
+		}
+	}
+
+	return c.commService.Send(addr, id, args)
+}
+
+// Faults are applied once when the stream is opened,
+// and per message on the input stream.
+func (c *Comm) StreamMessenger(addr, id string, input, reply chan []byte) error {
+	if _, _, err := c.inj.apply(addr); err != nil {
+		return err
+	}
+
+	faulty := make(chan []byte)
+
+	go func() {
+		defer close(faulty)
+
+		for content := range input {
+			copies, corrupt, err := c.inj.apply(addr)
+			if err != nil {
+				continue
+			}
+
+			if corrupt {
+				content = c.inj.corrupt(content)
+			}
+
+			for i := 0; i < copies; i++ {
+				faulty <- content
+			}
+		}
+	}()
+
+	err := c.commService.StreamMessenger(addr, id, faulty, reply)
+
+	// Unblock the forwarding goroutine if the stream ended early.
+	go func() {
+		for range faulty {
+		}
+	}()
+
+	return err
+}
+
+// Faults are applied once when the stream is opened,
+// and per message sent on the stream.
+func (c *Comm) DialStream(ctx context.Context, addr, id string) (pb.Gossip_StreamClient, error) {
+	if _, _, err := c.inj.apply(addr); err != nil {
+		return nil, err
+	}
+
+	s, err := c.commService.DialStream(ctx, addr, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &faultyStream{Gossip_StreamClient: s, c: c, addr: addr}, nil
+}
+
+type faultyStream struct {
+	pb.Gossip_StreamClient
+	c    *Comm
+	addr string
+}
+
+// Dropped messages are lost silently, as on the wire.
+func (fs *faultyStream) Send(m *pb.Msg) error {
+	copies, corrupt, err := fs.c.inj.apply(fs.addr)
+	if err != nil {
+		return nil
+	}
+
+	if corrupt {
+		m = fs.c.corruptMsg(m)
+	}
+
+	for i := 0; i < copies; i++ {
+		if err := fs.Gossip_StreamClient.Send(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Corrupts the blob data if present, otherwise the message content.
+func (c *Comm) corruptMsg(m *pb.Msg) *pb.Msg {
+	ret := proto.Clone(m).(*pb.Msg)
+
+	if b := ret.GetBlob(); len(b.GetData()) > 0 {
+		b.Data = c.inj.corrupt(b.GetData())
+	} else if r := ret.GetRelay(); r != nil {
+		r.Content = c.inj.corrupt(r.GetContent())
+	} else {
+		ret.Content = c.inj.corrupt(ret.GetContent())
+	}
+
+	return ret
+}
+
+// Corrupts the application gossip if present, otherwise the note signature.
+func (c *Comm) corruptState(args *pb.State) *pb.State {
+	ret := proto.Clone(args).(*pb.State)
+
+	if ext := ret.GetExternalGossip(); len(ext) > 0 {
+		ret.ExternalGossip = c.inj.corrupt(ext)
+	} else if sign := ret.GetOwnNote().GetSignature(); sign != nil {
+		sign.R = c.inj.corrupt(sign.GetR())
+	}
+
+	return ret
+}
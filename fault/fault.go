@@ -0,0 +1,229 @@
+package fault
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDropped     = errors.New("Message dropped by fault injector")
+	ErrPartitioned = errors.New("Destination is partitioned by fault injector")
+)
+
+// Rule describes the faults injected on messages towards a single destination.
+// Probabilities are in the range [0, 1].
+type Rule struct {
+	// Probability of silently dropping a message.
+	Drop float64
+
+	// Fixed delay added to each message, plus a uniformly
+	// distributed random delay in [0, Jitter).
+	Latency time.Duration
+	Jitter  time.Duration
+
+	// One-way partition, all messages towards the destination fail.
+	Partitioned bool
+
+	// Probability of delivering a message twice.
+	Duplicate float64
+
+	// Probability of flipping a byte in the message payload.
+	Corrupt float64
+}
+
+// Injector holds the fault rules shared by the wrapped comm and ping services.
+// All methods are safe for concurrent use and take effect immediately.
+type Injector struct {
+	rules       map[string]*Rule
+	defaultRule *Rule
+	ruleMutex   sync.RWMutex
+
+	rng      *rand.Rand
+	rngMutex sync.Mutex
+}
+
+// Creates a new injector without any rules,
+// the seed determines the sequence of injected faults.
+func NewInjector(seed int64) *Injector {
+	return &Injector{
+		rules:       make(map[string]*Rule),
+		defaultRule: &Rule{},
+		rng:         rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Replaces the rule for the given destination address.
+func (i *Injector) SetRule(dest string, r Rule) {
+	i.ruleMutex.Lock()
+	defer i.ruleMutex.Unlock()
+
+	i.rules[dest] = &r
+}
+
+// Replaces the rule used for destinations without a specific rule.
+func (i *Injector) SetDefaultRule(r Rule) {
+	i.ruleMutex.Lock()
+	defer i.ruleMutex.Unlock()
+
+	i.defaultRule = &r
+}
+
+// Removes the rule for the given destination, the default rule applies afterwards.
+func (i *Injector) ClearRule(dest string) {
+	i.ruleMutex.Lock()
+	defer i.ruleMutex.Unlock()
+
+	delete(i.rules, dest)
+}
+
+// Removes all rules, including the default rule.
+func (i *Injector) Reset() {
+	i.ruleMutex.Lock()
+	defer i.ruleMutex.Unlock()
+
+	i.rules = make(map[string]*Rule)
+	i.defaultRule = &Rule{}
+}
+
+// Returns a copy of the rule currently applied to the given destination.
+func (i *Injector) Rule(dest string) Rule {
+	i.ruleMutex.RLock()
+	defer i.ruleMutex.RUnlock()
+
+	if r, ok := i.rules[dest]; ok {
+		return *r
+	}
+
+	return *i.defaultRule
+}
+
+// Sets the drop probability for the given destination.
+func (i *Injector) SetDrop(dest string, p float64) {
+	i.updateRule(dest, func(r *Rule) {
+		r.Drop = p
+	})
+}
+
+// Sets the added latency and jitter for the given destination.
+func (i *Injector) SetLatency(dest string, latency, jitter time.Duration) {
+	i.updateRule(dest, func(r *Rule) {
+		r.Latency = latency
+		r.Jitter = jitter
+	})
+}
+
+// Sets the duplication probability for the given destination.
+func (i *Injector) SetDuplicate(dest string, p float64) {
+	i.updateRule(dest, func(r *Rule) {
+		r.Duplicate = p
+	})
+}
+
+// Sets the corruption probability for the given destination.
+func (i *Injector) SetCorrupt(dest string, p float64) {
+	i.updateRule(dest, func(r *Rule) {
+		r.Corrupt = p
+	})
+}
+
+// Partitions the given destinations, messages sent towards them will fail.
+// The partition is one-way, messages from the destinations are not affected
+// unless their own injector partitions this node.
+func (i *Injector) Partition(dests ...string) {
+	for _, d := range dests {
+		i.updateRule(d, func(r *Rule) {
+			r.Partitioned = true
+		})
+	}
+}
+
+// Removes the partition towards the given destinations.
+func (i *Injector) Heal(dests ...string) {
+	for _, d := range dests {
+		i.updateRule(d, func(r *Rule) {
+			r.Partitioned = false
+		})
+	}
+}
+
+func (i *Injector) updateRule(dest string, f func(*Rule)) {
+	i.ruleMutex.Lock()
+	defer i.ruleMutex.Unlock()
+
+	r, ok := i.rules[dest]
+	if !ok {
+		cp := *i.defaultRule
+		r = &cp
+		i.rules[dest] = r
+	}
+
+	f(r)
+}
+
+// Applies the rule for the given destination before a message is sent.
+// Returns the number of times the message should be delivered
+// and whether it should be corrupted.
+func (i *Injector) apply(dest string) (int, bool, error) {
+	r := i.Rule(dest)
+
+	if r.Partitioned {
+		return 0, false, ErrPartitioned
+	}
+
+	if i.chance(r.Drop) {
+		return 0, false, ErrDropped
+	}
+
+	if d := r.Latency + i.jitter(r.Jitter); d > 0 {
+		time.Sleep(d)
+	}
+
+	copies := 1
+	if i.chance(r.Duplicate) {
+		copies = 2
+	}
+
+	return copies, i.chance(r.Corrupt), nil
+}
+
+func (i *Injector) chance(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+
+	i.rngMutex.Lock()
+	defer i.rngMutex.Unlock()
+
+	return i.rng.Float64() < p
+}
+
+func (i *Injector) jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+
+	i.rngMutex.Lock()
+	defer i.rngMutex.Unlock()
+
+	return time.Duration(i.rng.Int63n(int64(max)))
+}
+
+// Flips a random bit in a copy of the given data.
+func (i *Injector) corrupt(data []byte) []byte {
+	if len(data) == 0 {
+		return data
+	}
+
+	ret := make([]byte, len(data))
+	copy(ret, data)
+
+	i.rngMutex.Lock()
+	defer i.rngMutex.Unlock()
+
+	idx := i.rng.Intn(len(ret))
+	ret[idx] ^= byte(1 << uint(i.rng.Intn(8)))
+
+	return ret
+}
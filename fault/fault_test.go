@@ -0,0 +1,296 @@
+package fault
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	pb "github.com/joonnna/ifrit/protobuf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+type FaultTestSuite struct {
+	suite.Suite
+
+	inj  *Injector
+	stub *commStub
+	c    *Comm
+	p    *Ping
+}
+
+func TestFaultTestSuite(t *testing.T) {
+	r := log.Root()
+
+	r.SetHandler(log.DiscardHandler())
+	suite.Run(t, new(FaultTestSuite))
+}
+
+func (suite *FaultTestSuite) SetupTest() {
+	suite.inj = NewInjector(1)
+	suite.stub = &commStub{}
+	suite.c = NewComm(suite.stub, suite.inj)
+	suite.p = NewPing(&pingStub{}, suite.inj)
+}
+
+func (suite *FaultTestSuite) TestNoRules() {
+	msg := &pb.Msg{Content: []byte("content")}
+
+	_, err := suite.c.Send("addr", "", msg)
+	require.NoError(suite.T(), err, "Send failed without any rules.")
+	assert.Equal(suite.T(), 1, suite.stub.numSent(), "Message not delivered exactly once.")
+	assert.Equal(suite.T(), msg.GetContent(), suite.stub.lastContent(), "Message altered without rules.")
+}
+
+func (suite *FaultTestSuite) TestDrop() {
+	suite.inj.SetDrop("addr", 1.0)
+
+	_, err := suite.c.Send("addr", "", &pb.Msg{})
+	assert.Equal(suite.T(), ErrDropped, err, "Message not dropped.")
+
+	_, err = suite.c.Gossip("addr", "", &pb.State{})
+	assert.Equal(suite.T(), ErrDropped, err, "Gossip not dropped.")
+
+	_, err = suite.p.Ping("addr", &pb.Ping{})
+	assert.Equal(suite.T(), ErrDropped, err, "Ping not dropped.")
+
+	_, err = suite.c.Send("other", "", &pb.Msg{})
+	assert.NoError(suite.T(), err, "Rule applied to wrong destination.")
+
+	assert.Equal(suite.T(), 1, suite.stub.numSent(), "Dropped messages were delivered.")
+}
+
+func (suite *FaultTestSuite) TestDefaultRule() {
+	suite.inj.SetDefaultRule(Rule{Drop: 1.0})
+
+	_, err := suite.c.Send("addr", "", &pb.Msg{})
+	assert.Equal(suite.T(), ErrDropped, err, "Default rule not applied.")
+
+	suite.inj.SetDrop("addr", 0)
+
+	_, err = suite.c.Send("addr", "", &pb.Msg{})
+	assert.NoError(suite.T(), err, "Specific rule did not override default rule.")
+
+	suite.inj.Reset()
+
+	_, err = suite.c.Send("other", "", &pb.Msg{})
+	assert.NoError(suite.T(), err, "Reset did not remove default rule.")
+}
+
+func (suite *FaultTestSuite) TestPartition() {
+	suite.inj.Partition("addr", "pingAddr")
+
+	_, err := suite.c.Gossip("addr", "", &pb.State{})
+	assert.Equal(suite.T(), ErrPartitioned, err, "Partition not applied to gossip.")
+
+	_, err = suite.p.Ping("pingAddr", &pb.Ping{})
+	assert.Equal(suite.T(), ErrPartitioned, err, "Partition not applied to pings.")
+
+	suite.inj.Heal("addr", "pingAddr")
+
+	_, err = suite.c.Gossip("addr", "", &pb.State{})
+	assert.NoError(suite.T(), err, "Partition not healed.")
+
+	_, err = suite.p.Ping("pingAddr", &pb.Ping{})
+	assert.NoError(suite.T(), err, "Partition not healed.")
+}
+
+func (suite *FaultTestSuite) TestDuplicate() {
+	suite.inj.SetDuplicate("addr", 1.0)
+
+	_, err := suite.c.Send("addr", "", &pb.Msg{})
+	require.NoError(suite.T(), err, "Send failed.")
+
+	assert.Equal(suite.T(), 2, suite.stub.numSent(), "Message not duplicated.")
+}
+
+func (suite *FaultTestSuite) TestCorrupt() {
+	content := []byte("content")
+	msg := &pb.Msg{Content: content}
+
+	suite.inj.SetCorrupt("addr", 1.0)
+
+	_, err := suite.c.Send("addr", "", msg)
+	require.NoError(suite.T(), err, "Send failed.")
+
+	assert.False(suite.T(), bytes.Equal(content, suite.stub.lastContent()), "Message not corrupted.")
+	assert.Equal(suite.T(), []byte("content"), msg.GetContent(), "Original message was modified.")
+}
+
+func (suite *FaultTestSuite) TestCorruptRelay() {
+	content := []byte("content")
+	msg := &pb.Msg{Relay: &pb.RelayMsg{Content: content, Hops: 1}}
+
+	suite.inj.SetCorrupt("addr", 1.0)
+
+	_, err := suite.c.Send("addr", "", msg)
+	require.NoError(suite.T(), err, "Send failed.")
+
+	sent := suite.stub.lastMsg()
+	require.NotNil(suite.T(), sent.GetRelay(), "Relay dropped from corrupted message.")
+	assert.Equal(suite.T(), uint32(1), sent.GetRelay().GetHops(), "Relay fields not kept.")
+	assert.False(suite.T(), bytes.Equal(content, sent.GetRelay().GetContent()), "Relayed content not corrupted.")
+	assert.Equal(suite.T(), []byte("content"), msg.GetRelay().GetContent(), "Original message was modified.")
+}
+
+func (suite *FaultTestSuite) TestStreamChunks() {
+	data := []byte("content")
+
+	s, err := suite.c.DialStream(context.Background(), "addr", "")
+	require.NoError(suite.T(), err, "Failed to open stream.")
+
+	suite.inj.SetCorrupt("addr", 1.0)
+
+	require.NoError(suite.T(), s.Send(&pb.Msg{Blob: &pb.BlobChunk{Data: data}}), "Send failed.")
+	assert.False(suite.T(), bytes.Equal(data, suite.stub.lastContent()), "Chunk not corrupted.")
+
+	suite.inj.SetRule("addr", Rule{Drop: 1.0})
+
+	require.NoError(suite.T(), s.Send(&pb.Msg{Blob: &pb.BlobChunk{Data: data}}),
+		"Dropped chunk reported as failed.")
+	assert.Equal(suite.T(), 1, suite.stub.numSent(), "Dropped chunk was delivered.")
+
+	_, err = suite.c.DialStream(context.Background(), "addr", "")
+	assert.Equal(suite.T(), ErrDropped, err, "Stream not dropped when opened.")
+}
+
+func (suite *FaultTestSuite) TestLatency() {
+	latency := time.Millisecond * 50
+
+	suite.inj.SetLatency("addr", latency, latency)
+
+	start := time.Now()
+
+	_, err := suite.c.Send("addr", "", &pb.Msg{})
+	require.NoError(suite.T(), err, "Send failed.")
+
+	elapsed := time.Since(start)
+	assert.True(suite.T(), elapsed >= latency, "Latency not added.")
+	assert.True(suite.T(), elapsed < latency*4, "Too much latency added.")
+}
+
+type commStub struct {
+	sent      [][]byte
+	msgs      []*pb.Msg
+	sentMutex sync.Mutex
+}
+
+func (cs *commStub) Register(p pb.GossipServer) {
+}
+
+func (cs *commStub) CloseConn(addr string) {
+}
+
+func (cs *commStub) Addr() string {
+	return "addr"
+}
+
+func (cs *commStub) Start() {
+}
+
+func (cs *commStub) Stop() {
+}
+
+func (cs *commStub) Gossip(addr, id string, m *pb.State) (*pb.StateResponse, error) {
+	cs.record(m.GetExternalGossip())
+	return &pb.StateResponse{}, nil
+}
+
+func (cs *commStub) Rebuttal(addr, id string, m *pb.State) (*pb.StateResponse, error) {
+	return cs.Gossip(addr, id, m)
+}
+
+func (cs *commStub) Send(addr, id string, m *pb.Msg) (*pb.MsgResponse, error) {
+	cs.sentMutex.Lock()
+	cs.msgs = append(cs.msgs, m)
+	cs.sentMutex.Unlock()
+
+	cs.record(m.GetContent())
+	return &pb.MsgResponse{}, nil
+}
+
+func (cs *commStub) StreamMessenger(addr, id string, input, reply chan []byte) error {
+	defer close(reply)
+
+	for content := range input {
+		cs.record(content)
+	}
+
+	return nil
+}
+
+func (cs *commStub) DialStream(ctx context.Context, addr, id string) (pb.Gossip_StreamClient, error) {
+	return &streamStub{cs: cs}, nil
+}
+
+func (cs *commStub) record(content []byte) {
+	cs.sentMutex.Lock()
+	defer cs.sentMutex.Unlock()
+
+	cs.sent = append(cs.sent, content)
+}
+
+func (cs *commStub) numSent() int {
+	cs.sentMutex.Lock()
+	defer cs.sentMutex.Unlock()
+
+	return len(cs.sent)
+}
+
+func (cs *commStub) lastContent() []byte {
+	cs.sentMutex.Lock()
+	defer cs.sentMutex.Unlock()
+
+	if len(cs.sent) == 0 {
+		return nil
+	}
+
+	return cs.sent[len(cs.sent)-1]
+}
+
+func (cs *commStub) lastMsg() *pb.Msg {
+	cs.sentMutex.Lock()
+	defer cs.sentMutex.Unlock()
+
+	if len(cs.msgs) == 0 {
+		return nil
+	}
+
+	return cs.msgs[len(cs.msgs)-1]
+}
+
+type pingStub struct {
+}
+
+func (ps *pingStub) Pause(t time.Duration) {
+}
+
+func (ps *pingStub) Start() {
+}
+
+func (ps *pingStub) Stop() {
+}
+
+func (ps *pingStub) Ping(addr string, m *pb.Ping) (*pb.Pong, error) {
+	return &pb.Pong{}, nil
+}
+
+// Records the blob data sent on the stream.
+type streamStub struct {
+	grpc.ClientStream
+	cs *commStub
+}
+
+func (ss *streamStub) Send(m *pb.Msg) error {
+	ss.cs.record(m.GetBlob().GetData())
+	return nil
+}
+
+func (ss *streamStub) Recv() (*pb.MsgResponse, error) {
+	return &pb.MsgResponse{}, nil
+}
@@ -0,0 +1,47 @@
+package fault
+
+import (
+	log "github.com/inconshreveable/log15"
+	pb "github.com/joonnna/ifrit/protobuf"
+	"github.com/joonnna/ifrit/transport"
+)
+
+// Named to keep the embedded field distinct from the Ping method.
+type pingService interface {
+	transport.Ping
+}
+
+// Ping wraps a ping service and injects faults on all outgoing pings.
+type Ping struct {
+	pingService
+	inj *Injector
+}
+
+// Wraps the given ping service, faults are controlled through the injector.
+func NewPing(ps transport.Ping, inj *Injector) *Ping {
+	return &Ping{
+		pingService: ps,
+		inj:         inj,
+	}
+}
+
+func (p *Ping) Ping(addr string, msg *pb.Ping) (*pb.Pong, error) {
+	copies, corrupt, err := p.inj.apply(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if corrupt {
+		msg = &pb.Ping{
+			Nonce: p.inj.corrupt(msg.GetNonce()),
+		}
+	}
+
+	for i := 1; i < copies; i++ {
+		if _, err := p.pingService.Ping(addr, msg); err != nil {
+			log.Debug(err.Error(), "addr", addr)
+		}
+	}
+
+	return p.pingService.Ping(addr, msg)
+}
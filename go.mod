@@ -4,14 +4,17 @@ go 1.14
 
 require (
 	github.com/golang/protobuf v1.4.2
+	github.com/golang/snappy v0.0.4
 	github.com/gorilla/mux v1.7.4
 	github.com/inconshreveable/log15 v0.0.0-20200109203555-b30bc20e4fd1
 	github.com/jinzhu/configor v1.2.0
 	github.com/joonnna/workerpool v0.0.0-20180531065140-2c82629f6727
+	github.com/klauspost/compress v1.11.13
 	github.com/rs/cors v1.7.0
 	github.com/sirupsen/logrus v1.2.0 // indirect
 	github.com/spf13/viper v1.7.0
 	github.com/stretchr/testify v1.6.0
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 	golang.org/x/net v0.0.0-20200528225125-3c3fba18258b
 	google.golang.org/grpc v1.29.1
 )
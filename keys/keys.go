@@ -0,0 +1,133 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"math/big"
+
+	pb "github.com/joonnna/ifrit/protobuf"
+)
+
+const (
+	// Names of the supported key algorithms, as given in the config.
+	ECDSA   = "ecdsa"
+	Ed25519 = "ed25519"
+)
+
+var (
+	errUnknownAlgorithm = errors.New("Unknown key algorithm, has to be either ecdsa or ed25519")
+	errUnknownKey       = errors.New("Key is neither an ecdsa nor an ed25519 key")
+)
+
+// Generates a private key for the given algorithm, ecdsa keys use the P-521 curve.
+func Generate(alg string) (crypto.Signer, error) {
+	switch alg {
+	case "", ECDSA:
+		return ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case Ed25519:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	default:
+		return nil, errUnknownAlgorithm
+	}
+}
+
+// Returns the signature algorithm of the given public or private key.
+func Algorithm(key interface{}) (pb.SignatureAlgorithm, error) {
+	switch key.(type) {
+	case *ecdsa.PublicKey, *ecdsa.PrivateKey:
+		return pb.SignatureAlgorithm_ECDSA, nil
+	case ed25519.PublicKey, ed25519.PrivateKey:
+		return pb.SignatureAlgorithm_ED25519, nil
+	default:
+		return 0, errUnknownKey
+	}
+}
+
+// Returns the x509 algorithm used to sign certificates and certificate requests with the given key.
+func X509Algorithm(priv crypto.Signer) x509.SignatureAlgorithm {
+	if _, ok := priv.(ed25519.PrivateKey); ok {
+		return x509.PureEd25519
+	}
+
+	return x509.ECDSAWithSHA256
+}
+
+// Returns true if the key is of a supported algorithm.
+func Supported(pub crypto.PublicKey) bool {
+	_, err := Algorithm(pub)
+	return err == nil
+}
+
+// Signs the data with the given key.
+// Ecdsa signs the sha256 hash of the data, ed25519 signs the data itself
+// and its signature is split into its r and s halves.
+func Sign(priv crypto.Signer, data []byte) ([]byte, []byte, error) {
+	switch key := priv.(type) {
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, hashContent(data))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return r.Bytes(), s.Bytes(), nil
+
+	case ed25519.PrivateKey:
+		sig := ed25519.Sign(key, data)
+
+		return sig[:32], sig[32:], nil
+
+	default:
+		return nil, nil, errUnknownKey
+	}
+}
+
+// Returns true if r and s is a valid signature of the data by the given public key.
+func Verify(pub crypto.PublicKey, data, r, s []byte) bool {
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		var rInt, sInt big.Int
+
+		rInt.SetBytes(r)
+		sInt.SetBytes(s)
+
+		return ecdsa.Verify(key, hashContent(data), &rInt, &sInt)
+
+	case ed25519.PublicKey:
+		if len(r) != 32 || len(s) != 32 {
+			return false
+		}
+
+		return ed25519.Verify(key, data, append(append([]byte{}, r...), s...))
+
+	default:
+		return false
+	}
+}
+
+// Signs the data with the given key, returning a signature message naming the algorithm.
+func NewSignature(priv crypto.Signer, data []byte) (*pb.Signature, error) {
+	alg, err := Algorithm(priv)
+	if err != nil {
+		return nil, err
+	}
+
+	r, s, err := Sign(priv, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.Signature{R: r, S: s, Algorithm: alg}, nil
+}
+
+func hashContent(data []byte) []byte {
+	h := sha256.New()
+	h.Write(data)
+	return h.Sum(nil)
+}
@@ -0,0 +1,69 @@
+package keys
+
+import (
+	"crypto/x509"
+	"testing"
+
+	pb "github.com/joonnna/ifrit/protobuf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type KeysTestSuite struct {
+	suite.Suite
+}
+
+func TestKeysTestSuite(t *testing.T) {
+	suite.Run(t, new(KeysTestSuite))
+}
+
+func (suite *KeysTestSuite) TestSignAndVerify() {
+	tests := []struct {
+		alg     string
+		pbAlg   pb.SignatureAlgorithm
+		x509Alg x509.SignatureAlgorithm
+	}{
+		{
+			alg:     ECDSA,
+			pbAlg:   pb.SignatureAlgorithm_ECDSA,
+			x509Alg: x509.ECDSAWithSHA256,
+		},
+
+		{
+			alg:     Ed25519,
+			pbAlg:   pb.SignatureAlgorithm_ED25519,
+			x509Alg: x509.PureEd25519,
+		},
+	}
+
+	other, err := Generate(ECDSA)
+	require.NoError(suite.T(), err, "Failed to generate key.")
+
+	for i, t := range tests {
+		priv, err := Generate(t.alg)
+		require.NoErrorf(suite.T(), err, "Failed to generate key for test %d", i)
+
+		alg, err := Algorithm(priv.Public())
+		require.NoErrorf(suite.T(), err, "Supported key rejected for test %d", i)
+		assert.Equalf(suite.T(), t.pbAlg, alg, "Wrong algorithm for test %d", i)
+		assert.Equalf(suite.T(), t.x509Alg, X509Algorithm(priv), "Wrong x509 algorithm for test %d", i)
+
+		r, s, err := Sign(priv, []byte("data"))
+		require.NoErrorf(suite.T(), err, "Failed to sign for test %d", i)
+
+		assert.Truef(suite.T(), Verify(priv.Public(), []byte("data"), r, s), "Valid signature rejected for test %d", i)
+		assert.Falsef(suite.T(), Verify(priv.Public(), []byte("other"), r, s), "Signature of other data accepted for test %d", i)
+		assert.Falsef(suite.T(), Verify(other.Public(), []byte("data"), r, s), "Signature of other key accepted for test %d", i)
+
+		sign, err := NewSignature(priv, []byte("data"))
+		require.NoErrorf(suite.T(), err, "Failed to sign for test %d", i)
+		assert.Equalf(suite.T(), t.pbAlg, sign.GetAlgorithm(), "Signature names the wrong algorithm for test %d", i)
+	}
+
+	_, err = Generate("rsa")
+	assert.Equal(suite.T(), errUnknownAlgorithm, err, "Unknown algorithm accepted.")
+
+	assert.False(suite.T(), Supported("key"), "Unknown key accepted.")
+	assert.False(suite.T(), Verify(nil, []byte("data"), nil, nil), "Signature without key accepted.")
+}
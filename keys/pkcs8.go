@@ -0,0 +1,407 @@
+package keys
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// Pem block type of encrypted PKCS #8 keys.
+	EncryptedBlockType = "ENCRYPTED PRIVATE KEY"
+
+	// Scrypt parameters of newly encrypted keys, the defaults of openssl.
+	scryptCost        = 1 << 14
+	scryptBlockSize   = 8
+	scryptParallelism = 1
+	saltSize          = 16
+)
+
+var (
+	errNoPassphrase   = errors.New("Private key is encrypted but no passphrase is given")
+	errDecrypt        = errors.New("Failed to decrypt private key, wrong passphrase")
+	errEncryptionAlg  = errors.New("Private key is encrypted with an unsupported algorithm")
+	errKeyDerivation  = errors.New("Private key is encrypted with an unsupported key derivation function")
+	errBlockType      = errors.New("Unknown pem block type of private key")
+	errNotSigner      = errors.New("Private key can not be used for signing")
+	errEmptyKeyfile   = errors.New("Passphrase file is empty")
+	errUnsupportedKey = errors.New("Private key is neither an ecdsa, ed25519 nor rsa key")
+
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidScrypt         = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+
+	// Key sizes of the supported AES-CBC ciphers.
+	aesKeySizes = map[string]int{
+		oidAES128CBC.String(): 16,
+		oidAES192CBC.String(): 24,
+		oidAES256CBC.String(): 32,
+	}
+)
+
+// Structures of RFC 5958, RFC 8018 and RFC 7914.
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+type scryptParams struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+	KeyLength                int `asn1:"optional"`
+}
+
+// Returns the pem block of the given private key.
+// Without a passphrase ecdsa keys are stored in their SEC 1 form, rsa keys in their PKCS #1 form
+// and ed25519 keys as PKCS #8, as older versions expect.
+// With a passphrase the key is stored as encrypted PKCS #8,
+// with a key derived through scrypt and encrypted with AES-256-CBC.
+func MarshalPrivateKey(priv crypto.PrivateKey, passphrase []byte) (*pem.Block, error) {
+	if len(passphrase) > 0 {
+		b, err := x509.MarshalPKCS8PrivateKey(priv)
+		if err != nil {
+			return nil, err
+		}
+
+		b, err = encryptPKCS8(b, passphrase)
+		if err != nil {
+			return nil, err
+		}
+
+		return &pem.Block{Type: EncryptedBlockType, Bytes: b}, nil
+	}
+
+	switch key := priv.(type) {
+	case *ecdsa.PrivateKey:
+		b, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		return &pem.Block{Type: "EC PRIVATE KEY", Bytes: b}, nil
+
+	case *rsa.PrivateKey:
+		return &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}, nil
+
+	case ed25519.PrivateKey:
+		b, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		return &pem.Block{Type: "PRIVATE KEY", Bytes: b}, nil
+
+	default:
+		return nil, errUnsupportedKey
+	}
+}
+
+// Parses the private key of the given pem block, in either its SEC 1, PKCS #1,
+// PKCS #8 or encrypted PKCS #8 form. The passphrase is only used for encrypted keys.
+func ParsePrivateKey(block *pem.Block, passphrase []byte) (crypto.Signer, error) {
+	var key interface{}
+	var err error
+
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+
+	case EncryptedBlockType:
+		if len(passphrase) == 0 {
+			return nil, errNoPassphrase
+		}
+
+		b, err := decryptPKCS8(block.Bytes, passphrase)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err = x509.ParsePKCS8PrivateKey(b)
+		if err != nil {
+			return nil, errDecrypt
+		}
+
+	default:
+		return nil, errBlockType
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	priv, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errNotSigner
+	}
+
+	return priv, nil
+}
+
+// Writes the private key to the given file, readable only by the owner.
+// The key is written to a temporary file first, an existing key is hence never left half overwritten.
+func WritePrivateKey(path string, priv crypto.PrivateKey, passphrase []byte) error {
+	block, err := MarshalPrivateKey(priv, passphrase)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), ".key-*.pem")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(f.Name())
+
+	if err = pem.Encode(f, block); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// Reads the private key stored in the given file,
+// also returning whether it was stored encrypted.
+func ReadPrivateKey(path string, passphrase []byte) (crypto.Signer, bool, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, false, errBlockType
+	}
+
+	priv, err := ParsePrivateKey(block, passphrase)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return priv, block.Type == EncryptedBlockType, nil
+}
+
+// Returns the passphrase protecting private keys, the content of the keyfile if given,
+// otherwise the passphrase itself. Trailing newlines of the keyfile are ignored.
+func ReadPassphrase(passphrase, keyfile string) ([]byte, error) {
+	if keyfile == "" {
+		return []byte(passphrase), nil
+	}
+
+	b, err := ioutil.ReadFile(keyfile)
+	if err != nil {
+		return nil, err
+	}
+
+	p := strings.TrimRight(string(b), "\r\n")
+	if p == "" {
+		return nil, errEmptyKeyfile
+	}
+
+	return []byte(p), nil
+}
+
+func encryptPKCS8(der, passphrase []byte) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	key, err := scrypt.Key(passphrase, salt, scryptCost, scryptBlockSize, scryptParallelism, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	pad := aes.BlockSize - len(der)%aes.BlockSize
+	data := append(append([]byte{}, der...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+
+	cipher.NewCBCEncrypter(c, iv).CryptBlocks(data, data)
+
+	kdf, err := asn1.Marshal(scryptParams{
+		Salt:                     salt,
+		CostParameter:            scryptCost,
+		BlockSize:                scryptBlockSize,
+		ParallelizationParameter: scryptParallelism,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{
+			Algorithm:  oidScrypt,
+			Parameters: asn1.RawValue{FullBytes: kdf},
+		},
+		EncryptionScheme: pkix.AlgorithmIdentifier{
+			Algorithm:  oidAES256CBC,
+			Parameters: asn1.RawValue{FullBytes: ivParam},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPBES2,
+			Parameters: asn1.RawValue{FullBytes: params},
+		},
+		EncryptedData: data,
+	})
+}
+
+// Decrypts PBES2 encrypted keys, derived through either scrypt or PBKDF2
+// and encrypted with AES-CBC, which covers the keys written by us and by openssl.
+func decryptPKCS8(der, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	var params pbes2Params
+	var iv []byte
+
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
+	}
+
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, errEncryptionAlg
+	}
+
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+
+	keyLen, ok := aesKeySizes[params.EncryptionScheme.Algorithm.String()]
+	if !ok {
+		return nil, errEncryptionAlg
+	}
+
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+
+	if len(iv) != aes.BlockSize {
+		return nil, errEncryptionAlg
+	}
+
+	key, err := deriveKey(params.KeyDerivationFunc, passphrase, keyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	data := info.EncryptedData
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errDecrypt
+	}
+
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(c, iv).CryptBlocks(out, data)
+
+	pad := int(out[len(out)-1])
+	if pad == 0 || pad > aes.BlockSize || !bytes.Equal(out[len(out)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, errDecrypt
+	}
+
+	return out[:len(out)-pad], nil
+}
+
+func deriveKey(kdf pkix.AlgorithmIdentifier, passphrase []byte, keyLen int) ([]byte, error) {
+	switch {
+	case kdf.Algorithm.Equal(oidScrypt):
+		var p scryptParams
+		if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &p); err != nil {
+			return nil, err
+		}
+
+		return scrypt.Key(passphrase, p.Salt, p.CostParameter, p.BlockSize, p.ParallelizationParameter, keyLen)
+
+	case kdf.Algorithm.Equal(oidPBKDF2):
+		var p pbkdf2Params
+		var h func() hash.Hash
+
+		if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &p); err != nil {
+			return nil, err
+		}
+
+		switch {
+		case p.PRF.Algorithm == nil, p.PRF.Algorithm.Equal(oidHMACWithSHA1):
+			h = sha1.New
+		case p.PRF.Algorithm.Equal(oidHMACWithSHA256):
+			h = sha256.New
+		default:
+			return nil, errKeyDerivation
+		}
+
+		return pbkdf2.Key(passphrase, p.Salt, p.IterationCount, keyLen, h), nil
+
+	default:
+		return nil, errKeyDerivation
+	}
+}
@@ -0,0 +1,151 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type Pkcs8TestSuite struct {
+	suite.Suite
+
+	path string
+}
+
+func TestPkcs8TestSuite(t *testing.T) {
+	suite.Run(t, new(Pkcs8TestSuite))
+}
+
+func (suite *Pkcs8TestSuite) SetupTest() {
+	path, err := ioutil.TempDir("", "keys")
+	require.NoError(suite.T(), err, "Failed to create directory.")
+
+	suite.path = path
+}
+
+func (suite *Pkcs8TestSuite) TearDownTest() {
+	os.RemoveAll(suite.path)
+}
+
+func (suite *Pkcs8TestSuite) TestMarshalPrivateKey() {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(suite.T(), err, "Failed to generate rsa key.")
+
+	ecKey, err := Generate(ECDSA)
+	require.NoError(suite.T(), err, "Failed to generate key.")
+
+	edKey, err := Generate(Ed25519)
+	require.NoError(suite.T(), err, "Failed to generate key.")
+
+	tests := []struct {
+		priv      crypto.Signer
+		blockType string
+	}{
+		{priv: ecKey, blockType: "EC PRIVATE KEY"},
+		{priv: edKey, blockType: "PRIVATE KEY"},
+		{priv: rsaKey, blockType: "RSA PRIVATE KEY"},
+	}
+
+	for i, t := range tests {
+		block, err := MarshalPrivateKey(t.priv, nil)
+		require.NoErrorf(suite.T(), err, "Failed to marshal key for test %d", i)
+		assert.Equalf(suite.T(), t.blockType, block.Type, "Wrong clear text form for test %d", i)
+
+		priv, err := ParsePrivateKey(block, []byte("ignored"))
+		require.NoErrorf(suite.T(), err, "Failed to parse clear text key for test %d", i)
+		assert.Equalf(suite.T(), t.priv, priv, "Parsed key differs for test %d", i)
+
+		block, err = MarshalPrivateKey(t.priv, []byte("secret"))
+		require.NoErrorf(suite.T(), err, "Failed to encrypt key for test %d", i)
+		assert.Equalf(suite.T(), EncryptedBlockType, block.Type, "Key not encrypted for test %d", i)
+
+		priv, err = ParsePrivateKey(block, []byte("secret"))
+		require.NoErrorf(suite.T(), err, "Failed to decrypt key for test %d", i)
+		assert.Equalf(suite.T(), t.priv, priv, "Decrypted key differs for test %d", i)
+
+		_, err = ParsePrivateKey(block, []byte("wrong"))
+		assert.Errorf(suite.T(), err, "Key decrypted with the wrong passphrase for test %d", i)
+
+		_, err = ParsePrivateKey(block, nil)
+		assert.Equalf(suite.T(), errNoPassphrase, err, "Encrypted key parsed without a passphrase for test %d", i)
+	}
+}
+
+func (suite *Pkcs8TestSuite) TestPrivateKey() {
+	for _, alg := range []string{ECDSA, Ed25519} {
+		priv, err := Generate(alg)
+		require.NoError(suite.T(), err, "Failed to generate key.")
+
+		path := filepath.Join(suite.path, alg+".pem")
+
+		require.NoErrorf(suite.T(), WritePrivateKey(path, priv, nil), "Failed to write %s key.", alg)
+
+		info, err := os.Stat(path)
+		require.NoError(suite.T(), err, "Key not written.")
+		assert.Equal(suite.T(), os.FileMode(0600), info.Mode().Perm(), "Key readable by others.")
+
+		loaded, encrypted, err := ReadPrivateKey(path, nil)
+		require.NoErrorf(suite.T(), err, "Failed to read %s key.", alg)
+		assert.False(suite.T(), encrypted, "Clear text key reported as encrypted.")
+		assert.Equalf(suite.T(), priv, loaded, "Read %s key differs.", alg)
+	}
+}
+
+func (suite *Pkcs8TestSuite) TestEncryptedPrivateKey() {
+	priv, err := Generate(ECDSA)
+	require.NoError(suite.T(), err, "Failed to generate key.")
+
+	path := filepath.Join(suite.path, "key.pem")
+
+	require.NoError(suite.T(), WritePrivateKey(path, priv, nil), "Failed to write key.")
+
+	// Clear text keys are read regardless of the passphrase, letting callers encrypt them in place.
+	loaded, encrypted, err := ReadPrivateKey(path, []byte("secret"))
+	require.NoError(suite.T(), err, "Failed to read clear text key with a passphrase.")
+	assert.False(suite.T(), encrypted, "Clear text key reported as encrypted.")
+	assert.Equal(suite.T(), priv, loaded, "Read key differs.")
+
+	require.NoError(suite.T(), WritePrivateKey(path, priv, []byte("secret")), "Failed to write encrypted key.")
+
+	b, err := ioutil.ReadFile(path)
+	require.NoError(suite.T(), err, "Failed to read key.")
+	assert.Contains(suite.T(), string(b), EncryptedBlockType, "Key not encrypted.")
+
+	loaded, encrypted, err = ReadPrivateKey(path, []byte("secret"))
+	require.NoError(suite.T(), err, "Failed to read encrypted key.")
+	assert.True(suite.T(), encrypted, "Encrypted key reported as clear text.")
+	assert.Equal(suite.T(), priv, loaded, "Read key differs.")
+
+	_, _, err = ReadPrivateKey(path, []byte("wrong"))
+	assert.Error(suite.T(), err, "Read key with the wrong passphrase.")
+
+	_, _, err = ReadPrivateKey(path, nil)
+	assert.Equal(suite.T(), errNoPassphrase, err, "Read encrypted key without a passphrase.")
+}
+
+func (suite *Pkcs8TestSuite) TestReadPassphrase() {
+	keyfile := filepath.Join(suite.path, "passphrase")
+	require.NoError(suite.T(), ioutil.WriteFile(keyfile, []byte("from file\n"), 0600))
+
+	p, err := ReadPassphrase("inline", keyfile)
+	require.NoError(suite.T(), err, "Failed to read keyfile.")
+	assert.Equal(suite.T(), []byte("from file"), p, "Keyfile content not used as passphrase.")
+
+	p, err = ReadPassphrase("inline", "")
+	require.NoError(suite.T(), err, "Failed to use inline passphrase.")
+	assert.Equal(suite.T(), []byte("inline"), p, "Inline passphrase not used.")
+
+	empty := filepath.Join(suite.path, "empty")
+	require.NoError(suite.T(), ioutil.WriteFile(empty, []byte("\n"), 0600))
+
+	_, err = ReadPassphrase("inline", empty)
+	assert.Equal(suite.T(), errEmptyKeyfile, err, "Empty keyfile accepted.")
+}
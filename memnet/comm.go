@@ -0,0 +1,247 @@
+package memnet
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	pb "github.com/joonnna/ifrit/protobuf"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/credentials"
+	grpcPeer "google.golang.org/grpc/peer"
+)
+
+// Comm delivers gossip, messages and streams directly to the
+// gossip server registered by the destination transport.
+// All messages are copied, sender and receiver never share memory.
+type Comm struct {
+	net  *Network
+	addr string
+
+	cert    *x509.Certificate
+	srv     pb.GossipServer
+	running bool
+	mutex   sync.RWMutex
+}
+
+type memAddr string
+
+func (a memAddr) Network() string {
+	return "memnet"
+}
+
+func (a memAddr) String() string {
+	return string(a)
+}
+
+func (c *Comm) Register(srv pb.GossipServer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.srv = srv
+}
+
+// Replaces the certificate presented to other transports, e.g. after renewing it.
+func (c *Comm) SetCertificate(cert *x509.Certificate, priv crypto.Signer) error {
+	if cert == nil {
+		return errNilCert
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.cert = cert
+
+	return nil
+}
+
+func (c *Comm) certificate() *x509.Certificate {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.cert
+}
+
+// No connections are kept between in-memory transports.
+func (c *Comm) CloseConn(addr string) {
+}
+
+func (c *Comm) Addr() string {
+	return c.addr
+}
+
+// Makes the transport reachable for other transports in the network.
+func (c *Comm) Start() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.running = true
+}
+
+// Makes the transport unreachable, equivalent to a crashed node.
+func (c *Comm) Stop() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.running = false
+}
+
+func (c *Comm) Gossip(addr, id string, args *pb.State) (*pb.StateResponse, error) {
+	srv, err := c.remote(addr, id)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := srv.Spread(c.peerContext(context.Background()), proto.Clone(args).(*pb.State))
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Clone(r).(*pb.StateResponse), nil
+}
+
+// Rebuttals are gossip messages, in-memory calls have no deadlines.
+func (c *Comm) Rebuttal(addr, id string, args *pb.State) (*pb.StateResponse, error) {
+	return c.Gossip(addr, id, args)
+}
+
+func (c *Comm) Send(addr, id string, args *pb.Msg) (*pb.MsgResponse, error) {
+	srv, err := c.remote(addr, id)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := srv.Messenger(c.peerContext(context.Background()), proto.Clone(args).(*pb.Msg))
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Clone(r).(*pb.MsgResponse), nil
+}
+
+func (c *Comm) StreamMessenger(addr, id string, input, reply chan []byte) error {
+	srv, err := c.remote(addr, id)
+	if err != nil {
+		return err
+	}
+
+	defer close(reply)
+
+	ctx, cancel := context.WithCancel(c.peerContext(context.Background()))
+	defer cancel()
+
+	s := newServerStream(ctx)
+
+	// Sending messages from input stream to the server.
+	// Runs until the producer closes the channel.
+	go func() {
+		defer close(s.reqs)
+
+		for content := range input {
+			msg := &pb.Msg{
+				Content: copyBytes(content),
+			}
+
+			select {
+			case s.reqs <- msg:
+			case <-ctx.Done():
+				// Drain input so the producer never blocks.
+				for range input {
+				}
+				return
+			}
+		}
+	}()
+
+	go func() {
+		srv.Stream(s)
+		cancel()
+	}()
+
+	for {
+		select {
+		case resp := <-s.resps:
+			reply <- resp.GetContent()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Opens a raw stream to the destination's gossip server,
+// the stream is torn down when the context is cancelled.
+func (c *Comm) DialStream(ctx context.Context, addr, id string) (pb.Gossip_StreamClient, error) {
+	srv, err := c.remote(addr, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(c.peerContext(ctx))
+
+	cs := &clientStream{
+		s:      newServerStream(ctx),
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+
+	go func() {
+		cs.err = srv.Stream(cs.s)
+		close(cs.done)
+	}()
+
+	return cs, nil
+}
+
+// Returns the gossip server of the given destination if it is reachable,
+// and its certificate carries the given id, as verified during a tls handshake.
+func (c *Comm) remote(addr, id string) (pb.GossipServer, error) {
+	dest := c.net.comm(addr)
+	if dest == nil {
+		return nil, errUnreachable
+	}
+
+	dest.mutex.RLock()
+	defer dest.mutex.RUnlock()
+
+	if id != "" && string(dest.cert.SubjectKeyId) != id {
+		return nil, errWrongId
+	}
+
+	if !dest.running {
+		return nil, errUnreachable
+	}
+
+	if dest.srv == nil {
+		return nil, errNoServer
+	}
+
+	return dest.srv, nil
+}
+
+// Creates a context equivalent to the one gRPC provides after
+// a successful TLS handshake, the receiver reads our certificate from it.
+func (c *Comm) peerContext(parent context.Context) context.Context {
+	p := &grpcPeer.Peer{
+		Addr: memAddr(c.addr),
+		AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{c.certificate()},
+			},
+		},
+	}
+
+	return grpcPeer.NewContext(parent, p)
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+
+	ret := make([]byte, len(b))
+	copy(ret, b)
+
+	return ret
+}
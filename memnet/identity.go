@@ -0,0 +1,113 @@
+package memnet
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/x509"
+	"sync"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/joonnna/ifrit/keys"
+)
+
+// Identity holds the key material of a single in-memory node.
+// It implements both the certificate manager and the crypto service of the ifrit core.
+type Identity struct {
+	net *Network
+
+	// Replaced together when the certificate is renewed.
+	priv  crypto.Signer
+	cert  *x509.Certificate
+	mutex sync.RWMutex
+
+	caCert *x509.Certificate
+
+	numRings   uint32
+	knownCerts []*x509.Certificate
+	trusted    bool
+}
+
+func (i *Identity) Certificate() *x509.Certificate {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	return i.cert
+}
+
+func (i *Identity) CaCertificate() *x509.Certificate {
+	return i.caCert
+}
+
+func (i *Identity) Priv() crypto.Signer {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	return i.priv
+}
+
+func (i *Identity) ContactList() []*x509.Certificate {
+	ret := make([]*x509.Certificate, 0, len(i.knownCerts))
+
+	for _, c := range i.knownCerts {
+		ret = append(ret, c)
+	}
+
+	return ret
+}
+
+func (i *Identity) NumRings() uint32 {
+	return i.numRings
+}
+
+func (i *Identity) Trusted() bool {
+	return i.trusted
+}
+
+// In-memory identities are never persisted.
+func (i *Identity) SavePrivateKey(path string) error {
+	return errNotSupported
+}
+
+// In-memory identities are never persisted.
+func (i *Identity) SaveCertificate(path string) error {
+	return errNotSupported
+}
+
+func (i *Identity) Verify(data, r, s []byte, pub crypto.PublicKey) bool {
+	if pub == nil {
+		log.Error("Peer had no publicKey")
+		return false
+	}
+
+	return keys.Verify(pub, data, r, s)
+}
+
+func (i *Identity) Sign(data []byte) ([]byte, []byte, error) {
+	return keys.Sign(i.Priv(), data)
+}
+
+// Renews the certificate through the network CA with a newly generated key
+// of the same algorithm, keeping the id and addresses.
+func (i *Identity) Renew() (*x509.Certificate, error) {
+	alg := keys.ECDSA
+	if _, ok := i.Priv().(ed25519.PrivateKey); ok {
+		alg = keys.Ed25519
+	}
+
+	priv, err := keys.Generate(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := i.net.renew(i.Certificate(), priv)
+	if err != nil {
+		return nil, err
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.priv, i.cert = priv, cert
+
+	return cert, nil
+}
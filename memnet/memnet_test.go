@@ -0,0 +1,255 @@
+package memnet
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"io"
+	"testing"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	pb "github.com/joonnna/ifrit/protobuf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/credentials"
+	grpcPeer "google.golang.org/grpc/peer"
+)
+
+type MemnetTestSuite struct {
+	suite.Suite
+
+	net *Network
+
+	id1, id2         *Identity
+	comm1, comm2     *Comm
+	ping1, ping2     *Ping
+	server1, server2 *serverStub
+}
+
+func TestMemnetTestSuite(t *testing.T) {
+	r := log.Root()
+
+	r.SetHandler(log.DiscardHandler())
+	suite.Run(t, new(MemnetTestSuite))
+}
+
+func (suite *MemnetTestSuite) SetupTest() {
+	n, err := NewNetwork(3, 1, 1)
+	require.NoError(suite.T(), err, "Failed to create network.")
+
+	suite.net = n
+
+	suite.id1, suite.comm1, suite.ping1, suite.server1 = suite.newNode()
+	suite.id2, suite.comm2, suite.ping2, suite.server2 = suite.newNode()
+}
+
+func (suite *MemnetTestSuite) newNode() (*Identity, *Comm, *Ping, *serverStub) {
+	id, err := suite.net.NewIdentity()
+	require.NoError(suite.T(), err, "Failed to create identity.")
+
+	c, p, err := suite.net.NewTransport(id)
+	require.NoError(suite.T(), err, "Failed to create transport.")
+
+	s := &serverStub{}
+
+	c.Register(s)
+	c.Start()
+	p.Start()
+
+	return id, c, p, s
+}
+
+func (suite *MemnetTestSuite) TestIdentity() {
+	caCert := suite.net.CaCertificate()
+
+	require.NoError(suite.T(), suite.id1.Certificate().CheckSignatureFrom(caCert),
+		"Certificate not signed by network CA.")
+
+	assert.Len(suite.T(), suite.id1.Certificate().SubjectKeyId, 32, "Invalid id length.")
+	assert.Len(suite.T(), suite.id1.Certificate().Subject.Locality, 2, "Missing addresses.")
+	assert.NotEqual(suite.T(), suite.comm1.Addr(), suite.comm2.Addr(), "Addresses not unique.")
+
+	assert.True(suite.T(), suite.id1.Trusted(), "First identity should be a boot node.")
+	assert.False(suite.T(), suite.id2.Trusted(), "Only one boot node allowed.")
+	assert.Empty(suite.T(), suite.id1.ContactList(), "First identity should have no contacts.")
+	assert.Len(suite.T(), suite.id2.ContactList(), 1, "Boot node not in contact list.")
+
+	r, s, err := suite.id1.Sign([]byte("data"))
+	require.NoError(suite.T(), err, "Failed to sign.")
+	assert.True(suite.T(), suite.id2.Verify([]byte("data"), r, s, suite.id1.Priv().Public()),
+		"Valid signature not accepted.")
+}
+
+func (suite *MemnetTestSuite) TestGossip() {
+	args := &pb.State{ExternalGossip: []byte("gossip")}
+
+	reply, err := suite.comm1.Gossip(suite.comm2.Addr(), "", args)
+	require.NoError(suite.T(), err, "Gossip failed.")
+	assert.Equal(suite.T(), []byte("reply"), reply.GetExternalGossip(), "Wrong reply.")
+
+	require.NotNil(suite.T(), suite.server2.lastCert, "Sender certificate not in context.")
+	assert.Equal(suite.T(), suite.id1.Certificate().Raw, suite.server2.lastCert.Raw,
+		"Wrong sender certificate in context.")
+
+	_, err = suite.comm1.Gossip(suite.comm2.Addr(), string(suite.id2.Certificate().SubjectKeyId), args)
+	assert.NoError(suite.T(), err, "Gossip to expected id failed.")
+
+	_, err = suite.comm1.Gossip(suite.comm2.Addr(), string(suite.id1.Certificate().SubjectKeyId), args)
+	assert.Equal(suite.T(), errWrongId, err, "Transport with other id accepted.")
+
+	suite.comm2.Stop()
+
+	_, err = suite.comm1.Gossip(suite.comm2.Addr(), "", args)
+	assert.Equal(suite.T(), errUnreachable, err, "Stopped transport was reachable.")
+
+	_, err = suite.comm1.Gossip("nonExisting", "", args)
+	assert.Equal(suite.T(), errUnreachable, err, "Non existing transport was reachable.")
+}
+
+func (suite *MemnetTestSuite) TestSend() {
+	reply, err := suite.comm1.Send(suite.comm2.Addr(), "", &pb.Msg{Content: []byte("msg")})
+	require.NoError(suite.T(), err, "Send failed.")
+	assert.Equal(suite.T(), []byte("msg"), reply.GetContent(), "Wrong reply.")
+}
+
+func (suite *MemnetTestSuite) TestStream() {
+	input := make(chan []byte)
+	reply := make(chan []byte)
+
+	go func() {
+		suite.comm1.StreamMessenger(suite.comm2.Addr(), "", input, reply)
+	}()
+
+	for i := 0; i < 3; i++ {
+		input <- []byte{byte(i)}
+
+		select {
+		case r := <-reply:
+			assert.Equal(suite.T(), []byte{byte(i)}, r, "Wrong stream reply.")
+		case <-time.After(time.Second):
+			suite.T().Fatal("Stream reply timed out.")
+		}
+	}
+
+	close(input)
+
+	select {
+	case _, ok := <-reply:
+		assert.False(suite.T(), ok, "Reply stream not closed.")
+	case <-time.After(time.Second):
+		suite.T().Fatal("Reply stream not closed.")
+	}
+}
+
+func (suite *MemnetTestSuite) TestDialStream() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, err := suite.comm1.DialStream(ctx, suite.comm2.Addr(), "")
+	require.NoError(suite.T(), err, "Failed to open stream.")
+
+	require.NoError(suite.T(), s.Send(&pb.Msg{Content: []byte("content")}), "Send failed.")
+
+	r, err := s.Recv()
+	require.NoError(suite.T(), err, "Recv failed.")
+	assert.Equal(suite.T(), []byte("content"), r.GetContent(), "Wrong stream reply.")
+
+	require.NoError(suite.T(), s.CloseSend(), "CloseSend failed.")
+
+	_, err = s.Recv()
+	assert.Equal(suite.T(), io.EOF, err, "Stream not ended after the server returned.")
+
+	_, err = suite.comm1.DialStream(ctx, suite.comm2.Addr(), "wrong id")
+	assert.Equal(suite.T(), errWrongId, err, "Stream opened to peer with wrong id.")
+}
+
+func (suite *MemnetTestSuite) TestPing() {
+	pong, err := suite.ping1.Ping(suite.ping2.Addr(), &pb.Ping{Nonce: []byte("nonce")})
+	require.NoError(suite.T(), err, "Ping failed.")
+	require.NotNil(suite.T(), pong.GetSignature(), "Pong not signed.")
+
+	suite.ping2.Pause(time.Minute)
+
+	_, err = suite.ping1.Ping(suite.ping2.Addr(), &pb.Ping{})
+	assert.Equal(suite.T(), errUnreachable, err, "Paused ping service responded.")
+
+	suite.ping2.Pause(0)
+	suite.ping2.Stop()
+
+	_, err = suite.ping1.Ping(suite.ping2.Addr(), &pb.Ping{})
+	assert.Equal(suite.T(), errUnreachable, err, "Stopped ping service responded.")
+}
+
+func (suite *MemnetTestSuite) TestEd25519Identity() {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(suite.T(), err, "Failed to generate key.")
+
+	id, err := suite.net.NewIdentityWithKey(priv)
+	require.NoError(suite.T(), err, "Failed to create identity.")
+
+	require.NoError(suite.T(), id.Certificate().CheckSignatureFrom(suite.net.CaCertificate()),
+		"Certificate not signed by network CA.")
+	assert.Equal(suite.T(), priv.Public(), id.Certificate().PublicKey, "Certificate carries another key.")
+
+	r, s, err := id.Sign([]byte("data"))
+	require.NoError(suite.T(), err, "Failed to sign.")
+	assert.True(suite.T(), suite.id1.Verify([]byte("data"), r, s, priv.Public()),
+		"Valid signature not accepted.")
+
+	_, p, err := suite.net.NewTransport(id)
+	require.NoError(suite.T(), err, "Failed to create transport.")
+	p.Start()
+
+	pong, err := suite.ping1.Ping(p.Addr(), &pb.Ping{Nonce: []byte("nonce")})
+	require.NoError(suite.T(), err, "Ping failed.")
+	assert.Equal(suite.T(), pb.SignatureAlgorithm_ED25519, pong.GetSignature().GetAlgorithm(), "Pong names the wrong algorithm.")
+
+	_, err = suite.net.NewIdentityWithKey(&unknownSigner{})
+	assert.Equal(suite.T(), errKeyType, err, "Unsupported key accepted.")
+}
+
+type serverStub struct {
+	lastCert *x509.Certificate
+}
+
+func (ss *serverStub) Spread(ctx context.Context, args *pb.State) (*pb.StateResponse, error) {
+	p, ok := grpcPeer.FromContext(ctx)
+	if ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			ss.lastCert = info.State.PeerCertificates[0]
+		}
+	}
+
+	return &pb.StateResponse{ExternalGossip: []byte("reply")}, nil
+}
+
+func (ss *serverStub) Messenger(ctx context.Context, args *pb.Msg) (*pb.MsgResponse, error) {
+	return &pb.MsgResponse{Content: args.GetContent()}, nil
+}
+
+// Echoes all received messages.
+func (ss *serverStub) Stream(srv pb.Gossip_StreamServer) error {
+	for {
+		msg, err := srv.Recv()
+		if err != nil {
+			return nil
+		}
+
+		if err := srv.Send(&pb.MsgResponse{Content: msg.GetContent()}); err != nil {
+			return err
+		}
+	}
+}
+
+// Signer with an unsupported public key.
+type unknownSigner struct {
+	crypto.Signer
+}
+
+func (rs *unknownSigner) Public() crypto.PublicKey {
+	return struct{}{}
+}
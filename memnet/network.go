@@ -0,0 +1,292 @@
+package memnet
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	mrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/joonnna/ifrit/keys"
+)
+
+var (
+	errUnreachable     = errors.New("Remote entity not reachable")
+	errNoRings         = errors.New("Number of rings needs to be greater than zero")
+	errAddrInUse       = errors.New("Address already registered in network")
+	errNotSupported    = errors.New("Operation not supported by in-memory identities")
+	errNoServer        = errors.New("No gossip server registered")
+	errWrongId         = errors.New("Remote certificate does not carry the expected id")
+	errNoSigner        = errors.New("Ping service has no signer")
+	errNilIdentity     = errors.New("Given identity was nil")
+	errNilCert         = errors.New("Given certificate was nil")
+	errForeignIdentity = errors.New("Identity was issued by another network")
+	errKeyType         = errors.New("Key is neither an ecdsa nor an ed25519 key")
+
+	ringNumberOid = []int{2, 5, 13, 37}
+)
+
+// Network connects in-memory transports within a single process.
+// It also acts as the certificate authority for all identities it creates.
+type Network struct {
+	comms     map[string]*Comm
+	pings     map[string]*Ping
+	nodeMutex sync.RWMutex
+
+	caKey  *ecdsa.PrivateKey
+	caCert *x509.Certificate
+
+	numRings  uint32
+	bootNodes int
+
+	knownCerts []*x509.Certificate
+	nextAddr   int
+	idMutex    sync.Mutex
+
+	rng      *mrand.Rand
+	rngMutex sync.Mutex
+}
+
+// Creates a new network with an in-process CA.
+// bootNodes decides how many certificates are handed out as contacts
+// to new identities, equivalent to the boot_nodes setting of the real CA.
+// Ids are generated from the given seed, so ring positions are reproducible.
+func NewNetwork(numRings uint32, bootNodes int, seed int64) (*Network, error) {
+	if numRings == 0 {
+		return nil, errNoRings
+	}
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Network{
+		comms:     make(map[string]*Comm),
+		pings:     make(map[string]*Ping),
+		caKey:     priv,
+		numRings:  numRings,
+		bootNodes: bootNodes,
+		rng:       mrand.New(mrand.NewSource(seed)),
+	}
+
+	serial, err := n.serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		SubjectKeyId:          []byte{1, 2, 3, 4, 5},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		NotBefore:             time.Now().AddDate(-10, 0, 0),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		ExtraExtensions:       []pkix.Extension{n.ringExtension()},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+
+	raw, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		return nil, err
+	}
+
+	n.caCert, err = x509.ParseCertificate(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// Generates a new ecdsa key pair and a certificate signed by the network CA.
+// Each identity is assigned unique in-memory rpc and ping addresses.
+func (n *Network) NewIdentity() (*Identity, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return n.NewIdentityWithKey(priv)
+}
+
+// Same as NewIdentity, but with the given ecdsa or ed25519 private key,
+// letting networks mix key algorithms.
+func (n *Network) NewIdentityWithKey(priv crypto.Signer) (*Identity, error) {
+	if !keys.Supported(priv.Public()) {
+		return nil, errKeyType
+	}
+
+	n.idMutex.Lock()
+	defer n.idMutex.Unlock()
+
+	host := fmt.Sprintf("mem%d", n.nextAddr)
+	n.nextAddr++
+
+	serial, err := n.serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		SubjectKeyId: n.genId(),
+		Subject: pkix.Name{
+			Locality: []string{fmt.Sprintf("%s:1", host), fmt.Sprintf("%s:2", host)},
+		},
+		NotBefore:       time.Now().AddDate(-10, 0, 0),
+		NotAfter:        time.Now().AddDate(10, 0, 0),
+		ExtraExtensions: []pkix.Extension{n.ringExtension()},
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		KeyUsage:        x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+
+	cert, err := n.issue(template, priv.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	contacts := make([]*x509.Certificate, len(n.knownCerts))
+	copy(contacts, n.knownCerts)
+
+	trusted := len(n.knownCerts) < n.bootNodes
+	if trusted {
+		n.knownCerts = append(n.knownCerts, cert)
+	}
+
+	return &Identity{
+		net:        n,
+		priv:       priv,
+		cert:       cert,
+		caCert:     n.caCert,
+		numRings:   n.numRings,
+		knownCerts: contacts,
+		trusted:    trusted,
+	}, nil
+}
+
+// Issues a certificate with the id and addresses of the given one for the given key,
+// issued later than the given certificate as peers require.
+func (n *Network) renew(curr *x509.Certificate, priv crypto.Signer) (*x509.Certificate, error) {
+	serial, err := n.serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	notBefore := time.Now().AddDate(-10, 0, 0).Truncate(time.Second)
+	if !notBefore.After(curr.NotBefore) {
+		notBefore = curr.NotBefore.Add(time.Second)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:    serial,
+		SubjectKeyId:    curr.SubjectKeyId,
+		Subject:         curr.Subject,
+		NotBefore:       notBefore,
+		NotAfter:        time.Now().AddDate(10, 0, 0),
+		ExtraExtensions: []pkix.Extension{n.ringExtension()},
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		KeyUsage:        x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+
+	return n.issue(template, priv.Public())
+}
+
+func (n *Network) issue(template *x509.Certificate, pub crypto.PublicKey) (*x509.Certificate, error) {
+	raw, err := x509.CreateCertificate(rand.Reader, template, n.caCert, pub, n.caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(raw)
+}
+
+// Creates the comm and ping services for the given identity,
+// both are reachable by other transports of this network once started.
+func (n *Network) NewTransport(id *Identity) (*Comm, *Ping, error) {
+	if id == nil {
+		return nil, nil, errNilIdentity
+	}
+
+	if id.caCert != n.caCert {
+		return nil, nil, errForeignIdentity
+	}
+
+	c := &Comm{
+		net:  n,
+		cert: id.cert,
+		addr: id.cert.Subject.Locality[0],
+	}
+
+	p := &Ping{
+		net:    n,
+		addr:   id.cert.Subject.Locality[1],
+		signer: id,
+	}
+
+	n.nodeMutex.Lock()
+	defer n.nodeMutex.Unlock()
+
+	if _, ok := n.comms[c.addr]; ok {
+		return nil, nil, errAddrInUse
+	}
+
+	n.comms[c.addr] = c
+	n.pings[p.addr] = p
+
+	return c, p, nil
+}
+
+// Returns the certificate of the network CA.
+func (n *Network) CaCertificate() *x509.Certificate {
+	return n.caCert
+}
+
+func (n *Network) comm(addr string) *Comm {
+	n.nodeMutex.RLock()
+	defer n.nodeMutex.RUnlock()
+
+	return n.comms[addr]
+}
+
+func (n *Network) ping(addr string) *Ping {
+	n.nodeMutex.RLock()
+	defer n.nodeMutex.RUnlock()
+
+	return n.pings[addr]
+}
+
+func (n *Network) ringExtension() pkix.Extension {
+	ringBytes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(ringBytes[0:], n.numRings)
+
+	return pkix.Extension{
+		Id:       ringNumberOid,
+		Critical: false,
+		Value:    ringBytes,
+	}
+}
+
+func (n *Network) genId() []byte {
+	n.rngMutex.Lock()
+	defer n.rngMutex.Unlock()
+
+	id := make([]byte, 32)
+	n.rng.Read(id)
+
+	return id
+}
+
+func (n *Network) serialNumber() (*big.Int, error) {
+	sLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	return rand.Int(rand.Reader, sLimit)
+}
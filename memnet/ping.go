@@ -0,0 +1,101 @@
+package memnet
+
+import (
+	"crypto/x509"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/joonnna/ifrit/keys"
+	pb "github.com/joonnna/ifrit/protobuf"
+)
+
+// Ping answers pings from other in-memory transports,
+// signing the received ping the same way the UDP server does.
+type Ping struct {
+	net    *Network
+	addr   string
+	signer pongSigner
+
+	running     bool
+	pausedUntil time.Time
+	mutex       sync.RWMutex
+}
+
+type pongSigner interface {
+	Sign([]byte) ([]byte, []byte, error)
+	Certificate() *x509.Certificate
+}
+
+func (p *Ping) Ping(addr string, msg *pb.Ping) (*pb.Pong, error) {
+	dest := p.net.ping(addr)
+	if dest == nil || !dest.reachable() {
+		return nil, errUnreachable
+	}
+
+	return dest.pong(msg)
+}
+
+// Makes the ping service respond to pings.
+func (p *Ping) Start() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.running = true
+}
+
+// Stops responding to pings.
+func (p *Ping) Stop() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.running = false
+}
+
+// Stops responding to pings for the given duration.
+func (p *Ping) Pause(d time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.pausedUntil = time.Now().Add(d)
+}
+
+func (p *Ping) Addr() string {
+	return p.addr
+}
+
+func (p *Ping) reachable() bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.running && time.Now().After(p.pausedUntil)
+}
+
+func (p *Ping) pong(msg *pb.Ping) (*pb.Pong, error) {
+	if p.signer == nil {
+		return nil, errNoSigner
+	}
+
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	r, s, err := p.signer.Sign(data)
+	if err != nil {
+		return nil, err
+	}
+
+	alg, err := keys.Algorithm(p.signer.Certificate().PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.Pong{
+		Signature: &pb.Signature{
+			R:         r,
+			S:         s,
+			Algorithm: alg,
+		},
+	}, nil
+}
@@ -0,0 +1,153 @@
+package memnet
+
+import (
+	"io"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	pb "github.com/joonnna/ifrit/protobuf"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+// Server side of an in-memory stream, implements pb.Gossip_StreamServer.
+type serverStream struct {
+	ctx context.Context
+
+	reqs  chan *pb.Msg
+	resps chan *pb.MsgResponse
+}
+
+func newServerStream(ctx context.Context) *serverStream {
+	return &serverStream{
+		ctx:   ctx,
+		reqs:  make(chan *pb.Msg),
+		resps: make(chan *pb.MsgResponse),
+	}
+}
+
+func (s *serverStream) Send(m *pb.MsgResponse) error {
+	select {
+	case s.resps <- proto.Clone(m).(*pb.MsgResponse):
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+func (s *serverStream) Recv() (*pb.Msg, error) {
+	select {
+	case m, ok := <-s.reqs:
+		if !ok {
+			return nil, io.EOF
+		}
+		return m, nil
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+func (s *serverStream) SetHeader(metadata.MD) error {
+	return nil
+}
+
+func (s *serverStream) SendHeader(metadata.MD) error {
+	return nil
+}
+
+func (s *serverStream) SetTrailer(metadata.MD) {
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) SendMsg(m interface{}) error {
+	return s.Send(m.(*pb.MsgResponse))
+}
+
+func (s *serverStream) RecvMsg(m interface{}) error {
+	msg, err := s.Recv()
+	if err != nil {
+		return err
+	}
+
+	proto.Merge(m.(proto.Message), msg)
+
+	return nil
+}
+
+// Client side of a stream, delivering requests to the server stream
+// handed to the destination's gossip server.
+type clientStream struct {
+	s      *serverStream
+	done   chan struct{}
+	cancel context.CancelFunc
+	err    error
+
+	closeOnce sync.Once
+}
+
+func (cs *clientStream) Send(m *pb.Msg) error {
+	select {
+	case cs.s.reqs <- proto.Clone(m).(*pb.Msg):
+		return nil
+	case <-cs.done:
+		return io.EOF
+	case <-cs.s.ctx.Done():
+		return cs.s.ctx.Err()
+	}
+}
+
+// Returns io.EOF once the server handler has returned without error,
+// releasing the stream context like grpc does when a stream ends.
+func (cs *clientStream) Recv() (*pb.MsgResponse, error) {
+	select {
+	case m := <-cs.s.resps:
+		return m, nil
+	case <-cs.done:
+		cs.cancel()
+
+		if cs.err != nil {
+			return nil, cs.err
+		}
+		return nil, io.EOF
+	case <-cs.s.ctx.Done():
+		return nil, cs.s.ctx.Err()
+	}
+}
+
+func (cs *clientStream) CloseSend() error {
+	cs.closeOnce.Do(func() {
+		close(cs.s.reqs)
+	})
+
+	return nil
+}
+
+func (cs *clientStream) Header() (metadata.MD, error) {
+	return nil, nil
+}
+
+func (cs *clientStream) Trailer() metadata.MD {
+	return nil
+}
+
+func (cs *clientStream) Context() context.Context {
+	return cs.s.ctx
+}
+
+func (cs *clientStream) SendMsg(m interface{}) error {
+	return cs.Send(m.(*pb.Msg))
+}
+
+func (cs *clientStream) RecvMsg(m interface{}) error {
+	msg, err := cs.Recv()
+	if err != nil {
+		return err
+	}
+
+	proto.Merge(m.(proto.Message), msg)
+
+	return nil
+}
@@ -6,7 +6,6 @@ import (
 	"net"
 	"os"
 	"strconv"
-	"strings"
 
 	log "github.com/inconshreveable/log15"
 )
@@ -19,12 +18,10 @@ var (
 func GetOpenPort() int {
 	attempts := 0
 	for {
-		l, err := net.Listen("tcp4", ":0")
+		l, err := net.Listen("tcp", ":0")
 		if err == nil {
-			addr := l.Addr().String()
+			port := l.Addr().(*net.TCPAddr).Port
 			l.Close()
-			tmp := strings.Split(addr, ":")
-			port, _ := strconv.Atoi(tmp[len(tmp)-1])
 			return port
 		} else {
 			fmt.Println(err)
@@ -55,7 +52,7 @@ func ListenOnPort(port int) (net.Listener, error) {
 		}
 	*/
 	for {
-		l, err = net.Listen("tcp4", fmt.Sprintf("%s:%d", addr[0], startPort))
+		l, err = net.Listen("tcp", net.JoinHostPort(addr[0], strconv.Itoa(startPort)))
 		if err == nil {
 			break
 		}
@@ -97,7 +94,8 @@ func GetListener(hostname string, portnum int) (net.Listener, error) {
 	*/
 
 	for {
-		l, err = net.Listen("tcp4", fmt.Sprintf(":%d", portnum))
+		// Binds all local interfaces, both ipv4 and ipv6.
+		l, err = net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(portnum)))
 		if err == nil {
 			return l, nil
 		} else {
@@ -129,6 +127,10 @@ func GetLocalIP() string {
 		return h
 	*/
 
+	if ip, err := LocalIP(); err == nil {
+		return ip
+	}
+
 	h, _ := os.Hostname()
 	addr, err := net.LookupHost(h)
 	if err != nil || len(addr) < 1 {
@@ -138,19 +140,57 @@ func GetLocalIP() string {
 	return addr[0]
 }
 
+// Returns a non-loopback address of the host, ipv4 addresses are preferred over ipv6.
+// Falls back to the addresses of the network interfaces if the hostname does not resolve to one.
 func LocalIP() (string, error) {
 	host, _ := os.Hostname()
 
 	addrs, err := net.LookupIP(host)
+	if err == nil {
+		if ip := pickAddr(addrs); ip != nil {
+			return ip.String(), nil
+		}
+	}
+
+	ifAddrs, err := net.InterfaceAddrs()
 	if err != nil {
 		return "", err
 	}
 
-	if len(addrs) == 0 {
-		return "", errNoAddr
+	var ips []net.IP
+
+	for _, a := range ifAddrs {
+		if ipNet, ok := a.(*net.IPNet); ok {
+			ips = append(ips, ipNet.IP)
+		}
+	}
+
+	if ip := pickAddr(ips); ip != nil {
+		return ip.String(), nil
+	}
+
+	return "", errNoAddr
+}
+
+// Link-local ipv6 addresses are skipped, they are unusable without a zone.
+func pickAddr(ips []net.IP) net.IP {
+	var v6 net.IP
+
+	for _, ip := range ips {
+		if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+			continue
+		}
+
+		if ip.To4() != nil {
+			return ip
+		}
+
+		if v6 == nil {
+			v6 = ip
+		}
 	}
 
-	return addrs[0].String(), nil
+	return v6
 }
 
 /* Change: Added port as specifiable argument. If passed argument is zero functionality will be as before.
@@ -171,7 +211,7 @@ func ListenUdp(hostname string, portnum int) (*net.UDPConn, string, error) {
 		addr[0] = hostname
 	}
 
-	udpAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf(":%d", portnum))
+	udpAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort("", strconv.Itoa(portnum)))
 	if err != nil {
 		return nil, "", err
 	}
@@ -181,7 +221,8 @@ func ListenUdp(hostname string, portnum int) (*net.UDPConn, string, error) {
 		return nil, "", err
 	}
 
-	fullAddr := fmt.Sprintf("%s:%d", hostname, portnum)
+	// The bound port differs from the requested one if port 0 was requested.
+	fullAddr := net.JoinHostPort(hostname, strconv.Itoa(conn.LocalAddr().(*net.UDPAddr).Port))
 
 	return conn, fullAddr, nil
 }
@@ -0,0 +1,40 @@
+package netutil
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPickAddr(t *testing.T) {
+	v4, v6 := net.ParseIP("10.0.0.1"), net.ParseIP("2001:db8::1")
+
+	tests := []struct {
+		in  []net.IP
+		out net.IP
+	}{
+		{in: nil, out: nil},
+		{in: []net.IP{net.IPv6loopback, net.ParseIP("127.0.0.1")}, out: nil},
+		{in: []net.IP{net.ParseIP("fe80::1"), v6}, out: v6},
+		{in: []net.IP{v6, v4}, out: v4},
+	}
+
+	for i, test := range tests {
+		assert.Equalf(t, test.out, pickAddr(test.in), "Wrong address picked for test %d.", i)
+	}
+}
+
+func TestListenUdpIpv6(t *testing.T) {
+	conn, addr, err := ListenUdp("::1", 0)
+	require.NoError(t, err, "Failed to listen.")
+	defer conn.Close()
+
+	host, port, err := net.SplitHostPort(addr)
+	require.NoError(t, err, "Returned address does not parse.")
+	assert.Equal(t, "::1", host, "Wrong host.")
+	assert.Equal(t, strconv.Itoa(conn.LocalAddr().(*net.UDPAddr).Port), port, "Bound port not returned.")
+	assert.NotEqual(t, "0", port, "Requested port returned instead of the bound one.")
+}
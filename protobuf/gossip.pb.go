@@ -24,11 +24,39 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 
+// Signatures without an algorithm are ecdsa signatures,
+// as sent by members predating the algorithm field.
+type SignatureAlgorithm int32
+
+const (
+	SignatureAlgorithm_ECDSA   SignatureAlgorithm = 0
+	SignatureAlgorithm_ED25519 SignatureAlgorithm = 1
+)
+
+var SignatureAlgorithm_name = map[int32]string{
+	0: "ECDSA",
+	1: "ED25519",
+}
+
+var SignatureAlgorithm_value = map[string]int32{
+	"ECDSA":   0,
+	"ED25519": 1,
+}
+
+func (x SignatureAlgorithm) String() string {
+	return proto.EnumName(SignatureAlgorithm_name, int32(x))
+}
+
+func (SignatureAlgorithm) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{0}
+}
+
 type State struct {
 	//repeated NodeInfo existingNodes
 	ExistingHosts        map[string]uint64 `protobuf:"bytes,1,rep,name=existingHosts,proto3" json:"existingHosts,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"varint,2,opt,name=value,proto3"`
 	OwnNote              *Note             `protobuf:"bytes,2,opt,name=ownNote,proto3" json:"ownNote,omitempty"`
 	ExternalGossip       []byte            `protobuf:"bytes,3,opt,name=externalGossip,proto3" json:"externalGossip,omitempty"`
+	RevocationNumber     uint64            `protobuf:"varint,4,opt,name=revocationNumber,proto3" json:"revocationNumber,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
 	XXX_unrecognized     []byte            `json:"-"`
 	XXX_sizecache        int32             `json:"-"`
@@ -80,13 +108,24 @@ func (m *State) GetExternalGossip() []byte {
 	return nil
 }
 
-//Application message
+func (m *State) GetRevocationNumber() uint64 {
+	if m != nil {
+		return m.RevocationNumber
+	}
+	return 0
+}
+
+// Application message
 type Msg struct {
-	Content              []byte   `protobuf:"bytes,1,opt,name=content,proto3" json:"content,omitempty"`
-	Error                string   `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	Content []byte `protobuf:"bytes,1,opt,name=content,proto3" json:"content,omitempty"`
+	Error   string `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	// Set on streams transferring blobs.
+	Blob *BlobChunk `protobuf:"bytes,3,opt,name=blob,proto3" json:"blob,omitempty"`
+	// Set on messages relayed over ring successors.
+	Relay                *RelayMsg `protobuf:"bytes,4,opt,name=relay,proto3" json:"relay,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
 }
 
 func (m *Msg) Reset()         { *m = Msg{} }
@@ -128,13 +167,30 @@ func (m *Msg) GetError() string {
 	return ""
 }
 
-//Application response
+func (m *Msg) GetBlob() *BlobChunk {
+	if m != nil {
+		return m.Blob
+	}
+	return nil
+}
+
+func (m *Msg) GetRelay() *RelayMsg {
+	if m != nil {
+		return m.Relay
+	}
+	return nil
+}
+
+// Application response
 type MsgResponse struct {
-	Content              []byte   `protobuf:"bytes,1,opt,name=content,proto3" json:"content,omitempty"`
-	Error                string   `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	Content []byte   `protobuf:"bytes,1,opt,name=content,proto3" json:"content,omitempty"`
+	Error   string   `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	BlobAck *BlobAck `protobuf:"bytes,3,opt,name=blobAck,proto3" json:"blobAck,omitempty"`
+	// Signature of the destination over the reply to a relayed message.
+	Signature            *Signature `protobuf:"bytes,4,opt,name=signature,proto3" json:"signature,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}   `json:"-"`
+	XXX_unrecognized     []byte     `json:"-"`
+	XXX_sizecache        int32      `json:"-"`
 }
 
 func (m *MsgResponse) Reset()         { *m = MsgResponse{} }
@@ -176,11 +232,257 @@ func (m *MsgResponse) GetError() string {
 	return ""
 }
 
+func (m *MsgResponse) GetBlobAck() *BlobAck {
+	if m != nil {
+		return m.BlobAck
+	}
+	return nil
+}
+
+func (m *MsgResponse) GetSignature() *Signature {
+	if m != nil {
+		return m.Signature
+	}
+	return nil
+}
+
+// A message forwarded over ring successors towards the destination,
+// signed by the source.
+type RelayMsg struct {
+	Source      []byte `protobuf:"bytes,1,opt,name=source,proto3" json:"source,omitempty"`
+	Destination []byte `protobuf:"bytes,2,opt,name=destination,proto3" json:"destination,omitempty"`
+	Content     []byte `protobuf:"bytes,3,opt,name=content,proto3" json:"content,omitempty"`
+	// Random, binds the reply to the message.
+	Nonce     []byte     `protobuf:"bytes,4,opt,name=nonce,proto3" json:"nonce,omitempty"`
+	Signature *Signature `protobuf:"bytes,5,opt,name=signature,proto3" json:"signature,omitempty"`
+	// Number of hops so far, not signed.
+	Hops uint32 `protobuf:"varint,6,opt,name=hops,proto3" json:"hops,omitempty"`
+	// Unix time in nanoseconds after which the message is refused.
+	Expiry               int64    `protobuf:"varint,7,opt,name=expiry,proto3" json:"expiry,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RelayMsg) Reset()         { *m = RelayMsg{} }
+func (m *RelayMsg) String() string { return proto.CompactTextString(m) }
+func (*RelayMsg) ProtoMessage()    {}
+func (*RelayMsg) Descriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{3}
+}
+
+func (m *RelayMsg) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RelayMsg.Unmarshal(m, b)
+}
+func (m *RelayMsg) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RelayMsg.Marshal(b, m, deterministic)
+}
+func (m *RelayMsg) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RelayMsg.Merge(m, src)
+}
+func (m *RelayMsg) XXX_Size() int {
+	return xxx_messageInfo_RelayMsg.Size(m)
+}
+func (m *RelayMsg) XXX_DiscardUnknown() {
+	xxx_messageInfo_RelayMsg.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RelayMsg proto.InternalMessageInfo
+
+func (m *RelayMsg) GetSource() []byte {
+	if m != nil {
+		return m.Source
+	}
+	return nil
+}
+
+func (m *RelayMsg) GetDestination() []byte {
+	if m != nil {
+		return m.Destination
+	}
+	return nil
+}
+
+func (m *RelayMsg) GetContent() []byte {
+	if m != nil {
+		return m.Content
+	}
+	return nil
+}
+
+func (m *RelayMsg) GetNonce() []byte {
+	if m != nil {
+		return m.Nonce
+	}
+	return nil
+}
+
+func (m *RelayMsg) GetSignature() *Signature {
+	if m != nil {
+		return m.Signature
+	}
+	return nil
+}
+
+func (m *RelayMsg) GetHops() uint32 {
+	if m != nil {
+		return m.Hops
+	}
+	return 0
+}
+
+func (m *RelayMsg) GetExpiry() int64 {
+	if m != nil {
+		return m.Expiry
+	}
+	return 0
+}
+
+// A chunk of a blob, chunks without data and not marked as last
+// open (or resume) the transfer.
+type BlobChunk struct {
+	TransferId []byte `protobuf:"bytes,1,opt,name=transferId,proto3" json:"transferId,omitempty"`
+	Offset     uint64 `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"`
+	Data       []byte `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	// Sha256 of the chunk data.
+	Hash []byte `protobuf:"bytes,4,opt,name=hash,proto3" json:"hash,omitempty"`
+	Last bool   `protobuf:"varint,5,opt,name=last,proto3" json:"last,omitempty"`
+	// Sha256 of the entire blob, present on the last chunk.
+	Digest               []byte   `protobuf:"bytes,6,opt,name=digest,proto3" json:"digest,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *BlobChunk) Reset()         { *m = BlobChunk{} }
+func (m *BlobChunk) String() string { return proto.CompactTextString(m) }
+func (*BlobChunk) ProtoMessage()    {}
+func (*BlobChunk) Descriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{4}
+}
+
+func (m *BlobChunk) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BlobChunk.Unmarshal(m, b)
+}
+func (m *BlobChunk) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BlobChunk.Marshal(b, m, deterministic)
+}
+func (m *BlobChunk) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BlobChunk.Merge(m, src)
+}
+func (m *BlobChunk) XXX_Size() int {
+	return xxx_messageInfo_BlobChunk.Size(m)
+}
+func (m *BlobChunk) XXX_DiscardUnknown() {
+	xxx_messageInfo_BlobChunk.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BlobChunk proto.InternalMessageInfo
+
+func (m *BlobChunk) GetTransferId() []byte {
+	if m != nil {
+		return m.TransferId
+	}
+	return nil
+}
+
+func (m *BlobChunk) GetOffset() uint64 {
+	if m != nil {
+		return m.Offset
+	}
+	return 0
+}
+
+func (m *BlobChunk) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *BlobChunk) GetHash() []byte {
+	if m != nil {
+		return m.Hash
+	}
+	return nil
+}
+
+func (m *BlobChunk) GetLast() bool {
+	if m != nil {
+		return m.Last
+	}
+	return false
+}
+
+func (m *BlobChunk) GetDigest() []byte {
+	if m != nil {
+		return m.Digest
+	}
+	return nil
+}
+
+// Acknowledges all blob data before the offset.
+type BlobAck struct {
+	Offset               uint64   `protobuf:"varint,1,opt,name=offset,proto3" json:"offset,omitempty"`
+	Done                 bool     `protobuf:"varint,2,opt,name=done,proto3" json:"done,omitempty"`
+	Error                string   `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *BlobAck) Reset()         { *m = BlobAck{} }
+func (m *BlobAck) String() string { return proto.CompactTextString(m) }
+func (*BlobAck) ProtoMessage()    {}
+func (*BlobAck) Descriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{5}
+}
+
+func (m *BlobAck) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BlobAck.Unmarshal(m, b)
+}
+func (m *BlobAck) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BlobAck.Marshal(b, m, deterministic)
+}
+func (m *BlobAck) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BlobAck.Merge(m, src)
+}
+func (m *BlobAck) XXX_Size() int {
+	return xxx_messageInfo_BlobAck.Size(m)
+}
+func (m *BlobAck) XXX_DiscardUnknown() {
+	xxx_messageInfo_BlobAck.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BlobAck proto.InternalMessageInfo
+
+func (m *BlobAck) GetOffset() uint64 {
+	if m != nil {
+		return m.Offset
+	}
+	return 0
+}
+
+func (m *BlobAck) GetDone() bool {
+	if m != nil {
+		return m.Done
+	}
+	return false
+}
+
+func (m *BlobAck) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
 type StateResponse struct {
 	Certificates         []*Certificate `protobuf:"bytes,1,rep,name=certificates,proto3" json:"certificates,omitempty"`
 	Notes                []*Note        `protobuf:"bytes,2,rep,name=notes,proto3" json:"notes,omitempty"`
 	Accusations          []*Accusation  `protobuf:"bytes,3,rep,name=accusations,proto3" json:"accusations,omitempty"`
 	ExternalGossip       []byte         `protobuf:"bytes,4,opt,name=externalGossip,proto3" json:"externalGossip,omitempty"`
+	RevocationList       []byte         `protobuf:"bytes,5,opt,name=revocationList,proto3" json:"revocationList,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
 	XXX_unrecognized     []byte         `json:"-"`
 	XXX_sizecache        int32          `json:"-"`
@@ -190,7 +492,7 @@ func (m *StateResponse) Reset()         { *m = StateResponse{} }
 func (m *StateResponse) String() string { return proto.CompactTextString(m) }
 func (*StateResponse) ProtoMessage()    {}
 func (*StateResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_878fa4887b90140c, []int{3}
+	return fileDescriptor_878fa4887b90140c, []int{6}
 }
 
 func (m *StateResponse) XXX_Unmarshal(b []byte) error {
@@ -239,7 +541,14 @@ func (m *StateResponse) GetExternalGossip() []byte {
 	return nil
 }
 
-//Raw certificate
+func (m *StateResponse) GetRevocationList() []byte {
+	if m != nil {
+		return m.RevocationList
+	}
+	return nil
+}
+
+// Raw certificate
 type Certificate struct {
 	Raw                  []byte   `protobuf:"bytes,1,opt,name=raw,proto3" json:"raw,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -251,7 +560,7 @@ func (m *Certificate) Reset()         { *m = Certificate{} }
 func (m *Certificate) String() string { return proto.CompactTextString(m) }
 func (*Certificate) ProtoMessage()    {}
 func (*Certificate) Descriptor() ([]byte, []int) {
-	return fileDescriptor_878fa4887b90140c, []int{4}
+	return fileDescriptor_878fa4887b90140c, []int{7}
 }
 
 func (m *Certificate) XXX_Unmarshal(b []byte) error {
@@ -279,7 +588,7 @@ func (m *Certificate) GetRaw() []byte {
 	return nil
 }
 
-//accuser and accused are the respective node ids
+// accuser and accused are the respective node ids
 type Accusation struct {
 	Epoch                uint64     `protobuf:"varint,1,opt,name=epoch,proto3" json:"epoch,omitempty"`
 	Accuser              []byte     `protobuf:"bytes,2,opt,name=accuser,proto3" json:"accuser,omitempty"`
@@ -295,7 +604,7 @@ func (m *Accusation) Reset()         { *m = Accusation{} }
 func (m *Accusation) String() string { return proto.CompactTextString(m) }
 func (*Accusation) ProtoMessage()    {}
 func (*Accusation) Descriptor() ([]byte, []int) {
-	return fileDescriptor_878fa4887b90140c, []int{5}
+	return fileDescriptor_878fa4887b90140c, []int{8}
 }
 
 func (m *Accusation) XXX_Unmarshal(b []byte) error {
@@ -352,20 +661,24 @@ func (m *Accusation) GetRingNum() uint32 {
 }
 
 type Note struct {
-	Epoch                uint64     `protobuf:"varint,1,opt,name=epoch,proto3" json:"epoch,omitempty"`
-	Id                   []byte     `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
-	Mask                 uint32     `protobuf:"varint,3,opt,name=mask,proto3" json:"mask,omitempty"`
-	Signature            *Signature `protobuf:"bytes,4,opt,name=signature,proto3" json:"signature,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}   `json:"-"`
-	XXX_unrecognized     []byte     `json:"-"`
-	XXX_sizecache        int32      `json:"-"`
+	Epoch     uint64     `protobuf:"varint,1,opt,name=epoch,proto3" json:"epoch,omitempty"`
+	Id        []byte     `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	Mask      uint32     `protobuf:"varint,3,opt,name=mask,proto3" json:"mask,omitempty"`
+	Signature *Signature `protobuf:"bytes,4,opt,name=signature,proto3" json:"signature,omitempty"`
+	// Sorted by key, keys are unique.
+	Attributes []*Attribute `protobuf:"bytes,5,rep,name=attributes,proto3" json:"attributes,omitempty"`
+	// Overrides the addresses in the certificate when present.
+	Address              *Address `protobuf:"bytes,6,opt,name=address,proto3" json:"address,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
 func (m *Note) Reset()         { *m = Note{} }
 func (m *Note) String() string { return proto.CompactTextString(m) }
 func (*Note) ProtoMessage()    {}
 func (*Note) Descriptor() ([]byte, []int) {
-	return fileDescriptor_878fa4887b90140c, []int{6}
+	return fileDescriptor_878fa4887b90140c, []int{9}
 }
 
 func (m *Note) XXX_Unmarshal(b []byte) error {
@@ -414,20 +727,137 @@ func (m *Note) GetSignature() *Signature {
 	return nil
 }
 
-//Raw elliptic signature
-type Signature struct {
-	R                    []byte   `protobuf:"bytes,1,opt,name=r,proto3" json:"r,omitempty"`
-	S                    []byte   `protobuf:"bytes,2,opt,name=s,proto3" json:"s,omitempty"`
+func (m *Note) GetAttributes() []*Attribute {
+	if m != nil {
+		return m.Attributes
+	}
+	return nil
+}
+
+func (m *Note) GetAddress() *Address {
+	if m != nil {
+		return m.Address
+	}
+	return nil
+}
+
+type Address struct {
+	RpcAddr              string   `protobuf:"bytes,1,opt,name=rpcAddr,proto3" json:"rpcAddr,omitempty"`
+	PingAddr             string   `protobuf:"bytes,2,opt,name=pingAddr,proto3" json:"pingAddr,omitempty"`
+	HttpAddr             string   `protobuf:"bytes,3,opt,name=httpAddr,proto3" json:"httpAddr,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Address) Reset()         { *m = Address{} }
+func (m *Address) String() string { return proto.CompactTextString(m) }
+func (*Address) ProtoMessage()    {}
+func (*Address) Descriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{10}
+}
+
+func (m *Address) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Address.Unmarshal(m, b)
+}
+func (m *Address) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Address.Marshal(b, m, deterministic)
+}
+func (m *Address) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Address.Merge(m, src)
+}
+func (m *Address) XXX_Size() int {
+	return xxx_messageInfo_Address.Size(m)
+}
+func (m *Address) XXX_DiscardUnknown() {
+	xxx_messageInfo_Address.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Address proto.InternalMessageInfo
+
+func (m *Address) GetRpcAddr() string {
+	if m != nil {
+		return m.RpcAddr
+	}
+	return ""
+}
+
+func (m *Address) GetPingAddr() string {
+	if m != nil {
+		return m.PingAddr
+	}
+	return ""
+}
+
+func (m *Address) GetHttpAddr() string {
+	if m != nil {
+		return m.HttpAddr
+	}
+	return ""
+}
+
+type Attribute struct {
+	Key                  string   `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value                string   `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
 }
 
+func (m *Attribute) Reset()         { *m = Attribute{} }
+func (m *Attribute) String() string { return proto.CompactTextString(m) }
+func (*Attribute) ProtoMessage()    {}
+func (*Attribute) Descriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{11}
+}
+
+func (m *Attribute) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Attribute.Unmarshal(m, b)
+}
+func (m *Attribute) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Attribute.Marshal(b, m, deterministic)
+}
+func (m *Attribute) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Attribute.Merge(m, src)
+}
+func (m *Attribute) XXX_Size() int {
+	return xxx_messageInfo_Attribute.Size(m)
+}
+func (m *Attribute) XXX_DiscardUnknown() {
+	xxx_messageInfo_Attribute.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Attribute proto.InternalMessageInfo
+
+func (m *Attribute) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *Attribute) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
+// Raw signature, ed25519 signatures are split into their r and s halves.
+type Signature struct {
+	R                    []byte             `protobuf:"bytes,1,opt,name=r,proto3" json:"r,omitempty"`
+	S                    []byte             `protobuf:"bytes,2,opt,name=s,proto3" json:"s,omitempty"`
+	Algorithm            SignatureAlgorithm `protobuf:"varint,3,opt,name=algorithm,proto3,enum=proto.SignatureAlgorithm" json:"algorithm,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
+}
+
 func (m *Signature) Reset()         { *m = Signature{} }
 func (m *Signature) String() string { return proto.CompactTextString(m) }
 func (*Signature) ProtoMessage()    {}
 func (*Signature) Descriptor() ([]byte, []int) {
-	return fileDescriptor_878fa4887b90140c, []int{7}
+	return fileDescriptor_878fa4887b90140c, []int{12}
 }
 
 func (m *Signature) XXX_Unmarshal(b []byte) error {
@@ -462,6 +892,13 @@ func (m *Signature) GetS() []byte {
 	return nil
 }
 
+func (m *Signature) GetAlgorithm() SignatureAlgorithm {
+	if m != nil {
+		return m.Algorithm
+	}
+	return SignatureAlgorithm_ECDSA
+}
+
 type Data struct {
 	Content              []byte   `protobuf:"bytes,1,opt,name=content,proto3" json:"content,omitempty"`
 	Id                   []byte   `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
@@ -474,7 +911,7 @@ func (m *Data) Reset()         { *m = Data{} }
 func (m *Data) String() string { return proto.CompactTextString(m) }
 func (*Data) ProtoMessage()    {}
 func (*Data) Descriptor() ([]byte, []int) {
-	return fileDescriptor_878fa4887b90140c, []int{8}
+	return fileDescriptor_878fa4887b90140c, []int{13}
 }
 
 func (m *Data) XXX_Unmarshal(b []byte) error {
@@ -520,7 +957,7 @@ func (m *Ping) Reset()         { *m = Ping{} }
 func (m *Ping) String() string { return proto.CompactTextString(m) }
 func (*Ping) ProtoMessage()    {}
 func (*Ping) Descriptor() ([]byte, []int) {
-	return fileDescriptor_878fa4887b90140c, []int{9}
+	return fileDescriptor_878fa4887b90140c, []int{14}
 }
 
 func (m *Ping) XXX_Unmarshal(b []byte) error {
@@ -560,7 +997,7 @@ func (m *Pong) Reset()         { *m = Pong{} }
 func (m *Pong) String() string { return proto.CompactTextString(m) }
 func (*Pong) ProtoMessage()    {}
 func (*Pong) Descriptor() ([]byte, []int) {
-	return fileDescriptor_878fa4887b90140c, []int{10}
+	return fileDescriptor_878fa4887b90140c, []int{15}
 }
 
 func (m *Pong) XXX_Unmarshal(b []byte) error {
@@ -606,7 +1043,7 @@ func (m *Test) Reset()         { *m = Test{} }
 func (m *Test) String() string { return proto.CompactTextString(m) }
 func (*Test) ProtoMessage()    {}
 func (*Test) Descriptor() ([]byte, []int) {
-	return fileDescriptor_878fa4887b90140c, []int{11}
+	return fileDescriptor_878fa4887b90140c, []int{16}
 }
 
 func (m *Test) XXX_Unmarshal(b []byte) error {
@@ -635,14 +1072,20 @@ func (m *Test) GetNums() []int32 {
 }
 
 func init() {
+	proto.RegisterEnum("proto.SignatureAlgorithm", SignatureAlgorithm_name, SignatureAlgorithm_value)
 	proto.RegisterType((*State)(nil), "proto.State")
 	proto.RegisterMapType((map[string]uint64)(nil), "proto.State.ExistingHostsEntry")
 	proto.RegisterType((*Msg)(nil), "proto.Msg")
 	proto.RegisterType((*MsgResponse)(nil), "proto.MsgResponse")
+	proto.RegisterType((*RelayMsg)(nil), "proto.RelayMsg")
+	proto.RegisterType((*BlobChunk)(nil), "proto.BlobChunk")
+	proto.RegisterType((*BlobAck)(nil), "proto.BlobAck")
 	proto.RegisterType((*StateResponse)(nil), "proto.StateResponse")
 	proto.RegisterType((*Certificate)(nil), "proto.Certificate")
 	proto.RegisterType((*Accusation)(nil), "proto.Accusation")
 	proto.RegisterType((*Note)(nil), "proto.Note")
+	proto.RegisterType((*Address)(nil), "proto.Address")
+	proto.RegisterType((*Attribute)(nil), "proto.Attribute")
 	proto.RegisterType((*Signature)(nil), "proto.Signature")
 	proto.RegisterType((*Data)(nil), "proto.Data")
 	proto.RegisterType((*Ping)(nil), "proto.Ping")
@@ -650,54 +1093,81 @@ func init() {
 	proto.RegisterType((*Test)(nil), "proto.Test")
 }
 
-func init() { proto.RegisterFile("gossip.proto", fileDescriptor_878fa4887b90140c) }
+func init() {
+	proto.RegisterFile("gossip.proto", fileDescriptor_878fa4887b90140c)
+}
 
 var fileDescriptor_878fa4887b90140c = []byte{
-	// 556 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x54, 0xd1, 0x6e, 0xd3, 0x3c,
-	0x14, 0xfe, 0x9d, 0x26, 0x9d, 0x7a, 0x92, 0x4e, 0xfb, 0xad, 0x5d, 0x44, 0x15, 0xd2, 0x4a, 0x24,
-	0x20, 0x37, 0x54, 0x53, 0x27, 0x10, 0x42, 0x42, 0x02, 0x41, 0x05, 0x17, 0x74, 0x9a, 0x3c, 0x5e,
-	0xc0, 0xa4, 0x87, 0x60, 0x6d, 0xb5, 0x23, 0xdb, 0x65, 0xdb, 0x93, 0x70, 0xcb, 0xdb, 0xf0, 0x18,
-	0xbc, 0x0a, 0xb2, 0x93, 0xb4, 0xe9, 0x28, 0x4c, 0xbb, 0xea, 0xf9, 0x7c, 0xbe, 0x73, 0xce, 0xe7,
-	0x2f, 0xa7, 0x86, 0xa4, 0x54, 0xc6, 0x88, 0x6a, 0x52, 0x69, 0x65, 0x15, 0x8d, 0xfc, 0x4f, 0xf6,
-	0x8b, 0x40, 0x74, 0x6e, 0xb9, 0x45, 0x3a, 0x83, 0x21, 0x5e, 0x0b, 0x63, 0x85, 0x2c, 0x3f, 0x28,
-	0x63, 0x4d, 0x4a, 0xc6, 0xbd, 0x3c, 0x9e, 0x1e, 0xd5, 0xfc, 0x89, 0x27, 0x4d, 0x66, 0x5d, 0xc6,
-	0x4c, 0x5a, 0x7d, 0xc3, 0xb6, 0xab, 0xe8, 0x23, 0xd8, 0x53, 0x57, 0xf2, 0x54, 0x59, 0x4c, 0x83,
-	0x31, 0xc9, 0xe3, 0x69, 0xdc, 0x34, 0x70, 0x47, 0xac, 0xcd, 0xd1, 0xc7, 0xb0, 0x8f, 0xd7, 0x16,
-	0xb5, 0xe4, 0x97, 0xef, 0xbd, 0xac, 0xb4, 0x37, 0x26, 0x79, 0xc2, 0x6e, 0x9d, 0x8e, 0x5e, 0x03,
-	0xfd, 0x73, 0x26, 0x3d, 0x80, 0xde, 0x05, 0xde, 0xa4, 0x64, 0x4c, 0xf2, 0x01, 0x73, 0x21, 0x3d,
-	0x84, 0xe8, 0x1b, 0xbf, 0x5c, 0xd5, 0x43, 0x43, 0x56, 0x83, 0x97, 0xc1, 0x0b, 0x92, 0x3d, 0x83,
-	0xde, 0xdc, 0x94, 0x34, 0x85, 0xbd, 0x42, 0x49, 0x8b, 0xd2, 0xfa, 0xb2, 0x84, 0xb5, 0xd0, 0x95,
-	0xa2, 0xd6, 0x4a, 0xfb, 0xd2, 0x01, 0xab, 0x41, 0xf6, 0x0a, 0xe2, 0xb9, 0x29, 0x19, 0x9a, 0x4a,
-	0x49, 0x83, 0xf7, 0x2e, 0xff, 0x49, 0x60, 0xe8, 0x2d, 0x5b, 0x77, 0x78, 0x0e, 0x49, 0x81, 0xda,
-	0x8a, 0x2f, 0xa2, 0xe0, 0x16, 0x5b, 0x7b, 0x69, 0xe3, 0xce, 0xdb, 0x4d, 0x8a, 0x6d, 0xf1, 0xe8,
-	0x43, 0x88, 0xa4, 0x72, 0x05, 0x81, 0x2f, 0xd8, 0xb2, 0xb3, 0xce, 0xd0, 0x13, 0x88, 0x79, 0x51,
-	0xac, 0x0c, 0xb7, 0x42, 0x49, 0x93, 0xf6, 0x3c, 0xf1, 0xff, 0x86, 0xf8, 0x66, 0x9d, 0x61, 0x5d,
-	0xd6, 0x8e, 0x2f, 0x10, 0xee, 0xfa, 0x02, 0xd9, 0x11, 0xc4, 0x1d, 0x71, 0xce, 0x7a, 0xcd, 0xaf,
-	0x1a, 0x13, 0x5c, 0x98, 0xfd, 0x20, 0x00, 0x9b, 0x21, 0xde, 0x8f, 0x4a, 0x15, 0x5f, 0x3d, 0x25,
-	0x64, 0x35, 0x70, 0xfe, 0xf9, 0xe1, 0x58, 0xfb, 0x94, 0xb0, 0x16, 0x6e, 0x32, 0x8b, 0x66, 0x05,
-	0x5a, 0x48, 0x27, 0x30, 0x30, 0xa2, 0x94, 0xdc, 0xae, 0x34, 0x7a, 0x71, 0xf1, 0xf4, 0xa0, 0xdd,
-	0xc6, 0xf6, 0x9c, 0x6d, 0x28, 0xae, 0x93, 0x16, 0xb2, 0x3c, 0x5d, 0x2d, 0xd3, 0x68, 0x4c, 0xf2,
-	0x21, 0x6b, 0x61, 0x56, 0x41, 0xe8, 0xb7, 0x6e, 0xb7, 0xb6, 0x7d, 0x08, 0xc4, 0xa2, 0x91, 0x15,
-	0x88, 0x05, 0xa5, 0x10, 0x2e, 0xb9, 0xb9, 0xf0, 0x72, 0x86, 0xcc, 0xc7, 0xf7, 0xd5, 0x92, 0x3d,
-	0x81, 0xc1, 0xfa, 0x9c, 0x26, 0x40, 0x74, 0xe3, 0x18, 0xd1, 0x0e, 0x99, 0x66, 0x1a, 0x31, 0xd9,
-	0x31, 0x84, 0xef, 0xb8, 0xe5, 0xff, 0x58, 0xb0, 0x5b, 0xf2, 0xb2, 0x07, 0x10, 0x9e, 0x09, 0x59,
-	0xba, 0xcb, 0x48, 0x25, 0x0b, 0x6c, 0xf8, 0x35, 0xc8, 0x3e, 0x42, 0x78, 0xa6, 0xfe, 0x96, 0xdd,
-	0xbe, 0x46, 0x70, 0xf7, 0x35, 0x46, 0x10, 0x7e, 0x42, 0x63, 0x9d, 0x25, 0x72, 0xb5, 0xac, 0x97,
-	0x36, 0x62, 0x3e, 0x9e, 0x7e, 0x27, 0xd0, 0xaf, 0x9f, 0x14, 0x3a, 0x81, 0xfe, 0x79, 0xa5, 0x91,
-	0x2f, 0x68, 0xd2, 0x7d, 0x2e, 0x46, 0x87, 0x5d, 0xd4, 0xfe, 0x13, 0xb2, 0xff, 0xe8, 0x53, 0x18,
-	0xcc, 0xd1, 0x18, 0x94, 0x25, 0x6a, 0x0a, 0x0d, 0x69, 0x6e, 0xca, 0x11, 0xdd, 0xc4, 0x1d, 0xba,
-	0x6b, 0x6f, 0x35, 0xf2, 0xe5, 0xdd, 0xdc, 0x9c, 0x1c, 0x93, 0xcf, 0x7d, 0x9f, 0x38, 0xf9, 0x1d,
-	0x00, 0x00, 0xff, 0xff, 0xac, 0x7d, 0x8f, 0x9f, 0xf2, 0x04, 0x00, 0x00,
+	// 945 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x56, 0xdd, 0x6e, 0xdb, 0x36,
+	0x14, 0x2e, 0x2d, 0x39, 0x8e, 0x8e, 0x64, 0xcf, 0x23, 0x8a, 0x41, 0x33, 0x86, 0x55, 0x13, 0xd6,
+	0xc2, 0x28, 0x36, 0xa3, 0x73, 0xd0, 0xfd, 0x5d, 0xcd, 0x4b, 0x8c, 0x6d, 0x58, 0x13, 0x14, 0xcc,
+	0xee, 0x76, 0x33, 0x5a, 0x62, 0x64, 0x21, 0xb6, 0x28, 0x90, 0x74, 0x9b, 0xdc, 0xee, 0x76, 0x0f,
+	0xd0, 0xdb, 0x3d, 0xd0, 0x2e, 0xf6, 0x26, 0x7b, 0x85, 0x81, 0x14, 0x65, 0xc9, 0x76, 0x8a, 0x20,
+	0x57, 0x3e, 0xdf, 0x39, 0x87, 0xe2, 0x77, 0x7e, 0xf8, 0xc1, 0x10, 0x64, 0x5c, 0xca, 0xbc, 0x9c,
+	0x94, 0x82, 0x2b, 0x8e, 0xbb, 0xe6, 0x27, 0xfe, 0xab, 0x03, 0xdd, 0x4b, 0x45, 0x15, 0xc3, 0x73,
+	0xe8, 0xb3, 0x9b, 0x5c, 0xaa, 0xbc, 0xc8, 0x7e, 0xe6, 0x52, 0xc9, 0x10, 0x45, 0xce, 0xd8, 0x9f,
+	0x3e, 0xa9, 0xf2, 0x27, 0x26, 0x69, 0x32, 0x6f, 0x67, 0xcc, 0x0b, 0x25, 0x6e, 0xc9, 0xee, 0x29,
+	0xfc, 0x14, 0x7a, 0xfc, 0x6d, 0x71, 0xc1, 0x15, 0x0b, 0x3b, 0x11, 0x1a, 0xfb, 0x53, 0xdf, 0x7e,
+	0x40, 0xbb, 0x48, 0x1d, 0xc3, 0xcf, 0x60, 0xc0, 0x6e, 0x14, 0x13, 0x05, 0x5d, 0xfd, 0x64, 0x68,
+	0x85, 0x4e, 0x84, 0xc6, 0x01, 0xd9, 0xf3, 0xe2, 0xe7, 0x30, 0x14, 0xec, 0x0d, 0x4f, 0xa8, 0xca,
+	0x79, 0x71, 0xb1, 0x59, 0x2f, 0x98, 0x08, 0xdd, 0x08, 0x8d, 0x5d, 0x72, 0xe0, 0x1f, 0xfd, 0x00,
+	0xf8, 0x90, 0x1f, 0x1e, 0x82, 0x73, 0xcd, 0x6e, 0x43, 0x14, 0xa1, 0xb1, 0x47, 0xb4, 0x89, 0x1f,
+	0x43, 0xf7, 0x0d, 0x5d, 0x6d, 0x2a, 0x82, 0x2e, 0xa9, 0xc0, 0xf7, 0x9d, 0x6f, 0x51, 0xfc, 0x27,
+	0x02, 0xe7, 0x5c, 0x66, 0x38, 0x84, 0x5e, 0xc2, 0x0b, 0xc5, 0x0a, 0x65, 0xce, 0x05, 0xa4, 0x86,
+	0xfa, 0x2c, 0x13, 0x82, 0x0b, 0x73, 0xd6, 0x23, 0x15, 0xc0, 0x9f, 0x83, 0xbb, 0x58, 0xf1, 0x85,
+	0xa9, 0xc1, 0x9f, 0x0e, 0x6d, 0xc5, 0x3f, 0xae, 0xf8, 0xe2, 0x74, 0xb9, 0x29, 0xae, 0x89, 0x89,
+	0xe2, 0xa7, 0xd0, 0x15, 0x6c, 0x45, 0x6f, 0x4d, 0x01, 0xfe, 0xf4, 0x03, 0x9b, 0x46, 0xb4, 0xef,
+	0x5c, 0x66, 0xa4, 0x8a, 0xc6, 0xef, 0x10, 0xf8, 0x1a, 0x32, 0x59, 0xf2, 0x42, 0xb2, 0x07, 0x93,
+	0x19, 0x43, 0x4f, 0x5f, 0x37, 0x4b, 0xae, 0x2d, 0x9f, 0x41, 0x8b, 0xcf, 0x2c, 0xb9, 0x26, 0x75,
+	0x18, 0x4f, 0xc0, 0x93, 0x79, 0x56, 0x50, 0xb5, 0x11, 0x2c, 0x74, 0x77, 0xb8, 0x5f, 0xd6, 0x7e,
+	0xd2, 0xa4, 0xc4, 0xff, 0x22, 0x38, 0xae, 0xd9, 0xe2, 0x8f, 0xe0, 0x48, 0xf2, 0x8d, 0x48, 0x98,
+	0x65, 0x65, 0x11, 0x8e, 0xc0, 0x4f, 0x99, 0x1e, 0x82, 0x19, 0x8d, 0xa1, 0x16, 0x90, 0xb6, 0xab,
+	0x5d, 0x90, 0x73, 0x50, 0x50, 0xc1, 0x8b, 0xa4, 0x22, 0x13, 0x90, 0x0a, 0xec, 0xd2, 0xec, 0xde,
+	0x4b, 0x13, 0x63, 0x70, 0x97, 0xbc, 0x94, 0xe1, 0x51, 0x84, 0xc6, 0x7d, 0x62, 0x6c, 0xcd, 0x96,
+	0xdd, 0x94, 0xb9, 0xb8, 0x0d, 0x7b, 0x11, 0x1a, 0x3b, 0xc4, 0x22, 0xdd, 0x6c, 0x6f, 0x3b, 0x27,
+	0xfc, 0x29, 0x80, 0x12, 0xb4, 0x90, 0x57, 0x4c, 0xfc, 0x92, 0xda, 0xba, 0x5a, 0x1e, 0xfd, 0x15,
+	0x7e, 0x75, 0x25, 0x99, 0xb2, 0xab, 0x63, 0x91, 0xbe, 0x31, 0xa5, 0x8a, 0xda, 0x72, 0x8c, 0x6d,
+	0x58, 0x50, 0xb9, 0xb4, 0xa5, 0x18, 0x5b, 0xfb, 0x56, 0x54, 0x2a, 0x53, 0xc4, 0x31, 0x31, 0xb6,
+	0xfe, 0x66, 0x9a, 0x67, 0x4c, 0x2a, 0xc3, 0x37, 0x20, 0x16, 0xc5, 0xbf, 0x42, 0xcf, 0x0e, 0xac,
+	0x75, 0x2d, 0x3a, 0xb8, 0x96, 0x17, 0xd5, 0x1e, 0x1f, 0x13, 0x63, 0x37, 0x3b, 0xe1, 0xb4, 0x76,
+	0x22, 0xfe, 0x0f, 0x41, 0xdf, 0xbc, 0xe0, 0xed, 0x56, 0x7d, 0x0d, 0x41, 0xc2, 0x84, 0xca, 0xaf,
+	0xf2, 0x84, 0x2a, 0x56, 0xbf, 0x76, 0x6c, 0xfb, 0x7a, 0xda, 0x84, 0xc8, 0x4e, 0x1e, 0xfe, 0x4c,
+	0x8f, 0x48, 0x1f, 0xe8, 0x44, 0xce, 0xfe, 0xeb, 0xae, 0x22, 0xf8, 0x04, 0x7c, 0x9a, 0x24, 0x1b,
+	0x69, 0xa6, 0x2d, 0x43, 0xc7, 0x24, 0x7e, 0x68, 0x13, 0x67, 0xdb, 0x08, 0x69, 0x67, 0xdd, 0x21,
+	0x08, 0xee, 0x9d, 0x82, 0xf0, 0x0c, 0x06, 0xcd, 0xc3, 0x7f, 0x95, 0xdb, 0x66, 0x06, 0x64, 0xcf,
+	0x1b, 0x3f, 0x01, 0xbf, 0x55, 0x84, 0x56, 0x01, 0x41, 0xdf, 0xda, 0x91, 0x6a, 0x33, 0xfe, 0x1b,
+	0x01, 0x34, 0x64, 0x4c, 0xdf, 0x4a, 0x9e, 0x2c, 0x6d, 0x8b, 0x2b, 0xa0, 0x57, 0xd5, 0x90, 0x64,
+	0xc2, 0x2e, 0x72, 0x0d, 0x9b, 0x48, 0x5a, 0x2f, 0xb1, 0x85, 0x0f, 0x7d, 0x55, 0xfa, 0x4b, 0x22,
+	0x2f, 0xb2, 0x8b, 0xcd, 0xda, 0x94, 0xd2, 0x27, 0x35, 0x8c, 0xff, 0x41, 0xe0, 0x1a, 0xb5, 0xbc,
+	0x9b, 0xdc, 0x00, 0x3a, 0x79, 0x6a, 0x79, 0x75, 0xf2, 0x54, 0xaf, 0xc3, 0x9a, 0xca, 0xea, 0xd5,
+	0xf7, 0x89, 0xb1, 0x1f, 0x4c, 0xe6, 0x05, 0x00, 0x55, 0x4a, 0xe4, 0x8b, 0x8d, 0x9e, 0x71, 0x37,
+	0x72, 0x5a, 0x07, 0x66, 0x75, 0x80, 0xb4, 0x72, 0xb4, 0xdc, 0xd0, 0x34, 0x15, 0x4c, 0x56, 0x0f,
+	0xae, 0x91, 0x9b, 0x59, 0xe5, 0x25, 0x75, 0x38, 0xfe, 0x1d, 0x7a, 0xd6, 0x67, 0x6a, 0x2e, 0x13,
+	0x8d, 0xac, 0x30, 0xd7, 0x10, 0x8f, 0xe0, 0xb8, 0xcc, 0x8b, 0xcc, 0x84, 0x2a, 0x59, 0xdb, 0x62,
+	0x1d, 0x5b, 0x2a, 0x55, 0x9a, 0x58, 0xb5, 0xde, 0x5b, 0x1c, 0x9f, 0x80, 0xb7, 0xe5, 0x77, 0x9f,
+	0xe6, 0x7b, 0x56, 0xf3, 0xe3, 0x3f, 0xc0, 0xdb, 0x76, 0x01, 0x07, 0x80, 0x84, 0x5d, 0x10, 0x24,
+	0x34, 0x92, 0xb6, 0xb7, 0x48, 0xe2, 0x6f, 0xc0, 0xa3, 0xab, 0x8c, 0x8b, 0x5c, 0x2d, 0xd7, 0xe6,
+	0xea, 0xc1, 0xf4, 0xe3, 0xfd, 0x36, 0xce, 0xea, 0x04, 0xd2, 0xe4, 0xc6, 0x2f, 0xc0, 0x3d, 0xd3,
+	0x6a, 0xf0, 0x7e, 0x11, 0xdf, 0x9b, 0x62, 0xfc, 0x09, 0xb8, 0xaf, 0xf3, 0x22, 0x6b, 0xb4, 0x10,
+	0xb5, 0xb4, 0x30, 0x7e, 0x05, 0xee, 0x6b, 0xfe, 0xbe, 0xe8, 0xee, 0xb4, 0x3b, 0xf7, 0x0b, 0xfa,
+	0x08, 0xdc, 0xdf, 0x98, 0x34, 0x42, 0x52, 0x6c, 0xd6, 0x95, 0x08, 0x74, 0x89, 0xb1, 0x9f, 0x7f,
+	0x01, 0xf8, 0xb0, 0x34, 0xec, 0x41, 0x77, 0x7e, 0x7a, 0x76, 0x39, 0x1b, 0x3e, 0xc2, 0x3e, 0xf4,
+	0xe6, 0x67, 0xd3, 0x97, 0x2f, 0xbf, 0xfa, 0x6e, 0x88, 0xa6, 0xef, 0x10, 0x1c, 0x55, 0xff, 0x2f,
+	0xf0, 0x04, 0x8e, 0x2e, 0x4b, 0xc1, 0x68, 0x8a, 0x83, 0xf6, 0x7f, 0x87, 0xd1, 0xe3, 0x36, 0xaa,
+	0x75, 0x28, 0x7e, 0x84, 0xbf, 0x04, 0xef, 0x9c, 0x49, 0xc9, 0x8a, 0x8c, 0x09, 0x0c, 0x36, 0xe9,
+	0x5c, 0x66, 0x23, 0xdc, 0xd8, 0xad, 0x74, 0xfd, 0x79, 0x25, 0x18, 0x5d, 0xdf, 0x9f, 0x3b, 0x46,
+	0x2f, 0xd0, 0xe2, 0xc8, 0x04, 0x4e, 0xfe, 0x1f, 0x00, 0xb4, 0xde, 0x76, 0xad, 0xff, 0x08, 0x00,
+	0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
 var _ context.Context
-var _ grpc.ClientConn
+var _ grpc.ClientConnInterface
 
 // This is a compile-time assertion to ensure that this generated file
 // is compatible with the grpc package it is being compiled against.
-const _ = grpc.SupportPackageIsVersion4
+const _ = grpc.SupportPackageIsVersion6
 
 // GossipClient is the client API for Gossip service.
 //
@@ -709,10 +1179,10 @@ type GossipClient interface {
 }
 
 type gossipClient struct {
-	cc *grpc.ClientConn
+	cc grpc.ClientConnInterface
 }
 
-func NewGossipClient(cc *grpc.ClientConn) GossipClient {
+func NewGossipClient(cc grpc.ClientConnInterface) GossipClient {
 	return &gossipClient{cc}
 }
 
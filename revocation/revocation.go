@@ -0,0 +1,135 @@
+package revocation
+
+import (
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"sync"
+)
+
+var (
+	errNoCaCert      = errors.New("No CA certificate to verify revocation list against")
+	errNoNumber      = errors.New("Revocation list has no number")
+	errRevokedCert   = errors.New("Peer certificate has been revoked")
+	errOldRevocation = errors.New("Already had the same or a more recent revocation list")
+)
+
+// List holds the most recent revocation list signed by the CA,
+// and answers whether certificates have been revoked.
+// Safe for concurrent use.
+type List struct {
+	caCert *x509.Certificate
+
+	raw     []byte
+	number  *big.Int
+	serials map[string]bool
+	mutex   sync.RWMutex
+}
+
+// Creates an empty revocation list, only lists signed by the given CA certificate are accepted.
+func NewList(caCert *x509.Certificate) *List {
+	return &List{
+		caCert:  caCert,
+		serials: make(map[string]bool),
+	}
+}
+
+// Replaces the current list with the given DER encoded revocation list if it is
+// correctly signed by the CA and more recent than the current one.
+// Returns true if the list was replaced.
+func (l *List) Update(raw []byte) (bool, error) {
+	if l.caCert == nil {
+		return false, errNoCaCert
+	}
+
+	rl, err := x509.ParseRevocationList(raw)
+	if err != nil {
+		return false, err
+	}
+
+	if rl.Number == nil {
+		return false, errNoNumber
+	}
+
+	// Group certificates issued before revocation support lack the CRL signing
+	// key usage, so the signature is checked directly instead of through CheckSignatureFrom.
+	err = l.caCert.CheckSignature(rl.SignatureAlgorithm, rl.RawTBSRevocationList, rl.Signature)
+	if err != nil {
+		return false, err
+	}
+
+	serials := make(map[string]bool)
+	for _, e := range rl.RevokedCertificateEntries {
+		serials[e.SerialNumber.String()] = true
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.number != nil && l.number.Cmp(rl.Number) >= 0 {
+		return false, errOldRevocation
+	}
+
+	l.raw = raw
+	l.number = rl.Number
+	l.serials = serials
+
+	return true, nil
+}
+
+// Returns the DER encoded revocation list, nil if none has been received.
+func (l *List) Raw() []byte {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	return l.raw
+}
+
+// Returns the number of the current revocation list, zero if none has been received.
+func (l *List) Number() uint64 {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	if l.number == nil {
+		return 0
+	}
+
+	return l.number.Uint64()
+}
+
+// Returns true if a certificate with the given serial number has been revoked.
+func (l *List) Revoked(serial *big.Int) bool {
+	if serial == nil {
+		return false
+	}
+
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	return l.serials[serial.String()]
+}
+
+// Returns true if the given certificate has been revoked.
+func (l *List) IsRevoked(cert *x509.Certificate) bool {
+	return l.Revoked(cert.SerialNumber)
+}
+
+// Can be used as tls.Config.VerifyPeerCertificate,
+// rejects connections from peers presenting a revoked certificate.
+// Whether a certificate has to be presented at all is left to the tls configuration.
+func (l *List) VerifyPeerCertificate(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return nil
+	}
+
+	cert, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return err
+	}
+
+	if l.IsRevoked(cert) {
+		return errRevokedCert
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package revocation
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type RevocationTestSuite struct {
+	suite.Suite
+
+	caPriv *ecdsa.PrivateKey
+	caCert *x509.Certificate
+}
+
+func TestRevocationTestSuite(t *testing.T) {
+	suite.Run(t, new(RevocationTestSuite))
+}
+
+func (suite *RevocationTestSuite) SetupTest() {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(suite.T(), err, "Failed to generate keys.")
+
+	suite.caPriv = priv
+	suite.caCert = genCert(suite.T(), priv, big.NewInt(1))
+}
+
+func (suite *RevocationTestSuite) TestUpdate() {
+	l := NewList(suite.caCert)
+
+	require.Zero(suite.T(), l.Number(), "Empty list had a number.")
+	require.Nil(suite.T(), l.Raw(), "Empty list had content.")
+
+	raw := genList(suite.T(), suite.caPriv, suite.caCert, 2, big.NewInt(10))
+
+	updated, err := l.Update(raw)
+	require.NoError(suite.T(), err, "Valid list rejected.")
+	require.True(suite.T(), updated, "Valid list not applied.")
+	require.Equal(suite.T(), uint64(2), l.Number(), "Wrong list number.")
+	require.Equal(suite.T(), raw, l.Raw(), "Wrong list content.")
+	require.True(suite.T(), l.Revoked(big.NewInt(10)), "Serial not revoked.")
+	require.False(suite.T(), l.Revoked(big.NewInt(11)), "Serial wrongly revoked.")
+	require.False(suite.T(), l.Revoked(nil), "Nil serial revoked.")
+
+	updated, err = l.Update(genList(suite.T(), suite.caPriv, suite.caCert, 2, big.NewInt(11)))
+	require.EqualError(suite.T(), err, errOldRevocation.Error(), "Same number accepted.")
+	require.False(suite.T(), updated, "Same number applied.")
+
+	updated, err = l.Update(genList(suite.T(), suite.caPriv, suite.caCert, 1, big.NewInt(11)))
+	require.EqualError(suite.T(), err, errOldRevocation.Error(), "Older list accepted.")
+	require.False(suite.T(), updated, "Older list applied.")
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(suite.T(), err, "Failed to generate keys.")
+
+	updated, err = l.Update(genList(suite.T(), other, suite.caCert, 3, big.NewInt(11)))
+	require.Error(suite.T(), err, "Forged list accepted.")
+	require.False(suite.T(), updated, "Forged list applied.")
+	require.False(suite.T(), l.Revoked(big.NewInt(11)), "Serial revoked by forged list.")
+
+	_, err = l.Update([]byte("garbage"))
+	require.Error(suite.T(), err, "Malformed list accepted.")
+
+	_, err = NewList(nil).Update(raw)
+	require.EqualError(suite.T(), err, errNoCaCert.Error(), "List accepted without CA certificate.")
+}
+
+func (suite *RevocationTestSuite) TestVerifyPeerCertificate() {
+	l := NewList(suite.caCert)
+
+	revoked := genCert(suite.T(), suite.caPriv, big.NewInt(20))
+	valid := genCert(suite.T(), suite.caPriv, big.NewInt(21))
+
+	_, err := l.Update(genList(suite.T(), suite.caPriv, suite.caCert, 1, revoked.SerialNumber))
+	require.NoError(suite.T(), err, "Valid list rejected.")
+
+	require.True(suite.T(), l.IsRevoked(revoked), "Certificate not revoked.")
+	require.False(suite.T(), l.IsRevoked(valid), "Certificate wrongly revoked.")
+
+	require.EqualError(suite.T(), l.VerifyPeerCertificate([][]byte{revoked.Raw}, nil),
+		errRevokedCert.Error(), "Revoked certificate accepted.")
+	require.NoError(suite.T(), l.VerifyPeerCertificate([][]byte{valid.Raw}, nil),
+		"Valid certificate refused.")
+	require.NoError(suite.T(), l.VerifyPeerCertificate(nil, nil),
+		"Missing certificate refused.")
+}
+
+func genCert(t *testing.T, priv *ecdsa.PrivateKey, serial *big.Int) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"ifrit"}},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+
+	raw, err := x509.CreateCertificate(rand.Reader, template, template, priv.Public(), priv)
+	require.NoError(t, err, "Failed to create certificate.")
+
+	cert, err := x509.ParseCertificate(raw)
+	require.NoError(t, err, "Failed to parse certificate.")
+
+	return cert
+}
+
+func genList(t *testing.T, priv *ecdsa.PrivateKey, caCert *x509.Certificate, number int64, serials ...*big.Int) []byte {
+	var entries []x509.RevocationListEntry
+
+	for _, s := range serials {
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   s,
+			RevocationTime: time.Now(),
+		})
+	}
+
+	template := &x509.RevocationList{
+		RevokedCertificateEntries: entries,
+		Number:                    big.NewInt(number),
+		ThisUpdate:                time.Now(),
+		NextUpdate:                time.Now().Add(time.Hour),
+	}
+
+	// Mirrors the CA, whose group certificate may lack the CRL signing key usage.
+	issuer := *caCert
+	issuer.KeyUsage |= x509.KeyUsageCRLSign
+
+	raw, err := x509.CreateRevocationList(rand.Reader, template, &issuer, priv)
+	require.NoError(t, err, "Failed to create revocation list.")
+
+	return raw
+}
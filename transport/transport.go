@@ -0,0 +1,62 @@
+package transport
+
+import (
+	"crypto"
+	"crypto/x509"
+	"time"
+
+	pb "github.com/joonnna/ifrit/protobuf"
+	"golang.org/x/net/context"
+)
+
+// Comm carries gossip, messages and streams between members.
+// The default implementation is the grpc transport in the comm package.
+//
+// Incoming calls are handed to the gossip server passed to Register.
+// Their context has to carry a grpc peer whose AuthInfo is a credentials.TLSInfo
+// holding the certificate of the remote member, the way grpc does after a tls handshake,
+// members are identified by their certificate and not by their address.
+type Comm interface {
+	Register(pb.GossipServer)
+	CloseConn(string)
+	Addr() string
+	Start()
+	Stop()
+
+	// All calls take the address and the expected id of the remote member,
+	// calls have to fail if the remote certificate does not carry the id, unless the id is empty.
+	Gossip(string, string, *pb.State) (*pb.StateResponse, error)
+	Rebuttal(string, string, *pb.State) (*pb.StateResponse, error)
+	Send(string, string, *pb.Msg) (*pb.MsgResponse, error)
+	StreamMessenger(string, string, chan []byte, chan []byte) error
+	DialStream(context.Context, string, string) (pb.Gossip_StreamClient, error)
+}
+
+// Ping carries the pings of the failure detector.
+// The default implementation is the udp server in the comm package.
+// Pongs have to be signed by the pinged member.
+type Ping interface {
+	Pause(time.Duration)
+	Ping(string, *pb.Ping) (*pb.Pong, error)
+	Start()
+	Stop()
+}
+
+// Identity holds the certificate and private key of a member.
+// The default implementation is the crypto unit in the comm package,
+// which obtains its certificate from the ifrit CA.
+// Keys are either ecdsa or ed25519 keys, signatures are split into r and s
+// as done by the keys package.
+type Identity interface {
+	Certificate() *x509.Certificate
+	CaCertificate() *x509.Certificate
+	Priv() crypto.Signer
+	ContactList() []*x509.Certificate
+	NumRings() uint32
+	Trusted() bool
+	SavePrivateKey(string) error
+	SaveCertificate(string) error
+
+	Sign([]byte) ([]byte, []byte, error)
+	Verify([]byte, []byte, []byte, crypto.PublicKey) bool
+}